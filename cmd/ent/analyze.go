@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	builtin8 "github.com/filecoin-project/specs-actors/v8/actors/builtin"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+var analyzeCmd = &cli.Command{
+	Name:        "analyze",
+	Description: "analyze state layout affecting migration and cron cost",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "partitions",
+			Description: "find partitions with many terminated sectors and report how far compaction would reduce partition counts",
+			ArgsUsage:   "<state-root>",
+			Action:      runAnalyzePartitionsCmd,
+			Flags: []cli.Flag{
+				&cli.Float64Flag{
+					Name:  "min-dead-ratio",
+					Usage: "report partitions with at least this fraction of terminated sectors",
+					Value: 0.5,
+				},
+				&cli.IntFlag{
+					Name:  "top",
+					Usage: "list this many partitions with the most terminated sectors",
+					Value: 20,
+				},
+			},
+		},
+	},
+}
+
+// partitionStats are the sector counts of a partition.
+type partitionStats struct {
+	Miner      address.Address
+	Deadline   uint64
+	Partition  int64
+	Sectors    uint64
+	Terminated uint64
+	Faulty     uint64
+}
+
+func (p *partitionStats) deadRatio() float64 {
+	if p.Sectors == 0 {
+		return 0
+	}
+	return float64(p.Terminated) / float64(p.Sectors)
+}
+
+var errStopSectors = errors.New("stop")
+
+// minerPartitionSize returns the window post partition size of a miner from the
+// seal proof of its first sector, false if it has no sectors.
+func minerPartitionSize(c *cli.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid) (uint64, bool, error) {
+	var proof abi.RegisteredSealProof
+	found := false
+	err := lib.ForEachMinerSector(c.Context, store, actorsVersion, head, func(s *lib.MinerSector) error {
+		proof, found = s.SealProof, true
+		return errStopSectors
+	})
+	if err != nil && !errors.Is(err, errStopSectors) {
+		return 0, false, err
+	}
+	if !found {
+		return 0, false, nil
+	}
+	size, err := builtin8.SealProofWindowPoStPartitionSectors(proof)
+	return size, err == nil, err
+}
+
+func runAnalyzePartitionsCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	labels, err := stateLabels(c, store, root)
+	if err != nil {
+		return err
+	}
+	minRatio := c.Float64("min-dead-ratio")
+
+	var candidates []partitionStats
+	var partitions, compacted, sectors, terminated, candidateTerminated uint64
+	var miners, candidateMiners int
+	err = r.ForEachMiner(func(addr address.Address, a *lib.Actor) error {
+		partSize, ok, err := minerPartitionSize(c, store, r.ActorsVersion(), a.Head)
+		if err != nil {
+			return xerrors.Errorf("failed to read sectors of miner %s: %w", addr, err)
+		}
+		miners++
+		// Compaction packs the live sectors of a deadline into as few partitions
+		// as the partition size allows
+		var live [miner8.WPoStPeriodDeadlines]uint64
+		var current [miner8.WPoStPeriodDeadlines]uint64
+		hasCandidate := false
+		err = r.ForEachMinerPartition(a, func(dlIdx uint64, partIdx int64, p *miner8.Partition) error {
+			ps := partitionStats{Miner: addr, Deadline: dlIdx, Partition: partIdx}
+			var err error
+			if ps.Sectors, err = p.Sectors.Count(); err != nil {
+				return err
+			}
+			if ps.Terminated, err = p.Terminated.Count(); err != nil {
+				return err
+			}
+			if ps.Faulty, err = p.Faults.Count(); err != nil {
+				return err
+			}
+			current[dlIdx]++
+			live[dlIdx] += ps.Sectors - ps.Terminated
+			sectors += ps.Sectors
+			terminated += ps.Terminated
+			if ps.Sectors > 0 && ps.deadRatio() >= minRatio {
+				candidates = append(candidates, ps)
+				candidateTerminated += ps.Terminated
+				hasCandidate = true
+			}
+			return nil
+		})
+		if err != nil {
+			return xerrors.Errorf("failed to read partitions of miner %s: %w", addr, err)
+		}
+		if hasCandidate {
+			candidateMiners++
+		}
+		for dlIdx := range current {
+			partitions += current[dlIdx]
+			if !ok {
+				compacted += current[dlIdx]
+				continue
+			}
+			compacted += (live[dlIdx] + partSize - 1) / partSize
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("State %s (actors v%d)\n", root, r.ActorsVersion())
+	fmt.Printf("Miners: %d\n", miners)
+	fmt.Printf("Partitions: %d holding %d sectors, %d terminated\n", partitions, sectors, terminated)
+	fmt.Printf("Partitions with dead ratio >= %.2f: %d in %d miners, holding %d terminated sectors\n", minRatio, len(candidates), candidateMiners, candidateTerminated)
+	if partitions > 0 {
+		fmt.Printf("Partitions after compacting every deadline: %d (%.1f%% fewer)\n", compacted, 100*float64(partitions-compacted)/float64(partitions))
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Terminated > candidates[j].Terminated })
+	top := c.Int("top")
+	if top > len(candidates) {
+		top = len(candidates)
+	}
+	if top > 0 {
+		fmt.Printf("\n%-12s %-8s %-9s %-8s %-10s %-7s %s\n", "miner", "deadline", "partition", "sectors", "terminated", "faulty", "dead")
+		for _, p := range candidates[:top] {
+			fmt.Printf("%-12s %-8d %-9d %-8d %-10d %-7d %.2f\n", labels.Format(p.Miner), p.Deadline, p.Partition, p.Sectors, p.Terminated, p.Faulty, p.deadRatio())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func validateBatchCmd() *cli.Command {
+	flags := []cli.Flag{
+		&cli.StringFlag{Name: "roots-file", Usage: "file of roots to validate, one epoch,cid per line", Required: true},
+		&cli.IntFlag{Name: "parallel", Value: 1, Usage: "validate this many roots at once"},
+		&cli.StringFlag{Name: "report", Usage: "save a consolidated json report of every root to this file"},
+		manifestFlag(),
+		tolerancesFlag(),
+		checkPluginFlag(),
+	}
+	flags = append(flags, expectedBalanceFlags()...)
+	return &cli.Command{
+		Name:   "batch",
+		Usage:  "validate many state roots of any actors version and report them together",
+		Action: runValidateBatchCmd,
+		Flags:  append(flags, notifyFlags()...),
+	}
+}
+
+// batchRoot is a state root of a validation batch.
+type batchRoot struct {
+	Epoch abi.ChainEpoch
+	Root  cid.Cid
+}
+
+// batchRootReport is the outcome of validating one root of a batch.  Error is set
+// when the root could not be validated at all.
+type batchRootReport struct {
+	Epoch         abi.ChainEpoch `json:"epoch"`
+	StateRoot     string         `json:"stateRoot"`
+	ActorsVersion int            `json:"actorsVersion"`
+	Duration      time.Duration  `json:"duration"`
+	Violations    []string       `json:"violations,omitempty"`
+	Known         int            `json:"known"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// readRootsFile reads epoch,cid lines.  Blank lines and lines starting with # are
+// skipped.
+func readRootsFile(path string) ([]batchRoot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+	var roots []batchRoot
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) != 2 {
+			return nil, xerrors.Errorf("%s:%d: expected epoch,cid", path, line)
+		}
+		epoch, err := strconv.ParseInt(strings.TrimSpace(fields[0]), 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("%s:%d: invalid epoch: %w", path, line, err)
+		}
+		root, err := cid.Decode(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return nil, xerrors.Errorf("%s:%d: invalid cid: %w", path, line, err)
+		}
+		roots = append(roots, batchRoot{Epoch: abi.ChainEpoch(epoch), Root: root})
+	}
+	return roots, scanner.Err()
+}
+
+func runValidateBatchCmd(c *cli.Context) error {
+	if c.IsSet("manifest") && !c.IsSet("report") {
+		return xerrors.Errorf("--manifest needs --report")
+	}
+	roots, err := readRootsFile(c.String("roots-file"))
+	if err != nil {
+		return err
+	}
+	parallel := c.Int("parallel")
+	if parallel < 1 {
+		return xerrors.Errorf("--parallel must be at least 1")
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	notifier := lib.NewNotifier(c.String("notify-url"), c.Bool("notify-slack"))
+
+	// A root failing to validate is recorded and the batch goes on
+	reports := make([]batchRootReport, len(roots))
+	validate := func(r batchRoot, rep *batchRootReport) error {
+		rep.Epoch, rep.StateRoot = r.Epoch, r.Root.String()
+		info, err := lib.InspectRoot(c.Context, store, r.Root)
+		if err != nil {
+			return err
+		}
+		rep.ActorsVersion = info.ActorsVersion
+		spec, ok := lookupMigration(ActorsVersion(info.ActorsVersion))
+		if !ok {
+			return xerrors.Errorf("no invariant checks for actors v%d", info.ActorsVersion)
+		}
+		opts, err := loadValidateOpts(c, r.Epoch)
+		if err != nil {
+			return err
+		}
+		var outcome validationOutcome
+		opts.ReportPath, opts.Provenance, opts.Outcome, opts.Quiet = "", nil, &outcome, true
+		if err := spec.Validate(c.Context, store, r.Epoch, r.Root, opts); err != nil {
+			return err
+		}
+		rep.Duration, rep.Violations, rep.Known = outcome.Duration, outcome.Violations, outcome.Known
+		return nil
+	}
+
+	var lk sync.Mutex
+	done := 0
+	grp, ctx := errgroup.WithContext(c.Context)
+	c.Context = ctx
+	sem := make(chan struct{}, parallel)
+	for i, r := range roots {
+		i, r := i, r
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+		grp.Go(func() error {
+			defer func() { <-sem }()
+			rep := &reports[i]
+			if err := validate(r, rep); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				rep.Error = err.Error()
+			}
+			lk.Lock()
+			defer lk.Unlock()
+			done++
+			status := fmt.Sprintf("%d violations, %d known findings", len(rep.Violations), rep.Known)
+			if rep.Error != "" {
+				status = "error: " + rep.Error
+			}
+			fmt.Printf("[%d/%d] epoch %d %s (actors v%d): %s\n", done, len(roots), r.Epoch, r.Root, rep.ActorsVersion, status)
+			return nil
+		})
+	}
+	if err := grp.Wait(); err != nil {
+		return err
+	}
+
+	if path := c.String("report"); path != "" {
+		if err := writeJSONFile(path, reports); err != nil {
+			return xerrors.Errorf("failed to write batch report: %w", err)
+		}
+		if prov := newProvenance(c, cid.Undef, -1); prov != nil {
+			for _, r := range roots {
+				prov.StateRoots = append(prov.StateRoots, r.Root)
+			}
+			prov.Rows = uint64(len(reports))
+			if err := prov.addFile(path); err != nil {
+				return err
+			}
+			if err := prov.write(); err != nil {
+				return xerrors.Errorf("failed to write manifest: %w", err)
+			}
+		}
+	}
+	var clean, failed, errored int
+	fmt.Printf("Batch validation of %d roots:\n", len(roots))
+	for _, rep := range reports {
+		switch {
+		case rep.Error != "":
+			errored++
+			fmt.Printf("  epoch %d %s: could not validate: %s\n", rep.Epoch, rep.StateRoot, rep.Error)
+		case len(rep.Violations) > 0:
+			failed++
+			fmt.Printf("  epoch %d %s: %d violations\n", rep.Epoch, rep.StateRoot, len(rep.Violations))
+			printMessages(rep.Violations, false)
+		default:
+			clean++
+		}
+	}
+	summary := fmt.Sprintf("%d clean, %d with violations, %d could not be validated", clean, failed, errored)
+	fmt.Printf("%s\n", summary)
+	recordCount("clean", clean)
+	recordCount("withViolations", failed)
+	recordCount("errored", errored)
+	notifier.Notify("done", summary, map[string]string{"rootsFile": c.String("roots-file")})
+	if errored > 0 {
+		return xerrors.Errorf("%d of %d roots failed validation", failed+errored, len(roots))
+	}
+	if failed > 0 {
+		return validationFailed("%d of %d roots failed validation", failed, len(roots))
+	}
+	return nil
+}
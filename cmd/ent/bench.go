@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+var benchCmd = &cli.Command{
+	Name:        "bench",
+	Description: "benchmark ent builds against each other and storage with recorded reads",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "compare",
+			Description: "run an ent command with two ent binaries in turn and compare time, peak memory and output state roots",
+			ArgsUsage:   "-- <ent args...>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "bin-a", Usage: "first ent binary, default the running one"},
+				&cli.StringFlag{Name: "bin-b", Usage: "second ent binary, default the running one"},
+				&cli.IntFlag{Name: "runs", Usage: "runs of each binary, alternating between them", Value: 1},
+			},
+			Action: runBenchCompareCmd,
+		},
+		{
+			Name:        "replay-trace",
+			Description: "replay the block reads of an access trace recorded with --record-trace against the chain stores or a datastore, to benchmark storage without migration CPU cost",
+			ArgsUsage:   "<trace-file>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "datastore", Usage: "read from this badger datastore directory instead of ent's chain stores"},
+				&cli.IntFlag{Name: "workers", Usage: "concurrent reads, taking reads in trace order", Value: 1},
+			},
+			Action: runBenchReplayTraceCmd,
+		},
+	},
+}
+
+// outputRootRe finds the output state root in lines like "<in> => <out> -- 1m2s"
+// printed by migrate commands.
+var outputRootRe = regexp.MustCompile(`=> (\S+)`)
+
+// benchRun is the result of running an ent binary once.
+type benchRun struct {
+	Duration time.Duration
+	// MaxRSS is the peak resident set size in bytes
+	MaxRSS int64
+	// Root is the last output state root printed, "" if none
+	Root string
+	Err  error
+}
+
+func runBench(bin string, args []string) benchRun {
+	var stdout bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	start := time.Now()
+	err := cmd.Run()
+	run := benchRun{Duration: time.Since(start), Err: err}
+	if cmd.ProcessState != nil {
+		if ru, ok := cmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
+			run.MaxRSS = int64(ru.Maxrss) << 10 // Maxrss is in KiB on linux
+		}
+	}
+	if err != nil {
+		_, _ = os.Stderr.Write(stdout.Bytes())
+	}
+	if m := outputRootRe.FindAllStringSubmatch(stdout.String(), -1); m != nil {
+		run.Root = m[len(m)-1][1]
+	}
+	return run
+}
+
+func runBenchCompareCmd(c *cli.Context) error {
+	args := c.Args().Slice()
+	if len(args) == 0 {
+		return xerrors.Errorf("not enough args, need ent command to run after --")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	bins := [2]string{c.String("bin-a"), c.String("bin-b")}
+	for i := range bins {
+		if bins[i] == "" {
+			bins[i] = self
+		}
+	}
+	runs := c.Int("runs")
+	if runs < 1 {
+		return xerrors.Errorf("--runs must be at least 1")
+	}
+
+	// Runs are sequential, the binaries share the chain stores and would contend
+	var results [2][]benchRun
+	for r := 0; r < runs; r++ {
+		for i, bin := range bins {
+			fmt.Printf("run %d/%d: %s\n", r+1, runs, bin)
+			run := runBench(bin, args)
+			if run.Err != nil {
+				return xerrors.Errorf("%s failed: %w", bin, run.Err)
+			}
+			fmt.Printf("  %v, max rss %d MiB, root %s\n", run.Duration, run.MaxRSS>>20, run.Root)
+			results[i] = append(results[i], run)
+		}
+	}
+
+	var means [2]time.Duration
+	var peaks [2]int64
+	for i, rs := range results {
+		for _, run := range rs {
+			means[i] += run.Duration / time.Duration(runs)
+			if run.MaxRSS > peaks[i] {
+				peaks[i] = run.MaxRSS
+			}
+		}
+	}
+	fmt.Printf("\n%-3s %-14s %-12s %s\n", "", "mean time", "max rss MiB", "binary")
+	for i, name := range []string{"a", "b"} {
+		fmt.Printf("%-3s %-14v %-12d %s\n", name, means[i].Round(time.Millisecond), peaks[i]>>20, bins[i])
+	}
+	if means[0] > 0 {
+		fmt.Printf("b/a time %.3f\n", float64(means[1])/float64(means[0]))
+	}
+	if peaks[0] > 0 {
+		fmt.Printf("b/a memory %.3f\n", float64(peaks[1])/float64(peaks[0]))
+	}
+
+	// Every run must agree on the output root
+	root := results[0][0].Root
+	for i, rs := range results {
+		for r, run := range rs {
+			if run.Root != root {
+				return xerrors.Errorf("output roots differ: %s run 1 gave %q, %s run %d gave %q", bins[0], root, bins[i], r+1, run.Root)
+			}
+		}
+	}
+	if root == "" {
+		fmt.Printf("no output roots printed to compare\n")
+	} else {
+		fmt.Printf("output roots equal: %s\n", root)
+	}
+	return nil
+}
+
+func runBenchReplayTraceCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need trace file")
+	}
+	f, err := os.Open(c.Args().First())
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint:errcheck
+	var bs blockstore.Blockstore
+	if path := c.String("datastore"); path != "" {
+		var closeDs func() error
+		if bs, closeDs, err = lib.OpenDatastoreBlockstore(path); err != nil {
+			return err
+		}
+		defer closeDs() // nolint:errcheck
+	} else {
+		chn := entstore.Chain{}
+		if bs, err = chn.Blockstore(c.Context); err != nil {
+			return err
+		}
+	}
+	stats, err := lib.ReplayAccessTrace(c.Context, bs, f, c.Int("workers"))
+	if err != nil {
+		return err
+	}
+	secs := stats.Elapsed.Seconds()
+	fmt.Printf("Replayed %d reads (%d missing) of %s in %v\n", stats.Reads+stats.Missing, stats.Missing, humanize.IBytes(stats.Bytes), stats.Elapsed.Round(time.Millisecond))
+	fmt.Printf("Throughput: %.0f reads/s, %s/s\n", float64(stats.Reads+stats.Missing)/secs, humanize.IBytes(uint64(float64(stats.Bytes)/secs)))
+	fmt.Printf("Latency: p50 %v, p90 %v, p99 %v, max %v\n", stats.Latencies[0], stats.Latencies[1], stats.Latencies[2], stats.Latencies[3])
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	gbig "math/big"
+
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/urfave/cli/v2"
+)
+
+// checkCmd has the check subcommands registered with registerSubcommand.
+var checkCmd = &cli.Command{
+	Name:        "check",
+	Description: "quick focused consistency checks of chain data and state",
+}
+
+// relDiff returns |a - b| / |b|, or |a| when b is zero.
+func relDiff(a, b big.Int) float64 {
+	diff := new(gbig.Float).SetInt(big.Sub(a, b).Abs().Int)
+	if !b.IsZero() {
+		diff.Quo(diff, new(gbig.Float).SetInt(b.Abs().Int))
+	}
+	f, _ := diff.Float64()
+	return f
+}
+
+// checkReport collects the outcome of named checks and prints each one.
+type checkReport struct {
+	failed int
+	// quiet suppresses printing passing checks
+	quiet bool
+	// maxPrinted caps the failures printed by failf, zero prints all
+	maxPrinted int
+}
+
+// failf records a failed check described by format.
+func (r *checkReport) failf(format string, args ...interface{}) {
+	r.failed++
+	if r.maxPrinted == 0 || r.failed <= r.maxPrinted {
+		fmt.Printf("FAILED  "+format+"\n", args...)
+	}
+}
+
+// printOmitted prints the number of failures failf did not print.
+func (r *checkReport) printOmitted() {
+	if r.maxPrinted > 0 && r.failed > r.maxPrinted {
+		fmt.Printf("... %d more failures\n", r.failed-r.maxPrinted)
+	}
+}
+
+func (r *checkReport) exact(name string, got, want big.Int) {
+	if got.Equals(want) {
+		if r.quiet {
+			return
+		}
+		fmt.Printf("ok      %s: %v\n", name, got)
+		return
+	}
+	r.failed++
+	fmt.Printf("FAILED  %s: %v, expected %v\n", name, got, want)
+}
+
+func (r *checkReport) close(name string, got, want big.Int, tolerance float64) {
+	d := relDiff(got, want)
+	if d <= tolerance {
+		if r.quiet {
+			return
+		}
+		fmt.Printf("ok      %s: %v, expected %v (diff %.4g)\n", name, got, want, d)
+		return
+	}
+	r.failed++
+	fmt.Printf("FAILED  %s: %v, expected %v (diff %.4g > %.4g)\n", name, got, want, d, tolerance)
+}
+
+func (r *checkReport) err() error {
+	recordCount("failures", r.failed)
+	if r.failed > 0 {
+		return validationFailed("%d checks failed", r.failed)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "chain",
+		Description: "check the parent state roots of headers walking back from a chain head exist and decode at the mainnet actors version of their epoch",
+		ArgsUsage:   "<head-block-cid>",
+		Action:      runCheckChainCmd,
+		Flags: []cli.Flag{
+			&cli.Int64Flag{
+				Name:  "count",
+				Usage: "number of headers to check",
+				Value: 100,
+			},
+		},
+	})
+}
+
+func runCheckChainCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need chain head")
+	}
+	head, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	iter, err := chn.NewChainStateIterator(c.Context, head)
+	if err != nil {
+		return xerrors.Errorf("failed to load head: %w", err)
+	}
+
+	failed := 0
+	checked := int64(0)
+	for ; checked < c.Int64("count"); checked++ {
+		if err := c.Context.Err(); err != nil {
+			return err
+		}
+		val := iter.Val()
+		if msg := checkParentState(c, &chn, store, val); msg != "" {
+			failed++
+			fmt.Printf("FAILED  block at %d, parent state %s: %s\n", val.BlockHeight, val.State, msg)
+		}
+		if iter.Done() {
+			checked++
+			break
+		}
+		if err := iter.Step(c.Context); err != nil {
+			fmt.Printf("FAILED  header below epoch %d: %s\n", val.BlockHeight, err)
+			failed++
+			break
+		}
+	}
+	fmt.Printf("checked %d headers, %d failed\n", checked, failed)
+	if failed > 0 {
+		return xerrors.Errorf("%d headers failed", failed)
+	}
+	return nil
+}
+
+// checkParentState returns what is wrong with the parent state root of a header,
+// or "" if it is fine.
+func checkParentState(c *cli.Context, chn *lib.Chain, store cbornode.IpldStore, val lib.IterVal) string {
+	has, err := chn.HasBlock(c.Context, val.State)
+	if err != nil {
+		return err.Error()
+	}
+	if !has {
+		return "missing from store"
+	}
+	info, err := lib.InspectRoot(c.Context, store, val.State)
+	if err != nil {
+		return err.Error()
+	}
+	expected := lib.ExpectedActorsVersion(abi.ChainEpoch(val.BlockHeight))
+	if info.ActorsVersion != expected {
+		return fmt.Sprintf("actors v%d, expected v%d at this epoch", info.ActorsVersion, expected)
+	}
+	// Actors v0 states are bare actors trees, later ones are wrapped
+	if expected >= 2 && !info.Wrapped {
+		return "bare actors tree, expected a wrapped state root"
+	}
+	if expected < 2 && info.Wrapped {
+		return "wrapped state root, expected a bare actors tree"
+	}
+	if info.Wrapped && info.Version != lib.ExpectedStateTreeVersion(expected) {
+		return fmt.Sprintf("state tree version %d, expected %d", info.Version, lib.ExpectedStateTreeVersion(expected))
+	}
+	return ""
+}
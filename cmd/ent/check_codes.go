@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "codes",
+		Description: "report actors whose code CID is of a different actors version than expected, catching incomplete migrations",
+		ArgsUsage:   "<state-root>",
+		Action:      runCheckCodesCmd,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "expect-version",
+				Usage: "actors version every code must be of, by default that of the system actor",
+			},
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "print at most this many failures",
+				Value: 20,
+			},
+		},
+	})
+}
+
+func runCheckCodesCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	expected := r.ActorsVersion()
+	if c.IsSet("expect-version") {
+		expected = c.Int("expect-version")
+	}
+	version, err := lib.ActorCodeVersioner(c.Context, store, r.Info)
+	if err != nil {
+		return err
+	}
+
+	report := checkReport{quiet: true, maxPrinted: c.Int("max-failures")}
+	// byVersion counts actors by the actors version of their code, -1 for unknown
+	byVersion := make(map[int]int)
+	err = r.Tree.ForEach(func(addr address.Address, a *lib.Actor) error {
+		if err := c.Context.Err(); err != nil {
+			return err
+		}
+		v, ok := version(a.Code)
+		if !ok {
+			byVersion[-1]++
+			report.failf("actor %s has code %s of no known actors version", addr, a.Code)
+			return nil
+		}
+		byVersion[v]++
+		if v != expected {
+			report.failf("actor %s has %s code %s of actors v%d, not v%d", addr, r.CodeName(a.Code), a.Code, v, expected)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	report.printOmitted()
+	versions := make([]int, 0, len(byVersion))
+	for v := range byVersion {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	fmt.Printf("Actors of state %s by code actors version:\n", root)
+	for _, v := range versions {
+		if v < 0 {
+			fmt.Printf("  unknown: %d\n", byVersion[v])
+			continue
+		}
+		fmt.Printf("  v%d: %d\n", v, byVersion[v])
+	}
+	fmt.Printf("Expected actors v%d, %d actors failed\n", expected, report.failed)
+	return report.err()
+}
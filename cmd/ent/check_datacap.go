@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	market8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/market"
+	verifreg8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/verifreg"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "datacap",
+		Description: "sum verified deal space in the market and cross-check it against verified registry DataCap and sector verified deal weight",
+		ArgsUsage:   "<state-root>",
+		Action:      runCheckDataCapCmd,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "top",
+				Usage: "list this many clients with the most verified deal space",
+				Value: 10,
+			},
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "print at most this many failures",
+				Value: 20,
+			},
+		},
+	})
+}
+
+// clientDataCap is the verified deal space and remaining DataCap of a client.
+type clientDataCap struct {
+	addr      address.Address
+	used      abi.StoragePower
+	remaining abi.StoragePower
+	verified  bool
+}
+
+func runCheckDataCapCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	market, info, err := lib.LoadMarketState(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	verifreg, _, err := lib.LoadVerifregState(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	report := checkReport{quiet: true, maxPrinted: c.Int("max-failures")}
+
+	// Verified deal space of the market by client
+	clients := make(map[address.Address]*clientDataCap)
+	client := func(addr address.Address) *clientDataCap {
+		cd, ok := clients[addr]
+		if !ok {
+			cd = &clientDataCap{addr: addr, used: big.Zero(), remaining: big.Zero()}
+			clients[addr] = cd
+		}
+		return cd
+	}
+	activeSpace, pendingSpace := big.Zero(), big.Zero()
+	// activeVerified holds active verified deals until found in a sector
+	activeVerified := make(map[abi.DealID]address.Address)
+	var verifiedDeals int
+	err = lib.ForEachDeal(c.Context, store, info.ActorsVersion, market, func(id abi.DealID, p *market8.DealProposal, s *market8.DealState) error {
+		if !p.VerifiedDeal {
+			return nil
+		}
+		verifiedDeals++
+		size := big.NewIntUnsigned(uint64(p.PieceSize))
+		if size.LessThan(verifreg8.MinVerifiedDealSize) {
+			report.failf("verified deal %d piece size %d is below the minimum verified deal size", id, p.PieceSize)
+		}
+		cd := client(p.Client)
+		cd.used = big.Add(cd.used, size)
+		if s == nil {
+			pendingSpace = big.Add(pendingSpace, size)
+			return nil
+		}
+		activeSpace = big.Add(activeSpace, size)
+		activeVerified[id] = p.Provider
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remaining DataCap of the registry
+	verifiers := make(map[address.Address]abi.StoragePower)
+	allowance := big.Zero()
+	if err := lib.ForEachDataCap(c.Context, store, info.ActorsVersion, verifreg.Verifiers, func(addr address.Address, dcap abi.StoragePower) error {
+		verifiers[addr] = dcap
+		allowance = big.Add(allowance, dcap)
+		if dcap.LessThan(big.Zero()) {
+			report.failf("verifier %s has negative allowance %v", addr, dcap)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	remaining := big.Zero()
+	var verifiedClients int
+	if err := lib.ForEachDataCap(c.Context, store, info.ActorsVersion, verifreg.VerifiedClients, func(addr address.Address, dcap abi.StoragePower) error {
+		verifiedClients++
+		cd := client(addr)
+		cd.remaining, cd.verified = dcap, true
+		remaining = big.Add(remaining, dcap)
+		// Clients are removed once their DataCap drops below a usable deal size
+		if dcap.LessThan(verifreg8.MinVerifiedDealSize) {
+			report.failf("verified client %s has DataCap %v below the minimum verified deal size", addr, dcap)
+		}
+		if _, ok := verifiers[addr]; ok {
+			report.failf("%s is both a verifier and a verified client", addr)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Active verified deals must add verified deal weight to the sector holding them
+	tree, err := lib.LoadActorsTree(c.Context, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return err
+	}
+	providers := make(map[address.Address]struct{})
+	for _, provider := range activeVerified {
+		providers[provider] = struct{}{}
+	}
+	for provider := range providers {
+		a, found, err := tree.GetActor(provider)
+		if err != nil {
+			return err
+		}
+		if !found {
+			report.failf("provider %s of active verified deals has no actor", provider)
+			continue
+		}
+		if err := lib.ForEachMinerSector(c.Context, store, info.ActorsVersion, a.Head, func(s *lib.MinerSector) error {
+			for _, id := range s.DealIDs {
+				if _, ok := activeVerified[id]; !ok {
+					continue
+				}
+				delete(activeVerified, id)
+				if s.VerifiedDealWeight.IsZero() {
+					report.failf("miner %s sector %d holds verified deal %d but has no verified deal weight", provider, s.SectorNumber, id)
+				}
+			}
+			return nil
+		}); err != nil {
+			return xerrors.Errorf("failed to read sectors of miner %s: %w", provider, err)
+		}
+	}
+	for id, provider := range activeVerified {
+		report.failf("active verified deal %d is in no sector of its provider %s", id, provider)
+	}
+
+	fmt.Printf("Verified deals: %d, %v bytes active, %v bytes pending activation\n", verifiedDeals, activeSpace, pendingSpace)
+	fmt.Printf("Verified clients: %d with %v bytes DataCap remaining\n", verifiedClients, remaining)
+	fmt.Printf("Verifiers: %d with %v bytes allowance remaining\n", len(verifiers), allowance)
+	byUse := make([]*clientDataCap, 0, len(clients))
+	for _, cd := range clients {
+		if !cd.used.IsZero() {
+			byUse = append(byUse, cd)
+		}
+	}
+	sort.Slice(byUse, func(i, j int) bool { return byUse[i].used.GreaterThan(byUse[j].used) })
+	top := c.Int("top")
+	if top > len(byUse) {
+		top = len(byUse)
+	}
+	if top > 0 {
+		// Deal space plus remaining DataCap is the DataCap granted to the client
+		// and not yet spent on deals since removed from the market
+		fmt.Printf("\n%-12s %-20s %-20s %s\n", "client", "verified deal bytes", "remaining datacap", "still verified")
+		for _, cd := range byUse[:top] {
+			fmt.Printf("%-12s %-20v %-20v %v\n", cd.addr, cd.used, cd.remaining, cd.verified)
+		}
+	}
+	report.printOmitted()
+	return report.err()
+}
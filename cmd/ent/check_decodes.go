@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "decodes",
+		Description: "decode the head of every actor with the state type of its code and report heads which fail to decode",
+		ArgsUsage:   "<state-root>",
+		Action:      runCheckDecodesCmd,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "sample",
+				Usage: "check only a deterministic sample of actors, e.g. 1% or 0.01",
+			},
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "print at most this many failures",
+				Value: 20,
+			},
+		},
+	})
+}
+
+func runCheckDecodesCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	fraction := 1.0
+	if c.IsSet("sample") {
+		if fraction, err = parseFraction(c.String("sample")); err != nil {
+			return err
+		}
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+
+	report := checkReport{quiet: true, maxPrinted: c.Int("max-failures")}
+	checked := make(map[string]int)
+	err = r.Tree.ForEach(func(addr address.Address, a *lib.Actor) error {
+		if fraction < 1 && !lib.InSample(addr, fraction) {
+			return nil
+		}
+		actorName := r.CodeName(a.Code)
+		checked[actorName]++
+		st, err := r.NewActorState(a.Code)
+		if err != nil {
+			report.failf("%s with code %s: %s", addr, a.Code, err)
+			return nil
+		}
+		if err := store.Get(c.Context, a.Head, st); err != nil {
+			report.failf("%s %s head %s does not decode as actors v%d state: %s", actorName, addr, a.Head, r.ActorsVersion(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(checked))
+	total := 0
+	for n, count := range checked {
+		names = append(names, n)
+		total += count
+	}
+	sort.Strings(names)
+	report.printOmitted()
+	fmt.Printf("Decoded the heads of %d actors of state %s (actors v%d), %d failed\n", total, root, r.ActorsVersion(), report.failed)
+	for _, n := range names {
+		fmt.Printf("  %-18s %d\n", n, checked[n])
+	}
+	return report.err()
+}
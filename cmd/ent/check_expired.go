@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "expired",
+		Description: "report sectors past their expiration still live in a partition, and power claims counting more raw power than the active sectors, overdue ones included",
+		ArgsUsage:   "<state-root> <height>",
+		Action:      runCheckExpiredCmd,
+		Flags: []cli.Flag{
+			&cli.Int64Flag{
+				Name:  "grace",
+				Usage: "epochs after expiration a sector may stay live, the expiration queue handles sectors at the end of their deadline",
+				Value: int64(miner8.WPoStProvingPeriod),
+			},
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "print at most this many failures",
+				Value: 20,
+			},
+			epochFlag(),
+			headFlag(),
+		},
+	})
+}
+
+func runCheckExpiredCmd(c *cli.Context) error {
+	root, height, _, err := stateArgs(c)
+	if err != nil {
+		return err
+	}
+	// Sectors expiring at or after deadline are not yet overdue
+	deadline := height - abi.ChainEpoch(c.Int64("grace"))
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	power, err := r.PowerState()
+	if err != nil {
+		return err
+	}
+	claims := make(map[address.Address]abi.StoragePower)
+	err = lib.ForEachPowerClaim(c.Context, store, r.ActorsVersion(), power.Claims, func(addr address.Address, raw, qa abi.StoragePower) error {
+		claims[addr] = raw
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to load power claims: %w", err)
+	}
+
+	type sectorExpiration struct {
+		expiration abi.ChainEpoch
+		size       abi.SectorSize
+	}
+	report := checkReport{quiet: true, maxPrinted: c.Int("max-failures")}
+	var miners, expired int
+	err = r.ForEachMiner(func(addr address.Address, a *lib.Actor) error {
+		miners++
+		sectors := make(map[uint64]sectorExpiration)
+		err := r.ForEachMinerSector(a, func(s *lib.MinerSector) error {
+			size, err := s.SealProof.SectorSize()
+			if err != nil {
+				return err
+			}
+			sectors[uint64(s.SectorNumber)] = sectorExpiration{expiration: s.Expiration, size: size}
+			return nil
+		})
+		if err != nil {
+			return xerrors.Errorf("failed to read sectors of miner %s: %w", addr, err)
+		}
+		// unexpired sums the raw power of the active sectors not yet overdue, and
+		// overdue that of active sectors already reported as overdue, which the
+		// claim still counts
+		unexpired, overdue := big.Zero(), big.Zero()
+		err = r.ForEachMinerPartition(a, func(dlIdx uint64, partIdx int64, p *miner8.Partition) error {
+			live, err := bitfield.SubtractBitField(p.Sectors, p.Terminated)
+			if err != nil {
+				return err
+			}
+			inactive, err := bitfield.MergeBitFields(p.Faults, p.Unproven)
+			if err != nil {
+				return err
+			}
+			active, err := bitfield.SubtractBitField(live, inactive)
+			if err != nil {
+				return err
+			}
+			activeSectors, err := active.AllMap(1 << 20)
+			if err != nil {
+				return err
+			}
+			return live.ForEach(func(sno uint64) error {
+				s, ok := sectors[sno]
+				if !ok {
+					return nil
+				}
+				power := abi.NewStoragePower(int64(s.size))
+				if s.expiration < deadline {
+					expired++
+					report.failf("miner %s sector %d expired at epoch %d but is live in deadline %d partition %d", addr, sno, s.expiration, dlIdx, partIdx)
+					if activeSectors[sno] {
+						overdue = big.Add(overdue, power)
+					}
+				} else if activeSectors[sno] {
+					unexpired = big.Add(unexpired, power)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return xerrors.Errorf("failed to read partitions of miner %s: %w", addr, err)
+		}
+		// Power of overdue sectors is not reported again as an excess claim
+		active := big.Add(unexpired, overdue)
+		if claim, ok := claims[addr]; ok && claim.GreaterThan(active) {
+			report.failf("miner %s claims %s raw power, %s more than its active sectors", addr, claim, big.Sub(claim, active))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	report.printOmitted()
+	fmt.Printf("Checked the sectors of %d miners of state %s (actors v%d) at height %d: %d expired sectors live, %d checks failed\n",
+		miners, root, r.ActorsVersion(), height, expired, report.failed)
+	return report.err()
+}
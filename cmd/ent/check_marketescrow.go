@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "market-escrow",
+		Description: "check every market participant's locked funds are within its escrow and match the collateral and unpaid fees of its deals, and no escrow or locked entry belongs to a deleted actor",
+		ArgsUsage:   "<state-root>",
+		Action:      runCheckMarketEscrowCmd,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "print at most this many failures",
+				Value: 20,
+			},
+		},
+	})
+}
+
+func runCheckMarketEscrowCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	market, info, err := lib.LoadMarketState(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	tree, err := lib.LoadActorsTree(c.Context, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return err
+	}
+	marketActor, found, err := tree.GetActor(builtin0.StorageMarketActorAddr)
+	if err != nil || !found {
+		return xerrors.Errorf("failed to load market actor: %w", err)
+	}
+	report := checkReport{quiet: true, maxPrinted: c.Int("max-failures")}
+	exists := func(table string, addr address.Address) error {
+		_, found, err := tree.GetActor(addr)
+		if err != nil {
+			return err
+		}
+		if !found {
+			report.failf("%s table entry of %s, which has no actor", table, addr)
+		}
+		return nil
+	}
+
+	escrow := make(map[address.Address]abi.TokenAmount)
+	escrowTotal := big.Zero()
+	if err := lib.ForEachBalance(c.Context, store, info.ActorsVersion, market.EscrowTable, func(addr address.Address, amount abi.TokenAmount) error {
+		escrow[addr] = amount
+		escrowTotal = big.Add(escrowTotal, amount)
+		return exists("escrow", addr)
+	}); err != nil {
+		return xerrors.Errorf("failed to load escrow table: %w", err)
+	}
+	locks, err := lib.LoadDealLocks(c.Context, store, info.ActorsVersion, market)
+	if err != nil {
+		return err
+	}
+	locked := make(map[address.Address]struct{})
+	lockedTotal := big.Zero()
+	if err := lib.ForEachBalance(c.Context, store, info.ActorsVersion, market.LockedTable, func(addr address.Address, amount abi.TokenAmount) error {
+		locked[addr] = struct{}{}
+		lockedTotal = big.Add(lockedTotal, amount)
+		if balance, ok := escrow[addr]; !ok {
+			report.failf("%s has %v locked and no escrow", addr, amount)
+		} else if amount.GreaterThan(balance) {
+			report.failf("%s has %v locked, more than its escrow of %v", addr, amount, balance)
+		}
+		want, ok := locks.ByAddress[addr]
+		if !ok {
+			want = big.Zero()
+		}
+		if !amount.Equals(want) {
+			report.failf("%s has %v locked, its deals lock %v", addr, amount, want)
+		}
+		return exists("locked", addr)
+	}); err != nil {
+		return xerrors.Errorf("failed to load locked table: %w", err)
+	}
+	for addr, want := range locks.ByAddress {
+		if _, ok := locked[addr]; !ok && !want.IsZero() {
+			report.failf("%s has nothing locked, its deals lock %v", addr, want)
+		}
+	}
+	report.printOmitted()
+
+	report.exact("locked table total vs market locked totals", lockedTotal,
+		big.Sum(market.TotalClientLockedCollateral, market.TotalProviderLockedCollateral, market.TotalClientStorageFee))
+	report.exact("market total client locked collateral vs deals", market.TotalClientLockedCollateral, locks.ClientCollateral)
+	report.exact("market total provider locked collateral vs deals", market.TotalProviderLockedCollateral, locks.ProviderCollateral)
+	report.exact("market total client storage fee vs deals", market.TotalClientStorageFee, locks.ClientStorageFee)
+	if escrowTotal.GreaterThan(marketActor.Balance) {
+		report.failf("escrow total %v exceeds the market actor balance %v", escrowTotal, marketActor.Balance)
+	}
+	fmt.Printf("Checked %d escrow and %d locked entries against %d deals, %d checks failed\n", len(escrow), len(locked), locks.Deals, report.failed)
+	return report.err()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+
+	address "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "migrated-actors",
+		Description: "check every actor after a migration has a code of the migrated actors version and no account nonce decreased",
+		ArgsUsage:   "<state-root-before> <state-root-after>",
+		Action:      runCheckMigratedActorsCmd,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "print at most this many failures",
+				Value: 20,
+			},
+		},
+	})
+}
+
+func runCheckMigratedActorsCmd(c *cli.Context) error {
+	if c.Args().Len() < 2 {
+		return xerrors.Errorf("not enough args, need state roots before and after migration")
+	}
+	before, err := cid.Decode(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	after, err := cid.Decode(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	beforeState, err := lib.NewStateReader(c.Context, store, before)
+	if err != nil {
+		return err
+	}
+	afterState, err := lib.NewStateReader(c.Context, store, after)
+	if err != nil {
+		return err
+	}
+	version, err := lib.ActorCodeVersioner(c.Context, store, afterState.Info)
+	if err != nil {
+		return err
+	}
+
+	// Account nonces only grow with the messages they send, which a migration
+	// must carry over.  Only accounts send messages so only their nonces are kept.
+	nonces := make(map[address.Address]uint64)
+	err = beforeState.Tree.ForEach(func(addr address.Address, a *lib.Actor) error {
+		if err := c.Context.Err(); err != nil {
+			return err
+		}
+		if beforeState.CodeName(a.Code) == "account" {
+			nonces[addr] = a.CallSeqNum
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	report := checkReport{quiet: true, maxPrinted: c.Int("max-failures")}
+	var actors, stale, unknown int
+	err = afterState.Tree.ForEach(func(addr address.Address, a *lib.Actor) error {
+		if err := c.Context.Err(); err != nil {
+			return err
+		}
+		actors++
+		v, ok := version(a.Code)
+		switch {
+		case !ok:
+			unknown++
+			report.failf("actor %s has code %s of no known actors version", addr, a.Code)
+		case v != afterState.ActorsVersion():
+			stale++
+			report.failf("actor %s has %s code %s of actors v%d, not v%d", addr, afterState.CodeName(a.Code), a.Code, v, afterState.ActorsVersion())
+		}
+		if nonce, ok := nonces[addr]; ok && a.CallSeqNum < nonce {
+			report.failf("account %s nonce decreased from %d to %d", addr, nonce, a.CallSeqNum)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	report.printOmitted()
+	fmt.Printf("Checked %d actors of state %s (actors v%d) migrated from %s (actors v%d): %d with stale codes, %d with unknown codes, %d checks failed\n",
+		actors, after, afterState.ActorsVersion(), before, beforeState.ActorsVersion(), stale, unknown, report.failed)
+	return report.err()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+
+	address "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "miner-addresses",
+		Description: "check every miner's owner, worker, control and pending addresses resolve to existing account or multisig actors",
+		ArgsUsage:   "<state-root>",
+		Action:      runCheckMinerAddressesCmd,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "print at most this many failures",
+				Value: 20,
+			},
+		},
+	})
+}
+
+// minerAddressRoles are the actor codes each address of a miner's info must
+// resolve to: owners and control addresses may be multisigs, workers sign blocks
+// and so must be accounts.
+var minerAddressRoles = map[string][]string{
+	"owner":          {"account", "multisig"},
+	"pending owner":  {"account", "multisig"},
+	"worker":         {"account"},
+	"pending worker": {"account"},
+	"control":        {"account", "multisig"},
+}
+
+func runCheckMinerAddressesCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	resolver, err := lib.NewAddressResolver(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+
+	report := checkReport{quiet: true, maxPrinted: c.Int("max-failures")}
+	// check reports a failure if the role address of miner does not resolve to
+	// an actor with one of the codes of the role.  Tree lookups are not safe for
+	// concurrent use so miners are checked in the walk.
+	check := func(miner address.Address, role string, addr address.Address) error {
+		id := addr
+		if addr.Protocol() != address.ID {
+			report.failf("miner %s %s %s is not an ID address", miner, role, addr)
+			resolved, found, err := resolver.Resolve(addr)
+			if err != nil {
+				return err
+			}
+			if !found {
+				report.failf("miner %s %s %s has no actor", miner, role, addr)
+				return nil
+			}
+			id = resolved
+		}
+		a, found, err := r.Tree.GetActor(id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			report.failf("miner %s %s %s has no actor, it was deleted or never existed", miner, role, addr)
+			return nil
+		}
+		code := r.CodeName(a.Code)
+		for _, want := range minerAddressRoles[role] {
+			if code == want {
+				return nil
+			}
+		}
+		if code == "" {
+			code = a.Code.String()
+		}
+		report.failf("miner %s %s %s is a %s actor, not %v", miner, role, addr, code, minerAddressRoles[role])
+		return nil
+	}
+
+	var miners int
+	err = r.ForEachMiner(func(addr address.Address, a *lib.Actor) error {
+		miners++
+		addrs, err := r.MinerAddresses(a)
+		if err != nil {
+			report.failf("miner %s info does not load: %s", addr, err)
+			return nil
+		}
+		if err := check(addr, "owner", addrs.Owner); err != nil {
+			return err
+		}
+		if err := check(addr, "worker", addrs.Worker); err != nil {
+			return err
+		}
+		for _, control := range addrs.ControlAddresses {
+			if err := check(addr, "control", control); err != nil {
+				return err
+			}
+		}
+		if addrs.PendingWorker != address.Undef {
+			if err := check(addr, "pending worker", addrs.PendingWorker); err != nil {
+				return err
+			}
+		}
+		if addrs.PendingOwner != address.Undef {
+			if err := check(addr, "pending owner", addrs.PendingOwner); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	report.printOmitted()
+	fmt.Printf("Checked the addresses of %d miners of state %s (actors v%d), %d failed\n", miners, root, r.ActorsVersion(), report.failed)
+	return report.err()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "orphans",
+		Description: "report actors present before a migration but absent after it, and those created by it, other than documented deletions and creations",
+		ArgsUsage:   "<state-root-before> <state-root-after>",
+		Action:      runCheckOrphansCmd,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "expect-deleted",
+				Usage: "ID address of an actor the migration is expected to delete, may be repeated",
+			},
+			&cli.StringSliceFlag{
+				Name:  "expect-created",
+				Usage: "ID address of an actor the migration is expected to create, may be repeated",
+			},
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "print at most this many failures",
+				Value: 20,
+			},
+		},
+	})
+}
+
+func runCheckOrphansCmd(c *cli.Context) error {
+	if c.Args().Len() < 2 {
+		return xerrors.Errorf("not enough args, need state roots before and after migration")
+	}
+	before, err := cid.Decode(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	after, err := cid.Decode(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	afterInfo, err := lib.InspectRoot(c.Context, store, after)
+	if err != nil {
+		return err
+	}
+	documented := lib.DocumentedActorChanges[afterInfo.ActorsVersion]
+	expectDeleted, err := expectedActors(c.StringSlice("expect-deleted"), documented.Deleted)
+	if err != nil {
+		return err
+	}
+	expectCreated, err := expectedActors(c.StringSlice("expect-created"), documented.Created)
+	if err != nil {
+		return err
+	}
+	labels, err := stateLabels(c, store, before, after)
+	if err != nil {
+		return err
+	}
+	removed, created, err := lib.DiffActorSets(c.Context, store, before, after)
+	if err != nil {
+		return err
+	}
+
+	report := checkReport{maxPrinted: c.Int("max-failures")}
+	// check reports the actors of what changed, unexpected ones as failures, and
+	// the expected actors that did not change as failures too.
+	check := func(what string, actors []*lib.PresentActor, expected map[address.Address]bool) {
+		for _, a := range actors {
+			if expected[a.Addr] {
+				delete(expected, a.Addr)
+				fmt.Printf("ok      %s %s actor %s, balance %v, as expected\n", what, a.Code, labels.Format(a.Addr), a.Balance)
+				continue
+			}
+			report.failf("%s %s actor %s, balance %v", what, a.Code, labels.Format(a.Addr), a.Balance)
+		}
+		missing := make([]address.Address, 0, len(expected))
+		for addr := range expected {
+			missing = append(missing, addr)
+		}
+		sort.Slice(missing, func(i, j int) bool { return missing[i].String() < missing[j].String() })
+		for _, addr := range missing {
+			report.failf("expected actor %s to be %s", labels.Format(addr), what)
+		}
+	}
+	check("deleted", removed, expectDeleted)
+	check("created", created, expectCreated)
+	report.printOmitted()
+	fmt.Printf("Migration from %s to %s (actors v%d) deleted %d and created %d actors, %d checks failed\n",
+		before, after, afterInfo.ActorsVersion, len(removed), len(created), report.failed)
+	return report.err()
+}
+
+// expectedActors returns the set of the ID addresses flags and documented.
+func expectedActors(flags []string, documented []address.Address) (map[address.Address]bool, error) {
+	expected := make(map[address.Address]bool, len(flags)+len(documented))
+	for _, addr := range documented {
+		expected[addr] = true
+	}
+	for _, s := range flags {
+		addr, err := address.NewFromString(s)
+		if err != nil {
+			return nil, err
+		}
+		if addr.Protocol() != address.ID {
+			return nil, xerrors.Errorf("expected actor %s is not an ID address", addr)
+		}
+		expected[addr] = true
+	}
+	return expected, nil
+}
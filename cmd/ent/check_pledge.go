@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "pledge",
+		Description: "recompute initial pledge for a sample of recently activated sectors and report sectors whose stored pledge is far off",
+		Action:      runCheckPledgeCmd,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "sample",
+				Usage: "fraction of miners to check, e.g. 1% or 0.01",
+				Value: "1%",
+			},
+			&cli.Int64Flag{
+				Name:  "window",
+				Usage: "only check sectors activated within this many epochs before the state, whose pledge was computed in nearly the same network conditions",
+				Value: 120,
+			},
+			&cli.Float64Flag{
+				Name:  "tolerance",
+				Usage: "relative difference between stored and recomputed pledge above which a sector is an outlier",
+				Value: 0.01,
+			},
+			&cli.StringFlag{
+				Name:  "circulating-supply",
+				Usage: "circulating supply in attoFIL to use instead of estimating it from the state",
+			},
+			&cli.IntFlag{
+				Name:  "max-outliers",
+				Usage: "print at most this many outliers",
+				Value: 20,
+			},
+		},
+	})
+}
+
+type pledgeOutlier struct {
+	miner    address.Address
+	sector   abi.SectorNumber
+	stored   abi.TokenAmount
+	expected abi.TokenAmount
+	diff     float64
+}
+
+func runCheckPledgeCmd(c *cli.Context) error {
+	if c.Args().Len() < 2 {
+		return xerrors.Errorf("not enough args, need state root and height")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	hRaw, err := strconv.ParseInt(c.Args().Get(1), 10, 64)
+	if err != nil {
+		return err
+	}
+	height := abi.ChainEpoch(hRaw)
+	fraction, err := parseFraction(c.String("sample"))
+	if err != nil {
+		return err
+	}
+	tolerance := c.Float64("tolerance")
+	// Stored pledge was computed with the reward, power and supply at activation,
+	// which only match those of the state for sectors activated shortly before it
+	since := height - abi.ChainEpoch(c.Int64("window"))
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	if r.ActorsVersion() < 2 {
+		return xerrors.Errorf("pledge recomputation needs actors v2+ state, %s holds actors v%d", root, r.ActorsVersion())
+	}
+	reward, err := r.RewardState()
+	if err != nil {
+		return err
+	}
+	power, err := r.PowerState()
+	if err != nil {
+		return err
+	}
+	var circSupply abi.TokenAmount
+	if val := c.String("circulating-supply"); val != "" {
+		if circSupply, err = big.FromString(val); err != nil {
+			return err
+		}
+	} else {
+		supply, err := lib.EstimateCirculatingSupply(c.Context, store, root, height)
+		if err != nil {
+			return err
+		}
+		circSupply = supply.Circulating()
+	}
+	fmt.Printf("Circulating supply: %v\n", circSupply)
+
+	var miners, sectors, older int
+	var outliers []pledgeOutlier
+	err = r.ForEachMiner(func(addr address.Address, a *lib.Actor) error {
+		if !lib.InSample(addr, fraction) {
+			return nil
+		}
+		miners++
+		return r.ForEachMinerSector(a, func(s *lib.MinerSector) error {
+			if s.Activation < since {
+				older++
+				return nil
+			}
+			size, err := s.SealProof.SectorSize()
+			if err != nil {
+				return err
+			}
+			qa := miner8.QAPowerForWeight(size, s.Expiration-s.Activation, s.DealWeight, s.VerifiedDealWeight)
+			expected := miner8.InitialPledgeForPower(qa, reward.ThisEpochBaselinePower, reward.ThisEpochRewardSmoothed, power.ThisEpochQAPowerSmoothed, circSupply)
+			sectors++
+			if d := relDiff(s.InitialPledge, expected); d > tolerance {
+				outliers = append(outliers, pledgeOutlier{
+					miner:    addr,
+					sector:   s.SectorNumber,
+					stored:   s.InitialPledge,
+					expected: expected,
+					diff:     d,
+				})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(outliers, func(i, j int) bool { return outliers[i].diff > outliers[j].diff })
+	fmt.Printf("Checked %d sectors of %d miners activated since epoch %d, %d outliers beyond %.4g, skipped %d sectors activated before\n",
+		sectors, miners, since, len(outliers), tolerance, older)
+	for i, o := range outliers {
+		if i == c.Int("max-outliers") {
+			fmt.Printf("... %d more\n", len(outliers)-i)
+			break
+		}
+		fmt.Printf("%s sector %d: stored %v, recomputed %v (diff %.4g)\n", o.miner, o.sector, o.stored, o.expected, o.diff)
+	}
+	if len(outliers) > 0 {
+		return xerrors.Errorf("%d sectors have initial pledge far from the recomputed value", len(outliers))
+	}
+	return nil
+}
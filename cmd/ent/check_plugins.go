@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "plugins",
+		Description: "run the custom actor checks of Go check plugins on a state without the invariant checks",
+		ArgsUsage:   "<state-root> <height>",
+		Action:      runCheckPluginsCmd,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "plugin",
+				Usage:    "Go plugin of custom actor checks, may be repeated",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "print at most this many failures",
+				Value: 100,
+			},
+			epochFlag(),
+			headFlag(),
+		},
+	})
+}
+
+func runCheckPluginsCmd(c *cli.Context) error {
+	root, height, _, err := stateArgs(c)
+	if err != nil {
+		return err
+	}
+	checks, err := loadCheckPlugins(c.StringSlice("plugin"))
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	env, err := lib.NewCheckEnv(c.Context, store, root, height)
+	if err != nil {
+		return err
+	}
+
+	report := checkReport{quiet: true, maxPrinted: c.Int("max-failures")}
+	if err := lib.RunActorChecks(c.Context, env, checks, func(msg string) {
+		report.failf("%s", msg)
+	}); err != nil {
+		return err
+	}
+	report.printOmitted()
+	fmt.Printf("Ran %d custom checks on %s (actors v%d), %d failed\n", len(checks), root, env.Info.ActorsVersion, report.failed)
+	return report.err()
+}
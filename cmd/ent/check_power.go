@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	power8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/power"
+	smoothing8 "github.com/filecoin-project/specs-actors/v8/actors/util/smoothing"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "power",
+		Description: "check power actor totals and smoothed estimate against the claims table, optionally comparing a migrated state",
+		Action:      runCheckPowerCmd,
+		Flags: []cli.Flag{
+			toleranceFlag(),
+		},
+	})
+}
+
+func toleranceFlag() cli.Flag {
+	return &cli.Float64Flag{
+		Name:  "tolerance",
+		Usage: "relative difference allowed between values which are only expected to be close",
+		Value: 0.01,
+	}
+}
+
+func runCheckPowerCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root and optional migrated state root")
+	}
+	roots := make([]cid.Cid, c.Args().Len())
+	for i := range roots {
+		var err error
+		if roots[i], err = cid.Decode(c.Args().Get(i)); err != nil {
+			return err
+		}
+	}
+	if len(roots) > 2 {
+		return xerrors.Errorf("too many args, need state root and optional migrated state root")
+	}
+	tolerance := c.Float64("tolerance")
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+
+	var report checkReport
+	states := make([]*power8.State, len(roots))
+	for i, root := range roots {
+		st, info, err := lib.LoadPowerState(c.Context, store, root)
+		if err != nil {
+			return err
+		}
+		states[i] = st
+		claimsRaw, claimsQA := big.Zero(), big.Zero()
+		claimCount := int64(0)
+		if err := lib.ForEachPowerClaim(c.Context, store, info.ActorsVersion, st.Claims, func(_ address.Address, raw, qa abi.StoragePower) error {
+			claimsRaw = big.Add(claimsRaw, raw)
+			claimsQA = big.Add(claimsQA, qa)
+			claimCount++
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		fmt.Printf("Power actor at %s (actors v%d)\n", root, info.ActorsVersion)
+		report.exact("claims count vs MinerCount", big.NewInt(claimCount), big.NewInt(st.MinerCount))
+		report.exact("claims raw power vs TotalBytesCommitted", claimsRaw, st.TotalBytesCommitted)
+		report.exact("claims QA power vs TotalQABytesCommitted", claimsQA, st.TotalQABytesCommitted)
+		// This epoch values are snapshotted at the end of cron so may lag the totals
+		report.close("ThisEpochRawBytePower vs TotalRawBytePower", st.ThisEpochRawBytePower, st.TotalRawBytePower, tolerance)
+		report.close("ThisEpochQualityAdjPower vs TotalQualityAdjPower", st.ThisEpochQualityAdjPower, st.TotalQualityAdjPower, tolerance)
+		report.close("ThisEpochQAPowerSmoothed vs ThisEpochQualityAdjPower", smoothing8.Estimate(&st.ThisEpochQAPowerSmoothed), st.ThisEpochQualityAdjPower, tolerance)
+	}
+	if len(states) == 2 {
+		before, after := states[0], states[1]
+		fmt.Printf("Migration %s => %s\n", roots[0], roots[1])
+		report.close("TotalRawBytePower", after.TotalRawBytePower, before.TotalRawBytePower, tolerance)
+		report.close("TotalQualityAdjPower", after.TotalQualityAdjPower, before.TotalQualityAdjPower, tolerance)
+		report.close("ThisEpochQualityAdjPower", after.ThisEpochQualityAdjPower, before.ThisEpochQualityAdjPower, tolerance)
+		report.close("ThisEpochQAPowerSmoothed", smoothing8.Estimate(&after.ThisEpochQAPowerSmoothed), smoothing8.Estimate(&before.ThisEpochQAPowerSmoothed), tolerance)
+	}
+	return report.err()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "qapower",
+		Description: "recompute sector QA power from deal weights and check it against partition power and the miner's power claim",
+		Action:      runCheckQAPowerCmd,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "miner",
+				Usage: "check only this miner and print every check",
+			},
+		},
+	})
+}
+
+func runCheckQAPowerCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	var only address.Address
+	if val := c.String("miner"); val != "" {
+		if only, err = address.NewFromString(val); err != nil {
+			return err
+		}
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	power, err := r.PowerState()
+	if err != nil {
+		return err
+	}
+	claims := make(map[address.Address]miner8.PowerPair)
+	if err := lib.ForEachPowerClaim(c.Context, store, r.ActorsVersion(), power.Claims, func(addr address.Address, raw, qa abi.StoragePower) error {
+		claims[addr] = miner8.NewPowerPair(raw, qa)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	report := checkReport{quiet: only == address.Undef}
+	miners := 0
+	err = r.ForEachMiner(func(addr address.Address, a *lib.Actor) error {
+		if only != address.Undef && addr != only {
+			return nil
+		}
+		miners++
+		sectorPower := make(map[uint64]miner8.PowerPair)
+		if err := r.ForEachMinerSector(a, func(s *lib.MinerSector) error {
+			size, err := s.SealProof.SectorSize()
+			if err != nil {
+				return err
+			}
+			qa := miner8.QAPowerForWeight(size, s.Expiration-s.Activation, s.DealWeight, s.VerifiedDealWeight)
+			sectorPower[uint64(s.SectorNumber)] = miner8.NewPowerPair(big.NewIntUnsigned(uint64(size)), qa)
+			return nil
+		}); err != nil {
+			return err
+		}
+		sum := func(sectors bitfield.BitField) (miner8.PowerPair, error) {
+			total := miner8.NewPowerPairZero()
+			err := sectors.ForEach(func(sno uint64) error {
+				p, ok := sectorPower[sno]
+				if !ok {
+					return xerrors.Errorf("miner %s partition sector %d has no sector info", addr, sno)
+				}
+				total = total.Add(p)
+				return nil
+			})
+			return total, err
+		}
+
+		active := miner8.NewPowerPairZero()
+		if err := r.ForEachMinerPartition(a, func(dlIdx uint64, partIdx int64, p *miner8.Partition) error {
+			live, err := bitfield.SubtractBitField(p.Sectors, p.Terminated)
+			if err != nil {
+				return err
+			}
+			livePower, err := sum(live)
+			if err != nil {
+				return err
+			}
+			faultyPower, err := sum(p.Faults)
+			if err != nil {
+				return err
+			}
+			unprovenPower, err := sum(p.Unproven)
+			if err != nil {
+				return err
+			}
+			prefix := fmt.Sprintf("%s deadline %d partition %d", addr, dlIdx, partIdx)
+			report.exact(prefix+" live raw power", livePower.Raw, p.LivePower.Raw)
+			report.exact(prefix+" live QA power", livePower.QA, p.LivePower.QA)
+			report.exact(prefix+" faulty QA power", faultyPower.QA, p.FaultyPower.QA)
+			report.exact(prefix+" unproven QA power", unprovenPower.QA, p.UnprovenPower.QA)
+			active = active.Add(p.LivePower.Sub(p.FaultyPower).Sub(p.UnprovenPower))
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		claim, ok := claims[addr]
+		if !ok {
+			report.failed++
+			fmt.Printf("FAILED  %s has no power claim\n", addr)
+			return nil
+		}
+		report.exact(addr.String()+" active raw power vs claim", active.Raw, claim.Raw)
+		report.exact(addr.String()+" active QA power vs claim", active.QA, claim.QA)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if only != address.Undef && miners == 0 {
+		return xerrors.Errorf("no miner actor %s in state %s", only, root)
+	}
+	fmt.Printf("Checked QA power of %d miners, %d checks failed\n", miners, report.failed)
+	return report.err()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "root",
+		Description: "report whether a cid is a wrapped state root or a bare actors tree and check its version",
+		Action:      runCheckRootCmd,
+	})
+}
+
+func runCheckRootCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	info, err := lib.InspectRoot(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	expected := lib.ExpectedStateTreeVersion(info.ActorsVersion)
+	if !info.Wrapped {
+		fmt.Printf("%s: bare actors tree, actors v%d, wraps as state tree version %d\n", root, info.ActorsVersion, expected)
+		return nil
+	}
+	fmt.Printf("%s: wrapped state root, version %d, actors tree %s, actors v%d\n", root, info.Version, info.Actors, info.ActorsVersion)
+	if info.Version != expected {
+		return xerrors.Errorf("state tree version %d does not match actors v%d, expected version %d", info.Version, info.ActorsVersion, expected)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "roundtrip",
+		Description: "decode the head of every actor with the state type of its code, encode it again and report heads whose bytes or CID change",
+		ArgsUsage:   "<state-root>",
+		Action:      runCheckRoundTripCmd,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "sample",
+				Usage: "check only a deterministic sample of actors, e.g. 1% or 0.01",
+			},
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "print at most this many failures",
+				Value: 20,
+			},
+		},
+	})
+}
+
+func runCheckRoundTripCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	fraction := 1.0
+	if c.IsSet("sample") {
+		if fraction, err = parseFraction(c.String("sample")); err != nil {
+			return err
+		}
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+
+	report := checkReport{quiet: true, maxPrinted: c.Int("max-failures")}
+	checked := make(map[string]int)
+	// Actors sharing a head are checked once
+	seen := cid.NewSet()
+	err = r.Tree.ForEach(func(addr address.Address, a *lib.Actor) error {
+		if err := c.Context.Err(); err != nil {
+			return err
+		}
+		if fraction < 1 && !lib.InSample(addr, fraction) {
+			return nil
+		}
+		actorName := r.CodeName(a.Code)
+		checked[actorName]++
+		if !seen.Visit(a.Head) {
+			return nil
+		}
+		st, err := r.NewActorState(a.Code)
+		if err != nil {
+			report.failf("%s with code %s: %s", addr, a.Code, err)
+			return nil
+		}
+		if err := lib.RoundTripActorState(c.Context, store, a.Head, st); err != nil {
+			report.failf("%s %s head %s does not round trip as actors v%d state: %s", actorName, addr, a.Head, r.ActorsVersion(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(checked))
+	total := 0
+	for n, count := range checked {
+		names = append(names, n)
+		total += count
+	}
+	sort.Strings(names)
+	report.printOmitted()
+	fmt.Printf("Round tripped the heads of %d actors of state %s (actors v%d), %d failed\n", total, root, r.ActorsVersion(), report.failed)
+	for _, n := range names {
+		fmt.Printf("  %-18s %d\n", n, checked[n])
+	}
+	return report.err()
+}
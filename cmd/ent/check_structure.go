@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("check", &cli.Command{
+		Name:        "structure",
+		Description: "check the encoding of a single HAMT or AMT without loading a state tree: its bitwidth and that all its keys and values decode; with no args list the known structure types",
+		ArgsUsage:   "<root>",
+		Action:      runCheckStructureCmd,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "type",
+				Usage: "structure type, e.g. miner-sectors-amt",
+			},
+			&cli.IntFlag{
+				Name:  "actors-version",
+				Usage: "actors version the structure was written by",
+			},
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "print at most this many failures",
+				Value: 20,
+			},
+		},
+	})
+}
+
+func runCheckStructureCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		fmt.Printf("Structure types:\n")
+		for _, t := range lib.StructureTypes {
+			fmt.Printf("  %-32s %s\n", t.Name, t.Description)
+		}
+		return nil
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	if !c.IsSet("type") || !c.IsSet("actors-version") {
+		return xerrors.Errorf("need --type and --actors-version of the structure")
+	}
+	t, ok := lib.LookupStructureType(c.String("type"))
+	if !ok {
+		return xerrors.Errorf("unknown structure type %s, run with no args to list types", c.String("type"))
+	}
+	v := c.Int("actors-version")
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+
+	report := checkReport{quiet: true, maxPrinted: c.Int("max-failures")}
+	entries, err := lib.CheckStructure(c.Context, store, v, root, t, func(key string, err error) {
+		report.failf("entry %s: %s", key, err)
+	})
+	if err != nil {
+		report.failf("%s %s: %s", t.Name, root, err)
+	}
+	report.printOmitted()
+	fmt.Printf("Checked %d entries of %s %s (actors v%d, bitwidth %d), %d failed\n", entries, t.Name, root, v, t.Bitwidth(v), report.failed)
+	return report.err()
+}
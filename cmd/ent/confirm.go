@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+)
+
+// confirmMinActors is the estimated actor count from which migrations and full
+// exports ask for confirmation.  Devnet states are far below it, mainnet states
+// far above.
+const confirmMinActors = 100000
+
+// confirmRun prints an estimate of running command over the state at root to
+// stderr and, for states of confirmMinActors or more, asks for confirmation on the
+// terminal unless --yes is set.  It fails if the run is not confirmed.  The
+// returned function records the completed run for later estimates.
+func confirmRun(c *cli.Context, store cbornode.IpldStore, command string, root cid.Cid) (func(blocks, bytes uint64), error) {
+	est, err := lib.EstimateRun(c.Context, store, command, root)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to estimate %s: %w", command, err)
+	}
+	line := fmt.Sprintf("%s of state %s: about %d actors", command, root, est.Actors)
+	if prev := est.Previous; prev != nil {
+		line += fmt.Sprintf(", estimated %v", est.Duration.Round(time.Second))
+		if est.Blocks > 0 {
+			line += fmt.Sprintf(" and %d blocks written", est.Blocks)
+		}
+		if est.Bytes > 0 {
+			line += fmt.Sprintf(" and %s written", humanize.IBytes(est.Bytes))
+		}
+		line += fmt.Sprintf(" from the run over %d actors on %s", prev.Actors, prev.Time.Format("2006-01-02"))
+	}
+	_, _ = fmt.Fprintln(os.Stderr, line)
+
+	if est.Actors >= confirmMinActors && !c.Bool("yes") {
+		if err := confirm(command, est.Actors); err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	return func(blocks, bytes uint64) {
+		err := lib.RecordRun(lib.RunRecord{
+			Command:   command,
+			StateRoot: root,
+			Time:      time.Now(),
+			Actors:    est.Actors,
+			Seconds:   time.Since(start).Seconds(),
+			Blocks:    blocks,
+			Bytes:     bytes,
+		})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to record run: %s\n", err)
+		}
+	}, nil
+}
+
+// confirm asks on the terminal whether to run command over a state of actors
+// actors.
+func confirm(command string, actors uint64) error {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return xerrors.Errorf("%s of a state of about %d actors needs confirmation, pass --yes to run without a terminal", command, actors)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Continue? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return xerrors.Errorf("%s not confirmed", command)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+var diffCmd = &cli.Command{
+	Name:        "diff",
+	Description: "compare two states",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "balances",
+			Description: "rank the actors with the largest balance increases and decreases between two states, with totals by actor type",
+			ArgsUsage:   "<state-root-a> <state-root-b>",
+			Action:      runDiffBalancesCmd,
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:  "top",
+					Usage: "list this many actors with the largest increases and decreases",
+					Value: 50,
+				},
+			},
+		},
+		{
+			Name:        "matrix",
+			Description: "compare several states pairwise, e.g. migration outputs of different machines, builds or cached and uncached runs, in a table of the number of actors each pair differs in",
+			ArgsUsage:   "<state-root> <state-root> [<state-root>...]",
+			Action:      runDiffMatrixCmd,
+		},
+	},
+}
+
+func runDiffBalancesCmd(c *cli.Context) error {
+	if c.Args().Len() < 2 {
+		return xerrors.Errorf("not enough args, need two state roots")
+	}
+	rootA, err := cid.Decode(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	rootB, err := cid.Decode(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	labels, err := stateLabels(c, store, rootA, rootB)
+	if err != nil {
+		return err
+	}
+	changes, err := lib.DiffBalances(c.Context, store, rootA, rootB)
+	if err != nil {
+		return err
+	}
+
+	type typeTotals struct {
+		actors             int
+		increase, decrease abi.TokenAmount
+	}
+	byType := make(map[string]*typeTotals)
+	net := big.Zero()
+	for _, ch := range changes {
+		t, ok := byType[ch.Code]
+		if !ok {
+			t = &typeTotals{increase: big.Zero(), decrease: big.Zero()}
+			byType[ch.Code] = t
+		}
+		t.actors++
+		if ch.Delta.GreaterThan(big.Zero()) {
+			t.increase = big.Add(t.increase, ch.Delta)
+		} else {
+			t.decrease = big.Add(t.decrease, ch.Delta)
+		}
+		net = big.Add(net, ch.Delta)
+	}
+
+	fmt.Printf("Balance changes from %s to %s (attoFIL)\n", rootA, rootB)
+	fmt.Printf("Actors changed: %d, net change: %v\n", len(changes), net)
+	fmt.Printf("By actor type:\n")
+	fmt.Printf("  %-18s %8s %28s %28s %28s\n", "type", "actors", "increase", "decrease", "net")
+	types := make([]string, 0, len(byType))
+	for code := range byType {
+		types = append(types, code)
+	}
+	sort.Strings(types)
+	for _, code := range types {
+		t := byType[code]
+		name := code
+		if name == "" {
+			name = "(unknown)"
+		}
+		fmt.Printf("  %-18s %8d %28v %28v %28v\n", name, t.actors, t.increase, t.decrease, big.Add(t.increase, t.decrease))
+	}
+
+	top := c.Int("top")
+	printChanges := func(title string, changes []*lib.BalanceChange) {
+		fmt.Printf("%s:\n", title)
+		for _, ch := range changes {
+			fmt.Printf("  %-12s %-18s %28v -> %-28v %+v\n", labels.Format(ch.Addr), ch.Code, ch.Before, ch.After, ch.Delta)
+		}
+	}
+	// changes are ordered from the largest increase to the largest decrease
+	var increases, decreases []*lib.BalanceChange
+	for i := 0; i < len(changes) && len(increases) < top && changes[i].Delta.GreaterThan(big.Zero()); i++ {
+		increases = append(increases, changes[i])
+	}
+	for i := len(changes) - 1; i >= 0 && len(decreases) < top && changes[i].Delta.LessThan(big.Zero()); i-- {
+		decreases = append(decreases, changes[i])
+	}
+	printChanges("Largest increases", increases)
+	printChanges("Largest decreases", decreases)
+	return nil
+}
+
+func runDiffMatrixCmd(c *cli.Context) error {
+	if c.Args().Len() < 2 {
+		return xerrors.Errorf("not enough args, need at least two state roots")
+	}
+	roots := make([]cid.Cid, c.Args().Len())
+	for i, arg := range c.Args().Slice() {
+		root, err := cid.Decode(arg)
+		if err != nil {
+			return err
+		}
+		roots[i] = root
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+
+	// diffs[i][j] is the number of actors roots i and j differ in, -1 for
+	// identical roots.  Each state is held in memory in turn while the later
+	// states are compared to it.
+	diffs := make([][]int, len(roots))
+	for i := range diffs {
+		diffs[i] = make([]int, len(roots))
+		diffs[i][i] = -1
+	}
+	for i := 0; i < len(roots)-1; i++ {
+		var snapshot *lib.ActorSnapshot
+		for j := i + 1; j < len(roots); j++ {
+			n := -1
+			if !roots[j].Equals(roots[i]) {
+				if snapshot == nil {
+					if snapshot, err = lib.LoadActorSnapshot(c.Context, store, roots[i]); err != nil {
+						return xerrors.Errorf("failed to load state %s: %w", roots[i], err)
+					}
+				}
+				if n, err = snapshot.CountActorDiffs(c.Context, store, roots[j]); err != nil {
+					return xerrors.Errorf("failed to compare state %s to %s: %w", roots[j], roots[i], err)
+				}
+			}
+			diffs[i][j], diffs[j][i] = n, n
+		}
+	}
+
+	fmt.Printf("States:\n")
+	for i, root := range roots {
+		fmt.Printf("  %-4d %s\n", i+1, root)
+	}
+	fmt.Printf("Actors differing between each pair of states, = for identical state roots:\n")
+	fmt.Printf("  %-4s", "")
+	for i := range roots {
+		fmt.Printf(" %10d", i+1)
+	}
+	fmt.Println()
+	for i := range roots {
+		fmt.Printf("  %-4d", i+1)
+		for _, n := range diffs[i] {
+			if n < 0 {
+				fmt.Printf(" %10s", "=")
+			} else {
+				fmt.Printf(" %10d", n)
+			}
+		}
+		fmt.Println()
+	}
+	return nil
+}
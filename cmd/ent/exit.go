@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"syscall"
+
+	datastore "github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"golang.org/x/xerrors"
+)
+
+// Exit codes of ent, so scripts running it can tell a migration bug from a full
+// disk without reading its output.
+const (
+	exitOK = 0
+	// exitFailed is the exit code of errors of no other class
+	exitFailed = 1
+	// exitValidationFailed is the exit code of runs finding invariant violations
+	// or failing checks
+	exitValidationFailed = 2
+	// exitRootMismatch is the exit code of migrations whose output is not the
+	// --expect-root state root
+	exitRootMismatch = 3
+	// exitStoreError is the exit code of runs failing on reads or writes of the
+	// chain stores, a missing block or a full disk
+	exitStoreError = 4
+	// exitCheckpointed is the exit code of migrations interrupted, by a signal,
+	// --timeout or a stall, after checkpointing their cache for a rerun
+	exitCheckpointed = 5
+	// exitInterrupted is the exit code of runs interrupted without a checkpoint
+	exitInterrupted = 6
+	// exitStalled is the exit code of migrations aborted by the stall watchdog
+	// without a checkpoint
+	exitStalled = 7
+)
+
+// exitError is an error ending a run with an exit code other than that of its
+// class.  It does not implement cli.ExitCoder, which would exit from within
+// app.Run before the result file is written.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode returns err ending the run with exit code code.
+func withExitCode(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
+
+// validationFailed returns an error ending the run with exitValidationFailed.
+func validationFailed(format string, args ...interface{}) error {
+	return withExitCode(exitValidationFailed, xerrors.Errorf(format, args...))
+}
+
+// isValidationFailure returns whether err is from finding invariant violations
+// or failing checks rather than from failing to run them.
+func isValidationFailure(err error) bool {
+	return exitCode(err) == exitValidationFailed
+}
+
+// exitCode returns the exit code of a run ending with err.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var ee *exitError
+	if xerrors.As(err, &ee) {
+		return ee.code
+	}
+	if xerrors.Is(err, context.Canceled) || xerrors.Is(err, context.DeadlineExceeded) {
+		return exitInterrupted
+	}
+	if isStoreError(err) {
+		return exitStoreError
+	}
+	return exitFailed
+}
+
+// isStoreError returns whether err is from the chain stores missing a block or
+// the disk failing them.
+func isStoreError(err error) bool {
+	if xerrors.Is(err, blockstore.ErrNotFound) || xerrors.Is(err, datastore.ErrNotFound) {
+		return true
+	}
+	var errno syscall.Errno
+	if xerrors.As(err, &errno) {
+		switch errno {
+		case syscall.ENOSPC, syscall.EIO, syscall.EROFS, syscall.EDQUOT:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/export"
+	"github.com/filecoin-project/ent/lib"
+)
+
+// exportCmd has the export subcommands registered with registerSubcommand.
+var exportCmd = &cli.Command{
+	Name:        "export",
+	Description: "stream state tree data for offline analysis",
+}
+
+func formatFlag() cli.Flag {
+	return &cli.StringFlag{Name: "format", Usage: "output format, jsonl, csv or cbor", Value: "jsonl"}
+}
+
+func exportFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{Name: "workers", Usage: "actors decoded and encoded in parallel, default the number of CPUs"},
+		&cli.IntFlag{Name: "queue-size", Usage: "capacity of the queues between export stages", Value: 64},
+		&cli.BoolFlag{Name: "sorted", Usage: "write rows in actor ID, then sector or deal ID order so exports of two states can be diffed"},
+		&cli.StringFlag{Name: "out", Usage: "write to this file instead of stdout, checkpointing progress to <out>.checkpoint"},
+		&cli.BoolFlag{Name: "resume", Usage: "continue the interrupted export to --out from its checkpoint"},
+		&cli.StringFlag{Name: "shard-size", Usage: "split --out into files <out>.00000, <out>.00001... of about this size, e.g. 1GB, listed in <out>.manifest.json"},
+		&cli.StringFlag{Name: "since", Usage: "export only the rows of actors whose head changed since this previous state root, marked add, update or delete"},
+		epochFlag(),
+		headFlag(),
+		manifestFlag(),
+		&cli.StringFlag{Name: "resume-from", Usage: "export only the actors walked after this actor, e.g. the last complete actor of an interrupted export"},
+	}
+}
+
+// truncatedRow is the row ending the output of an export cancelled after actor
+// last, or before any actor if undefined: {"truncated":true,"lastActor":...} in
+// jsonl, a TRUNCATED,<last actor> record in csv and the cbor text TRUNCATED in
+// cbor, which no other row is.
+func truncatedRow(format string, last address.Address) []byte {
+	lastActor := ""
+	if last != address.Undef {
+		lastActor = last.String()
+	}
+	switch format {
+	case "csv":
+		return []byte(truncatedMarker + "," + lastActor + "\n")
+	case "cbor":
+		var row bytes.Buffer
+		_ = cbg.WriteMajorTypeHeader(&row, cbg.MajTextString, uint64(len(truncatedMarker)))
+		row.WriteString(truncatedMarker)
+		var prefix [binary.MaxVarintLen64]byte
+		return append(prefix[:binary.PutUvarint(prefix[:], uint64(row.Len()))], row.Bytes()...)
+	default:
+		b, _ := json.Marshal(struct {
+			Truncated bool   `json:"truncated"`
+			LastActor string `json:"lastActor"`
+		}{true, lastActor})
+		return append(b, '\n')
+	}
+}
+
+// exportProgressPeriod is the time between export progress lines
+const exportProgressPeriod = 30 * time.Second
+
+// runExport runs the export pipeline over the actors tree of state root to stdout
+// or --out, preceded by header if the format is csv, and reports throughput on
+// stderr.  Full exports ask for confirmation first, see confirmRun.
+func runExport(c *cli.Context, store cbornode.IpldStore, root cid.Cid, epoch abi.ChainEpoch, tree lib.ActorsTree, rows lib.ActorRows, format string, header []string) error {
+	newEncoder, err := export.NewEncoder(format)
+	if err != nil {
+		return err
+	}
+	// Incremental and resumed exports are not full runs
+	recordRun := func(blocks, bytes uint64) {}
+	if !c.IsSet("since") && !c.Bool("resume") && !c.IsSet("resume-from") {
+		if recordRun, err = confirmRun(c, store, c.Command.FullName(), root); err != nil {
+			return err
+		}
+	}
+	cfg := export.Config{
+		Workers:    c.Int("workers"),
+		QueueSize:  c.Int("queue-size"),
+		NewEncoder: newEncoder,
+		Sorted:     c.Bool("sorted"),
+	}
+	var headerBytes []byte
+	if format == "csv" {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		w.Flush()
+		headerBytes = buf.Bytes()
+	}
+	var stats export.Stats
+	var out interface {
+		io.Writer
+		Flush() error
+	}
+	prov := newProvenance(c, root, epoch)
+	var stdout *hashingWriter
+	var fo *fileOutput
+	if c.IsSet("out") {
+		if fo, err = openFileOutput(c, root, format, headerBytes); err != nil {
+			return err
+		}
+		defer fo.Close() // nolint:errcheck
+		cfg.ResumeAfter = fo.resumeAfter
+		cfg.ActorWritten = fo.actorWritten
+		cfg.Checkpoint = fo.checkpoint
+		out = fo
+	} else {
+		if c.Bool("resume") || c.IsSet("shard-size") {
+			return xerrors.Errorf("--resume and --shard-size need --out")
+		}
+		stdout = newHashingWriter(os.Stdout)
+		w := bufio.NewWriter(stdout)
+		if c.IsSet("resume-from") {
+			if cfg.ResumeAfter, err = address.NewFromString(c.String("resume-from")); err != nil {
+				return err
+			}
+		} else if _, err := w.Write(headerBytes); err != nil {
+			return err
+		}
+		out = w
+	}
+	// last is the last actor written to stdout, to resume a cancelled export from
+	var last address.Address
+	if fo == nil {
+		cfg.ActorWritten = func(addr address.Address) error {
+			last = addr
+			return nil
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(exportProgressPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprintf(os.Stderr, "exported %s\n", &stats)
+			case <-done:
+				return
+			}
+		}
+	}()
+	err = export.Run(c.Context, tree, cfg, rows, out, &stats)
+	_, exported, _ := stats.Get()
+	recordCount("rows", int(exported))
+	if c.IsSet("out") {
+		recordOutput("out", c.String("out"))
+	}
+	if err != nil {
+		if fo != nil {
+			// The checkpoint left next to --out marks it incomplete
+			return xerrors.Errorf("%w (rerun with --resume to continue)", err)
+		}
+		if !cancelled(c, err) {
+			return err
+		}
+		// Output ends after the last complete actor, mark it truncated there
+		if _, werr := out.Write(truncatedRow(format, last)); werr != nil {
+			return werr
+		}
+		if ferr := out.Flush(); ferr != nil {
+			return ferr
+		}
+		fmt.Fprintf(os.Stderr, "exported %s\n", &stats)
+		if last == address.Undef {
+			return err
+		}
+		return xerrors.Errorf("%w (rerun with --resume-from %s to continue)", err, last)
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %s\n", &stats)
+	if fo != nil {
+		if err := fo.finish(); err != nil {
+			return err
+		}
+	}
+	_, _, written := stats.Get()
+	recordRun(0, written)
+	if prov == nil {
+		return nil
+	}
+	_, prov.Rows, _ = stats.Get()
+	prov.Partial = c.Bool("resume") || c.IsSet("resume-from")
+	if fo != nil {
+		for _, path := range fo.files() {
+			if err := prov.addFile(path); err != nil {
+				return err
+			}
+		}
+	} else {
+		prov.Outputs = append(prov.Outputs, stdout.output("-"))
+	}
+	return prov.write()
+}
+
+// exportRoot returns the state root to export, the first arg, looked up by
+// --epoch in the index or that of the chain head with --head, and its epoch, -1
+// if not known.
+func exportRoot(c *cli.Context) (cid.Cid, abi.ChainEpoch, error) {
+	if c.IsSet("epoch") || c.Bool("head") {
+		root, epoch, _, err := stateArgs(c)
+		return root, epoch, err
+	}
+	if !c.Args().Present() {
+		return cid.Undef, 0, xerrors.Errorf("not enough args, need state root, --epoch or --head")
+	}
+	root, err := cid.Decode(c.Args().First())
+	return root, -1, err
+}
+
+// exportSince restricts an export of tree with rows to the rows that changed since
+// the state of --since, whose tree and rows load returns.
+func exportSince(c *cli.Context, store cbornode.IpldStore, tree lib.ActorsTree, rows lib.ActorRows, load func(*cli.Context, cbornode.IpldStore, cid.Cid) (lib.ActorsTree, lib.ActorRows, error)) (lib.ActorsTree, lib.ActorRows, error) {
+	since, err := cid.Decode(c.String("since"))
+	if err != nil {
+		return nil, nil, xerrors.Errorf("invalid --since root: %w", err)
+	}
+	prevTree, prevRows, err := load(c, store, since)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to load --since state: %w", err)
+	}
+	tree, rows = lib.ExportSince(tree, prevTree, rows, prevRows)
+	return tree, rows, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	address "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("export", &cli.Command{
+		Name:        "sample",
+		Description: "export the code, nonce, balance and state size of a deterministic sample of actors, with addresses optionally redacted, for sharing outside the team",
+		ArgsUsage:   "<state-root>",
+		Action:      runExportSampleCmd,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{Name: "format", Usage: "output format, jsonl or csv", Value: "jsonl"},
+			&cli.StringFlag{Name: "fraction", Usage: "fraction of actors exported, e.g. 0.01 or 1%", Value: "1%"},
+			&cli.BoolFlag{Name: "redact-addresses", Usage: "replace actor addresses by a keyed hash and round nonces and balances down to a power of ten"},
+			&cli.StringFlag{Name: "redact-key", Usage: "secret key of --redact-addresses hashes, so exports can be joined, random by default"},
+		}, exportFlags()...),
+	})
+}
+
+func runExportSampleCmd(c *cli.Context) error {
+	format := c.String("format")
+	if format == "cbor" {
+		return xerrors.Errorf("samples have no cbor encoding, use jsonl or csv")
+	}
+	if c.IsSet("redact-key") && !c.Bool("redact-addresses") {
+		return xerrors.Errorf("--redact-key needs --redact-addresses")
+	}
+	root, epoch, err := exportRoot(c)
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	load, err := sampleRows(c)
+	if err != nil {
+		return err
+	}
+	tree, rows, err := load(c, store, root)
+	if err != nil {
+		return err
+	}
+	header := lib.SampleHeader
+	if c.IsSet("since") {
+		if tree, rows, err = exportSince(c, store, tree, rows, load); err != nil {
+			return err
+		}
+		header = append([]string{"change"}, header...)
+	}
+	return runExport(c, store, root, epoch, tree, rows, format, header)
+}
+
+// sampleRows returns the loader of the actors tree and sample rows of a state.
+// States loaded by the same loader share its redaction key, so their rows match.
+func sampleRows(c *cli.Context) (func(*cli.Context, cbornode.IpldStore, cid.Cid) (lib.ActorsTree, lib.ActorRows, error), error) {
+	fraction, err := parseFraction(c.String("fraction"))
+	if err != nil {
+		return nil, err
+	}
+	var redactor *lib.AddressRedactor
+	if c.Bool("redact-addresses") {
+		if redactor, err = lib.NewAddressRedactor(c.String("redact-key")); err != nil {
+			return nil, err
+		}
+	}
+	return func(c *cli.Context, store cbornode.IpldStore, root cid.Cid) (lib.ActorsTree, lib.ActorRows, error) {
+		r, err := lib.NewStateReader(c.Context, store, root)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows := func(addr address.Address, a *lib.Actor, emit func(row interface{}) error) error {
+			if !lib.InSample(addr, fraction) {
+				return nil
+			}
+			blocks, size, err := lib.CountStateBlocks(c.Context, store, a.Head)
+			if err != nil {
+				return xerrors.Errorf("failed to walk state of %s: %w", addr, err)
+			}
+			row := &lib.SampleRow{
+				Actor:       addr.String(),
+				Code:        r.CodeName(a.Code),
+				Nonce:       a.CallSeqNum,
+				Balance:     a.Balance,
+				StateBlocks: blocks,
+				StateBytes:  size,
+			}
+			if redactor != nil {
+				row.Actor = redactor.Redact(addr)
+				row.Coarsen()
+			}
+			return emit(row)
+		}
+		return r.Tree, rows, nil
+	}, nil
+}
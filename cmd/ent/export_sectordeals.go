@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("export", &cli.Command{
+		Name:        "sector-deals",
+		Description: "export one row per sector and deal pair joining miner sectors with market deal proposals",
+		ArgsUsage:   "<state-root>",
+		Action:      runExportSectorDealsCmd,
+		Flags: append([]cli.Flag{
+			formatFlag(),
+		}, exportFlags()...),
+	})
+}
+
+func runExportSectorDealsCmd(c *cli.Context) error {
+	root, epoch, err := exportRoot(c)
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	tree, rows, err := sectorDealRows(c, store, root)
+	if err != nil {
+		return err
+	}
+	header := lib.SectorDealHeader
+	if c.IsSet("since") {
+		if tree, rows, err = exportSince(c, store, tree, rows, sectorDealRows); err != nil {
+			return err
+		}
+		header = append([]string{"change"}, header...)
+	}
+	return runExport(c, store, root, epoch, tree, rows, c.String("format"), header)
+}
+
+// sectorDealRows returns the actors tree of the state at root and the rows of its
+// sector deals export.
+func sectorDealRows(c *cli.Context, store cbornode.IpldStore, root cid.Cid) (lib.ActorsTree, lib.ActorRows, error) {
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	market, err := r.MarketState()
+	if err != nil {
+		return nil, nil, err
+	}
+	proposals, err := r.DealProposals(market)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Sectors are walked in sector number order, deals in the order the sector
+	// lists them unless sorted
+	sorted := c.Bool("sorted")
+	rows := func(addr address.Address, a *lib.Actor, emit func(row interface{}) error) error {
+		if r.CodeName(a.Code) != "storageminer" {
+			return nil
+		}
+		return r.ForEachMinerSector(a, func(s *lib.MinerSector) error {
+			dealIDs := s.DealIDs
+			if sorted {
+				dealIDs = append([]abi.DealID(nil), dealIDs...)
+				sort.Slice(dealIDs, func(i, j int) bool { return dealIDs[i] < dealIDs[j] })
+			}
+			for _, id := range dealIDs {
+				row := lib.SectorDealRow{
+					Miner:            addr,
+					Sector:           s.SectorNumber,
+					SectorActivation: s.Activation,
+					SectorExpiration: s.Expiration,
+					DealID:           id,
+				}
+				p, found, err := proposals.Get(id)
+				if err != nil {
+					return xerrors.Errorf("failed to load deal %d of miner %s sector %d: %w", id, addr, s.SectorNumber, err)
+				}
+				if found {
+					row.Found = true
+					row.PieceCID = &p.PieceCID
+					row.PieceSize = p.PieceSize
+					row.Verified = p.VerifiedDeal
+					row.Client = &p.Client
+					row.StartEpoch = p.StartEpoch
+					row.EndEpoch = p.EndEpoch
+				}
+				if err := emit(&row); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return r.Tree, rows, nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dustin/go-humanize"
+	address "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// exportShard is an output file of an export to --out.  Shards hold the output of
+// the actors walked from FirstActor to LastActor.
+type exportShard struct {
+	File       string
+	Bytes      int64
+	FirstActor address.Address
+	LastActor  address.Address
+}
+
+// exportCheckpoint records how far an export to a file got: the output of the
+// actors walked up to Actor is in Shards, the last of which may be partly written
+// and is truncated to its Bytes on resume.
+type exportCheckpoint struct {
+	Root      cid.Cid
+	Format    string
+	Sorted    bool
+	ShardSize int64
+	Actor     address.Address
+	Shards    []exportShard
+}
+
+// exportManifest lists the shards of a complete sharded export.
+type exportManifest struct {
+	Root   cid.Cid
+	Format string
+	Sorted bool
+	Shards []exportShard
+}
+
+func checkpointPath(out string) string {
+	return out + ".checkpoint"
+}
+
+func manifestPath(out string) string {
+	return out + ".manifest.json"
+}
+
+// replaceJSONFile replaces path with the json encoding of v so that an
+// interruption never leaves a partial file.
+func replaceJSONFile(path string, v interface{}) error {
+	tmp := path + ".tmp"
+	if err := writeJSONFile(tmp, v); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readExportCheckpoint(out string) (*exportCheckpoint, error) {
+	raw, err := ioutil.ReadFile(checkpointPath(out))
+	if os.IsNotExist(err) {
+		return nil, xerrors.Errorf("no checkpoint of an export to %s", out)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp exportCheckpoint
+	if err := json.Unmarshal(raw, &cp); err != nil {
+		return nil, xerrors.Errorf("corrupt checkpoint %s: %w", checkpointPath(out), err)
+	}
+	return &cp, nil
+}
+
+// fileOutput writes an export to --out, split into shards of about shardSize
+// bytes if shardSize is set.  Shards end only between actors and each starts with
+// the header, so every shard can be processed and retried on its own.
+type fileOutput struct {
+	path      string
+	root      cid.Cid
+	format    string
+	sorted    bool
+	shardSize int64
+	header    []byte
+
+	// resumeAfter is the last actor written before a resume
+	resumeAfter address.Address
+	// shards are the closed shards, cur the open one if any
+	shards []exportShard
+	cur    *exportShard
+	f      *os.File
+	w      *bufio.Writer
+	// full is set when the open shard reached shardSize and is closed before
+	// the next actor's output
+	full bool
+}
+
+// openFileOutput opens the output of an export to --out.  On --resume the output
+// continues from its checkpoint.
+func openFileOutput(c *cli.Context, root cid.Cid, format string, header []byte) (*fileOutput, error) {
+	o := &fileOutput{
+		path:   c.String("out"),
+		root:   root,
+		format: format,
+		sorted: c.Bool("sorted"),
+		header: header,
+	}
+	if c.IsSet("shard-size") {
+		size, err := humanize.ParseBytes(c.String("shard-size"))
+		if err != nil {
+			return nil, xerrors.Errorf("invalid shard size: %w", err)
+		}
+		if size == 0 {
+			return nil, xerrors.Errorf("shard size must be positive")
+		}
+		o.shardSize = int64(size)
+	}
+	if c.IsSet("resume-from") {
+		return nil, xerrors.Errorf("use --resume to resume an export to --out")
+	}
+	if !c.Bool("resume") {
+		return o, nil
+	}
+	cp, err := readExportCheckpoint(o.path)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Root != root || cp.Format != format {
+		return nil, xerrors.Errorf("checkpoint is of a %s export of %s, not a %s export of %s", cp.Format, cp.Root, format, root)
+	}
+	if cp.Sorted != o.sorted || cp.ShardSize != o.shardSize {
+		return nil, xerrors.Errorf("checkpoint is of an export with --sorted=%t and shard size %d", cp.Sorted, cp.ShardSize)
+	}
+	o.resumeAfter = cp.Actor
+	fmt.Fprintf(os.Stderr, "resuming after actor %s\n", cp.Actor)
+	if len(cp.Shards) == 0 {
+		return o, nil
+	}
+	o.shards = cp.Shards[:len(cp.Shards)-1]
+	cur := cp.Shards[len(cp.Shards)-1]
+	f, err := os.OpenFile(filepath.Join(filepath.Dir(o.path), cur.File), os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(cur.Bytes); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(cur.Bytes, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	o.f, o.w, o.cur = f, bufio.NewWriter(f), &cur
+	o.full = o.shardSize > 0 && cur.Bytes >= o.shardSize
+	return o, nil
+}
+
+func (o *fileOutput) shardPath(i int) string {
+	if o.shardSize == 0 {
+		return o.path
+	}
+	return fmt.Sprintf("%s.%05d", o.path, i)
+}
+
+// files returns the paths of the shards of a finished export.
+func (o *fileOutput) files() []string {
+	paths := make([]string, len(o.shards))
+	for i := range o.shards {
+		paths[i] = o.shardPath(i)
+	}
+	return paths
+}
+
+func (o *fileOutput) openShard() error {
+	path := o.shardPath(len(o.shards))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	o.f, o.w = f, bufio.NewWriter(f)
+	o.cur = &exportShard{File: filepath.Base(path)}
+	n, err := o.w.Write(o.header)
+	o.cur.Bytes = int64(n)
+	return err
+}
+
+func (o *fileOutput) closeShard() error {
+	if o.f == nil {
+		return nil
+	}
+	if err := o.w.Flush(); err != nil {
+		return err
+	}
+	if err := o.f.Sync(); err != nil {
+		return err
+	}
+	if err := o.f.Close(); err != nil {
+		return err
+	}
+	o.shards = append(o.shards, *o.cur)
+	o.f, o.w, o.cur, o.full = nil, nil, nil, false
+	return nil
+}
+
+func (o *fileOutput) Write(p []byte) (int, error) {
+	if o.full {
+		if err := o.closeShard(); err != nil {
+			return 0, err
+		}
+	}
+	if o.f == nil {
+		if err := o.openShard(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := o.w.Write(p)
+	o.cur.Bytes += int64(n)
+	return n, err
+}
+
+func (o *fileOutput) Flush() error {
+	if o.w == nil {
+		return nil
+	}
+	return o.w.Flush()
+}
+
+// actorWritten records that the output of addr has all been written.
+func (o *fileOutput) actorWritten(addr address.Address) error {
+	if o.cur == nil {
+		return nil
+	}
+	if o.cur.FirstActor == address.Undef {
+		o.cur.FirstActor = addr
+	}
+	o.cur.LastActor = addr
+	o.full = o.shardSize > 0 && o.cur.Bytes >= o.shardSize
+	return nil
+}
+
+// checkpoint records that the output of the actors walked up to last has all
+// been written.
+func (o *fileOutput) checkpoint(last address.Address) error {
+	if err := o.Flush(); err != nil {
+		return err
+	}
+	shards := append([]exportShard(nil), o.shards...)
+	if o.cur != nil {
+		shards = append(shards, *o.cur)
+	}
+	return replaceJSONFile(checkpointPath(o.path), &exportCheckpoint{
+		Root:      o.root,
+		Format:    o.format,
+		Sorted:    o.sorted,
+		ShardSize: o.shardSize,
+		Actor:     last,
+		Shards:    shards,
+	})
+}
+
+// finish closes the last shard of a complete export, writes the manifest of a
+// sharded export and removes the checkpoint, as there is nothing to resume.
+func (o *fileOutput) finish() error {
+	// An unsharded export always has an output file, if only with the header
+	if o.shardSize == 0 && o.f == nil && len(o.shards) == 0 {
+		if err := o.openShard(); err != nil {
+			return err
+		}
+	}
+	if err := o.closeShard(); err != nil {
+		return err
+	}
+	if o.shardSize > 0 {
+		err := replaceJSONFile(manifestPath(o.path), &exportManifest{
+			Root:   o.root,
+			Format: o.format,
+			Sorted: o.sorted,
+			Shards: o.shards,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "wrote %d shards listed in %s\n", len(o.shards), manifestPath(o.path))
+	}
+	if err := os.Remove(checkpointPath(o.path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Close closes the open shard of an incomplete export.
+func (o *fileOutput) Close() error {
+	if o.f == nil {
+		return nil
+	}
+	return o.f.Close()
+}
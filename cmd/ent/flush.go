@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+var flushCmd = &cli.Command{
+	Name:        "flush",
+	Description: "flush the output of a migration run with migrate --buffer-out into ent's store or another datastore, without migrating again",
+	ArgsUsage:   "<state-root>",
+	Action:      runFlushCmd,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "from-cache",
+			Usage:    "buffer directory written by migrate --buffer-out",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "to",
+			Usage: "badger datastore directory to flush into instead of ent's store, created if missing",
+		},
+	},
+}
+
+func runFlushCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	dir := c.String("from-cache")
+	info, err := lib.ReadBufferDirInfo(dir)
+	if err != nil {
+		return err
+	}
+	if root != info.StateRootOut && (info.StateRootOutWrapped == nil || root != *info.StateRootOutWrapped) {
+		return xerrors.Errorf("%s holds the migration of %s to %s, not %s", dir, info.StateRootIn, info.StateRootOut, root)
+	}
+
+	chn := entstore.Chain{}
+	var dst blockstore.Blockstore
+	if to := c.String("to"); to != "" {
+		var closeDst func() error
+		if dst, closeDst, err = lib.CreateDatastoreBlockstore(to); err != nil {
+			return err
+		}
+		defer closeDst() // nolint:errcheck
+	}
+	start := time.Now()
+	written, err := chn.FlushBufferDir(c.Context, dir, dst)
+	if err != nil {
+		return xerrors.Errorf("flush stopped after %d blocks: %w", written, err)
+	}
+	duration := time.Since(start)
+	if written != info.Blocks {
+		return xerrors.Errorf("flushed %d blocks but %s holds %d", written, dir, info.Blocks)
+	}
+	// The flushed state must be readable from the store it went to
+	var has bool
+	if dst != nil {
+		has, err = dst.Has(root)
+	} else {
+		has, err = chn.HasBlock(c.Context, root)
+	}
+	if err != nil {
+		return err
+	}
+	if !has {
+		return xerrors.Errorf("state root %s missing after flush", root)
+	}
+	fmt.Printf("%s flushed %d blocks in %v\n", root, written, duration)
+	recordOutput("stateRoot", root.String())
+	recordTiming("flush", duration)
+	recordCount("blocks", int(written))
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+func gcFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{Name: "gc-percent", Usage: "set the garbage collection target percentage like GOGC, negative disables collection"},
+		&cli.Float64Flag{Name: "ballast-gb", Usage: "allocate a ballast of this many GB that is never touched, raising the heap size the collector paces against"},
+	}
+}
+
+// applyGC applies the gc flags of c and returns a function printing the
+// collections and pause time since, with the settings in effect, so runs tuned
+// differently compare like for like.
+func applyGC(c *cli.Context) (func(), error) {
+	gcPercent := "GOGC=" + os.Getenv("GOGC")
+	if gcPercent == "GOGC=" {
+		gcPercent = "GOGC=100"
+	}
+	if c.IsSet("gc-percent") {
+		debug.SetGCPercent(c.Int("gc-percent"))
+		gcPercent = "gc-percent=" + strconv.Itoa(c.Int("gc-percent"))
+	}
+	ballastGB := c.Float64("ballast-gb")
+	if ballastGB < 0 {
+		return nil, xerrors.Errorf("--ballast-gb must not be negative")
+	}
+	// The ballast is never written so its pages are never resident, but it counts
+	// towards the heap the next collection is paced against
+	ballast := make([]byte, int64(ballastGB*(1<<30)))
+
+	var start runtime.MemStats
+	runtime.ReadMemStats(&start)
+	begin := time.Now()
+	return func() {
+		var end runtime.MemStats
+		runtime.ReadMemStats(&end)
+		runtime.KeepAlive(ballast)
+		pause := time.Duration(end.PauseTotalNs - start.PauseTotalNs)
+		fmt.Printf("gc: %d collections, %v total pause (%.2f%% of %v), %s, ballast %.1f GB, heap reserved %d MiB\n",
+			end.NumGC-start.NumGC, pause, 100*float64(pause)/float64(time.Since(begin)), time.Since(begin).Round(time.Second),
+			gcPercent, ballastGB, end.HeapSys>>20)
+	}, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+var indexCmd = &cli.Command{
+	Name:        "index",
+	Description: "maintain the local index of epochs to tipsets and state roots",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "build",
+			Description: "walk the chain back from a block and index the tipset, state root and actors version of every epoch",
+			ArgsUsage:   "<head-block>",
+			Action:      runIndexBuildCmd,
+		},
+		{
+			Name:        "import-chainwatch",
+			Description: "index the chain recorded in a lotus chainwatch Postgres database, for archives without headers in the chain store",
+			Action:      runIndexImportChainwatchCmd,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "dsn",
+					Usage:    "Postgres connection string of the chainwatch database, e.g. postgres://user@host/chainwatch",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "psql",
+					Usage: "psql client to run queries with",
+					Value: "psql",
+				},
+				&cli.Int64Flag{
+					Name:  "min-height",
+					Usage: "import blocks from this height on",
+				},
+			},
+		},
+		{
+			Name:        "sectors",
+			Description: "build a database of the deadline, partition and key fields of every sector of a state, for ent lookup sector",
+			ArgsUsage:   "<state-root>",
+			Action:      runIndexSectorsCmd,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "out",
+					Usage: "directory of the database, which must not exist",
+					Value: lib.EntSectorIndexPath,
+				},
+				epochFlag(),
+				headFlag(),
+			},
+		},
+		{
+			Name:        "lookup",
+			Description: "print the indexed tipset, state root and actors version of an epoch",
+			ArgsUsage:   "<epoch>",
+			Action:      runIndexLookupCmd,
+		},
+	},
+}
+
+// indexProgressPeriod is the number of epochs indexed between progress lines
+const indexProgressPeriod = 10000
+
+func runIndexBuildCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need head block")
+	}
+	head, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	ci, err := lib.OpenChainIndex()
+	if err != nil {
+		return err
+	}
+	defer ci.Close() // nolint:errcheck
+	chn := entstore.Chain{}
+	n, err := chn.BuildIndex(c.Context, ci, head, func(e *lib.IndexEntry) {
+		if e.Epoch%indexProgressPeriod == 0 {
+			fmt.Printf("indexed epoch %d\n", e.Epoch)
+		}
+	})
+	if err != nil {
+		return xerrors.Errorf("index build stopped after %d epochs: %w", n, err)
+	}
+	fmt.Printf("indexed %d epochs\n", n)
+	return nil
+}
+
+func runIndexImportChainwatchCmd(c *cli.Context) error {
+	ci, err := lib.OpenChainIndex()
+	if err != nil {
+		return err
+	}
+	defer ci.Close() // nolint:errcheck
+	chn := entstore.Chain{}
+	n, skipped, err := chn.ImportChainwatch(c.Context, ci, c.String("psql"), c.String("dsn"), c.Int64("min-height"), func(e *lib.IndexEntry) {
+		if e.Epoch%indexProgressPeriod == 0 {
+			fmt.Printf("indexed epoch %d\n", e.Epoch)
+		}
+	})
+	if err != nil {
+		return xerrors.Errorf("chainwatch import stopped after %d epochs: %w", n, err)
+	}
+	fmt.Printf("indexed %d epochs, skipped %d blocks of other forks\n", n, skipped)
+	return nil
+}
+
+func runIndexLookupCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need epoch")
+	}
+	epoch, err := strconv.ParseInt(c.Args().First(), 10, 64)
+	if err != nil {
+		return err
+	}
+	e, err := lookupEpoch(epoch)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("epoch:          %d\n", e.Epoch)
+	fmt.Printf("tipset:         %v\n", e.TipSetKey)
+	fmt.Printf("state root:     %s\n", e.StateRoot)
+	version := fmt.Sprintf("v%d", e.ActorsVersion)
+	if e.VersionExpected {
+		version += " (mainnet schedule, state not in store)"
+	}
+	fmt.Printf("actors version: %s\n", version)
+	return nil
+}
+
+func lookupEpoch(epoch int64) (*lib.IndexEntry, error) {
+	ci, err := lib.OpenChainIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer ci.Close() // nolint:errcheck
+	e, found, err := ci.Entry(epoch)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, xerrors.Errorf("epoch %d is not indexed, run ent index build", epoch)
+	}
+	return e, nil
+}
+
+func epochFlag() cli.Flag {
+	return &cli.Int64Flag{Name: "epoch", Usage: "look up the state root and height of this epoch in the index instead of passing them"}
+}
+
+func headFlag() cli.Flag {
+	return &cli.BoolFlag{Name: "head", Usage: "use the state of the chain head recorded in the lotus datastore instead of passing a state root and height"}
+}
+
+// headState returns the parent state root of the chain head lotus recorded and
+// the height of the parent tipset, as ent index and info roots pair them.
+func headState(c *cli.Context) (cid.Cid, abi.ChainEpoch, error) {
+	if c.IsSet("epoch") {
+		return cid.Undef, 0, xerrors.Errorf("pass one of --head and --epoch")
+	}
+	head, err := lib.ReadChainHead()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	chn := entstore.Chain{}
+	iter, err := chn.NewChainStateIterator(c.Context, head[0])
+	if err != nil {
+		return cid.Undef, 0, xerrors.Errorf("failed to load chain head: %w", err)
+	}
+	val := iter.Val()
+	_, _ = fmt.Fprintf(os.Stderr, "chain head %v: state %s at epoch %d\n", head, val.State, val.Height)
+	return val.State, abi.ChainEpoch(val.Height), nil
+}
+
+// stateArgs returns the state root and height given as the first two args, or
+// looked up by --epoch in the index, or those of the chain head with --head.  It
+// returns the number of args consumed.
+func stateArgs(c *cli.Context) (cid.Cid, abi.ChainEpoch, int, error) {
+	if c.Bool("head") {
+		root, height, err := headState(c)
+		return root, height, 0, err
+	}
+	if c.IsSet("epoch") {
+		e, err := lookupEpoch(c.Int64("epoch"))
+		if err != nil {
+			return cid.Undef, 0, 0, err
+		}
+		return e.StateRoot, abi.ChainEpoch(e.Epoch), 0, nil
+	}
+	if c.Args().Len() < 2 {
+		return cid.Undef, 0, 0, xerrors.Errorf("not enough args, need state root and height of state, --epoch or --head")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return cid.Undef, 0, 0, err
+	}
+	height, err := strconv.ParseInt(c.Args().Get(1), 10, 64)
+	if err != nil {
+		return cid.Undef, 0, 0, err
+	}
+	return root, abi.ChainEpoch(height), 2, nil
+}
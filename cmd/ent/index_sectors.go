@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+var lookupCmd = &cli.Command{
+	Name:        "lookup",
+	Description: "look up records in databases built by ent index",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "sector",
+			Description: "print the deadline, partition and key fields of a miner's sector from a database built by ent index sectors",
+			ArgsUsage:   "<miner-id> <sector-number>",
+			Action:      runLookupSectorCmd,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "index",
+					Usage: "directory of the database built by ent index sectors",
+					Value: lib.EntSectorIndexPath,
+				},
+			},
+		},
+	},
+}
+
+// sectorIndexProgressPeriod is the number of miners indexed between progress lines
+const sectorIndexProgressPeriod = 1000
+
+func runIndexSectorsCmd(c *cli.Context) error {
+	root, _, err := exportRoot(c)
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	si, err := lib.CreateSectorIndex(c.String("out"))
+	if err != nil {
+		return err
+	}
+	defer si.Close() // nolint:errcheck
+	miners, sectors, err := lib.BuildSectorIndex(c.Context, store, si, root, func(miners, sectors int) {
+		if miners%sectorIndexProgressPeriod == 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "indexed %d sectors of %d miners\n", sectors, miners)
+		}
+	})
+	if err != nil {
+		return xerrors.Errorf("sector index build stopped after %d miners: %w", miners, err)
+	}
+	fmt.Printf("indexed %d sectors of %d miners of state %s\n", sectors, miners, root)
+	return nil
+}
+
+func runLookupSectorCmd(c *cli.Context) error {
+	if c.Args().Len() < 2 {
+		return xerrors.Errorf("not enough args, need miner ID and sector number")
+	}
+	miner, err := address.NewFromString(c.Args().First())
+	if err != nil {
+		return err
+	}
+	if miner.Protocol() != address.ID {
+		return xerrors.Errorf("sectors are indexed by miner ID address, not %s", miner)
+	}
+	sector, err := strconv.ParseUint(c.Args().Get(1), 10, 64)
+	if err != nil {
+		return err
+	}
+	si, root, err := lib.OpenSectorIndex(c.String("index"))
+	if err != nil {
+		return err
+	}
+	defer si.Close() // nolint:errcheck
+	loc, found, err := si.Sector(miner, abi.SectorNumber(sector))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return xerrors.Errorf("%s sector %d is not in any partition of state %s", miner, sector, root)
+	}
+	fmt.Printf("state root:  %s\n", root)
+	fmt.Printf("miner:       %s\n", loc.Miner)
+	fmt.Printf("sector:      %d\n", loc.SectorNumber)
+	fmt.Printf("deadline:    %d\n", loc.Deadline)
+	fmt.Printf("partition:   %d\n", loc.Partition)
+	fmt.Printf("status:      %s\n", loc.Status)
+	fmt.Printf("seal proof:  %d\n", loc.SealProof)
+	fmt.Printf("sealed CID:  %s\n", loc.SealedCID)
+	fmt.Printf("deals:       %v\n", loc.DealIDs)
+	fmt.Printf("activation:  %d\n", loc.Activation)
+	fmt.Printf("expiration:  %d\n", loc.Expiration)
+	return nil
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+// infoCmd has the info subcommands registered with registerSubcommand.
+var infoCmd = &cli.Command{
+	Name:        "info",
+	Description: "report blockchain and state info on latest state version",
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "all",
+		Description: "compute several of the balances, debts, power and deals reports in a single parallel walk of a state",
+		ArgsUsage:   "<state-root>",
+		Action:      runInfoAllCmd,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "include",
+				Usage: "reports to compute, some of balances, debts, power and deals",
+				Value: cli.NewStringSlice(lib.AllStateReports...),
+			},
+			epochFlag(),
+			headFlag(),
+		},
+	})
+}
+
+func runInfoAllCmd(c *cli.Context) error {
+	root, _, err := exportRoot(c)
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	include := c.StringSlice("include")
+	labels, err := stateLabels(c, store, root)
+	if err != nil {
+		return err
+	}
+	reports, err := lib.ComputeStateReports(c.Context, store, root, include)
+	if err != nil && !cancelled(c, err) {
+		return err
+	}
+
+	addrs := make([]address.Address, 0, len(reports.Balances))
+	for addr := range reports.Balances {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].String() < addrs[j].String() })
+	for _, report := range include {
+		switch report {
+		case lib.ReportBalances:
+			// Miner address, locked balance, and available balance as info balances prints them
+			fmt.Printf("== balances\n")
+			for _, addr := range addrs {
+				bi := reports.Balances[addr]
+				fmt.Printf("%s,%v,%v\n", addr, bi.LockedFunds, bi.Available())
+			}
+		case lib.ReportDebts:
+			fmt.Printf("== debts\n")
+			totalDebt := big.Zero()
+			for _, addr := range addrs {
+				if debt := reports.Balances[addr].Debt(); debt.GreaterThan(big.Zero()) {
+					fmt.Printf("miner %s: %s\n", labels.Format(addr), debt)
+					totalDebt = big.Add(totalDebt, debt)
+				}
+			}
+			if reports.BurntFunds != nil {
+				fmt.Printf("burnt funds balance: %s\n", *reports.BurntFunds)
+			}
+			fmt.Printf("total debt:          %s\n", totalDebt)
+		case lib.ReportPower:
+			fmt.Printf("== power\n")
+			if p := reports.Power; p != nil {
+				fmt.Printf("Claims: %d\n", p.Claims)
+				fmt.Printf("Claimed raw byte power: %v\n", p.RawBytePower)
+				fmt.Printf("Claimed quality adjusted power: %v\n", p.QualityAdjPower)
+				fmt.Printf("Raw byte power: %v\n", p.TotalRawBytePower)
+				fmt.Printf("Quality adjusted power: %v\n", p.TotalQualityAdjPower)
+				fmt.Printf("Miners above consensus minimum: %d\n", p.MinerAboveMinPowerCount)
+			}
+		case lib.ReportDeals:
+			fmt.Printf("== deals\n")
+			if d := reports.Deals; d != nil {
+				fmt.Printf("Proposals: %d\n", d.Proposals)
+				fmt.Printf("Active deals: %d\n", d.Active)
+				fmt.Printf("Client locked collateral: %v\n", d.TotalClientLockedCollateral)
+				fmt.Printf("Provider locked collateral: %v\n", d.TotalProviderLockedCollateral)
+				fmt.Printf("Client storage fees: %v\n", d.TotalClientStorageFee)
+			}
+		}
+	}
+	return writeTruncated(c, os.Stdout, err)
+}
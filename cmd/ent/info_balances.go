@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "debts",
+		Description: "display all miner actors in debt and total burnt funds, as they are decoded",
+		ArgsUsage:   "<state-root>",
+		Action:      runDebtsCmd,
+		Flags:       []cli.Flag{sortedBalancesFlag()},
+	})
+	registerSubcommand("info", &cli.Command{
+		Name:        "balances",
+		Description: "display all miner actor locked funds and available balances, as they are decoded",
+		ArgsUsage:   "<state-root>",
+		Action:      runBalancesCmd,
+		Flags:       []cli.Flag{sortedBalancesFlag()},
+	})
+}
+
+func runDebtsCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	stateRootIn, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+
+	labels, err := stateLabels(c, store, stateRootIn)
+	if err != nil {
+		return err
+	}
+	// print miners in debt as they are found, skipping positive balances
+	totalDebt := big.Zero()
+	err = streamMinerBalances(c, store, stateRootIn, func(addr address.Address, bi lib.BalanceInfo) error {
+		if debt := bi.Debt(); debt.GreaterThan(big.Zero()) {
+			fmt.Printf("miner %s: %s\n", labels.Format(addr), debt)
+			totalDebt = big.Add(totalDebt, debt)
+		}
+		return nil
+	})
+	if cancelled(c, err) {
+		fmt.Printf("total debt so far:   %s\n", totalDebt)
+		return writeTruncated(c, os.Stdout, err)
+	}
+	if err != nil {
+		return err
+	}
+	bf, _, err := lib.LoadStateActor(c.Context, store, stateRootIn, builtin0.BurntFundsActorAddr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("burnt funds balance: %s\n", bf.Balance)
+	fmt.Printf("total debt:          %s\n", totalDebt)
+	return nil
+}
+
+func runBalancesCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	stateRootIn, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+
+	// Print miner address, locked balance, and available balance (balance - lb - pcd - ip)
+	err = streamMinerBalances(c, store, stateRootIn, func(addr address.Address, bi lib.BalanceInfo) error {
+		fmt.Printf("%s,%v,%v\n", addr, bi.LockedFunds, bi.Available())
+		return nil
+	})
+	return writeTruncated(c, os.Stdout, err)
+}
+
+func sortedBalancesFlag() cli.Flag {
+	return &cli.BoolFlag{Name: "sorted", Usage: "print miners in ID order once all are decoded instead of streaming them in no particular order"}
+}
+
+// streamMinerBalances calls fn with the balance info of every miner of the state
+// at root as soon as it is decoded, or with --sorted in miner ID order once all
+// are decoded, which holds them all in memory.  It returns the error of a
+// cancelled walk after passing on the miners decoded so far.
+func streamMinerBalances(c *cli.Context, store cbornode.IpldStore, root cid.Cid, fn func(addr address.Address, bi lib.BalanceInfo) error) error {
+	if !c.Bool("sorted") {
+		return lib.ForEachMinerBalance(c.Context, store, root, fn)
+	}
+	type minerBalance struct {
+		id   uint64
+		addr address.Address
+		bi   lib.BalanceInfo
+	}
+	var balances []minerBalance
+	err := lib.ForEachMinerBalance(c.Context, store, root, func(addr address.Address, bi lib.BalanceInfo) error {
+		id, err := address.IDFromAddress(addr)
+		if err != nil {
+			return err
+		}
+		balances = append(balances, minerBalance{id: id, addr: addr, bi: bi})
+		return nil
+	})
+	if err != nil && !cancelled(c, err) {
+		return err
+	}
+	// A cancelled walk still passes on the miners decoded so far
+	sort.Slice(balances, func(i, j int) bool { return balances[i].id < balances[j].id })
+	for _, b := range balances {
+		if err := fn(b.addr, b.bi); err != nil {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "basefee",
+		Description: "write a csv of epoch vs parent base fee walking back from a chain tip",
+		Action:      runBasefeeCmd,
+		Flags: []cli.Flag{
+			&cli.Int64Flag{
+				Name:  "epochs",
+				Usage: "number of epochs to walk back from the tip",
+				Value: 2880,
+			},
+		},
+	})
+}
+
+func runBasefeeCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need chain tip")
+	}
+	bcid, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	epochs := c.Int64("epochs")
+	chn := entstore.Chain{}
+	iter, err := chn.NewChainStateIterator(c.Context, bcid)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	if err := w.Write([]string{"epoch", "parent_base_fee"}); err != nil {
+		return err
+	}
+	// Null rounds have no headers and so no rows
+	stop := iter.Val().Height - epochs
+	var stepErr error
+	for val := iter.Val(); val.Height > stop; val = iter.Val() {
+		if err := w.Write([]string{strconv.FormatInt(val.Height, 10), val.BaseFee.String()}); err != nil {
+			return err
+		}
+		if iter.Done() {
+			break
+		}
+		if stepErr = iter.Step(c.Context); stepErr != nil {
+			break
+		}
+	}
+	if stepErr != nil && !cancelled(c, stepErr) {
+		return stepErr
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeTruncated(c, os.Stdout, stepErr)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	address "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "empty-actors",
+		Description: "count actors with zero balance, zero nonce and empty state by type, candidates for pruning by a state cleanup migration",
+		ArgsUsage:   "<state-root>",
+		Action:      runEmptyActorsCmd,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "list", Usage: "list the address of every candidate, by type in actor ID order"},
+		},
+	})
+}
+
+// emptyActorCounts counts the actors of a code and those of them which are
+// candidates for pruning.
+type emptyActorCounts struct {
+	actors     int
+	candidates []address.Address
+}
+
+func runEmptyActorsCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	info, err := lib.InspectRoot(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+
+	var lk sync.Mutex
+	byCode := make(map[string]*emptyActorCounts)
+	err = lib.ForEachActor(c.Context, store, root, info.ActorsVersion, func(v *lib.ActorVisit) error {
+		candidate := v.Actor.Balance.IsZero() && v.Actor.CallSeqNum == 0
+		if candidate {
+			empty, err := lib.EmptyActorState(c.Context, store, v.ActorsVersion, v.Code, v.Actor.Head)
+			if err != nil {
+				return xerrors.Errorf("failed to load %s state of %s: %w", v.Code, v.Addr, err)
+			}
+			candidate = empty
+		}
+		code := v.Code
+		if code == "" {
+			code = "unknown"
+		}
+		lk.Lock()
+		defer lk.Unlock()
+		counts, ok := byCode[code]
+		if !ok {
+			counts = &emptyActorCounts{}
+			byCode[code] = counts
+		}
+		counts.actors++
+		if candidate {
+			counts.candidates = append(counts.candidates, v.Addr)
+		}
+		return nil
+	})
+	// A cancelled walk still reports the actors counted so far
+	if err != nil && !cancelled(c, err) {
+		return err
+	}
+
+	codes := make([]string, 0, len(byCode))
+	var actors, candidates int
+	for code, counts := range byCode {
+		codes = append(codes, code)
+		actors += counts.actors
+		candidates += len(counts.candidates)
+	}
+	sort.Strings(codes)
+	fmt.Printf("State %s (actors v%d)\n", root, info.ActorsVersion)
+	fmt.Printf("Pruning candidates: %d of %d actors have zero balance, zero nonce and empty state\n", candidates, actors)
+	fmt.Printf("  %-16s %10s %10s\n", "type", "actors", "candidates")
+	for _, code := range codes {
+		counts := byCode[code]
+		fmt.Printf("  %-16s %10d %10d\n", code, counts.actors, len(counts.candidates))
+	}
+	if c.Bool("list") {
+		for _, code := range codes {
+			addrs := byCode[code].candidates
+			if len(addrs) == 0 {
+				continue
+			}
+			sort.Slice(addrs, func(i, j int) bool {
+				a, _ := address.IDFromAddress(addrs[i])
+				b, _ := address.IDFromAddress(addrs[j])
+				return a < b
+			})
+			fmt.Printf("%s:\n", code)
+			for _, addr := range addrs {
+				fmt.Printf("  %s\n", addr)
+			}
+		}
+	}
+	return writeTruncated(c, os.Stdout, err)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "manifest",
+		Description: "list the actors bundle manifest of a state and check all actor code is present",
+		Action:      runManifestCmd,
+	})
+}
+
+func runManifestCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	stateRootIn, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	info, err := lib.InspectRoot(c.Context, store, stateRootIn)
+	if err != nil {
+		return err
+	}
+	if info.ActorsVersion < int(V8) {
+		fmt.Printf("actors v%d predate actor bundles, no manifest\n", info.ActorsVersion)
+		return nil
+	}
+	manifest, err := lib.ManifestFromState(c.Context, store, int(V8), info.Actors)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("manifest data: %s\n", manifest.Data)
+	missing := 0
+	for _, e := range manifest.Entries {
+		has, err := chn.HasBlock(c.Context, e.Code)
+		if err != nil {
+			return err
+		}
+		status := "ok"
+		if !has {
+			status = "MISSING"
+			missing++
+		}
+		fmt.Printf("%-18s %s %s\n", e.Name, e.Code, status)
+	}
+	if missing > 0 {
+		return xerrors.Errorf("%d actor code CIDs missing from store", missing)
+	}
+	return nil
+}
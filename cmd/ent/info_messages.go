@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "messages",
+		Description: "list the BLS and secp messages of a tipset from the chain store",
+		ArgsUsage:   "<block-cid>...",
+		Action:      runMessagesCmd,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "child",
+				Usage: "list the messages of the parent tipset of this block, whose receipts info receipts shows",
+			},
+		},
+	})
+}
+
+func runMessagesCmd(c *cli.Context) error {
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	var blocks []cid.Cid
+	if child := c.String("child"); child != "" {
+		ccid, err := cid.Decode(child)
+		if err != nil {
+			return err
+		}
+		blk, err := chn.BlockHeader(c.Context, ccid)
+		if err != nil {
+			return err
+		}
+		blocks = blk.Parents
+	}
+	for _, arg := range c.Args().Slice() {
+		bcid, err := cid.Decode(arg)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, bcid)
+	}
+	if len(blocks) == 0 {
+		return xerrors.Errorf("not enough args, need the block cids of a tipset or --child")
+	}
+
+	// Messages included by several blocks of the tipset execute once, in the
+	// first block including them
+	seen := make(map[cid.Cid]struct{})
+	var count, dups int
+	fmt.Printf("%-6s %-5s %-12s %-12s %-8s %-6s %-26s %-10s %-12s %-10s %s\n",
+		"index", "type", "from", "to", "nonce", "method", "value", "gas limit", "gas fee cap", "premium", "cid")
+	for _, bcid := range blocks {
+		blk, err := chn.BlockHeader(c.Context, bcid)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("block %s by %s at epoch %d\n", bcid, blk.Miner, blk.Height)
+		err = lib.ForEachBlockMessage(c.Context, store, blk, func(bm *lib.BlockMessage) error {
+			if _, ok := seen[bm.Cid]; ok {
+				dups++
+				return nil
+			}
+			seen[bm.Cid] = struct{}{}
+			kind := "bls"
+			if bm.Secp {
+				kind = "secp"
+			}
+			m := bm.Message
+			fmt.Printf("%-6d %-5s %-12s %-12s %-8d %-6d %-26v %-10d %-12v %-10v %s\n",
+				count, kind, m.From, m.To, m.Nonce, m.Method, m.Value, m.GasLimit, m.GasFeeCap, m.GasPremium, bm.Cid)
+			count++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d messages in %d blocks, %d duplicates skipped\n", count, len(blocks), dups)
+	return nil
+}
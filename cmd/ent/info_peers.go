@@ -0,0 +1,87 @@
+package main
+
+import (
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "export-peers",
+		Description: "exports the peer ID and multiaddrs of every miner with power",
+		ArgsUsage:   "<state-root>",
+		Action:      runExportPeersCmd,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{Name: "format", Usage: "output format, jsonl or csv", Value: "jsonl"},
+		}, exportFlags()...),
+	})
+}
+
+func runExportPeersCmd(c *cli.Context) error {
+	format := c.String("format")
+	if format == "cbor" {
+		return xerrors.Errorf("peers have no cbor encoding, use jsonl or csv")
+	}
+	root, epoch, err := exportRoot(c)
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	tree, rows, err := peerRows(c, store, root)
+	if err != nil {
+		return err
+	}
+	header := lib.PeerHeader
+	if c.IsSet("since") {
+		if tree, rows, err = exportSince(c, store, tree, rows, peerRows); err != nil {
+			return err
+		}
+		header = append([]string{"change"}, header...)
+	}
+	return runExport(c, store, root, epoch, tree, rows, format, header)
+}
+
+// peerRows returns the actors tree of the state at root and the rows of its peers
+// export, one for each miner with a raw byte power claim.
+func peerRows(c *cli.Context, store cbornode.IpldStore, root cid.Cid) (lib.ActorsTree, lib.ActorRows, error) {
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	power, err := r.PowerState()
+	if err != nil {
+		return nil, nil, err
+	}
+	powered := make(map[address.Address]bool)
+	err = lib.ForEachPowerClaim(c.Context, store, r.ActorsVersion(), power.Claims, func(addr address.Address, raw, qa abi.StoragePower) error {
+		if raw.GreaterThan(abi.NewStoragePower(0)) {
+			powered[addr] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to load power claims: %w", err)
+	}
+	rows := func(addr address.Address, a *lib.Actor, emit func(row interface{}) error) error {
+		if !powered[addr] {
+			return nil
+		}
+		peer, err := r.MinerPeerInfo(a)
+		if err != nil {
+			return xerrors.Errorf("failed to load miner %s info: %w", addr, err)
+		}
+		return emit(lib.NewPeerRow(addr, peer))
+	}
+	return r.Tree, rows, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	market8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/market"
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "pending-deals",
+		Description: "list published deals never activated in a sector and past their start epoch, which cron should have removed, with the funds they still lock",
+		ArgsUsage:   "<state-root> <height>",
+		Action:      runPendingDealsCmd,
+		Flags: []cli.Flag{
+			epochFlag(),
+			headFlag(),
+		},
+	})
+}
+
+func runPendingDealsCmd(c *cli.Context) error {
+	root, height, _, err := stateArgs(c)
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	market, info, err := lib.LoadMarketState(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	labels, err := stateLabels(c, store, root)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pending deals past their start epoch at height %d (attoFIL)\n", height)
+	fmt.Printf("%10s %-24s %-24s %10s %10s %24s %24s\n", "deal", "client", "provider", "start", "overdue", "client collateral", "provider collateral")
+	var pending, overdue int
+	clientCollateral, providerCollateral, fees := big.Zero(), big.Zero(), big.Zero()
+	err = lib.ForEachDeal(c.Context, store, info.ActorsVersion, market, func(id abi.DealID, p *market8.DealProposal, s *market8.DealState) error {
+		if err := c.Context.Err(); err != nil {
+			return err
+		}
+		if s != nil {
+			return nil
+		}
+		pending++
+		if p.StartEpoch >= height {
+			return nil
+		}
+		overdue++
+		clientCollateral = big.Add(clientCollateral, p.ClientCollateral)
+		providerCollateral = big.Add(providerCollateral, p.ProviderCollateral)
+		fees = big.Add(fees, p.TotalStorageFee())
+		fmt.Printf("%10d %-24s %-24s %10d %10d %24v %24v\n", id, labels.Format(p.Client), labels.Format(p.Provider), p.StartEpoch, height-p.StartEpoch, p.ClientCollateral, p.ProviderCollateral)
+		return nil
+	})
+	// A cancelled walk still reports the deals found so far
+	if err != nil && !cancelled(c, err) {
+		return err
+	}
+	fmt.Printf("%d of %d pending deals are past their start epoch\n", overdue, pending)
+	fmt.Printf("Locked by them: %v client collateral, %v provider collateral, %v client storage fee\n", clientCollateral, providerCollateral, fees)
+	return writeTruncated(c, os.Stdout, err)
+}
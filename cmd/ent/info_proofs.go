@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "proof-types",
+		Description: "summarize sectors and power by seal proof type and list miners with sectors on deprecated proof types",
+		ArgsUsage:   "<state-root>",
+		Action:      runProofTypesCmd,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "deprecated",
+				Usage: "seal proof types to flag, by name as listed in the summary",
+				Value: cli.NewStringSlice("2KiBV1", "8MiBV1", "512MiBV1", "32GiBV1", "64GiBV1"),
+			},
+		},
+	})
+}
+
+// proofTotals counts the sectors of a seal proof type and their nominal power.
+type proofTotals struct {
+	sectors int
+	miners  int
+	raw     abi.StoragePower
+	qa      abi.StoragePower
+}
+
+func (t *proofTotals) add(s *lib.MinerSector) error {
+	size, err := s.SealProof.SectorSize()
+	if err != nil {
+		return err
+	}
+	t.sectors++
+	t.raw = big.Add(t.raw, abi.NewStoragePower(int64(size)))
+	t.qa = big.Add(t.qa, miner8.QAPowerForWeight(size, s.Expiration-s.Activation, s.DealWeight, s.VerifiedDealWeight))
+	return nil
+}
+
+func runProofTypesCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	deprecated := make(map[string]bool)
+	for _, p := range c.StringSlice("deprecated") {
+		deprecated[p] = true
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	labels, err := stateLabels(c, store, root)
+	if err != nil {
+		return err
+	}
+
+	type deprecatedMiner struct {
+		addr address.Address
+		proofTotals
+	}
+	byProof := make(map[abi.RegisteredSealProof]*proofTotals)
+	var flagged []deprecatedMiner
+	err = r.ForEachMiner(func(addr address.Address, a *lib.Actor) error {
+		if err := c.Context.Err(); err != nil {
+			return err
+		}
+		miner := make(map[abi.RegisteredSealProof]*proofTotals)
+		err := r.ForEachMinerSector(a, func(s *lib.MinerSector) error {
+			t, ok := miner[s.SealProof]
+			if !ok {
+				t = &proofTotals{raw: big.Zero(), qa: big.Zero()}
+				miner[s.SealProof] = t
+			}
+			return t.add(s)
+		})
+		if err != nil {
+			return xerrors.Errorf("failed to read sectors of miner %s: %w", addr, err)
+		}
+		old := deprecatedMiner{addr: addr, proofTotals: proofTotals{raw: big.Zero(), qa: big.Zero()}}
+		for p, t := range miner {
+			total, ok := byProof[p]
+			if !ok {
+				total = &proofTotals{raw: big.Zero(), qa: big.Zero()}
+				byProof[p] = total
+			}
+			total.sectors += t.sectors
+			total.miners++
+			total.raw = big.Add(total.raw, t.raw)
+			total.qa = big.Add(total.qa, t.qa)
+			if deprecated[sealProofName(p)] {
+				old.sectors += t.sectors
+				old.raw = big.Add(old.raw, t.raw)
+				old.qa = big.Add(old.qa, t.qa)
+			}
+		}
+		if old.sectors > 0 {
+			flagged = append(flagged, old)
+		}
+		return nil
+	})
+	// A cancelled walk still reports the miners counted so far
+	if err != nil && !cancelled(c, err) {
+		return err
+	}
+
+	fmt.Printf("State %s (actors v%d)\n", root, r.ActorsVersion())
+	fmt.Printf("By seal proof:\n")
+	proofs := make([]abi.RegisteredSealProof, 0, len(byProof))
+	for p := range byProof {
+		proofs = append(proofs, p)
+	}
+	sort.Slice(proofs, func(i, j int) bool { return proofs[i] < proofs[j] })
+	for _, p := range proofs {
+		t := byProof[p]
+		mark := ""
+		if deprecated[sealProofName(p)] {
+			mark = "  deprecated"
+		}
+		fmt.Printf("  %-12s %d sectors in %d miners, raw %s, QA %s%s\n", sealProofName(p), t.sectors, t.miners,
+			humanize.BigIBytes(t.raw.Int), humanize.BigIBytes(t.qa.Int), mark)
+	}
+
+	sort.Slice(flagged, func(i, j int) bool {
+		if flagged[i].sectors != flagged[j].sectors {
+			return flagged[i].sectors > flagged[j].sectors
+		}
+		return flagged[i].addr.String() < flagged[j].addr.String()
+	})
+	fmt.Printf("Miners with sectors on deprecated proof types: %d\n", len(flagged))
+	for _, m := range flagged {
+		fmt.Printf("  %-12s %d sectors, raw %s, QA %s\n", labels.Format(m.addr), m.sectors,
+			humanize.BigIBytes(m.raw.Int), humanize.BigIBytes(m.qa.Int))
+	}
+	return writeTruncated(c, os.Stdout, err)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "receipts",
+		Description: "decode the message receipts of the parent tipset of a block from the chain store",
+		ArgsUsage:   "<block-cid>",
+		Action:      runReceiptsCmd,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "full",
+				Usage: "print whole return values instead of their first bytes",
+			},
+		},
+	})
+}
+
+// maxReturnBytes is the number of bytes of message return values printed
+const maxReturnBytes = 32
+
+func runReceiptsCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need block cid")
+	}
+	bcid, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	blk, err := chn.BlockHeader(c.Context, bcid)
+	if err != nil {
+		return err
+	}
+	if len(blk.Parents) == 0 {
+		return xerrors.Errorf("block %s has no parents, is it genesis?", bcid)
+	}
+	parent, err := chn.BlockHeader(c.Context, blk.Parents[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Receipts of tipset %v at epoch %d, executed into state %s\n", blk.Parents, parent.Height, blk.ParentStateRoot)
+	fmt.Printf("%-6s %-10s %-12s %s\n", "index", "exit code", "gas used", "return")
+	var count, failed, gasUsed int64
+	err = lib.ForEachReceipt(c.Context, store, blk.ParentMessageReceipts, func(i int64, r *lib.MessageReceipt) error {
+		count++
+		gasUsed += r.GasUsed
+		if !r.ExitCode.IsSuccess() {
+			failed++
+		}
+		ret := r.Return
+		suffix := ""
+		if len(ret) > maxReturnBytes && !c.Bool("full") {
+			ret, suffix = ret[:maxReturnBytes], "..."
+		}
+		fmt.Printf("%-6d %-10d %-12d %x%s\n", i, r.ExitCode, r.GasUsed, ret, suffix)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d receipts, %d failed, %d gas used\n", count, failed, gasUsed)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "reserves",
+		Description: "display the balances and vesting status of the mining reserve and listed foundation and multisig actors",
+		ArgsUsage:   "<state-root> <height>",
+		Action:      runReservesCmd,
+		Flags: []cli.Flag{
+			epochFlag(),
+			headFlag(),
+			&cli.StringSliceFlag{
+				Name:  "address",
+				Usage: "report this actor too, may be repeated",
+			},
+			&cli.StringFlag{
+				Name:  "addresses-file",
+				Usage: "report the actors listed in this file, one address per line optionally followed by a label",
+			},
+			&cli.BoolFlag{
+				Name:  "all-vesting",
+				Usage: "report every multisig with a vesting schedule",
+			},
+		},
+	})
+}
+
+func runReservesCmd(c *cli.Context) error {
+	root, height, _, err := stateArgs(c)
+	if err != nil {
+		return err
+	}
+	addrs := []address.Address{lib.ReserveAddr}
+	labels := make(lib.AddressLabels)
+	for addr, label := range addressLabels {
+		labels[addr] = label
+	}
+	for _, s := range c.StringSlice("address") {
+		addr, err := address.NewFromString(s)
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, addr)
+	}
+	if path := c.String("addresses-file"); path != "" {
+		fileAddrs, fileLabels, err := lib.ReadAddressesFile(path)
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, fileAddrs...)
+		for addr, label := range fileLabels {
+			labels[addr] = label
+		}
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	reserves, err := lib.LoadReserveActors(c.Context, store, root, height, addrs, c.Bool("all-vesting"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Reserve actors of state %s at epoch %d\n", root, height)
+	totalBalance, totalLocked, totalVested := big.Zero(), big.Zero(), big.Zero()
+	for _, r := range reserves {
+		name := labels.Format(r.Addr)
+		if r.ID == address.Undef {
+			fmt.Printf("%s: no actor\n", name)
+			continue
+		}
+		if r.ID != r.Addr {
+			name += " " + r.ID.String()
+		}
+		totalBalance = big.Add(totalBalance, r.Balance)
+		fmt.Printf("%s: %s, balance %v\n", name, r.Code, r.Balance)
+		if r.ID == lib.ReserveAddr {
+			fmt.Printf("  disbursed since genesis: %v of %v\n", big.Sub(lib.InitialFilReserved, r.Balance), lib.InitialFilReserved)
+		}
+		if v := r.Vesting; v != nil {
+			totalLocked = big.Add(totalLocked, v.Locked)
+			totalVested = big.Add(totalVested, v.Vested)
+			elapsed := height - v.StartEpoch
+			if elapsed > v.UnlockDuration {
+				elapsed = v.UnlockDuration
+			}
+			if elapsed < 0 {
+				elapsed = 0
+			}
+			fmt.Printf("  vesting from epoch %d over %d epochs (%.1f%% elapsed): %v vested, %v locked of %v\n",
+				v.StartEpoch, v.UnlockDuration, 100*float64(elapsed)/float64(v.UnlockDuration), v.Vested, v.Locked, v.InitialBalance)
+		}
+	}
+	fmt.Printf("Total balance: %v\n", totalBalance)
+	fmt.Printf("Total vested: %v, locked: %v\n", totalVested, totalLocked)
+	return nil
+}
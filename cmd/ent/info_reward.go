@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	smoothing8 "github.com/filecoin-project/specs-actors/v8/actors/util/smoothing"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "reward",
+		Description: "display the reward actor's baseline, realized and smoothed reward state",
+		Action:      runRewardCmd,
+	})
+}
+
+func runRewardCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	st, info, err := lib.LoadRewardState(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reward actor state at %s (actors v%d)\n", root, info.ActorsVersion)
+	fmt.Printf("Epoch: %d\n", st.Epoch)
+	fmt.Printf("CumsumBaseline: %v\n", st.CumsumBaseline)
+	fmt.Printf("CumsumRealized: %v\n", st.CumsumRealized)
+	fmt.Printf("EffectiveNetworkTime: %d\n", st.EffectiveNetworkTime)
+	fmt.Printf("EffectiveBaselinePower: %v\n", st.EffectiveBaselinePower)
+	fmt.Printf("ThisEpochBaselinePower: %v\n", st.ThisEpochBaselinePower)
+	fmt.Printf("ThisEpochReward: %v\n", st.ThisEpochReward)
+	// Smoothed estimates are Q.128 fixed point, print the raw values and the estimate
+	fmt.Printf("ThisEpochRewardSmoothed: position %v, velocity %v, estimate %v\n",
+		st.ThisEpochRewardSmoothed.PositionEstimate, st.ThisEpochRewardSmoothed.VelocityEstimate,
+		smoothing8.Estimate(&st.ThisEpochRewardSmoothed))
+	if info.ActorsVersion < 2 {
+		fmt.Printf("TotalMined: %v\n", st.TotalStoragePowerReward)
+		return nil
+	}
+	fmt.Printf("TotalStoragePowerReward: %v\n", st.TotalStoragePowerReward)
+	fmt.Printf("SimpleTotal: %v\n", st.SimpleTotal)
+	fmt.Printf("BaselineTotal: %v\n", st.BaselineTotal)
+	return nil
+}
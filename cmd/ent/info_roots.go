@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "roots",
+		Description: "provide state tree root cids for migrating",
+		ArgsUsage:   "<chain-tip-block> <count> | --head <count>",
+		Action:      runRootsCmd,
+		Flags:       []cli.Flag{headFlag()},
+	})
+}
+
+// rootsProgressPeriod is the number of roots read between progress lines
+const rootsProgressPeriod = 10000
+
+func runRootsCmd(c *cli.Context) error {
+	var bcid cid.Cid
+	var numArg string
+	if c.Bool("head") {
+		if !c.Args().Present() {
+			return xerrors.Errorf("not enough args, need number of states to fetch")
+		}
+		head, err := lib.ReadChainHead()
+		if err != nil {
+			return err
+		}
+		bcid, numArg = head[0], c.Args().First()
+	} else {
+		if c.Args().Len() < 2 {
+			return xerrors.Errorf("not enough args, need chain tip and number of states to fetch, or --head")
+		}
+		var err error
+		if bcid, err = cid.Decode(c.Args().First()); err != nil {
+			return err
+		}
+		numArg = c.Args().Get(1)
+	}
+	num, err := strconv.Atoi(numArg)
+	if err != nil {
+		return err
+	}
+	// Read roots from the index from the first block of the walk it holds
+	ci, err := lib.OpenChainIndex()
+	if err != nil {
+		return err
+	}
+	defer ci.Close() // nolint:errcheck
+	out := bufio.NewWriter(os.Stdout)
+	chn := entstore.Chain{}
+	read := 0
+	_, err = chn.WalkChainRoots(c.Context, ci, bcid, num, func(val lib.IterVal) error {
+		if _, err := fmt.Fprintf(out, "Epoch %d: %s \n", val.Height, val.State); err != nil {
+			return err
+		}
+		if read++; read%rootsProgressPeriod == 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "read %d of %d roots, at epoch %d\n", read, num, val.Height)
+		}
+		return nil
+	})
+	if ferr := out.Flush(); err == nil {
+		err = ferr
+	}
+	return writeTruncated(c, os.Stdout, err)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "sector-stats",
+		Description: "display sector counts by seal proof type and the distribution of sectors per miner",
+		ArgsUsage:   "<state-root>",
+		Action:      runSectorStatsCmd,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "top",
+				Usage: "list this many miners with the most sectors",
+				Value: 10,
+			},
+		},
+	})
+	registerSubcommand("info", &cli.Command{
+		Name:        "export-sectors",
+		Description: "exports all on-chain sectors",
+		ArgsUsage:   "<state-root>",
+		Action:      runExportSectorsCmd,
+		Flags: append([]cli.Flag{
+			&cli.BoolFlag{Name: "schema", Usage: "print the JSON Schema of exported sectors and exit"},
+			&cli.StringFlag{Name: "format", Usage: "output format, jsonl or cbor", Value: "jsonl"},
+		}, exportFlags()...),
+	})
+}
+
+// sealProofName names a seal proof type by sector size and proof version.
+func sealProofName(p abi.RegisteredSealProof) string {
+	size, err := p.SectorSize()
+	if err != nil {
+		return fmt.Sprintf("unknown(%d)", p)
+	}
+	if p <= abi.RegisteredSealProof_StackedDrg64GiBV1 {
+		return size.ShortString() + "V1"
+	}
+	return size.ShortString() + "V1_1"
+}
+
+// percentile returns the nearest rank p-th percentile of sorted values.
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted)) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+func runSectorStatsCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+
+	labels, err := stateLabels(c, store, root)
+	if err != nil {
+		return err
+	}
+
+	type minerCount struct {
+		addr    address.Address
+		sectors int
+	}
+	byProof := make(map[abi.RegisteredSealProof]int)
+	var miners []minerCount
+	var total, emptyMiners int
+	err = r.ForEachMiner(func(addr address.Address, a *lib.Actor) error {
+		if err := c.Context.Err(); err != nil {
+			return err
+		}
+		n := 0
+		err := r.ForEachMinerSector(a, func(s *lib.MinerSector) error {
+			byProof[s.SealProof]++
+			n++
+			return nil
+		})
+		if err != nil {
+			return xerrors.Errorf("failed to read sectors of miner %s: %w", addr, err)
+		}
+		total += n
+		if n == 0 {
+			emptyMiners++
+			return nil
+		}
+		miners = append(miners, minerCount{addr: addr, sectors: n})
+		return nil
+	})
+	// A cancelled walk still reports the miners counted so far
+	if err != nil && !cancelled(c, err) {
+		return err
+	}
+
+	fmt.Printf("State %s (actors v%d)\n", root, r.ActorsVersion())
+	fmt.Printf("Sectors: %d in %d miners, %d miners without sectors\n", total, len(miners), emptyMiners)
+	fmt.Printf("By seal proof:\n")
+	proofs := make([]abi.RegisteredSealProof, 0, len(byProof))
+	for p := range byProof {
+		proofs = append(proofs, p)
+	}
+	sort.Slice(proofs, func(i, j int) bool { return proofs[i] < proofs[j] })
+	for _, p := range proofs {
+		fmt.Printf("  %-12s %d\n", sealProofName(p), byProof[p])
+	}
+
+	sort.Slice(miners, func(i, j int) bool { return miners[i].sectors > miners[j].sectors })
+	counts := make([]int, len(miners))
+	for i, m := range miners {
+		counts[len(miners)-1-i] = m.sectors
+	}
+	fmt.Printf("Sectors per miner with sectors:\n")
+	for _, p := range []float64{50, 90, 99} {
+		fmt.Printf("  p%-3.0f %d\n", p, percentile(counts, p))
+	}
+	fmt.Printf("  max  %d\n", percentile(counts, 100))
+	top := c.Int("top")
+	if top > len(miners) {
+		top = len(miners)
+	}
+	if top > 0 {
+		fmt.Printf("Largest miners:\n")
+		for _, m := range miners[:top] {
+			fmt.Printf("  %-12s %d (%.2f%%)\n", labels.Format(m.addr), m.sectors, 100*float64(m.sectors)/float64(total))
+		}
+	}
+	return writeTruncated(c, os.Stdout, err)
+}
+
+func runExportSectorsCmd(c *cli.Context) error {
+	if c.Bool("schema") {
+		schema, err := lib.SectorSchema()
+		if err != nil {
+			return err
+		}
+		out, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	format := c.String("format")
+	if format == "csv" {
+		return xerrors.Errorf("sectors have no csv encoding, use jsonl or cbor")
+	}
+	stateRootIn, epoch, err := exportRoot(c)
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	tree, rows, err := sectorRows(c, store, stateRootIn)
+	if err != nil {
+		return err
+	}
+	if c.IsSet("since") {
+		if tree, rows, err = exportSince(c, store, tree, rows, sectorRows); err != nil {
+			return err
+		}
+	}
+	return runExport(c, store, stateRootIn, epoch, tree, rows, format, nil)
+}
+
+// sectorRows returns the actors tree of the state at root and the rows of its
+// sectors export.
+func sectorRows(c *cli.Context, store cbornode.IpldStore, root cid.Cid) (lib.ActorsTree, lib.ActorRows, error) {
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.Tree, lib.SectorRows(c.Context, store, r.ActorsVersion(), r.CodeName), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "summary",
+		Description: "display headline numbers of a state: actor counts, balances, power, deals and faults",
+		ArgsUsage:   "<state-root> <height>",
+		Action:      runSummaryCmd,
+		Flags:       []cli.Flag{epochFlag(), headFlag()},
+	})
+}
+
+func runSummaryCmd(c *cli.Context) error {
+	root, height, _, err := stateArgs(c)
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	r, err := lib.NewStateReader(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	total := big.Zero()
+	var actors, faultySectors uint64
+	err = r.Tree.ForEach(func(addr address.Address, a *lib.Actor) error {
+		if err := c.Context.Err(); err != nil {
+			return err
+		}
+		actors++
+		counts[r.CodeName(a.Code)]++
+		total = big.Add(total, a.Balance)
+		if r.CodeName(a.Code) != "storageminer" {
+			return nil
+		}
+		return r.ForEachMinerPartition(a, func(_ uint64, _ int64, p *miner8.Partition) error {
+			n, err := p.Faults.Count()
+			faultySectors += n
+			return err
+		})
+	})
+	printCounts := func() {
+		fmt.Printf("Actors: %d\n", actors)
+		names := make([]string, 0, len(counts))
+		for n := range counts {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Printf("  %-18s %d\n", n, counts[n])
+		}
+		fmt.Printf("Total balance: %v\n", total)
+	}
+	if cancelled(c, err) {
+		// Only the walk's counts so far are known
+		fmt.Printf("State %s at epoch %d (actors v%d)\n", root, height, r.ActorsVersion())
+		printCounts()
+		fmt.Printf("Faulty sectors: %d\n", faultySectors)
+		return writeTruncated(c, os.Stdout, err)
+	}
+	if err != nil {
+		return err
+	}
+	supply, err := lib.EstimateCirculatingSupply(c.Context, store, root, abi.ChainEpoch(height))
+	if err != nil {
+		return err
+	}
+	power, _, err := lib.LoadPowerState(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	market, _, err := lib.LoadMarketState(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	activeDeals, err := lib.CountActiveDeals(c.Context, store, r.ActorsVersion(), market)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("State %s at epoch %d (actors v%d)\n", root, height, r.ActorsVersion())
+	printCounts()
+	fmt.Printf("Locked: %v\n", supply.Locked)
+	fmt.Printf("Burnt: %v\n", supply.Burnt)
+	fmt.Printf("Circulating (estimate): %v\n", supply.Circulating())
+	fmt.Printf("Raw byte power: %v\n", power.TotalRawBytePower)
+	fmt.Printf("Quality adjusted power: %v\n", power.TotalQualityAdjPower)
+	fmt.Printf("Miners above consensus minimum: %d of %d with claims\n", power.MinerAboveMinPowerCount, power.MinerCount)
+	fmt.Printf("Active deals: %d\n", activeDeals)
+	fmt.Printf("Faulty sectors: %d\n", faultySectors)
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "tree-params",
+		Description: "display the bitwidth, node count and depth of the actors HAMT and the major singleton actor structures against the expected parameters of the state's actors version",
+		ArgsUsage:   "<state-root>",
+		Action:      runTreeParamsCmd,
+	})
+}
+
+func runTreeParamsCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	params, info, err := lib.TreeParams(c.Context, store, root)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Structures of state %s (actors v%d):\n", root, info.ActorsVersion)
+	fmt.Printf("  %-26s %-9s %-10s %9s %6s %10s\n", "structure", "bitwidth", "expected", "nodes", "depth", "entries")
+	mismatched := 0
+	for _, p := range params {
+		bitwidth := strconv.Itoa(p.Bitwidth)
+		if p.BitwidthInferred {
+			bitwidth = ">=" + bitwidth
+		}
+		status := ""
+		if !p.Matches() {
+			status = "  MISMATCH"
+			mismatched++
+		}
+		fmt.Printf("  %-26s %-9s %-10d %9d %6d %10d%s\n", p.Name, bitwidth, p.Expected, p.Nodes, p.Depth, p.Entries, status)
+	}
+	if mismatched > 0 {
+		return xerrors.Errorf("%d structures do not have the expected bitwidth", mismatched)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "upgrade-inputs",
+		Description: "print the state root and epoch mainnet ran a network upgrade on, and the ent migrate command rehearsing it",
+		ArgsUsage:   "<head-block> --nv <version> | --head --nv <version>",
+		Action:      runUpgradeInputsCmd,
+		Flags: []cli.Flag{
+			&cli.IntFlag{Name: "nv", Usage: "network version of the upgrade", Required: true},
+			headFlag(),
+		},
+	})
+}
+
+func runUpgradeInputsCmd(c *cli.Context) error {
+	nv := c.Int("nv")
+	var upgrade *lib.Upgrade
+	priorActors := lib.GenesisActorsVersion
+	for i, u := range lib.MainnetNetworkUpgrades {
+		if u.NetworkVersion == nv {
+			upgrade = &lib.MainnetNetworkUpgrades[i]
+			break
+		}
+		priorActors = u.ActorsVersion
+	}
+	if upgrade == nil {
+		return xerrors.Errorf("no mainnet upgrade to nv%d", nv)
+	}
+	head, _, err := headBlockArg(c)
+	if err != nil {
+		return err
+	}
+
+	input, err := upgradeInput(c, head, upgrade.Height)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("nv%d %s upgrade at epoch %d\n", upgrade.NetworkVersion, upgrade.Name, upgrade.Height)
+	fmt.Printf("input state root: %s\n", input.State)
+	fmt.Printf("input epoch:      %d\n", upgrade.Height)
+	fmt.Printf("  the parent state of the block at epoch %d, computed at epoch %d\n", input.BlockHeight, input.Height)
+	if input.Height < int64(upgrade.Height) {
+		fmt.Printf("  epochs %d to %d were null rounds, lotus ran cron for them before the upgrade and ent migrate does not\n", input.Height+1, upgrade.Height)
+	}
+
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	if info, err := lib.InspectRoot(c.Context, store, input.State); err != nil {
+		fmt.Printf("  the state is not in the store: %s\n", err)
+	} else if info.ActorsVersion != priorActors {
+		fmt.Printf("  WARNING the state holds actors v%d, mainnet ran actors v%d before the upgrade\n", info.ActorsVersion, priorActors)
+	}
+	if upgrade.ActorsVersion == priorActors {
+		fmt.Printf("nv%d installs no new actors, ent has no migration for it\n", nv)
+		return nil
+	}
+	if _, ok := lookupMigration(ActorsVersion(upgrade.ActorsVersion)); !ok {
+		fmt.Printf("ent has no migration to actors v%d\n", upgrade.ActorsVersion)
+		return nil
+	}
+	fmt.Printf("ent migrate v%d %s %d\n", upgrade.ActorsVersion, input.State, upgrade.Height)
+	return nil
+}
+
+// upgradeInput returns the state an upgrade at height ran on: the parent state of
+// the first block above height.  It answers from the index where it holds height,
+// otherwise it walks back from the block head.
+func upgradeInput(c *cli.Context, head cid.Cid, height abi.ChainEpoch) (*lib.IterVal, error) {
+	ci, err := lib.OpenChainIndex()
+	if err != nil {
+		return nil, err
+	}
+	e, found, err := ci.EntryAtOrBefore(int64(height))
+	_ = ci.Close()
+	if err != nil {
+		return nil, err
+	}
+	if found && e.BlockHeight > int64(height) {
+		return &lib.IterVal{State: e.StateRoot, Height: e.Epoch, BlockHeight: e.BlockHeight, TipSetKey: e.TipSetKey}, nil
+	}
+
+	chn := entstore.Chain{}
+	iter, err := chn.NewChainStateIterator(c.Context, head)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load head: %w", err)
+	}
+	if val := iter.Val(); val.BlockHeight <= int64(height) {
+		return nil, xerrors.Errorf("head block at epoch %d is not past the upgrade at epoch %d", val.BlockHeight, height)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "epoch %d is not indexed, walking back from epoch %d\n", height, iter.Val().Height)
+	for {
+		val := iter.Val()
+		if val.Height <= int64(height) {
+			return &val, nil
+		}
+		if iter.Done() {
+			return nil, xerrors.Errorf("reached genesis before epoch %d", height)
+		}
+		if err := iter.Step(c.Context); err != nil {
+			return nil, xerrors.Errorf("failed to walk back from epoch %d: %w", val.Height, err)
+		}
+	}
+}
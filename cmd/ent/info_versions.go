@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func init() {
+	registerSubcommand("info", &cli.Command{
+		Name:        "versions",
+		Description: "walk back the chain from a block and report the epochs at which the actors and state tree versions of the state changed, with the mainnet upgrades at those epochs",
+		ArgsUsage:   "<head-block> | --head",
+		Action:      runVersionsCmd,
+		Flags: []cli.Flag{
+			&cli.Int64Flag{
+				Name:  "count",
+				Usage: "number of states to walk back, 0 to walk back to genesis",
+				Value: 2880,
+			},
+			headFlag(),
+		},
+	})
+}
+
+// stateVersion is the actors and state tree version of a state.
+type stateVersion struct {
+	actors  int
+	wrapped bool
+	tree    lib.StateTreeVersion
+}
+
+func (v stateVersion) String() string {
+	if !v.wrapped {
+		return fmt.Sprintf("actors v%d, bare actors tree", v.actors)
+	}
+	return fmt.Sprintf("actors v%d, state tree v%d", v.actors, v.tree)
+}
+
+// headBlockArg returns the block given as the first arg, or the first block of
+// the chain head lotus recorded with --head, and the number of args consumed.
+func headBlockArg(c *cli.Context) (cid.Cid, int, error) {
+	if c.Bool("head") {
+		head, err := lib.ReadChainHead()
+		if err != nil {
+			return cid.Undef, 0, err
+		}
+		return head[0], 0, nil
+	}
+	if !c.Args().Present() {
+		return cid.Undef, 0, xerrors.Errorf("not enough args, need head block or --head")
+	}
+	blk, err := cid.Decode(c.Args().First())
+	return blk, 1, err
+}
+
+func runVersionsCmd(c *cli.Context) error {
+	head, _, err := headBlockArg(c)
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+	iter, err := chn.NewChainStateIterator(c.Context, head)
+	if err != nil {
+		return xerrors.Errorf("failed to load head: %w", err)
+	}
+
+	// newer is the version of the last state found in the store, at epoch
+	// newerEpoch.  States missing from the store, as in snapshots holding only
+	// recent states, are skipped and widen the epochs of a change.
+	var newer *stateVersion
+	var newerEpoch, epoch int64
+	count := c.Int64("count")
+	walked, missing, changes := int64(0), 0, 0
+	for ; count == 0 || walked < count; walked++ {
+		val := iter.Val()
+		epoch = val.Height
+		info, err := lib.InspectRoot(c.Context, store, val.State)
+		if err != nil {
+			if c.Context.Err() != nil {
+				break
+			}
+			missing++
+		} else {
+			v := stateVersion{actors: info.ActorsVersion, wrapped: info.Wrapped, tree: info.Version}
+			if newer == nil {
+				fmt.Printf("State at epoch %d: %s\n", val.Height, v)
+			} else if v != *newer {
+				changes++
+				fmt.Printf("Epochs %d => %d: %s => %s%s\n", val.Height, newerEpoch, v, *newer, upgradeNote(abi.ChainEpoch(val.Height), abi.ChainEpoch(newerEpoch), newer.actors))
+			}
+			newer, newerEpoch = &v, val.Height
+		}
+		if iter.Done() {
+			walked++
+			break
+		}
+		if err := iter.Step(c.Context); err != nil {
+			if cancelled(c, err) {
+				break
+			}
+			return xerrors.Errorf("failed to walk back from epoch %d: %w", val.Height, err)
+		}
+	}
+	fmt.Printf("Walked %d states back to epoch %d, %d version changes", walked, epoch, changes)
+	if missing > 0 {
+		fmt.Printf(", %d states missing from the store", missing)
+	}
+	fmt.Println()
+	return c.Context.Err()
+}
+
+// upgradeNote names the mainnet upgrades run between the states at epochs from
+// and to, preferring the one installing actorsVersion.
+func upgradeNote(from, to abi.ChainEpoch, actorsVersion int) string {
+	upgrades := lib.MainnetUpgradesBetween(from, to)
+	if len(upgrades) == 0 {
+		return " (no mainnet upgrade at these epochs)"
+	}
+	u := upgrades[0]
+	for _, other := range upgrades {
+		if other.ActorsVersion == actorsVersion {
+			u = other
+		}
+	}
+	return fmt.Sprintf(" (nv%d %s upgrade at epoch %d)", u.NetworkVersion, u.Name, u.Height)
+}
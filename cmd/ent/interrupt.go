@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+)
+
+// truncatedMarker starts the line ending the text output of a command cancelled
+// before it finished, so partial output is never mistaken for complete output.
+const truncatedMarker = "TRUNCATED"
+
+// applyInterrupt cancels the context of all commands on the first SIGINT or
+// SIGTERM, so they write what they have computed so far, and exits on the second.
+func applyInterrupt(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(c.Context)
+	c.Context = ctx
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		_, _ = fmt.Fprintf(os.Stderr, "%s: cancelling, writing partial results; signal again to exit now\n", sig)
+		cancel()
+		<-sigs
+		os.Exit(exitInterrupted)
+	}()
+	return nil
+}
+
+// cancelled returns whether err is from the command being cancelled, by a signal
+// or --timeout, in which case it should still write the results computed so far
+// and end them with writeTruncated.
+func cancelled(c *cli.Context, err error) bool {
+	return err != nil && c.Context.Err() != nil
+}
+
+// writeTruncated ends partial text output of a command with the truncation
+// marker if it was cancelled, and returns err.
+func writeTruncated(c *cli.Context, w io.Writer, err error) error {
+	if cancelled(c, err) {
+		_, _ = fmt.Fprintf(w, "%s: %v\n", truncatedMarker, c.Context.Err())
+	}
+	return err
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/ent/lib"
+)
+
+// addressLabels are the built-in labels and those of ~/.ent/labels and --labels,
+// loaded before any command runs.
+var addressLabels = lib.BuiltinAddressLabels()
+
+// stateLabels returns the address labels of reports of the states at roots, with
+// labelled robust addresses resolved to the IDs of their actors.
+func stateLabels(c *cli.Context, store cbornode.IpldStore, roots ...cid.Cid) (lib.AddressLabels, error) {
+	labels := addressLabels
+	for _, root := range roots {
+		resolved, err := labels.ForState(c.Context, store, root)
+		if err != nil {
+			return nil, err
+		}
+		labels = resolved
+	}
+	return labels, nil
+}
@@ -2,208 +2,53 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
-	"runtime/pprof"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	address "github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
-	"github.com/filecoin-project/go-state-types/big"
-	adt0 "github.com/filecoin-project/specs-actors/actors/util/adt"
-	builtin2 "github.com/filecoin-project/specs-actors/v2/actors/builtin"
-	migration4 "github.com/filecoin-project/specs-actors/v2/actors/migration/nv4"
-	migration7 "github.com/filecoin-project/specs-actors/v2/actors/migration/nv7"
-	states2 "github.com/filecoin-project/specs-actors/v2/actors/states"
-	builtin3 "github.com/filecoin-project/specs-actors/v3/actors/builtin"
-	migration10 "github.com/filecoin-project/specs-actors/v3/actors/migration/nv10"
-	states3 "github.com/filecoin-project/specs-actors/v3/actors/states"
-	adt3 "github.com/filecoin-project/specs-actors/v3/actors/util/adt"
-	builtin4 "github.com/filecoin-project/specs-actors/v4/actors/builtin"
-	migration12 "github.com/filecoin-project/specs-actors/v4/actors/migration/nv12"
-	states4 "github.com/filecoin-project/specs-actors/v4/actors/states"
-	adt4 "github.com/filecoin-project/specs-actors/v4/actors/util/adt"
-	builtin5 "github.com/filecoin-project/specs-actors/v5/actors/builtin"
-	migration13 "github.com/filecoin-project/specs-actors/v5/actors/migration/nv13"
-	states5 "github.com/filecoin-project/specs-actors/v5/actors/states"
-	adt5 "github.com/filecoin-project/specs-actors/v5/actors/util/adt"
-	builtin6 "github.com/filecoin-project/specs-actors/v6/actors/builtin"
-	migration14 "github.com/filecoin-project/specs-actors/v6/actors/migration/nv14"
-	states6 "github.com/filecoin-project/specs-actors/v6/actors/states"
 
 	cid "github.com/ipfs/go-cid"
 	cbornode "github.com/ipfs/go-ipld-cbor"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/urfave/cli/v2"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
 )
 
 var migrateCmd = &cli.Command{
 	Name:        "migrate",
 	Description: "migrate a filecoin state root",
-	Subcommands: []*cli.Command{
-		{
-			Name:   "v6",
-			Usage:  "migrate a filecoin state tree from v5 to v6",
-			Action: runMigrateV5ToV6Cmd,
-			Flags: []cli.Flag{
-				&cli.BoolFlag{Name: "validate"},
-				&cli.StringFlag{Name: "read-cache"},
-				&cli.StringFlag{Name: "write-cache"},
-			},
-		},
-
-		{
-			Name:   "v5",
-			Usage:  "migrate a filecoin state tree from v4 to v5",
-			Action: runMigrateV4ToV5Cmd,
-			Flags: []cli.Flag{
-				&cli.BoolFlag{Name: "validate"},
-				&cli.StringFlag{Name: "read-cache"},
-				&cli.BoolFlag{Name: "write-cache"},
-			},
-		},
-
-		{
-			Name:   "v4",
-			Usage:  "migrate a filecoin state tree from v3 to v4",
-			Action: runMigrateV3ToV4Cmd,
-			Flags: []cli.Flag{
-				&cli.BoolFlag{Name: "validate"},
-				&cli.StringFlag{Name: "read-cache"},
-				&cli.BoolFlag{Name: "write-cache"},
-			},
-		},
-
-		{
-			Name:   "v3",
-			Usage:  "migrate a single state tree from v2 to v3",
-			Action: runMigrateV2ToV3Cmd,
-			Flags: []cli.Flag{
-				&cli.BoolFlag{Name: "validate"},
-				&cli.StringFlag{Name: "read-cache"},
-				&cli.BoolFlag{Name: "write-cache"},
-			},
-		},
-		{
-			Name:   "v2",
-			Usage:  "migrate a single state tree from v1 to v2",
-			Action: runMigrateV1ToV2Cmd,
-			Flags: []cli.Flag{
-				&cli.BoolFlag{Name: "validate"},
-			},
-		},
-	},
+	Subcommands: migrateSubcommands(),
 }
 
 var validateCmd = &cli.Command{
 	Name:        "validate",
-	Description: "validate a statetree by checking lots of invariants",
-	Subcommands: []*cli.Command{
-		{
-			Name:   "v6",
-			Usage:  "validate a v6 state tree",
-			Action: runValidateV6Cmd,
-			Flags: []cli.Flag{
-				&cli.BoolFlag{Name: "unwrapped"},
-			},
-		},
-		{
-			Name:   "v5",
-			Usage:  "validate a v5 state tree",
-			Action: runValidateV5Cmd,
-			Flags: []cli.Flag{
-				&cli.BoolFlag{Name: "unwrapped"},
-			},
-		},
-		{
-			Name:   "v4",
-			Usage:  "validate a v4 state tree",
-			Action: runValidateV4Cmd,
-			Flags: []cli.Flag{
-				&cli.BoolFlag{Name: "unwrapped"},
-			},
-		},
-		{
-			Name:   "v3",
-			Usage:  "validation a single v3 state tree",
-			Action: runValidateV3Cmd,
-			Flags: []cli.Flag{
-				&cli.BoolFlag{Name: "unwrapped"},
-			},
-		},
-		{
-			Name:   "v2",
-			Usage:  "validate a single v2 state tree",
-			Action: runValidateV2Cmd,
-			Flags: []cli.Flag{
-				&cli.BoolFlag{Name: "unwrapped"},
-			},
-		},
-	},
-}
-
-var infoCmd = &cli.Command{
-	Name:        "info",
-	Description: "report blockchain and state info on latest state version",
-	Subcommands: []*cli.Command{
-		{
-			Name:        "roots",
-			Description: "provide state tree root cids for migrating",
-			Action:      runRootsCmd,
-		},
-		{
-			Name:        "debts",
-			Description: "display all miner actors in debt and total burnt funds",
-			Action:      runDebtsCmd,
-		},
-		{
-			Name:        "balances",
-			Description: "display all miner actor locked funds and available balances",
-			Action:      runBalancesCmd,
-		},
-		{
-			Name:        "export-sectors",
-			Description: "exports all on-chain sectors",
-			Action:      runExportSectorsCmd,
-		},
-	},
-}
-
-type ActorsVersion int
-
-const (
-	V2 = iota + 2
-	V3
-	V4
-	V5
-	V6
-)
-
-var migrateFuncs = map[ActorsVersion]func(context.Context, cid.Cid, string, cbornode.IpldStore, abi.ChainEpoch, *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error){
-	V2: migrateV1ToV2,
-	V3: migrateV2ToV3,
-	V4: migrateV3ToV4,
-	V5: migrateV4ToV5,
-	V6: migrateV5ToV6,
-}
-
-var validateFuncs = map[ActorsVersion]func(context.Context, cbornode.IpldStore, abi.ChainEpoch, cid.Cid, bool) error{
-	V2: validateV2,
-	V3: validateV3,
-	V4: validateV4,
-	V5: validateV5,
-	V6: validateV6,
+	Description: "validate a statetree by checking lots of invariants, with the checks of its actors version unless a version subcommand overrides them",
+	ArgsUsage:   "<state-root> <height>",
+	Action:      func(c *cli.Context) error { return runValidateCmd(c, 0) },
+	Flags:       validateFlags(),
+	Subcommands: validateSubcommands(),
 }
 
 func main() {
+	addRegisteredSubcommands(infoCmd, checkCmd, exportCmd)
 	// pprof server
 	go func() {
 		log.Println(http.ListenAndServe("localhost:6060", nil))
@@ -215,655 +60,788 @@ func main() {
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:  "cpuprofile",
-				Usage: "run cpuprofile and write results to provided file path",
+				Usage: "write a CPU profile of the command to this file, labelled by phase for migrations and validations",
+			},
+			&cli.StringFlag{
+				Name:  "heap-snapshots",
+				Usage: "write a heap profile to this directory every --heap-interval while the command runs, and when it ends",
+			},
+			&cli.DurationFlag{
+				Name:  "heap-interval",
+				Usage: "interval between --heap-snapshots heap profiles",
+				Value: 10 * time.Minute,
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "cancel the command after this long, e.g. 6h. Migrations checkpoint their cache when --write-cache is set",
+			},
+			&cli.IntFlag{
+				Name:  "store-retries",
+				Usage: "retry failed reads of the lotus chain store this many times",
+			},
+			&cli.DurationFlag{
+				Name:  "store-retry-backoff",
+				Usage: "delay before the first store read retry, doubling for each further retry",
+				Value: entstore.DefaultRetryBackoff,
+			},
+			&cli.Float64Flag{
+				Name:  "buffer-max-gb",
+				Usage: "cap the in memory migration write buffer at this many GB, spilling least recently used blocks to a temporary on disk store",
+			},
+			&cli.Float64Flag{
+				Name:  "io-limit",
+				Usage: "cap writes to the ent chain store and export output at this many MB/s, leaving disk bandwidth to a co-located lotus node",
+			},
+			&cli.BoolFlag{
+				Name:  "background",
+				Usage: "yield to other work on the machine: scale concurrent store reads and export workers to the system load and pause flushes while it is high",
+			},
+			&cli.BoolFlag{
+				Name:  "compress",
+				Usage: "zstd compress blocks and migration caches written to ent's own stores",
+			},
+			&cli.StringFlag{
+				Name:  "otlp-endpoint",
+				Usage: "export tracing spans of command phases to this OTLP/HTTP endpoint, e.g. localhost:4318",
+			},
+			&cli.BoolFlag{
+				Name:  "otlp-insecure",
+				Usage: "use plain http for --otlp-endpoint",
+			},
+			&cli.StringFlag{
+				Name:  "stores",
+				Usage: "read chain blocks from the tiers of this json stores config in place of the lotus chain store, by default ~/.ent/stores.json if it exists",
+			},
+			&cli.IntFlag{
+				Name:  "prefetch",
+				Usage: "read the blocks linked from each block read from the lotus chain store ahead of tree walks with this many concurrent reads, for cold caches and spinning disks",
+			},
+			&cli.BoolFlag{
+				Name:  "access-stats",
+				Usage: "count reads of every block through the chain store and report the most read blocks and the reads served by each store on exit",
+			},
+			&cli.IntFlag{
+				Name:  "access-stats-top",
+				Usage: "list this many of the most read blocks with --access-stats",
+				Value: 20,
+			},
+			&cli.StringFlag{
+				Name:  "record-trace",
+				Usage: "record the sequence of block reads reaching the on disk chain stores to this file, for ent bench replay-trace",
+			},
+			&cli.BoolFlag{
+				Name:  "yes",
+				Usage: "run migrations and full exports of mainnet scale states without asking for confirmation",
+			},
+			&cli.StringFlag{
+				Name:  "result-file",
+				Usage: "write the status, outputs, timings and error counts of migrate, validate, check, export, snapshot, index, diff and flush runs to this json file when they end, \"\" for none",
+				Value: defaultResultPath,
+			},
+			&cli.StringFlag{
+				Name:  "labels",
+				Usage: "label the actors listed in this file in reports, one address per line followed by its label, on top of the built-in labels and ~/.ent/labels",
 			},
 		},
+		Before: func(c *cli.Context) error {
+			resultPath = c.String("result-file")
+			recordInvocation(c.App.Commands, c.Args().Slice())
+			lib.AccessStats = c.Bool("access-stats")
+			if err := startCPUProfile(c); err != nil {
+				return err
+			}
+			if err := startHeapSnapshots(c); err != nil {
+				return err
+			}
+			if path := c.String("record-trace"); path != "" {
+				trace, err := lib.CreateAccessTrace(path)
+				if err != nil {
+					return err
+				}
+				lib.AccessTrace = trace
+			}
+			stores, err := entstore.LoadStoresConfig(c.String("stores"))
+			if err != nil {
+				return err
+			}
+			var labelFiles []string
+			if c.IsSet("labels") {
+				labelFiles = append(labelFiles, c.String("labels"))
+			}
+			labels, err := lib.LoadAddressLabels(labelFiles...)
+			if err != nil {
+				return err
+			}
+			addressLabels = labels
+			if err := setupTracing(c); err != nil {
+				return err
+			}
+			if err := applyInterrupt(c); err != nil {
+				return err
+			}
+			if err := applyTimeout(c); err != nil {
+				return err
+			}
+			entstore.Configure(entstore.Options{
+				Retry: entstore.RetryConfig{
+					Attempts: c.Int("store-retries") + 1,
+					Backoff:  c.Duration("store-retry-backoff"),
+					// Store read retries give up once the command is cancelled
+					Context: c.Context,
+				},
+				BufferMaxBytes:  int64(c.Float64("buffer-max-gb") * (1 << 30)),
+				Compress:        c.Bool("compress"),
+				IOLimit:         int64(c.Float64("io-limit") * (1 << 20)),
+				Background:      c.Bool("background"),
+				PrefetchWorkers: c.Int("prefetch"),
+				Stores:          stores,
+			})
+			return nil
+		},
+		After: cleanupRun,
 		Commands: []*cli.Command{
 			migrateCmd,
 			validateCmd,
 			infoCmd,
+			checkCmd,
+			exportCmd,
+			snapshotCmd,
+			reproCmd,
+			benchCmd,
+			indexCmd,
+			lookupCmd,
+			flushCmd,
+			analyzeCmd,
+			diffCmd,
+			serveCmd,
 		},
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 	for _, c := range app.Commands {
 		sort.Sort(cli.FlagsByName(c.Flags))
 	}
+	recordResults(app.Commands)
 	err := app.Run(os.Args)
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-func runMigrateCmd(c *cli.Context, v ActorsVersion) error {
-	if c.Args().Len() != 2 {
-		return xerrors.Errorf("not enough args, need state root to migrate and height of state")
-	}
-
-	if c.Args().Len() != 2 {
-		return xerrors.Errorf("not enough args, need state root to migrate and height of state")
+	if rerr := writeResult(err); rerr != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to write result file: %s\n", rerr)
 	}
-	cleanUp, err := cpuProfile(c)
 	if err != nil {
-		return err
+		log.Print(err)
+		os.Exit(exitCode(err))
 	}
-	defer cleanUp()
-
-	log := lib.NewMigrationLogger(os.Stdout)
+}
 
-	stateRootInRaw, err := cid.Decode(c.Args().First())
+func runMigrateCmd(c *cli.Context, v ActorsVersion) (err error) {
+	stateRootInRaw, height, _, err := stateArgs(c)
 	if err != nil {
 		return err
 	}
-	hRaw, err := strconv.Atoi(c.Args().Get(1))
+	reportGC, err := applyGC(c)
 	if err != nil {
 		return err
 	}
-	height := abi.ChainEpoch(int64(hRaw))
-	chn := lib.Chain{}
+	defer reportGC()
+	ctx, span := tracer.Start(c.Context, "migrate", trace.WithAttributes(
+		attribute.Int("actorsVersion", int(v)),
+		attribute.String("stateRoot", stateRootInRaw.String()),
+		attribute.Int64("height", int64(height)),
+	))
+	defer func() { endSpan(span, err) }()
+	c.Context = ctx
+
+	var logOut io.Writer = os.Stdout
+	if c.Bool("tui") {
+		// Migration progress is shown by the dashboard instead
+		logOut = ioutil.Discard
+	}
+	log := lib.NewMigrationLogger(logOut)
+	notifier := lib.NewNotifier(c.String("notify-url"), c.Bool("notify-slack"))
+	log.NotifyProgress(notifier)
+	defer func() {
+		if err != nil {
+			notifier.Notify("failed", err.Error(), map[string]string{"state": stateRootInRaw.String()})
+		}
+	}()
+
+	chn := entstore.Chain{}
 
 	// Migrate State
 	store, err := chn.LoadCborStore(c.Context)
 	if err != nil {
 		return err
 	}
+	spec, ok := lookupMigration(v)
+	if !ok {
+		return fmt.Errorf("unsupported actors version %d for migration\n", v)
+	}
+	profilePhase(c.Context, "load")
+	_, loadSpan := tracer.Start(c.Context, "load")
 	stateRootIn, err := loadStateRoot(c.Context, store, stateRootInRaw)
 	if err != nil {
+		endSpan(loadSpan, err)
 		return err
 	}
-	m, ok := migrateFuncs[v]
-	if !ok {
-		return fmt.Errorf("unsupported actors version %d for migration\n", v)
+	// Sampled migrations are quick and not full runs
+	recordRun := func(blocks, bytes uint64) {}
+	if !c.IsSet("sample") && !c.IsSet("max-actors") {
+		if recordRun, err = confirmRun(c, store, fmt.Sprintf("migrate v%d", v), stateRootIn); err != nil {
+			endSpan(loadSpan, err)
+			return err
+		}
 	}
-	stateRootOut, duration, cacheWriteCB, err := m(c.Context, stateRootIn, c.String("read-cache"), store, height, log)
+	opts, err := loadMigrateOpts(c, &chn, spec)
+	endSpan(loadSpan, err)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("%s => %s -- %v\n", stateRootIn, stateRootOut, duration)
-
-	// Measure flush time
-	writeStart := time.Now()
-	if err := chn.FlushBufferedState(c.Context, stateRootOut); err != nil {
-		return xerrors.Errorf("failed to flush state tree to disk: %w\n", err)
+	vOpts, err := loadValidateOpts(c, height)
+	if err != nil {
+		return err
 	}
-	writeDuration := time.Since(writeStart)
-	fmt.Printf("%s buffer flush time: %v\n", stateRootOut, writeDuration)
-
-	if c.Bool("write-cache") {
-		if err := cacheWriteCB(); err != nil {
-			return err
+	progress := newMigrationProgress()
+	log.OnLog(progress.follow)
+	if c.Bool("tui") {
+		opts.ProgressLogPeriod = tuiRefresh
+		opts.CacheStats = &lib.CacheStats{}
+		dash := newDashboard(os.Stderr, &chn, opts.CacheStats, progress)
+		go dash.run(c.Context)
+		defer dash.Stop()
+	}
+	// abortCtx is the context of the migration, cancelled by --stall-abort
+	abortCtx := c.Context
+	var wd *watchdog
+	if timeout := c.Duration("stall-timeout"); timeout > 0 {
+		// Job progress is only seen in progress log lines
+		if period := timeout / 4; period < opts.ProgressLogPeriod {
+			opts.ProgressLogPeriod = period
+		}
+		wd = newWatchdog(timeout, progress)
+		if c.Bool("stall-abort") {
+			var cancel context.CancelFunc
+			abortCtx, cancel = context.WithCancel(abortCtx)
+			defer cancel()
+			wd.abortWith(cancel, func(err error) { abandonRun(c, err) })
 		}
+		if c.Bool("write-cache") {
+			opts.OnCheckpoint = func(checkpoint func() error) {
+				wd.setCheckpoint(cacheWriteLogged(stateRootIn, checkpoint))
+			}
+		}
+		go wd.run()
+		defer wd.Stop()
 	}
-
-	if c.Bool("validate") {
-		val, ok := validateFuncs[v]
-		if !ok {
-			return fmt.Errorf("unsupported actors version %d for validation\n", v)
+	if c.IsSet("sample") || c.IsSet("max-actors") {
+		if c.Bool("validate") {
+			return xerrors.Errorf("cannot validate a sampled migration, sampled trees break whole state invariants")
 		}
-
-		err := val(c.Context, store, height, stateRootOut, false)
-		if err != nil {
-			return err
+		if c.IsSet("buffer-out") {
+			return xerrors.Errorf("cannot write the buffer of a sampled migration, its output is never flushed")
+		}
+		if c.IsSet("expect-root") {
+			return xerrors.Errorf("cannot expect the root of a sampled migration, its output is a scratch tree")
 		}
+		return wd.migrationErr(runSampledMigration(abortCtx, c, v, spec.Migrate, opts, store, stateRootIn, height, log))
 	}
-	return nil
-}
-
-func runMigrateV5ToV6Cmd(c *cli.Context) error {
-	return runMigrateCmd(c, V6)
-}
-
-func runMigrateV4ToV5Cmd(c *cli.Context) error {
-	return runMigrateCmd(c, V5)
-}
-
-func runMigrateV3ToV4Cmd(c *cli.Context) error {
-	return runMigrateCmd(c, V4)
-}
-
-func runMigrateV2ToV3Cmd(c *cli.Context) error {
-	return runMigrateCmd(c, V3)
-}
-
-func runMigrateV1ToV2Cmd(c *cli.Context) error {
-	return runMigrateCmd(c, V2)
-}
-
-func runValidateCmd(c *cli.Context, v ActorsVersion) error {
-	if c.Args().Len() != 2 {
-		return xerrors.Errorf("wrong number of args, need state root to migrate and height")
+	expectRoot := cid.Undef
+	if c.IsSet("expect-root") {
+		if expectRoot, err = cid.Decode(c.String("expect-root")); err != nil {
+			return xerrors.Errorf("bad --expect-root: %w", err)
+		}
 	}
-	cleanUp, err := cpuProfile(c)
-	if err != nil {
+	notifier.Notify("started", fmt.Sprintf("migrating %s at epoch %d to actors v%d", stateRootIn, height, v), nil)
+	profilePhase(c.Context, "migrate")
+	migrateCtx, migrateSpan := tracer.Start(abortCtx, fmt.Sprintf("migrate.v%d", v))
+	stateRootOut, duration, cacheWriteCB, err := spec.Migrate(migrateCtx, stateRootIn, opts, store, height, log)
+	cacheWriteCB = cacheWriteLogged(stateRootIn, cacheWriteCB)
+	endSpan(migrateSpan, err)
+	if err != nil && wd.migrationErr(err) != err {
+		// The watchdog already checkpointed the cache if it could
+		return wd.migrationErr(err)
+	}
+	if err != nil {
+		if dir := c.String("repro-bundle"); dir != "" {
+			if rerr := writeReproBundle(c.Context, &chn, store, spec, stateRootIn, height, opts, err, dir); rerr != nil {
+				fmt.Printf("failed to write repro bundle: %s\n", rerr)
+			}
+		}
+		// Keep the work done so far when cut off by --timeout
+		if c.Context.Err() != nil && c.Bool("write-cache") && cacheWriteCB != nil {
+			fmt.Printf("migration interrupted, checkpointing migration cache\n")
+			if cerr := cacheWriteCB(); cerr != nil {
+				fmt.Printf("failed to checkpoint migration cache: %s\n", cerr)
+			} else {
+				return withExitCode(exitCheckpointed, err)
+			}
+		}
 		return err
 	}
-	defer cleanUp()
-
-	stateRoot, err := cid.Decode(c.Args().First())
-	if err != nil {
-		return err
+	fmt.Printf("%s => %s -- %v\n", stateRootIn, stateRootOut, duration)
+	recordOutput("stateRootIn", stateRootIn.String())
+	recordOutput("stateRootOut", stateRootOut.String())
+	recordTiming("migrate", duration)
+	notifier.Notify("migrated", fmt.Sprintf("%s => %s", stateRootIn, stateRootOut), map[string]string{
+		"stateRootIn":  stateRootIn.String(),
+		"stateRootOut": stateRootOut.String(),
+		"duration":     duration.String(),
+	})
+	if spec.Bundle {
+		manifest, err := lib.LoadManifest(c.Context, store, opts.Manifest)
+		if err != nil {
+			return err
+		}
+		if err := lib.VerifyStateManifest(c.Context, store, int(v), stateRootOut, manifest); err != nil {
+			return xerrors.Errorf("migrated state does not match bundle: %w", err)
+		}
+		fmt.Printf("%s matches bundle manifest %s\n", stateRootOut, opts.Manifest)
 	}
-	hRaw, err := strconv.Atoi(c.Args().Get(1))
-	if err != nil {
-		return err
+	wrappedOut := cid.Undef
+	if c.Bool("wrap-output") {
+		wrappedOut, err = lib.WrapStateRoot(c.Context, store, int(v), stateRootOut)
+		if err != nil {
+			return xerrors.Errorf("failed to wrap output state: %w", err)
+		}
+		fmt.Printf("%s wrapped => %s\n", stateRootOut, wrappedOut)
+		recordOutput("stateRootOutWrapped", wrappedOut.String())
+	}
+	if expectRoot.Defined() && expectRoot != stateRootOut && expectRoot != wrappedOut {
+		return withExitCode(exitRootMismatch, xerrors.Errorf("migrated state root %s is not the expected %s", stateRootOut, expectRoot))
+	}
+
+	// Validation only reads migrated state which is still in the in memory
+	// buffer, so it runs concurrently with flushing that buffer to disk.
+	grp, ctx := errgroup.WithContext(c.Context)
+	grp.Go(func() (err error) {
+		profilePhase(ctx, "flush")
+		ctx, span := tracer.Start(ctx, "flush")
+		defer func() { endSpan(span, err) }()
+		// Measure flush time
+		writeStart := time.Now()
+		if dir := c.String("buffer-out"); dir != "" {
+			// Flushed later, possibly elsewhere, with ent flush
+			info := lib.BufferDirInfo{
+				StateRootIn:   stateRootIn,
+				StateRootOut:  stateRootOut,
+				Height:        height,
+				ActorsVersion: int(v),
+			}
+			if wrappedOut.Defined() {
+				info.StateRootOutWrapped = &wrappedOut
+			}
+			if err := chn.WriteBufferDir(ctx, dir, info); err != nil {
+				return xerrors.Errorf("failed to write buffer to %s: %w", dir, err)
+			}
+			recordOutput("bufferOut", dir)
+		} else if err := chn.FlushBufferedState(ctx, stateRootOut); err != nil {
+			return xerrors.Errorf("failed to flush state tree to disk: %w\n", err)
+		}
+		writeDuration := time.Since(writeStart)
+		fmt.Printf("%s buffer flush time: %v\n", stateRootOut, writeDuration)
+		recordTiming("flush", writeDuration)
+		notifier.Notify("flushed", fmt.Sprintf("%s flushed in %v", stateRootOut, writeDuration), nil)
+		return nil
+	})
+	// Violations fail the run once the flush is done rather than cancel it
+	var validateErr error
+	if c.Bool("validate") {
+		grp.Go(func() error {
+			profilePhase(ctx, "validate")
+			err := spec.Validate(ctx, store, height, stateRootOut, vOpts)
+			if isValidationFailure(err) {
+				validateErr = err
+				return nil
+			}
+			return err
+		})
 	}
-	height := abi.ChainEpoch(int64(hRaw))
-	chn := lib.Chain{}
-	store, err := chn.LoadCborStore(c.Context)
-	if err != nil {
+	var summary *lib.MigrationSummary
+	if c.Bool("summary") {
+		grp.Go(func() (err error) {
+			profilePhase(ctx, "summary")
+			summary, err = chn.SummarizeMigration(ctx, stateRootIn, stateRootOut)
+			return err
+		})
+	}
+	if err := grp.Wait(); err != nil {
 		return err
 	}
-	wrapped := true
-	if c.Bool("unwrapped") {
-		wrapped = false
+	if summary != nil {
+		printMigrationSummary(summary)
 	}
-	val, ok := validateFuncs[v]
-	if !ok {
-		return fmt.Errorf("unsupported actors version %d for validation\n", v)
-	}
-	return val(c.Context, store, height, stateRoot, wrapped)
-}
 
-func runValidateV6Cmd(c *cli.Context) error {
-	return runValidateCmd(c, V6)
-}
-
-func runValidateV5Cmd(c *cli.Context) error {
-	return runValidateCmd(c, V5)
-}
-
-func runValidateV4Cmd(c *cli.Context) error {
-	return runValidateCmd(c, V4)
-}
-
-func runValidateV3Cmd(c *cli.Context) error {
-	return runValidateCmd(c, V3)
-}
-
-func runValidateV2Cmd(c *cli.Context) error {
-	return runValidateCmd(c, V2)
+	if c.Bool("write-cache") {
+		if err := cacheWriteCB(); err != nil {
+			return err
+		}
+	}
+	if buffered, _, err := chn.BufferStats(c.Context); err == nil {
+		recordRun(buffered, 0)
+	}
+	notifier.Notify("done", fmt.Sprintf("%s => %s", stateRootIn, stateRootOut), nil)
+	return validateErr
 }
 
-func runRootsCmd(c *cli.Context) error {
-	if c.Args().Len() < 2 {
-		return xerrors.Errorf("not enough args, need chain tip and number of states to fetch")
+// runSampledMigration migrates a scratch tree holding a deterministic sample of the
+// input actors plus the singletons.  The scratch output is never flushed to disk.
+func runSampledMigration(ctx context.Context, c *cli.Context, v ActorsVersion, m migrateFunc, opts migrateOpts, store cbornode.IpldStore, stateRootIn cid.Cid, height abi.ChainEpoch, log *lib.MigrationLogger) error {
+	profilePhase(c.Context, "migrate")
+	fraction := 1.0
+	if c.IsSet("sample") {
+		var err error
+		fraction, err = parseFraction(c.String("sample"))
+		if err != nil {
+			return err
+		}
 	}
-
-	bcid, err := cid.Decode(c.Args().First())
-	if err != nil {
-		return err
+	maxActors := c.Int("max-actors")
+	singletons := make(map[address.Address]struct{})
+	for _, a := range lib.SingletonActorAddrs {
+		singletons[a] = struct{}{}
 	}
-	num, err := strconv.Atoi(c.Args().Get(1))
+	sampled := 0
+	sampleRoot, kept, err := lib.SubsetActorsTree(c.Context, store, int(v)-1, stateRootIn, func(a address.Address, _ *lib.Actor) bool {
+		if _, ok := singletons[a]; ok {
+			return true
+		}
+		if maxActors > 0 && sampled >= maxActors {
+			return false
+		}
+		if !lib.InSample(a, fraction) {
+			return false
+		}
+		sampled++
+		return true
+	})
 	if err != nil {
 		return err
 	}
-	// Read roots and epoch of creation from lotus datastore
-	roots := make([]lib.IterVal, num)
-	chn := lib.Chain{}
-	iter, err := chn.NewChainStateIterator(c.Context, bcid)
+	fmt.Printf("sampled %d actors (%d with singletons) from %s into scratch tree %s\n", sampled, kept, stateRootIn, sampleRoot)
+
+	sampleRootOut, duration, _, err := m(ctx, sampleRoot, opts, store, height, log)
 	if err != nil {
 		return err
 	}
-	for i := 0; !iter.Done() && i < num; i++ {
-		roots[i] = iter.Val()
-		if err := iter.Step(c.Context); err != nil {
-			return err
-		}
-	}
-	// Output roots
-	for _, val := range roots {
-		fmt.Printf("Epoch %d: %s \n", val.Height, val.State)
-	}
+	fmt.Printf("%s => %s -- %v\n", sampleRoot, sampleRootOut, duration)
 	return nil
 }
 
-func runDebtsCmd(c *cli.Context) error {
-	if !c.Args().Present() {
-		return xerrors.Errorf("not enough args, need state root")
-	}
-	stateRootIn, err := cid.Decode(c.Args().First())
+// runMigrateActorCmd migrates a tree containing only the requested actor and the
+// singleton actors and reports the requested actor's migrated state.
+func runMigrateActorCmd(c *cli.Context) error {
+	stateRootInRaw, height, nArgs, err := stateArgs(c)
 	if err != nil {
 		return err
 	}
-	chn := lib.Chain{}
-	store, err := chn.LoadCborStore(c.Context)
-	if err != nil {
-		return err
+	if c.Args().Len() != nArgs+1 {
+		return xerrors.Errorf("wrong number of args, need state root to migrate, height of state and actor address")
 	}
 
-	bf, err := migration4.InputTreeBurntFunds(c.Context, store, stateRootIn)
+	log := lib.NewMigrationLogger(os.Stdout)
+
+	addr, err := address.NewFromString(c.Args().Get(nArgs))
 	if err != nil {
 		return err
 	}
-
-	available, err := migration4.InputTreeMinerAvailableBalance(c.Context, store, stateRootIn)
+	v := ActorsVersion(c.Int("version"))
+	spec, ok := lookupMigration(v)
+	if !ok {
+		return fmt.Errorf("unsupported actors version %d for migration\n", v)
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
 	if err != nil {
 		return err
 	}
-	// filter out positive balances
-	totalDebt := big.Zero()
-	for addr, balance := range available {
-		if balance.LessThan(big.Zero()) {
-			debt := balance.Neg()
-			fmt.Printf("miner %s: %s\n", addr, debt)
-			totalDebt = big.Add(totalDebt, debt)
-		}
-	}
-	fmt.Printf("burnt funds balance: %s\n", bf)
-	fmt.Printf("total debt:          %s\n", totalDebt)
-	return nil
-}
-
-func runBalancesCmd(c *cli.Context) error {
-	if !c.Args().Present() {
-		return xerrors.Errorf("not enough args, need state root")
+	opts, err := loadMigrateOpts(c, &chn, spec)
+	if err != nil {
+		return err
 	}
-	stateRootIn, err := cid.Decode(c.Args().First())
+	stateRootIn, err := loadStateRoot(c.Context, store, stateRootInRaw)
 	if err != nil {
 		return err
 	}
-	chn := lib.Chain{}
-	store, err := chn.LoadCborStore(c.Context)
+	treeIn, err := lib.LoadActorsTree(c.Context, store, int(v)-1, stateRootIn)
 	if err != nil {
 		return err
 	}
-
-	balances, err := lib.V0TreeMinerBalances(c.Context, store, stateRootIn)
+	actorIn, found, err := treeIn.GetActor(addr)
 	if err != nil {
 		return err
 	}
-	// Print miner address, locked balance, and available balance (balance - lb - pcd - ip)
-	for addr, bi := range balances {
-		minerLiabilities := big.Sum(bi.LockedFunds, bi.PreCommitDeposits, bi.InitialPledge)
-		availableBalance := big.Sub(bi.Balance, minerLiabilities)
-		fmt.Printf("%s,%v,%v\n", addr, bi.LockedFunds, availableBalance)
+	if !found {
+		return xerrors.Errorf("actor %s not found in state %s", addr, stateRootIn)
 	}
-	return nil
-}
 
-func runExportSectorsCmd(c *cli.Context) error {
-	if !c.Args().Present() {
-		return xerrors.Errorf("not enough args, need state root")
-	}
-	stateRootIn, err := cid.Decode(c.Args().First())
+	subsetRoot, err := actorSubsetTree(c.Context, store, v, stateRootIn, addr)
 	if err != nil {
 		return err
 	}
-	chn := lib.Chain{}
-	store, err := chn.LoadCborStore(c.Context)
+	subsetRootOut, duration, _, err := spec.Migrate(c.Context, subsetRoot, opts, store, height, log)
 	if err != nil {
 		return err
 	}
-
-	tree, err := loadStateTreeV2(c.Context, store, stateRootIn)
+	treeOut, err := lib.LoadActorsTree(c.Context, store, int(v), subsetRootOut)
 	if err != nil {
 		return err
 	}
-
-	sectors, err := lib.ExportSectors(c.Context, adt0.WrapStore(c.Context, store), tree)
+	actorOut, found, err := treeOut.GetActor(addr)
 	if err != nil {
 		return err
 	}
+	if !found {
+		return xerrors.Errorf("actor %s missing from migrated state %s", addr, subsetRootOut)
+	}
+	fmt.Printf("%s: %s => %s -- %v\n", addr, actorIn.Head, actorOut.Head, duration)
 
-	// Print JSON representation of sector infos, one per line.
-	keepGoing := true
-	for keepGoing {
-		sinfo, ok := <-sectors
-		j, err := json.Marshal(sinfo)
-		if err != nil {
+	if c.Bool("dump") {
+		var raw cbg.Deferred
+		if err := store.Get(c.Context, actorOut.Head, &raw); err != nil {
 			return err
 		}
-		if _, err = os.Stdout.Write(j); err != nil {
+		nd, err := cbornode.Decode(raw.Raw, mh.SHA2_256, -1)
+		if err != nil {
 			return err
 		}
-		if _, err = os.Stdout.Write([]byte{'\n'}); err != nil {
+		j, err := nd.MarshalJSON()
+		if err != nil {
 			return err
 		}
-		keepGoing = ok
+		fmt.Printf("%s\n", j)
 	}
 	return nil
 }
 
-/*
-	Versioned migration and validation functions
-*/
-
-func migrateV1ToV2(ctx context.Context, stateRootIn cid.Cid, cacheRootStr string, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
-	start := time.Now()
-	stateRootOut, err := migration7.MigrateStateTree(ctx, store, stateRootIn, height, migration7.DefaultConfig())
-	duration := time.Since(start)
-	cacheWriteCallback := func() error { return nil }
-	return stateRootOut, duration, cacheWriteCallback, err
+// actorSubsetTree writes a tree of just the actor at addr and the singletons its
+// migration to actors version v may read.
+func actorSubsetTree(ctx context.Context, store cbornode.IpldStore, v ActorsVersion, stateRootIn cid.Cid, addr address.Address) (cid.Cid, error) {
+	keep := map[address.Address]struct{}{addr: {}}
+	for _, a := range lib.SingletonActorAddrs {
+		keep[a] = struct{}{}
+	}
+	subsetRoot, _, err := lib.SubsetActorsTree(ctx, store, int(v)-1, stateRootIn, func(a address.Address, _ *lib.Actor) bool {
+		_, ok := keep[a]
+		return ok
+	})
+	return subsetRoot, err
 }
 
-func migrateV2ToV3(ctx context.Context, stateRootIn cid.Cid, cacheRootStr string, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
-	cfg := migration10.Config{
-		MaxWorkers:        8,
-		JobQueueSize:      1000,
-		ResultQueueSize:   100,
-		ProgressLogPeriod: 5 * time.Minute,
-	}
-	cache := migration10.NewMemMigrationCache()
-	if cacheRootStr != "" {
-		cacheStateRoot, err := cid.Decode(cacheRootStr)
-		if err != nil {
-			return cid.Undef, time.Duration(0), nil, err
-		}
-		cache, err = lib.LoadCache(cacheStateRoot)
-		if err != nil {
-			return cid.Undef, time.Duration(0), nil, err
-		}
-		fmt.Printf("read cache from %s/%s\n", lib.EntCachePath, cacheStateRoot)
+// runValidateCmd validates a state with the invariant checks of actors version v,
+// or of the state's own actors version if v is 0.
+func runValidateCmd(c *cli.Context, v ActorsVersion) error {
+	stateRoot, height, _, err := stateArgs(c)
+	if err != nil {
+		return err
 	}
 
-	start := time.Now()
-	stateRootOut, err := migration10.MigrateStateTree(ctx, store, stateRootIn, height, cfg, log, cache)
+	profilePhase(c.Context, "load")
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
 	if err != nil {
-		return cid.Undef, time.Duration(0), nil, err
+		return err
 	}
-	duration := time.Since(start)
-	cacheWriteCallback := func() error {
-		persistStart := time.Now()
-		if err := lib.PersistCache(stateRootIn, cache); err != nil {
-			return err
-		}
-		persistDuration := time.Since(persistStart)
-		fmt.Printf("cache written to %s/%s, write time: %v\n", lib.EntCachePath, stateRootIn, persistDuration)
-		return nil
+	info, err := lib.InspectRoot(c.Context, store, stateRoot)
+	if err != nil {
+		return err
 	}
-	return stateRootOut, duration, cacheWriteCallback, nil
-}
-
-func migrateV3ToV4(ctx context.Context, stateRootIn cid.Cid, cacheRootStr string, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
-	cfg := migration12.Config{
-		MaxWorkers:        8,
-		JobQueueSize:      1000,
-		ResultQueueSize:   100,
-		ProgressLogPeriod: 5 * time.Minute,
+	if v == 0 {
+		v = ActorsVersion(info.ActorsVersion)
+		_, _ = fmt.Fprintf(os.Stderr, "validating with the checks of actors v%d, the version of state %s\n", v, stateRoot)
+	} else if int(v) != info.ActorsVersion {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: validating actors v%d state %s with the v%d checks\n", info.ActorsVersion, stateRoot, v)
 	}
-	cache := migration10.NewMemMigrationCache()
-	if cacheRootStr != "" {
-		cacheStateRoot, err := cid.Decode(cacheRootStr)
-		if err != nil {
-			return cid.Undef, time.Duration(0), nil, err
-		}
-		cache, err = lib.LoadCache(cacheStateRoot)
-		if err != nil {
-			return cid.Undef, time.Duration(0), nil, err
-		}
-		fmt.Printf("read cache from %s/%s\n", lib.EntCachePath, cacheStateRoot)
+	spec, ok := lookupMigration(v)
+	if !ok {
+		return xerrors.Errorf("no invariant checks for actors v%d", v)
 	}
-
-	start := time.Now()
-	stateRootOut, err := migration12.MigrateStateTree(ctx, store, stateRootIn, height, cfg, log, cache)
+	opts, err := loadValidateOpts(c, height)
 	if err != nil {
-		return cid.Undef, time.Duration(0), nil, err
-	}
-	duration := time.Since(start)
-	cacheWriteCallback := func() error {
-		persistStart := time.Now()
-		if err := lib.PersistCache(stateRootIn, cache); err != nil {
-			return err
-		}
-		persistDuration := time.Since(persistStart)
-		fmt.Printf("cache written to %s/%s, write time: %v\n", lib.EntCachePath, stateRootIn, persistDuration)
-		return nil
+		return err
 	}
-	return stateRootOut, duration, cacheWriteCallback, nil
+	profilePhase(c.Context, "validate")
+	return spec.Validate(c.Context, store, height, stateRoot, opts)
 }
 
-func migrateV4ToV5(ctx context.Context, stateRootIn cid.Cid, cacheRootStr string, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
-	cfg := migration13.Config{
-		MaxWorkers:        8,
-		JobQueueSize:      1000,
-		ResultQueueSize:   100,
-		ProgressLogPeriod: 5 * time.Minute,
-	}
-	cache := migration10.NewMemMigrationCache()
-	if cacheRootStr != "" {
-		cacheStateRoot, err := cid.Decode(cacheRootStr)
-		if err != nil {
-			return cid.Undef, time.Duration(0), nil, err
-		}
-		cache, err = lib.LoadCache(cacheStateRoot)
-		if err != nil {
-			return cid.Undef, time.Duration(0), nil, err
-		}
-		fmt.Printf("read cache from %s/%s\n", lib.EntCachePath, cacheStateRoot)
-	}
-	start := time.Now()
-	stateRootOut, err := migration13.MigrateStateTree(ctx, store, stateRootIn, height, cfg, log, cache)
-	if err != nil {
-		return cid.Undef, time.Duration(0), nil, err
-	}
-	duration := time.Since(start)
-	cacheWriteCallback := func() error {
-		persistStart := time.Now()
-		if err := lib.PersistCache(stateRootIn, cache); err != nil {
-			return err
-		}
-		persistDuration := time.Since(persistStart)
-		fmt.Printf("cache written to %s/%s, write time: %v\n", lib.EntCachePath, stateRootIn, persistDuration)
+/* Helpers */
+
+// timeoutGrace is how long a command gets to wind down after it was cancelled
+// before ent exits regardless.  Badger reads don't observe cancellation so a
+// wedged store could otherwise still hang forever.
+const timeoutGrace = 2 * time.Minute
+
+// applyTimeout gives all commands a context which is cancelled after --timeout.
+func applyTimeout(c *cli.Context) error {
+	timeout := c.Duration("timeout")
+	if timeout == 0 {
 		return nil
 	}
-	return stateRootOut, duration, cacheWriteCallback, nil
+	ctx, cancel := context.WithTimeout(c.Context, timeout)
+	c.Context = ctx
+	time.AfterFunc(timeout+timeoutGrace, func() {
+		cancel()
+		abandonRun(c, xerrors.Errorf("command still running %v after its %v timeout: %w", timeoutGrace, timeout, ctx.Err()))
+	})
+	return nil
 }
 
-func migrateV5ToV6(ctx context.Context, stateRootIn cid.Cid, cacheRootStr string, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
-	cfg := migration14.Config{
-		MaxWorkers:        8,
-		JobQueueSize:      1000,
-		ResultQueueSize:   100,
-		ProgressLogPeriod: 5 * time.Minute,
-	}
-	cache := migration10.NewMemMigrationCache()
-	if cacheRootStr != "" {
-		cacheStateRoot, err := cid.Decode(cacheRootStr)
-		if err != nil {
-			return cid.Undef, time.Duration(0), nil, err
+var (
+	cleanupOnce sync.Once
+	cleanupErr  error
+)
+
+// cleanupRun stops profiling and tracing, reports store statistics and removes
+// the spill store, once, when the command returns or is abandoned.
+func cleanupRun(c *cli.Context) error {
+	cleanupOnce.Do(func() {
+		stopCPUProfile()
+		stopHeapSnapshots()
+		if err := shutdownTracing(context.Background()); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to flush traces: %s\n", err)
 		}
-		cache, err = lib.LoadCache(cacheStateRoot)
-		if err != nil {
-			return cid.Undef, time.Duration(0), nil, err
+		reportBufferSpill()
+		reportCompression()
+		reportAccessStats(c)
+		reportPrefetch()
+		reportStoreTiers()
+		reportAccessTrace(c)
+		if err := lib.RemoveSpillStores(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to remove buffer spill store: %s\n", err)
 		}
-		fmt.Printf("read cache from %s/%s\n", lib.EntCachePath, cacheStateRoot)
-	}
-	start := time.Now()
-	stateRootOut, err := migration14.MigrateStateTree(ctx, store, stateRootIn, height, cfg, log, cache)
-	if err != nil {
-		return cid.Undef, time.Duration(0), nil, err
-	}
-	duration := time.Since(start)
-	cacheWriteCallback := func() error {
-		persistStart := time.Now()
-		if err := lib.PersistCache(stateRootIn, cache); err != nil {
-			return err
-		}
-		persistDuration := time.Since(persistStart)
-		fmt.Printf("cache written to %s/%s, write time: %v\n", lib.EntCachePath, stateRootIn, persistDuration)
-		return nil
-	}
-	return stateRootOut, duration, cacheWriteCallback, nil
+		cleanupErr = reportStoreRetries(c)
+	})
+	return cleanupErr
 }
 
-func validateV6(ctx context.Context, store cbornode.IpldStore, priorEpoch abi.ChainEpoch, stateRoot cid.Cid, wrapped bool) error {
-	var err error
-	if wrapped {
-		stateRoot, err = loadStateRoot(ctx, store, stateRoot)
-		if err != nil {
-			return xerrors.Errorf("failed to unwrap state root: %w", err)
-		}
+// abandonRun exits without waiting for a cancelled command still running after
+// timeoutGrace, as a last resort.  It cleans up and writes the result file first,
+// as if the command had returned err.
+func abandonRun(c *cli.Context, err error) {
+	_, _ = fmt.Fprintf(os.Stderr, "%s, exiting\n", err)
+	if cerr := cleanupRun(c); cerr != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s\n", cerr)
 	}
-	tree, err := states6.LoadTree(adt5.WrapStore(ctx, store), stateRoot)
-	if err != nil {
-		return xerrors.Errorf("failed to load tree: %w", err)
+	if rerr := writeResult(err); rerr != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to write result file: %s\n", rerr)
 	}
-	expectedBalance := builtin6.TotalFilecoin
-	start := time.Now()
-	acc, err := states6.CheckStateInvariants(tree, expectedBalance, priorEpoch)
-	duration := time.Since(start)
-	if err != nil {
-		return xerrors.Errorf("failed to check state invariants %w", err)
-	}
-	if acc.IsEmpty() {
-		fmt.Printf("Validation: %s -- no errors -- %v\n", stateRoot, duration)
-	} else {
-		fmt.Printf("Validation: %s -- with errors -- %v\n%s\n", stateRoot, duration, strings.Join(acc.Messages(), "\n"))
+	os.Exit(exitCode(err))
+}
+
+// reportStoreRetries prints a summary of retried store reads, if there were any.
+func reportStoreRetries(c *cli.Context) error {
+	stats := entstore.ReadRetryStats()
+	if stats.Retried == 0 {
+		return nil
 	}
+	_, _ = fmt.Fprintf(os.Stderr, "store reads retried: %d, recovered: %d, failed: %d\n", stats.Retried, stats.Recovered, stats.Failed)
 	return nil
 }
 
-func validateV5(ctx context.Context, store cbornode.IpldStore, priorEpoch abi.ChainEpoch, stateRoot cid.Cid, wrapped bool) error {
-	var err error
-	if wrapped {
-		stateRoot, err = loadStateRoot(ctx, store, stateRoot)
-		if err != nil {
-			return xerrors.Errorf("failed to unwrap state root: %w", err)
+// reportCompression prints compression ratios of data written with --compress.
+func reportCompression() {
+	report := func(what string, stats *lib.CompressionStats) {
+		raw, stored := stats.Get()
+		if raw == 0 {
+			return
 		}
+		_, _ = fmt.Fprintf(os.Stderr, "%s compressed %d MiB to %d MiB, ratio %.2f\n", what, raw>>20, stored>>20, float64(raw)/float64(stored))
 	}
-	tree, err := states5.LoadTree(adt5.WrapStore(ctx, store), stateRoot)
-	if err != nil {
-		return xerrors.Errorf("failed to load tree: %w", err)
-	}
-	expectedBalance := builtin5.TotalFilecoin
-	start := time.Now()
-	acc, err := states5.CheckStateInvariants(tree, expectedBalance, priorEpoch)
-	duration := time.Since(start)
-	if err != nil {
-		return xerrors.Errorf("failed to check state invariants %w", err)
-	}
-	if acc.IsEmpty() {
-		fmt.Printf("Validation: %s -- no errors -- %v\n", stateRoot, duration)
-	} else {
-		fmt.Printf("Validation: %s -- with errors -- %v\n%s\n", stateRoot, duration, strings.Join(acc.Messages(), "\n"))
-	}
-	return nil
+	report("blocks", &lib.BlockCompression)
+	report("migration cache", &lib.CacheCompression)
 }
 
-func validateV4(ctx context.Context, store cbornode.IpldStore, priorEpoch abi.ChainEpoch, stateRoot cid.Cid, wrapped bool) error {
-	var err error
-	if wrapped {
-		stateRoot, err = loadStateRoot(ctx, store, stateRoot)
-		if err != nil {
-			return xerrors.Errorf("failed to unwrap state root: %w", err)
-		}
+// reportAccessStats prints the block reads counted with --access-stats.
+func reportAccessStats(c *cli.Context) {
+	if !lib.AccessStats {
+		return
 	}
-	tree, err := states4.LoadTree(adt4.WrapStore(ctx, store), stateRoot)
-	if err != nil {
-		return xerrors.Errorf("failed to load tree: %w", err)
+	r := lib.BlockAccessReport(c.Int("access-stats-top"))
+	if r.Reads == 0 {
+		return
 	}
-	expectedBalance := builtin4.TotalFilecoin
-	start := time.Now()
-	acc, err := states4.CheckStateInvariants(tree, expectedBalance, priorEpoch)
-	duration := time.Since(start)
-	if err != nil {
-		return xerrors.Errorf("failed to check state invariants %w", err)
+	_, _ = fmt.Fprintf(os.Stderr, "block reads: %d of %d distinct blocks, %d MiB, %d blocks read once, %.2f reads per block\n",
+		r.Reads, r.Blocks, r.Bytes>>20, r.ReadOnce, float64(r.Reads)/float64(r.Blocks))
+	for _, t := range r.Tiers {
+		_, _ = fmt.Fprintf(os.Stderr, "  %-17s %12d reads %6.2f%%\n", t.Tier, t.Hits, 100*float64(t.Hits)/float64(r.Reads))
 	}
-	if acc.IsEmpty() {
-		fmt.Printf("Validation: %s -- no errors -- %v\n", stateRoot, duration)
-	} else {
-		fmt.Printf("Validation: %s -- with errors -- %v\n%s\n", stateRoot, duration, strings.Join(acc.Messages(), "\n"))
+	_, _ = fmt.Fprintf(os.Stderr, "most read blocks:\n")
+	for _, a := range r.Hottest {
+		_, _ = fmt.Fprintf(os.Stderr, "  %s %10d reads %8d bytes\n", a.Cid, a.Reads, a.Size)
 	}
-	return nil
 }
 
-func validateV3(ctx context.Context, store cbornode.IpldStore, priorEpoch abi.ChainEpoch, stateRoot cid.Cid, wrapped bool) error {
-	var err error
-	if wrapped {
-		stateRoot, err = loadStateRoot(ctx, store, stateRoot)
-		if err != nil {
-			return xerrors.Errorf("failed to unwrap state root: %w", err)
-		}
-	}
-	tree, err := states3.LoadTree(adt3.WrapStore(ctx, store), stateRoot)
-	if err != nil {
-		return xerrors.Errorf("failed to load tree: %w", err)
+// reportPrefetch prints how many of the blocks read ahead with --prefetch were used.
+func reportPrefetch() {
+	stats := lib.ReadPrefetchStats()
+	if stats.Fetched == 0 {
+		return
 	}
+	_, _ = fmt.Fprintf(os.Stderr, "prefetched %d blocks, %d read (%.1f%%)\n", stats.Fetched, stats.Used, 100*float64(stats.Used)/float64(stats.Fetched))
+}
 
-	expectedBalance := builtin3.TotalFilecoin
-	start := time.Now()
-	acc, err := states3.CheckStateInvariants(tree, expectedBalance, priorEpoch)
-	duration := time.Since(start)
-	if err != nil {
-		return xerrors.Errorf("failed to check state invariants %w", err)
+// reportStoreTiers prints the reads each configured store tier served.
+func reportStoreTiers() {
+	tiers := entstore.StoreTierHits()
+	var total uint64
+	for _, t := range tiers {
+		total += t.Hits
 	}
-	if acc.IsEmpty() {
-		fmt.Printf("Validation: %s -- no errors -- %v\n", stateRoot, duration)
-	} else {
-		fmt.Printf("Validation: %s -- with errors -- %v\n%s\n", stateRoot, duration, strings.Join(acc.Messages(), "\n"))
+	if total == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "store tier reads:\n")
+	for _, t := range tiers {
+		_, _ = fmt.Fprintf(os.Stderr, "  %-20s %12d %6.2f%%\n", t.Tier, t.Hits, 100*float64(t.Hits)/float64(total))
 	}
-	return nil
 }
 
-func validateV2(ctx context.Context, store cbornode.IpldStore, priorEpoch abi.ChainEpoch, stateRoot cid.Cid, wrapped bool) error {
-	var err error
-
-	if wrapped {
-		stateRoot, err = loadStateRoot(ctx, store, stateRoot)
-		if err != nil {
-			return xerrors.Errorf("failed to unwrap state root: %w", err)
-		}
-	}
-	tree, err := states2.LoadTree(adt0.WrapStore(ctx, store), stateRoot)
-	if err != nil {
-		return xerrors.Errorf("failed to load tree: %w", err)
-	}
-	expectedBalance := builtin2.TotalFilecoin
-	start := time.Now()
-	acc, err := states2.CheckStateInvariants(tree, expectedBalance, priorEpoch)
-	duration := time.Since(start)
-	if err != nil {
-		return xerrors.Errorf("failed to check state invariants", err)
+// reportAccessTrace closes the --record-trace file and prints the number of reads
+// it recorded.
+func reportAccessTrace(c *cli.Context) {
+	if lib.AccessTrace == nil {
+		return
 	}
-	if acc.IsEmpty() {
-		fmt.Printf("Validation: %s -- no errors -- %v\n", stateRoot, duration)
-	} else {
-		fmt.Printf("Validation: %s -- with errors -- %v\n%s\n", stateRoot, duration, strings.Join(acc.Messages(), "\n"))
+	if err := lib.AccessTrace.Close(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to write access trace: %s\n", err)
+		return
 	}
-	return nil
+	_, _ = fmt.Fprintf(os.Stderr, "recorded %d block reads to %s\n", lib.AccessTrace.Reads(), c.String("record-trace"))
 }
 
-/* Helpers */
-
-func cpuProfile(c *cli.Context) (func(), error) {
-	val := c.String("cpuprofile")
-	if val == "" { // flag not set do nothing and defer nothing
-		return func() {}, nil
+// reportBufferSpill prints how much of the write buffer spilled to disk, if any.
+func reportBufferSpill() {
+	blocks, bytes := lib.SpillStats()
+	if blocks == 0 {
+		return
 	}
+	_, _ = fmt.Fprintf(os.Stderr, "write buffer spilled %d blocks, %d MiB to disk\n", blocks, bytes>>20)
+}
 
-	// val is output path of cpuprofile file
-	f, err := os.Create(val)
+// parseFraction parses a sample size given either as a percentage ("1%") or as a
+// fraction ("0.01").
+func parseFraction(val string) (float64, error) {
+	pct := strings.HasSuffix(val, "%")
+	f, err := strconv.ParseFloat(strings.TrimSuffix(val, "%"), 64)
 	if err != nil {
-		return nil, err
+		return 0, xerrors.Errorf("invalid sample size %q: %w", val, err)
 	}
-	err = pprof.StartCPUProfile(f)
-	if err != nil {
-		return nil, err
+	if pct {
+		f /= 100
 	}
-
-	return func() {
-		pprof.StopCPUProfile()
-		err := f.Close()
-		if err != nil {
-			fmt.Printf("failed to close cpuprofile file %s: %s\n", val, err)
-		}
-	}, nil
-}
-
-func loadStateTreeV2(ctx context.Context, store cbornode.IpldStore, stateRoot cid.Cid) (*states2.Tree, error) {
-	adtStore := adt0.WrapStore(ctx, store)
-	stateRoot, err := loadStateRoot(ctx, store, stateRoot)
-	if err != nil {
-		return nil, err
+	if f <= 0 || f > 1 {
+		return 0, xerrors.Errorf("sample size %q out of range (0, 100%%]", val)
 	}
-	return states2.LoadTree(adtStore, stateRoot)
+	return f, nil
 }
 
+// loadStateRoot returns the actors tree root of stateRoot, unwrapping it if it is
+// a StateRoot wrapper.  Bare actors roots are detected and returned as is.
 func loadStateRoot(ctx context.Context, store cbornode.IpldStore, stateRoot cid.Cid) (cid.Cid, error) {
-	var treeTop lib.StateRoot
-	err := store.Get(ctx, stateRoot, &treeTop)
+	actors, treeTop, err := lib.UnwrapStateRoot(ctx, store, stateRoot)
 	if err != nil {
 		return cid.Undef, err
 	}
-	_, _ = fmt.Fprintf(os.Stderr, "State root version: %v\n", treeTop.Version)
-	return treeTop.Actors, nil
+	if treeTop == nil {
+		_, _ = fmt.Fprintf(os.Stderr, "State root is a bare actors tree\n")
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "State root version: %v\n", treeTop.Version)
+	}
+	return actors, nil
 }
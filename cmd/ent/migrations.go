@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	"github.com/filecoin-project/ent/migrate"
+	"github.com/filecoin-project/ent/validate"
+)
+
+type ActorsVersion = migrate.ActorsVersion
+
+const (
+	V2 = migrate.V2
+	V3 = migrate.V3
+	V4 = migrate.V4
+	V5 = migrate.V5
+	V6 = migrate.V6
+	V7 = migrate.V7
+	V8 = migrate.V8
+)
+
+// migrateOpts carries per run inputs that only some migrations use.
+type migrateOpts = migrate.Options
+
+// defaultProgressLogPeriod is how often migrations log job progress by default.
+const defaultProgressLogPeriod = migrate.DefaultProgressLogPeriod
+
+type migrateFunc = migrate.Func
+
+// validateOpts carries per run validation reporting settings.
+type validateOpts struct {
+	// Tolerances separates known epsilon findings from new violations
+	Tolerances *lib.ToleranceConfig
+	// ReportPath is where to save a json report of the run for diffing, if set
+	ReportPath string
+	// Full prints every message instead of grouping them by failure type
+	Full bool
+	// ArtifactsDir is where to write per miner debugging artifacts, if set
+	ArtifactsDir string
+	// Notifier receives the validation summary
+	Notifier *lib.Notifier
+	// ExpectedBalance is the total of actor balances the state must hold
+	ExpectedBalance abi.TokenAmount
+	// Outcome receives the result of the run if set
+	Outcome *validationOutcome
+	// Quiet suppresses printing the result, for callers reporting Outcome
+	Quiet bool
+	// Checks are custom actor checks from check plugins, run after the
+	// invariant checks
+	Checks []*lib.ActorCheck
+	// Height is the epoch of the validated state, passed to Checks
+	Height abi.ChainEpoch
+	// Provenance is the manifest of the report, written with it if set
+	Provenance *provenance
+}
+
+// validationOutcome is the result of a validation run.
+type validationOutcome struct {
+	StateRoot  cid.Cid
+	Duration   time.Duration
+	Violations []string
+	Known      int
+}
+
+type validateFunc func(context.Context, cbornode.IpldStore, abi.ChainEpoch, cid.Cid, validateOpts) error
+
+// migrationSpec describes a supported migration along with the invariant checks
+// for the output state.  Supporting a new network upgrade is a matter of adding
+// its migration to migrate.Registry and its checks to validate.Registry; the cli
+// commands are generated from the tables.
+type migrationSpec struct {
+	migrate.Spec
+	Validate validateFunc
+}
+
+// migrationRegistry lists supported migrations, newest first.
+var migrationRegistry = func() []migrationSpec {
+	specs := make([]migrationSpec, len(migrate.Registry))
+	for i, spec := range migrate.Registry {
+		specs[i] = migrationSpec{Spec: spec, Validate: validatorOf(spec.To)}
+	}
+	return specs
+}()
+
+// latestVersion is the newest actors version ent can migrate to.
+var latestVersion = migrate.Latest
+
+func lookupMigration(v ActorsVersion) (migrationSpec, bool) {
+	for _, spec := range migrationRegistry {
+		if spec.To == v {
+			return spec, true
+		}
+	}
+	return migrationSpec{}, false
+}
+
+func bundleFlag() cli.Flag {
+	return &cli.StringFlag{Name: "bundle", Usage: "builtin-actors bundle car file, required for bundle installing migrations"}
+}
+
+// loadMigrateOpts reads migrateOpts from command flags.  Bundles are imported into
+// the chain's buffered store so they are flushed along with migrated state.
+func loadMigrateOpts(c *cli.Context, chn *lib.Chain, spec migrationSpec) (migrateOpts, error) {
+	opts := migrateOpts{ReadCache: c.String("read-cache"), ProgressLogPeriod: defaultProgressLogPeriod}
+	if opts.ReadCache != "" {
+		fmt.Printf("reading cache from %s/%s\n", lib.EntCachePath, opts.ReadCache)
+	}
+	if !spec.Bundle {
+		return opts, nil
+	}
+	if c.String("bundle") == "" {
+		return opts, xerrors.Errorf("migration to v%d installs an actors bundle, provide one with --bundle", spec.To)
+	}
+	roots, err := chn.ImportCar(c.Context, c.String("bundle"))
+	if err != nil {
+		return opts, xerrors.Errorf("failed to import bundle: %w", err)
+	}
+	if len(roots) != 1 {
+		return opts, xerrors.Errorf("expected bundle with a single manifest root, found %d roots", len(roots))
+	}
+	opts.Manifest = roots[0]
+	return opts, nil
+}
+
+func tolerancesFlag() cli.Flag {
+	return &cli.StringFlag{Name: "tolerances", Usage: "json config of known invariant findings to report separately from new violations"}
+}
+
+func fullFlag() cli.Flag {
+	return &cli.BoolFlag{Name: "full", Usage: "print every invariant message instead of grouping them by failure type"}
+}
+
+func notifyFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "notify-url", Usage: "post progress milestones and results to this webhook"},
+		&cli.BoolFlag{Name: "notify-slack", Usage: "post Slack compatible {\"text\": ...} payloads to --notify-url"},
+	}
+}
+
+func artifactsFlag() cli.Flag {
+	return &cli.StringFlag{Name: "error-artifacts", Usage: "write a directory per miner with invariant errors holding its messages, state and partitions"}
+}
+
+func checkPluginFlag() cli.Flag {
+	return &cli.StringSliceFlag{Name: "check-plugin", Usage: "Go plugin of custom actor checks to run with the invariant checks, may be repeated"}
+}
+
+// loadCheckPlugins loads the custom checks of the plugins at paths.
+func loadCheckPlugins(paths []string) ([]*lib.ActorCheck, error) {
+	var checks []*lib.ActorCheck
+	for _, path := range paths {
+		pluginChecks, err := lib.LoadCheckPlugin(path)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, pluginChecks...)
+	}
+	return checks, nil
+}
+
+func expectedBalanceFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "network", Value: "mainnet", Usage: "network whose supply schedule gives the expected total of actor balances"},
+		&cli.StringFlag{Name: "expected-balance", Usage: "expected total of actor balances in attoFIL, overriding the network supply schedule"},
+	}
+}
+
+func reportFlag() cli.Flag {
+	return &cli.StringFlag{Name: "report", Usage: "save a json validation report to this file, for validate diff-reports"}
+}
+
+// loadValidateOpts reads validateOpts from command flags for validating a state at
+// height.
+func loadValidateOpts(c *cli.Context, height abi.ChainEpoch) (validateOpts, error) {
+	opts := validateOpts{
+		ReportPath:   c.String("report"),
+		Full:         c.Bool("full"),
+		ArtifactsDir: c.String("error-artifacts"),
+		Notifier:     lib.NewNotifier(c.String("notify-url"), c.Bool("notify-slack")),
+		Height:       height,
+	}
+	if c.IsSet("manifest") {
+		if opts.ReportPath == "" {
+			return opts, xerrors.Errorf("--manifest needs --report")
+		}
+		opts.Provenance = newProvenance(c, cid.Undef, height)
+	}
+	var err error
+	if opts.Checks, err = loadCheckPlugins(c.StringSlice("check-plugin")); err != nil {
+		return opts, err
+	}
+	if path := c.String("tolerances"); path != "" {
+		if opts.Tolerances, err = lib.LoadToleranceConfig(path); err != nil {
+			return opts, err
+		}
+	}
+	if val := c.String("expected-balance"); val != "" {
+		if opts.ExpectedBalance, err = big.FromString(val); err != nil {
+			return opts, xerrors.Errorf("invalid expected balance: %w", err)
+		}
+		return opts, nil
+	}
+	supply, err := lib.ExpectedTotalSupply(c.String("network"), height)
+	if err != nil {
+		return opts, err
+	}
+	opts.ExpectedBalance = supply.Total
+	return opts, nil
+}
+
+func migrateSubcommands() []*cli.Command {
+	var cmds []*cli.Command
+	for _, spec := range migrationRegistry {
+		v := spec.To
+		flags := []cli.Flag{
+			&cli.BoolFlag{Name: "validate"},
+			&cli.StringFlag{Name: "sample", Usage: "migrate only a deterministic sample of actors, e.g. 1% or 0.01"},
+			&cli.IntFlag{Name: "max-actors", Usage: "migrate at most this many actors"},
+			&cli.BoolFlag{Name: "wrap-output", Usage: "wrap the migrated actors tree in a versioned state root usable by lotus"},
+			&cli.BoolFlag{Name: "summary", Usage: "print what the migration changed by actor type, with the blocks and bytes it wrote"},
+			tolerancesFlag(),
+			checkPluginFlag(),
+			reportFlag(),
+			manifestFlag(),
+			fullFlag(),
+			artifactsFlag(),
+			reproBundleFlag(),
+			&cli.BoolFlag{Name: "tui", Usage: "show a terminal dashboard of migration progress on stderr"},
+			&cli.StringFlag{Name: "expect-root", Usage: fmt.Sprintf("exit with code %d, before flushing, when the migrated state root, or its wrapped root, is not this one", exitRootMismatch)},
+			&cli.StringFlag{Name: "buffer-out", Usage: "write the migrated state to this new directory instead of ent's store, to flush later with ent flush"},
+			epochFlag(),
+			headFlag(),
+		}
+		flags = append(flags, expectedBalanceFlags()...)
+		flags = append(flags, notifyFlags()...)
+		flags = append(flags, gcFlags()...)
+		if spec.Cached {
+			flags = append(flags,
+				&cli.StringFlag{Name: "read-cache"},
+				&cli.BoolFlag{Name: "write-cache"},
+				&cli.DurationFlag{Name: "stall-timeout", Usage: "dump goroutine stacks and checkpoint the cache with --write-cache when no migration job completes for this long"},
+				&cli.BoolFlag{Name: "stall-abort", Usage: fmt.Sprintf("exit with code %d after checkpointing the cache on a stall, or %d without a checkpoint", exitCheckpointed, exitStalled)},
+			)
+		}
+		if spec.Bundle {
+			flags = append(flags, bundleFlag())
+		}
+		cmds = append(cmds, &cli.Command{
+			Name:   fmt.Sprintf("v%d", v),
+			Usage:  fmt.Sprintf("migrate a filecoin state tree from v%d to v%d (nv%d)", v-1, v, spec.NetworkVersion),
+			Action: func(c *cli.Context) error { return runMigrateCmd(c, v) },
+			Flags:  flags,
+		})
+	}
+	return append(cmds, &cli.Command{
+		Name:      "actor",
+		Usage:     "migrate a single actor of a state tree and print its new head",
+		ArgsUsage: "<state-cid> <state-epoch> <actor-address>",
+		Action:    runMigrateActorCmd,
+		Flags: []cli.Flag{
+			&cli.IntFlag{Name: "version", Value: int(latestVersion), Usage: "actors version to migrate to"},
+			&cli.BoolFlag{Name: "dump", Usage: "print the migrated actor state as json"},
+			bundleFlag(),
+			epochFlag(),
+			headFlag(),
+		},
+	})
+}
+
+// validateFlags returns the flags of ent validate and its version subcommands.
+func validateFlags() []cli.Flag {
+	flags := []cli.Flag{
+		&cli.BoolFlag{Name: "unwrapped", Usage: "deprecated, bare actors roots are detected automatically"},
+		tolerancesFlag(),
+		reportFlag(),
+		manifestFlag(),
+		fullFlag(),
+		artifactsFlag(),
+		epochFlag(),
+		headFlag(),
+		checkPluginFlag(),
+	}
+	return append(append(flags, expectedBalanceFlags()...), notifyFlags()...)
+}
+
+func validateSubcommands() []*cli.Command {
+	var cmds []*cli.Command
+	for _, spec := range migrationRegistry {
+		v := spec.To
+		cmds = append(cmds, &cli.Command{
+			Name:   fmt.Sprintf("v%d", v),
+			Usage:  fmt.Sprintf("validate a state tree with the v%d checks whatever its actors version", v),
+			Action: func(c *cli.Context) error { return runValidateCmd(c, v) },
+			Flags:  validateFlags(),
+		})
+	}
+	return append(cmds, validateBatchCmd(), validateWatchCmd(), &cli.Command{
+		Name:      "diff-reports",
+		Usage:     "show invariant messages which appeared, disappeared or changed between two saved validation reports",
+		ArgsUsage: "<old.json> <new.json>",
+		Action:    runDiffReportsCmd,
+	})
+}
+
+// validatorOf returns the validateFunc running the invariant checks of actors
+// version v.
+func validatorOf(v ActorsVersion) validateFunc {
+	return func(ctx context.Context, store cbornode.IpldStore, priorEpoch abi.ChainEpoch, stateRoot cid.Cid, opts validateOpts) error {
+		return checkInvariants(ctx, store, stateRoot, opts, func(actorsRoot cid.Cid) (validate.MessageAccumulator, error) {
+			return validate.Registry[int(v)](ctx, store, actorsRoot, opts.ExpectedBalance, priorEpoch)
+		})
+	}
+}
+
+// cacheWriteLogged wraps a migration cache write callback to print where the
+// cache of stateRootIn went and how long writing it took.
+func cacheWriteLogged(stateRootIn cid.Cid, write func() error) func() error {
+	if write == nil {
+		return nil
+	}
+	return func() error {
+		persistStart := time.Now()
+		if err := write(); err != nil {
+			return err
+		}
+		persistDuration := time.Since(persistStart)
+		fmt.Printf("cache written to %s/%s, write time: %v\n", lib.EntCachePath, stateRootIn, persistDuration)
+		return nil
+	}
+}
+
+// checkInvariants unwraps the state root if it is wrapped, runs the version specific
+// invariant check and prints the result.
+func checkInvariants(ctx context.Context, store cbornode.IpldStore, stateRoot cid.Cid, opts validateOpts, check func(cid.Cid) (validate.MessageAccumulator, error)) (err error) {
+	ctx, span := tracer.Start(ctx, "validate")
+	defer func() { endSpan(span, err) }()
+	stateRoot, err = loadStateRoot(ctx, store, stateRoot)
+	if err != nil {
+		return xerrors.Errorf("failed to unwrap state root: %w", err)
+	}
+	start := time.Now()
+	acc, err := check(stateRoot)
+	if err != nil {
+		return xerrors.Errorf("failed to check state invariants %w", err)
+	}
+	messages := acc.Messages()
+	if len(opts.Checks) > 0 {
+		env, err := lib.NewCheckEnv(ctx, store, stateRoot, opts.Height)
+		if err != nil {
+			return err
+		}
+		if err := lib.RunActorChecks(ctx, env, opts.Checks, func(msg string) { messages = append(messages, msg) }); err != nil {
+			return xerrors.Errorf("failed to run custom checks: %w", err)
+		}
+	}
+	duration := time.Since(start)
+	report := validationReport{
+		StateRoot: stateRoot.String(),
+		Duration:  duration,
+		Messages:  messages,
+		Known:     make(map[string]string),
+	}
+	var violations, known []string
+	knownByRule := make(map[string]int)
+	for _, msg := range report.Messages {
+		if rule := opts.Tolerances.Match(msg); rule != nil {
+			report.Known[msg] = rule.Name
+			known = append(known, fmt.Sprintf("[%s] %s", rule.Name, msg))
+			knownByRule[rule.Name]++
+		} else {
+			violations = append(violations, msg)
+		}
+	}
+	if opts.ReportPath != "" {
+		if err := writeValidationReport(opts.ReportPath, &report); err != nil {
+			return xerrors.Errorf("failed to write validation report: %w", err)
+		}
+		if p := opts.Provenance; p != nil {
+			p.StateRoot, p.Rows = stateRoot, uint64(len(messages))
+			if err := p.addFile(opts.ReportPath); err != nil {
+				return err
+			}
+			if err := p.write(); err != nil {
+				return xerrors.Errorf("failed to write manifest: %w", err)
+			}
+		}
+	}
+	opts.Notifier.Notify("validated", fmt.Sprintf("%d violations, %d known findings", len(violations), len(known)), map[string]string{
+		"stateRoot": stateRoot.String(),
+		"duration":  duration.String(),
+	})
+	if opts.Outcome != nil {
+		*opts.Outcome = validationOutcome{StateRoot: stateRoot, Duration: duration, Violations: violations, Known: len(known)}
+	}
+	if opts.Quiet {
+		return nil
+	}
+	recordTiming("validate", duration)
+	recordCount("violations", len(violations))
+	recordCount("knownFindings", len(known))
+	if len(messages) == 0 {
+		fmt.Printf("Validation: %s -- no errors -- %v\n", stateRoot, duration)
+		return nil
+	}
+	if len(violations) == 0 {
+		fmt.Printf("Validation: %s -- only known epsilon findings -- %v\n", stateRoot, duration)
+	} else {
+		fmt.Printf("Validation: %s -- with errors -- %v\n", stateRoot, duration)
+		printMessages(violations, opts.Full)
+		if opts.ArtifactsDir != "" {
+			if err := writeMinerArtifacts(ctx, store, stateRoot, violations, opts.ArtifactsDir); err != nil {
+				return xerrors.Errorf("failed to write error artifacts: %w", err)
+			}
+		}
+	}
+	if len(known) > 0 {
+		fmt.Printf("Known epsilon findings (%d):\n", len(known))
+		if opts.Full {
+			fmt.Println(strings.Join(known, "\n"))
+		} else {
+			for _, rule := range opts.Tolerances.Rules {
+				if n := knownByRule[rule.Name]; n > 0 {
+					fmt.Printf("%s: %d messages\n", rule.Name, n)
+				}
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return validationFailed("%s has %d invariant violations", stateRoot, len(violations))
+	}
+	return nil
+}
+
+// printMigrationSummary prints the changes of a migration by actor type, most
+// bytes written first.
+func printMigrationSummary(s *lib.MigrationSummary) {
+	names := make([]string, 0, len(s.Types))
+	var totalBlocks, totalBytes int
+	for name, tc := range s.Types {
+		names = append(names, name)
+		totalBlocks += tc.Blocks
+		totalBytes += tc.Bytes
+	}
+	totalBlocks += s.TreeBlocks
+	totalBytes += s.TreeBytes
+	sort.Slice(names, func(i, j int) bool {
+		if s.Types[names[i]].Bytes != s.Types[names[j]].Bytes {
+			return s.Types[names[i]].Bytes > s.Types[names[j]].Bytes
+		}
+		return names[i] < names[j]
+	})
+	fmt.Printf("Migration summary (actors v%d => v%d): %d new blocks, %s\n", s.FromVersion, s.ToVersion, totalBlocks, humanize.IBytes(uint64(totalBytes)))
+	for _, name := range names {
+		tc := s.Types[name]
+		line := fmt.Sprintf("  %-16s %d actors: %d rewritten, %d code only, %d unchanged", name, tc.Actors, tc.Rewritten, tc.CodeOnly, tc.Unchanged)
+		if tc.Created > 0 {
+			line += fmt.Sprintf(", %d created", tc.Created)
+		}
+		if tc.Removed > 0 {
+			line += fmt.Sprintf(", %d removed", tc.Removed)
+		}
+		fmt.Printf("%s; %d new blocks, %s\n", line, tc.Blocks, humanize.IBytes(uint64(tc.Bytes)))
+	}
+	fmt.Printf("  %-16s %d new blocks, %s\n", "state tree", s.TreeBlocks, humanize.IBytes(uint64(s.TreeBytes)))
+	if len(s.AMTRoots) > 0 {
+		var widths []int
+		for bw := range s.AMTRoots {
+			widths = append(widths, bw)
+		}
+		sort.Ints(widths)
+		var parts []string
+		for _, bw := range widths {
+			parts = append(parts, fmt.Sprintf("%d with bitwidth %d", s.AMTRoots[bw], bw))
+		}
+		fmt.Printf("New AMTs: %s\n", strings.Join(parts, ", "))
+	}
+	fmt.Printf("Empty structures referenced by new blocks: %d HAMTs, %d AMTs\n", s.EmptyHAMTs, s.EmptyAMTs)
+}
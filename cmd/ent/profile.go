@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// cpuProfileFile is the file of the CPU profile started by --cpuprofile, if any.
+var cpuProfileFile *os.File
+
+// startCPUProfile starts the CPU profile of --cpuprofile, for whichever command
+// runs.  It is stopped by stopCPUProfile once the command returns.
+func startCPUProfile(c *cli.Context) error {
+	path := c.String("cpuprofile")
+	if path == "" {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	cpuProfileFile = f
+	return nil
+}
+
+// stopCPUProfile stops the CPU profile started by startCPUProfile and closes its
+// file.
+func stopCPUProfile() {
+	if cpuProfileFile == nil {
+		return
+	}
+	pprof.StopCPUProfile()
+	if err := cpuProfileFile.Close(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to close cpuprofile file %s: %s\n", cpuProfileFile.Name(), err)
+	}
+	cpuProfileFile = nil
+}
+
+// profilePhase labels the CPU profile samples of the calling goroutine, and of
+// the goroutines it starts from then on, with the phase of the command, like
+// load, migrate, flush or validate.  Filter a profile on it with
+// go tool pprof -tagfocus phase=<phase>.
+func profilePhase(ctx context.Context, phase string) {
+	pprof.SetGoroutineLabels(pprof.WithLabels(ctx, pprof.Labels("phase", phase)))
+}
+
+// heapSnapshots stops the heap snapshots started by startHeapSnapshots, nil when
+// none were.
+var heapSnapshots chan struct{}
+
+// heapSnapshotsDone is closed once the last heap snapshot is written.
+var heapSnapshotsDone chan struct{}
+
+// startHeapSnapshots writes a heap profile to the --heap-snapshots directory
+// every --heap-interval while the command runs, and a last one when it returns.
+// Snapshots are kept, so where memory grew can be seen even if the run is killed
+// for running out of memory.
+func startHeapSnapshots(c *cli.Context) error {
+	dir := c.String("heap-snapshots")
+	if dir == "" {
+		return nil
+	}
+	interval := c.Duration("heap-interval")
+	if interval <= 0 {
+		return xerrors.Errorf("--heap-interval must be positive, got %v", interval)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	heapSnapshots, heapSnapshotsDone = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(heapSnapshotsDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for n := 1; ; n++ {
+			select {
+			case <-ticker.C:
+			case <-heapSnapshots:
+				writeHeapSnapshot(dir, n)
+				return
+			}
+			writeHeapSnapshot(dir, n)
+		}
+	}()
+	return nil
+}
+
+// stopHeapSnapshots writes the last heap snapshot and stops the snapshots started
+// by startHeapSnapshots.
+func stopHeapSnapshots() {
+	if heapSnapshots == nil {
+		return
+	}
+	close(heapSnapshots)
+	<-heapSnapshotsDone
+	heapSnapshots = nil
+}
+
+// writeHeapSnapshot writes the nth heap profile of the run to dir, named by its
+// sequence number and time.  It is written to a temporary file and renamed so a
+// snapshot cut off by the process being killed is never mistaken for a whole one.
+func writeHeapSnapshot(dir string, n int) {
+	name := fmt.Sprintf("heap-%04d-%s.pb.gz", n, time.Now().Format("20060102T150405"))
+	err := func() error {
+		tmp, err := ioutil.TempFile(dir, name+".tmp*")
+		if err != nil {
+			return err
+		}
+		if err := pprof.Lookup("heap").WriteTo(tmp, 0); err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			_ = os.Remove(tmp.Name())
+			return err
+		}
+		return os.Rename(tmp.Name(), filepath.Join(dir, name))
+	}()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to write heap snapshot %s: %s\n", name, err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/rt"
+)
+
+// Progress lines logged by the specs-actors state tree migrations, identical in
+// every version since nv10.
+var (
+	workersStartedRe = regexp.MustCompile(`Started (\d+) workers`)
+	workerDoneRe     = regexp.MustCompile(`Worker \d+ done`)
+	jobsCreatedRe    = regexp.MustCompile(`Done creating (\d+) migration jobs`)
+	jobsProgressRe   = regexp.MustCompile(`(\d+) jobs created, (\d+) done, \d+ pending after .* \((\d+)/s\)`)
+	jobsDoneRe       = regexp.MustCompile(`All (\d+) done after`)
+)
+
+// migrationProgress follows the progress of a state tree migration from its log.
+type migrationProgress struct {
+	lk       sync.Mutex
+	snapshot progressSnapshot
+}
+
+type progressSnapshot struct {
+	Workers     int
+	WorkersDone int
+	// TotalJobs is zero until all jobs are created
+	TotalJobs   int
+	CreatedJobs int
+	DoneJobs    int
+	Rate        int
+	// AllDone is set once every job is done and the result tree is being flushed
+	AllDone bool
+	// LastProgress is when DoneJobs last increased, or when following started
+	LastProgress time.Time
+	LastLine     string
+}
+
+func newMigrationProgress() *migrationProgress {
+	return &migrationProgress{snapshot: progressSnapshot{LastProgress: time.Now()}}
+}
+
+// follow records progress from a migration log line.
+func (p *migrationProgress) follow(level rt.LogLevel, msg string) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	s := &p.snapshot
+	if level != rt.DEBUG {
+		s.LastLine = msg
+	}
+	done := s.DoneJobs
+	if m := workersStartedRe.FindStringSubmatch(msg); m != nil {
+		s.Workers, _ = strconv.Atoi(m[1])
+	} else if workerDoneRe.MatchString(msg) {
+		s.WorkersDone++
+	} else if m := jobsCreatedRe.FindStringSubmatch(msg); m != nil {
+		s.TotalJobs, _ = strconv.Atoi(m[1])
+		s.CreatedJobs = s.TotalJobs
+	} else if m := jobsProgressRe.FindStringSubmatch(msg); m != nil {
+		s.CreatedJobs, _ = strconv.Atoi(m[1])
+		s.DoneJobs, _ = strconv.Atoi(m[2])
+		s.Rate, _ = strconv.Atoi(m[3])
+	} else if m := jobsDoneRe.FindStringSubmatch(msg); m != nil {
+		s.DoneJobs, _ = strconv.Atoi(m[1])
+		s.TotalJobs = s.DoneJobs
+		s.AllDone = true
+	}
+	if s.DoneJobs > done {
+		s.LastProgress = time.Now()
+	}
+}
+
+func (p *migrationProgress) get() progressSnapshot {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return p.snapshot
+}
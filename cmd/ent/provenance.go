@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+)
+
+// provenance is the chain of custody manifest of an output derived from chain
+// state: what it was derived from, by which build and command, and the hashes of
+// the output to check it against.
+type provenance struct {
+	Command   string            `json:"command"`
+	Args      []string          `json:"args"`
+	Flags     map[string]string `json:"flags"`
+	StateRoot cid.Cid           `json:"stateRoot"`
+	// StateRoots are the inputs of outputs derived from many states
+	StateRoots []cid.Cid `json:"stateRoots,omitempty"`
+	// Epoch is the epoch of the state, omitted if the command was not told it
+	Epoch *abi.ChainEpoch `json:"epoch,omitempty"`
+	// EntVersion is the module version and vcs revision of the ent build
+	EntVersion string `json:"entVersion"`
+	// Modules are the versions of actors modules ent was built with
+	Modules map[string]string `json:"modules"`
+	Rows    uint64            `json:"rows"`
+	// Partial is set when the output was resumed, so Rows only counts the rows
+	// of the last run
+	Partial bool               `json:"partial,omitempty"`
+	Outputs []provenanceOutput `json:"outputs"`
+	Created time.Time          `json:"created"`
+
+	path string
+}
+
+// provenanceOutput is an output file, or "-" for stdout.
+type provenanceOutput struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+func manifestFlag() cli.Flag {
+	return &cli.StringFlag{Name: "manifest", Usage: "write a provenance manifest of the output to this json file: input root and epoch, ent and actors versions, flags, row count and output hashes"}
+}
+
+// newProvenance starts the provenance manifest of the output of the command of c,
+// if --manifest is set.  epoch is the epoch of the state or -1 if unknown.
+func newProvenance(c *cli.Context, root cid.Cid, epoch abi.ChainEpoch) *provenance {
+	if !c.IsSet("manifest") {
+		return nil
+	}
+	p := &provenance{
+		Args:       c.Args().Slice(),
+		Flags:      make(map[string]string),
+		StateRoot:  root,
+		EntVersion: entVersion(),
+		Modules:    actorsModuleVersions(),
+		Created:    time.Now().UTC(),
+		path:       c.String("manifest"),
+	}
+	if epoch >= 0 {
+		p.Epoch = &epoch
+	}
+	// Subcommands run as apps named by their parent commands, like "ent info"
+	p.Command = c.App.Name + " " + c.Command.Name
+	for _, ctx := range c.Lineage() {
+		for _, name := range ctx.LocalFlagNames() {
+			if _, ok := p.Flags[name]; !ok && name != "manifest" {
+				p.Flags[name] = fmt.Sprint(ctx.Value(name))
+			}
+		}
+	}
+	return p
+}
+
+// addFile records the size and hash of the output file at path.
+func (p *provenance) addFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint:errcheck
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	p.Outputs = append(p.Outputs, provenanceOutput{Path: path, Bytes: n, SHA256: hex.EncodeToString(h.Sum(nil))})
+	return nil
+}
+
+// write writes the manifest to --manifest.
+func (p *provenance) write() error {
+	sort.Slice(p.Outputs, func(i, j int) bool { return p.Outputs[i].Path < p.Outputs[j].Path })
+	return writeJSONFile(p.path, p)
+}
+
+// hashingWriter hashes and counts the bytes written through it.
+type hashingWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+func newHashingWriter(w io.Writer) *hashingWriter {
+	return &hashingWriter{w: w, h: sha256.New()}
+}
+
+func (hw *hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	_, _ = hw.h.Write(p[:n])
+	hw.n += int64(n)
+	return n, err
+}
+
+// output returns the record of the output written through hw to path.
+func (hw *hashingWriter) output(path string) provenanceOutput {
+	return provenanceOutput{Path: path, Bytes: hw.n, SHA256: hex.EncodeToString(hw.h.Sum(nil))}
+}
+
+// entVersion returns the module version and vcs revision of the build.
+func entVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			version += " " + s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				version += "+dirty"
+			}
+		}
+	}
+	return version
+}
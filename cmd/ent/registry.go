@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/urfave/cli/v2"
+)
+
+// registeredSubcommands holds the subcommands registered under each parent
+// command by name.  Reports live in their own files and register themselves from
+// init, so adding one does not touch the parent's definition.
+var registeredSubcommands = make(map[string][]*cli.Command)
+
+// registerSubcommand adds cmd to the subcommands of the parent command, like
+// "info" or "export".  It panics on a duplicate name, which is a programming error.
+func registerSubcommand(parent string, cmd *cli.Command) {
+	for _, other := range registeredSubcommands[parent] {
+		if other.Name == cmd.Name {
+			panic(fmt.Sprintf("%s %s registered twice", parent, cmd.Name))
+		}
+	}
+	registeredSubcommands[parent] = append(registeredSubcommands[parent], cmd)
+}
+
+// addRegisteredSubcommands appends the subcommands registered under each of cmds
+// and sorts its subcommands by name.
+func addRegisteredSubcommands(cmds ...*cli.Command) {
+	for _, cmd := range cmds {
+		for _, sub := range registeredSubcommands[cmd.Name] {
+			for _, other := range cmd.Subcommands {
+				if other.Name == sub.Name {
+					panic(fmt.Sprintf("%s %s registered twice", cmd.Name, sub.Name))
+				}
+			}
+			cmd.Subcommands = append(cmd.Subcommands, sub)
+		}
+		sort.Sort(cli.CommandsByName(cmd.Subcommands))
+	}
+}
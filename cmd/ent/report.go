@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	address "github.com/filecoin-project/go-address"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+)
+
+// validationReport is the saved result of one validation run.
+type validationReport struct {
+	StateRoot string        `json:"stateRoot"`
+	Duration  time.Duration `json:"duration"`
+	// Messages are all invariant check messages, including known findings
+	Messages []string `json:"messages"`
+	// Known maps tolerated messages to the name of the tolerance rule accepting them
+	Known map[string]string `json:"known,omitempty"`
+}
+
+func writeValidationReport(path string, r *validationReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readValidationReport(path string) (*validationReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint:errcheck
+	var r validationReport
+	if err := json.NewDecoder(f).Decode(&r); err != nil {
+		return nil, xerrors.Errorf("failed to parse validation report %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// numberRe matches standalone numbers but not the digits of addresses like f01234.
+var numberRe = regexp.MustCompile(`\b\d+\b`)
+
+// messageKey identifies a message across runs, ignoring the values it reports.
+func messageKey(msg string) string {
+	return numberRe.ReplaceAllString(msg, "N")
+}
+
+var (
+	// actorMessageRe matches messages of per actor checks, "<addr> <family>: <msg>"
+	actorMessageRe = regexp.MustCompile(`^([ft]0\d+) (\w+): (.*)$`)
+	addressRe      = regexp.MustCompile(`\b[ft][0-4][0-9a-z]+\b`)
+	familyRe       = regexp.MustCompile(`^(\w+)`)
+)
+
+// messageGroup is a class of invariant messages of one actor family.
+type messageGroup struct {
+	Family string
+	// Failure is the message with actor addresses and values masked
+	Failure  string
+	Actors   map[string]struct{}
+	Messages []string
+}
+
+// classifyMessage returns the actor family, failure type and actor address, if
+// any, of an accumulator message.
+func classifyMessage(msg string) (family, failure, actor string) {
+	if m := actorMessageRe.FindStringSubmatch(msg); m != nil {
+		actor, family, msg = m[1], m[2], m[3]
+	} else {
+		family = familyRe.FindString(msg)
+		actor = addressRe.FindString(msg)
+	}
+	return family, messageKey(addressRe.ReplaceAllString(msg, "ADDR")), actor
+}
+
+// groupMessages groups messages by actor family and failure type, largest group
+// first.
+func groupMessages(msgs []string) []*messageGroup {
+	groups := make(map[string]*messageGroup)
+	var ordered []*messageGroup
+	for _, msg := range msgs {
+		family, failure, actor := classifyMessage(msg)
+		key := family + "\x00" + failure
+		g, ok := groups[key]
+		if !ok {
+			g = &messageGroup{Family: family, Failure: failure, Actors: make(map[string]struct{})}
+			groups[key] = g
+			ordered = append(ordered, g)
+		}
+		if actor != "" {
+			g.Actors[actor] = struct{}{}
+		}
+		g.Messages = append(g.Messages, msg)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return len(ordered[i].Messages) > len(ordered[j].Messages) })
+	return ordered
+}
+
+// printMessages prints messages grouped by family and failure type, or one per
+// line when full is set.
+func printMessages(msgs []string, full bool) {
+	if full {
+		for _, msg := range msgs {
+			fmt.Println(msg)
+		}
+		return
+	}
+	for _, g := range groupMessages(msgs) {
+		fmt.Printf("%s %s: %d actors, %d messages, e.g. %s\n", g.Family, g.Failure, len(g.Actors), len(g.Messages), g.Messages[0])
+	}
+}
+
+type partitionArtifact struct {
+	Deadline     uint64
+	PartitionIdx int64
+	*miner8.Partition
+}
+
+// writeMinerArtifacts writes a directory per miner with invariant messages under
+// dir, holding the messages, the decoded miner state and its partitions.
+func writeMinerArtifacts(ctx context.Context, store cbornode.IpldStore, stateRoot cid.Cid, msgs []string, dir string) error {
+	byMiner := make(map[string][]string)
+	for _, msg := range msgs {
+		if family, _, actor := classifyMessage(msg); family == "miner" && actor != "" {
+			byMiner[actor] = append(byMiner[actor], msg)
+		}
+	}
+	if len(byMiner) == 0 {
+		return nil
+	}
+	info, err := lib.InspectRoot(ctx, store, stateRoot)
+	if err != nil {
+		return err
+	}
+	tree, err := lib.LoadActorsTree(ctx, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return err
+	}
+	for actor, minerMsgs := range byMiner {
+		addr, err := address.NewFromString(actor)
+		if err != nil {
+			return err
+		}
+		a, found, err := tree.GetActor(addr)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		minerDir := filepath.Join(dir, actor)
+		if err := os.MkdirAll(minerDir, 0777); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(minerDir, "messages.txt"), []byte(strings.Join(minerMsgs, "\n")+"\n"), 0666); err != nil {
+			return err
+		}
+		st, err := lib.LoadMinerState(ctx, store, info.ActorsVersion, a.Head)
+		if err != nil {
+			return err
+		}
+		if err := writeJSONFile(filepath.Join(minerDir, "state.json"), st); err != nil {
+			return err
+		}
+		var partitions []partitionArtifact
+		if err := lib.ForEachMinerPartition(ctx, store, info.ActorsVersion, a.Head, func(dlIdx uint64, partIdx int64, p *miner8.Partition) error {
+			p2 := *p
+			partitions = append(partitions, partitionArtifact{Deadline: dlIdx, PartitionIdx: partIdx, Partition: &p2})
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := writeJSONFile(filepath.Join(minerDir, "partitions.json"), partitions); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("wrote artifacts for %d miners to %s\n", len(byMiner), dir)
+	return nil
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	j, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(j, '\n'), 0666)
+}
+
+type changedMessage struct {
+	old, new string
+}
+
+// diffMessages splits messages into those only in new, those only in old and pairs
+// of messages with the same key whose values changed.
+func diffMessages(oldMsgs, newMsgs []string) (appeared, disappeared []string, changed []changedMessage) {
+	inOld := make(map[string]int)
+	for _, m := range oldMsgs {
+		inOld[m]++
+	}
+	var added []string
+	for _, m := range newMsgs {
+		if inOld[m] > 0 {
+			inOld[m]--
+			continue
+		}
+		added = append(added, m)
+	}
+	removedByKey := make(map[string][]string)
+	for _, m := range oldMsgs {
+		if inOld[m] > 0 {
+			inOld[m]--
+			removedByKey[messageKey(m)] = append(removedByKey[messageKey(m)], m)
+		}
+	}
+	for _, m := range added {
+		k := messageKey(m)
+		if removed := removedByKey[k]; len(removed) > 0 {
+			changed = append(changed, changedMessage{old: removed[0], new: m})
+			removedByKey[k] = removed[1:]
+			continue
+		}
+		appeared = append(appeared, m)
+	}
+	for _, removed := range removedByKey {
+		disappeared = append(disappeared, removed...)
+	}
+	sort.Strings(appeared)
+	sort.Strings(disappeared)
+	sort.Slice(changed, func(i, j int) bool { return changed[i].new < changed[j].new })
+	return appeared, disappeared, changed
+}
+
+func runDiffReportsCmd(c *cli.Context) error {
+	if c.Args().Len() != 2 {
+		return xerrors.Errorf("wrong number of args, need old and new validation reports")
+	}
+	oldReport, err := readValidationReport(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	newReport, err := readValidationReport(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	appeared, disappeared, changed := diffMessages(oldReport.Messages, newReport.Messages)
+	fmt.Printf("Old: %s, %d messages\nNew: %s, %d messages\n", oldReport.StateRoot, len(oldReport.Messages), newReport.StateRoot, len(newReport.Messages))
+	fmt.Printf("Appeared (%d):\n", len(appeared))
+	for _, m := range appeared {
+		fmt.Printf("+ %s\n", m)
+	}
+	fmt.Printf("Disappeared (%d):\n", len(disappeared))
+	for _, m := range disappeared {
+		fmt.Printf("- %s\n", m)
+	}
+	fmt.Printf("Changed (%d):\n", len(changed))
+	for _, m := range changed {
+		fmt.Printf("- %s\n+ %s\n", m.old, m.new)
+	}
+	return nil
+}
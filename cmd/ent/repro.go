@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strings"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+var reproCmd = &cli.Command{
+	Name:        "repro",
+	Description: "replay migration failures captured with --repro-bundle",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "run",
+			Description: "import a repro bundle and rerun the migration of its failing actor",
+			ArgsUsage:   "<bundle-dir>",
+			Action:      runReproRunCmd,
+		},
+		{
+			Name:        "minimize",
+			Description: "shrink the failing actor state of a repro bundle by dropping deadlines, sectors and deals while the failure persists",
+			ArgsUsage:   "<bundle-dir>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "out", Usage: "directory to write the minimized bundle to, default <bundle-dir>-min"},
+			},
+			Action: runReproMinimizeCmd,
+		},
+	},
+}
+
+func reproBundleFlag() cli.Flag {
+	return &cli.StringFlag{Name: "repro-bundle", Usage: "when the migration of an actor fails write a bundle reproducing it to this directory, for ent repro run"}
+}
+
+// reproBundle describes a captured migration failure.  Its state is a tree of the
+// failing actor and the singleton actors, stored in reproStateFile.
+type reproBundle struct {
+	Actor          string         `json:"actor"`
+	ActorsVersion  ActorsVersion  `json:"actorsVersion"`
+	NetworkVersion int            `json:"networkVersion"`
+	Height         abi.ChainEpoch `json:"height"`
+	// StateRoot is the actors tree of the bundle, OriginalStateRoot the full
+	// tree the failure occurred in
+	StateRoot         cid.Cid `json:"stateRoot"`
+	OriginalStateRoot cid.Cid `json:"originalStateRoot"`
+	// Manifest is the installed actors bundle manifest, for bundle migrations
+	Manifest cid.Cid `json:"manifest,omitempty"`
+	Error    string  `json:"error"`
+	// Modules are the versions of actors modules ent was built with
+	Modules map[string]string `json:"modules,omitempty"`
+}
+
+const (
+	reproBundleFile = "bundle.json"
+	reproStateFile  = "state.car"
+)
+
+// failedActorRe finds the failing actor in the errors of the state tree migrations.
+var failedActorRe = regexp.MustCompile(`actor,? (?:at )?addr ([ft][0-4][0-9a-z]+)`)
+
+// writeReproBundle writes a repro bundle of the failed migration of state to
+// dir.  It fails if the error does not name the failing actor.
+func writeReproBundle(ctx context.Context, chn *lib.Chain, store cbornode.IpldStore, spec migrationSpec, stateRootIn cid.Cid, height abi.ChainEpoch, opts migrateOpts, migrateErr error, dir string) error {
+	m := failedActorRe.FindStringSubmatch(migrateErr.Error())
+	if m == nil {
+		return xerrors.Errorf("migration error names no failing actor")
+	}
+	addr, err := address.NewFromString(m[1])
+	if err != nil {
+		return err
+	}
+	subsetRoot, err := actorSubsetTree(ctx, store, spec.To, stateRootIn, addr)
+	if err != nil {
+		return err
+	}
+	bundle := reproBundle{
+		Actor:             addr.String(),
+		ActorsVersion:     spec.To,
+		NetworkVersion:    spec.NetworkVersion,
+		Height:            height,
+		StateRoot:         subsetRoot,
+		OriginalStateRoot: stateRootIn,
+		Manifest:          opts.Manifest,
+		Error:             migrateErr.Error(),
+		Modules:           actorsModuleVersions(),
+	}
+	blocks, bytes, err := saveReproBundle(ctx, chn, &bundle, dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote repro bundle for %s to %s, %d blocks, %d bytes\n", addr, dir, blocks, bytes)
+	return nil
+}
+
+// saveReproBundle writes bundle and the blocks of its state to dir and returns the
+// number of blocks and bytes of state written.
+func saveReproBundle(ctx context.Context, chn *lib.Chain, bundle *reproBundle, dir string) (int, int, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return 0, 0, err
+	}
+	roots := []cid.Cid{bundle.StateRoot}
+	if bundle.Manifest.Defined() {
+		roots = append(roots, bundle.Manifest)
+	}
+	f, err := os.Create(filepath.Join(dir, reproStateFile))
+	if err != nil {
+		return 0, 0, err
+	}
+	blocks, bytes, err := chn.ExportCar(ctx, roots, f)
+	if err != nil {
+		_ = f.Close()
+		return 0, 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, 0, err
+	}
+	if err := writeJSONFile(filepath.Join(dir, reproBundleFile), bundle); err != nil {
+		return 0, 0, err
+	}
+	return blocks, bytes, nil
+}
+
+// actorsModuleVersions returns the versions of the specs-actors and go-state-types
+// modules in the build.
+func actorsModuleVersions() map[string]string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	versions := make(map[string]string)
+	for _, dep := range info.Deps {
+		if strings.HasPrefix(dep.Path, "github.com/filecoin-project/specs-actors") || dep.Path == "github.com/filecoin-project/go-state-types" {
+			versions[dep.Path] = dep.Version
+		}
+	}
+	return versions
+}
+
+func readReproBundle(dir string) (*reproBundle, error) {
+	f, err := os.Open(filepath.Join(dir, reproBundleFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint:errcheck
+	var bundle reproBundle
+	if err := json.NewDecoder(f).Decode(&bundle); err != nil {
+		return nil, xerrors.Errorf("failed to parse repro bundle %s: %w", dir, err)
+	}
+	return &bundle, nil
+}
+
+// loadReproBundle reads the bundle in dir and imports its state into the buffer
+// of chn.
+func loadReproBundle(c *cli.Context, chn *lib.Chain) (*reproBundle, migrationSpec, cbornode.IpldStore, error) {
+	if !c.Args().Present() {
+		return nil, migrationSpec{}, nil, xerrors.Errorf("not enough args, need repro bundle directory")
+	}
+	dir := c.Args().First()
+	bundle, err := readReproBundle(dir)
+	if err != nil {
+		return nil, migrationSpec{}, nil, err
+	}
+	spec, ok := lookupMigration(bundle.ActorsVersion)
+	if !ok {
+		return nil, migrationSpec{}, nil, xerrors.Errorf("unsupported actors version %d for migration", bundle.ActorsVersion)
+	}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return nil, migrationSpec{}, nil, err
+	}
+	if _, err := chn.ImportCar(c.Context, filepath.Join(dir, reproStateFile)); err != nil {
+		return nil, migrationSpec{}, nil, xerrors.Errorf("failed to import bundle state: %w", err)
+	}
+	return bundle, spec, store, nil
+}
+
+func runReproRunCmd(c *cli.Context) error {
+	chn := entstore.Chain{}
+	bundle, spec, store, err := loadReproBundle(c, &chn)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("replaying migration of %s to actors v%d at epoch %d\n", bundle.Actor, bundle.ActorsVersion, bundle.Height)
+	fmt.Printf("recorded error: %s\n", bundle.Error)
+
+	opts := migrateOpts{ProgressLogPeriod: defaultProgressLogPeriod, Manifest: bundle.Manifest}
+	log := lib.NewMigrationLogger(os.Stdout)
+	stateRootOut, duration, _, err := spec.Migrate(c.Context, bundle.StateRoot, opts, store, bundle.Height, log)
+	if err != nil {
+		if err.Error() == bundle.Error {
+			fmt.Printf("reproduced: %s\n", err)
+		} else {
+			fmt.Printf("failed differently: %s\n", err)
+		}
+		return err
+	}
+	fmt.Printf("migration succeeded: %s => %s -- %v\n", bundle.StateRoot, stateRootOut, duration)
+	return nil
+}
+
+// cidRe matches base32 CIDs, which differ between reduced states failing the same way.
+var cidRe = regexp.MustCompile(`\bbaf[a-z2-7]{50,}\b`)
+
+// reproErrorKey is the migration error message with addresses, CIDs and numbers
+// masked, equal for failures of the same cause.
+func reproErrorKey(msg string) string {
+	msg = cidRe.ReplaceAllString(msg, "CID")
+	return messageKey(addressRe.ReplaceAllString(msg, "ADDR"))
+}
+
+func runReproMinimizeCmd(c *cli.Context) error {
+	chn := entstore.Chain{}
+	bundle, spec, store, err := loadReproBundle(c, &chn)
+	if err != nil {
+		return err
+	}
+	out := c.String("out")
+	if out == "" {
+		out = strings.TrimRight(c.Args().First(), string(filepath.Separator)) + "-min"
+	}
+	addr, err := address.NewFromString(bundle.Actor)
+	if err != nil {
+		return err
+	}
+	r, err := lib.NewStateReader(c.Context, store, bundle.StateRoot)
+	if err != nil {
+		return err
+	}
+	actor, err := r.Actor(addr)
+	if err != nil {
+		return err
+	}
+	v := r.ActorsVersion()
+
+	opts := migrateOpts{ProgressLogPeriod: defaultProgressLogPeriod, Manifest: bundle.Manifest}
+	log := lib.NewMigrationLogger(ioutil.Discard)
+	want := reproErrorKey(bundle.Error)
+	runs := 0
+	// fails reports whether migrating the bundle with the actor head replaced by
+	// head fails the same way as recorded
+	fails := func(head cid.Cid) (bool, error) {
+		root, err := lib.ReplaceActorHead(c.Context, store, v, bundle.StateRoot, addr, head)
+		if err != nil {
+			return false, err
+		}
+		runs++
+		_, _, _, err = spec.Migrate(c.Context, root, opts, store, bundle.Height, log)
+		return err != nil && reproErrorKey(err.Error()) == want, nil
+	}
+	ok, err := fails(actor.Head)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return xerrors.Errorf("bundle does not reproduce its recorded error, nothing to minimize")
+	}
+
+	head := actor.Head
+	name := r.CodeName(actor.Code)
+	switch name {
+	case "storageminer":
+		all := make([]uint64, miner8.WPoStPeriodDeadlines)
+		for i := range all {
+			all[i] = uint64(i)
+		}
+		keptDls, err := ddmin(all, func(kept []uint64) (bool, error) {
+			h, err := lib.ClearMinerDeadlines(c.Context, store, v, head, notIn(kept))
+			if err != nil {
+				return false, err
+			}
+			return fails(h)
+		})
+		if err != nil {
+			return err
+		}
+		if head, err = lib.ClearMinerDeadlines(c.Context, store, v, head, notIn(keptDls)); err != nil {
+			return err
+		}
+		sectors, err := lib.MinerSectorNumbers(c.Context, store, v, head)
+		if err != nil {
+			return err
+		}
+		keptSectors, err := ddmin(sectors, func(kept []uint64) (bool, error) {
+			h, err := lib.FilterMinerSectors(c.Context, store, v, head, in(kept))
+			if err != nil {
+				return false, err
+			}
+			return fails(h)
+		})
+		if err != nil {
+			return err
+		}
+		if head, err = lib.FilterMinerSectors(c.Context, store, v, head, in(keptSectors)); err != nil {
+			return err
+		}
+		fmt.Printf("kept %d of %d deadlines, %d of %d sectors\n", len(keptDls), len(all), len(keptSectors), len(sectors))
+	case "storagemarket":
+		deals, err := lib.MarketDealIDs(c.Context, store, v, head)
+		if err != nil {
+			return err
+		}
+		keptDeals, err := ddmin(deals, func(kept []uint64) (bool, error) {
+			h, err := lib.FilterMarketDeals(c.Context, store, v, head, in(kept))
+			if err != nil {
+				return false, err
+			}
+			return fails(h)
+		})
+		if err != nil {
+			return err
+		}
+		if head, err = lib.FilterMarketDeals(c.Context, store, v, head, in(keptDeals)); err != nil {
+			return err
+		}
+		fmt.Printf("kept %d of %d deals\n", len(keptDeals), len(deals))
+	default:
+		return xerrors.Errorf("cannot minimize state of %s actor %s", name, addr)
+	}
+
+	minimized := *bundle
+	if minimized.StateRoot, err = lib.ReplaceActorHead(c.Context, store, v, bundle.StateRoot, addr, head); err != nil {
+		return err
+	}
+	blocks, bytes, err := saveReproBundle(c.Context, &chn, &minimized, out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote minimized repro bundle to %s after %d migrations, %d blocks, %d bytes\n", out, runs, blocks, bytes)
+	return nil
+}
+
+// ddmin returns a 1-minimal subset of items for which fails returns true, given
+// that it does for all items, by delta debugging: it tests ever smaller chunks of
+// the remaining items and their complements, refining the chunks when none fail.
+func ddmin(items []uint64, fails func(kept []uint64) (bool, error)) ([]uint64, error) {
+	if ok, err := fails(nil); err != nil || ok {
+		return nil, err
+	}
+	n := 2
+	for len(items) >= 2 {
+		chunks := splitChunks(items, n)
+		reduced := false
+		for _, chunk := range chunks {
+			ok, err := fails(chunk)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				items, n, reduced = chunk, 2, true
+				break
+			}
+		}
+		// With two chunks the complements are the chunks themselves
+		for i := 0; !reduced && n > 2 && i < len(chunks); i++ {
+			var rest []uint64
+			for j, chunk := range chunks {
+				if j != i {
+					rest = append(rest, chunk...)
+				}
+			}
+			ok, err := fails(rest)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				items, n, reduced = rest, n-1, true
+			}
+		}
+		if reduced {
+			continue
+		}
+		if n >= len(items) {
+			break
+		}
+		n *= 2
+		if n > len(items) {
+			n = len(items)
+		}
+	}
+	return items, nil
+}
+
+// splitChunks splits items into n chunks of nearly equal length.
+func splitChunks(items []uint64, n int) [][]uint64 {
+	chunks := make([][]uint64, 0, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		end := start + (len(items)-start)/(n-i)
+		chunks = append(chunks, items[start:end])
+		start = end
+	}
+	return chunks
+}
+
+func in(items []uint64) func(uint64) bool {
+	set := make(map[uint64]struct{}, len(items))
+	for _, i := range items {
+		set[i] = struct{}{}
+	}
+	return func(i uint64) bool {
+		_, ok := set[i]
+		return ok
+	}
+}
+
+func notIn(items []uint64) func(uint64) bool {
+	isIn := in(items)
+	return func(i uint64) bool { return !isIn(i) }
+}
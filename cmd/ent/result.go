@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// Statuses of a run in its result file.
+const (
+	resultOK          = "ok"
+	resultFailed      = "failed"
+	resultInterrupted = "interrupted"
+)
+
+// resultCommands are the top level commands whose runs write a result file, the
+// long running ones automation waits on.
+var resultCommands = map[string]bool{
+	"migrate":  true,
+	"validate": true,
+	"check":    true,
+	"export":   true,
+	"snapshot": true,
+	"index":    true,
+	"diff":     true,
+	"flush":    true,
+}
+
+// runResult is the machine readable summary of a run written to --result-file
+// when the run ends, whether it succeeded or not.  Commands add the outputs they
+// produce, the time their phases took and counts like failed checks as they go.
+type runResult struct {
+	lk sync.Mutex
+	// written is set once the result file is written, by the command returning
+	// or by abandonRun
+	written bool
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// Status is ok, failed or interrupted by a signal or --timeout
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// ExitCode is the exit code of the run, see exitCode
+	ExitCode int                `json:"exitCode"`
+	Start    time.Time          `json:"start"`
+	End      time.Time          `json:"end"`
+	Seconds  float64            `json:"seconds"`
+	Outputs  map[string]string  `json:"outputs"`
+	Timings  map[string]float64 `json:"timings"`
+	Counts   map[string]int     `json:"counts"`
+}
+
+// result is the result of this run.
+var result = &runResult{
+	Start:   time.Now(),
+	Outputs: make(map[string]string),
+	Timings: make(map[string]float64),
+	Counts:  make(map[string]int),
+}
+
+// defaultResultPath is the default --result-file, in ent's home directory rather
+// than the working directory so runs from anywhere are found in one place.
+const defaultResultPath = "~/.ent/result.json"
+
+// resultPath is the --result-file path, empty to write none.
+var resultPath string
+
+// recordOutput records an output of the run, like a state root or file written.
+func recordOutput(name, value string) {
+	result.lk.Lock()
+	defer result.lk.Unlock()
+	result.Outputs[name] = value
+}
+
+// recordTiming records how long a phase of the run took.
+func recordTiming(name string, d time.Duration) {
+	result.lk.Lock()
+	defer result.lk.Unlock()
+	result.Timings[name] = d.Seconds()
+}
+
+// recordCount records a count of the run, like failed checks.
+func recordCount(name string, n int) {
+	result.lk.Lock()
+	defer result.lk.Unlock()
+	result.Counts[name] = n
+}
+
+// recordResults makes the commands of resultCommands, and their subcommands,
+// record which command ran in the result.
+func recordResults(cmds []*cli.Command) {
+	for _, cmd := range cmds {
+		if resultCommands[cmd.Name] {
+			recordCommandResults(cmd, cmd.Name)
+		}
+	}
+}
+
+// recordInvocation records the command of resultCommands the args after the
+// global flags invoke, if any, before its flags are parsed or the Before hook
+// runs.  Runs failing there then still write a result.  The command's action
+// records the same command with its parsed args.
+func recordInvocation(cmds []*cli.Command, args []string) {
+	var name string
+	for len(args) > 0 {
+		var cmd *cli.Command
+		for _, c := range cmds {
+			if c.HasName(args[0]) {
+				cmd = c
+				break
+			}
+		}
+		if cmd == nil || (name == "" && !resultCommands[cmd.Name]) {
+			break
+		}
+		name = strings.TrimSpace(name + " " + cmd.Name)
+		cmds, args = cmd.Subcommands, args[1:]
+	}
+	if name == "" {
+		return
+	}
+	result.lk.Lock()
+	defer result.lk.Unlock()
+	result.Command, result.Args = name, args
+}
+
+// recordCommandResults wraps the actions of cmd and its subcommands, cmd being
+// named name in full.  The name is not read from the context: actions of commands
+// with subcommands run with an unnamed command.
+func recordCommandResults(cmd *cli.Command, name string) {
+	if action := cmd.Action; action != nil {
+		cmd.Action = func(c *cli.Context) error {
+			result.lk.Lock()
+			result.Command = name
+			result.Args = c.Args().Slice()
+			result.lk.Unlock()
+			return action(c)
+		}
+	}
+	for _, sub := range cmd.Subcommands {
+		recordCommandResults(sub, name+" "+sub.Name)
+	}
+}
+
+// writeResult writes the result of a run ending with err to resultPath, if a
+// command of resultCommands ran.  The file is replaced atomically so readers
+// never see a partial result.
+func writeResult(err error) error {
+	result.lk.Lock()
+	defer result.lk.Unlock()
+	if resultPath == "" || result.Command == "" || result.written {
+		return nil
+	}
+	result.written = true
+	result.End = time.Now()
+	result.Seconds = result.End.Sub(result.Start).Seconds()
+	switch {
+	case err == nil:
+		result.Status = resultOK
+	case xerrors.Is(err, context.Canceled) || xerrors.Is(err, context.DeadlineExceeded):
+		result.Status, result.Error = resultInterrupted, err.Error()
+	default:
+		result.Status, result.Error = resultFailed, err.Error()
+	}
+	result.ExitCode = exitCode(err)
+	raw, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	path, err := homedir.Expand(resultPath)
+	if err != nil {
+		return err
+	}
+	// The temporary file is in the same directory so the rename is atomic
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, name+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(raw, '\n')); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	// TempFile creates the file readable by its owner only, but CI jobs reading
+	// results may run as other users
+	if err := tmp.Chmod(0644); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
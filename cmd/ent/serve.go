@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+var serveCmd = &cli.Command{
+	Name:        "serve",
+	Description: "answer the lotus JSON-RPC methods StateGetActor, StateReadState and StateMinerSectors from ent's store, for any state including migration outputs",
+	ArgsUsage:   "[<state-root>]",
+	Action:      runServeCmd,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "listen",
+			Usage: "address to listen on, the lotus API address by default",
+			Value: "localhost:1234",
+		},
+		epochFlag(),
+		headFlag(),
+	},
+}
+
+func runServeCmd(c *cli.Context) error {
+	// The default state answers calls with an empty tipset key
+	root := cid.Undef
+	if c.Bool("head") || c.IsSet("epoch") {
+		var err error
+		if root, _, _, err = stateArgs(c); err != nil {
+			return err
+		}
+	} else if c.Args().Present() {
+		var err error
+		if root, err = cid.Decode(c.Args().First()); err != nil {
+			return err
+		}
+	}
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	handler := lib.NewStateServer(store, root)
+	mux.Handle("/rpc/v0", handler)
+	mux.Handle("/rpc/v1", handler)
+	srv := &http.Server{Addr: c.String("listen"), Handler: mux}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	if root == cid.Undef {
+		_, _ = fmt.Fprintf(os.Stderr, "serving lotus state methods on http://%s/rpc/v0, no default state\n", srv.Addr)
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "serving lotus state methods on http://%s/rpc/v0, default state %s\n", srv.Addr, root)
+	}
+	select {
+	case err := <-errs:
+		return err
+	case <-c.Context.Done():
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+var snapshotCmd = &cli.Command{
+	Name:        "snapshot",
+	Description: "export minimal CAR snapshots of chain data",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "state",
+			Description: "export exactly the blocks reachable from a state root, without chain history or messages",
+			ArgsUsage:   "<state-root>",
+			Action:      runSnapshotStateCmd,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "out",
+					Usage:    "path of the CAR file to write",
+					Required: true,
+				},
+			},
+		},
+		{
+			Name:        "import",
+			Description: "import a CAR snapshot into ent's chain store, e.g. to reproduce a migration from a state snapshot",
+			ArgsUsage:   "<car-file>",
+			Action:      runSnapshotImportCmd,
+		},
+	},
+}
+
+func runSnapshotStateCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need state root")
+	}
+	root, err := cid.Decode(c.Args().First())
+	if err != nil {
+		return err
+	}
+	chn := entstore.Chain{}
+	f, err := os.Create(c.String("out"))
+	if err != nil {
+		return err
+	}
+	blocks, bytes, err := chn.ExportCar(c.Context, []cid.Cid{root}, f)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d blocks, %d bytes of state %s to %s\n", blocks, bytes, root, c.String("out"))
+	return nil
+}
+
+func runSnapshotImportCmd(c *cli.Context) error {
+	if !c.Args().Present() {
+		return xerrors.Errorf("not enough args, need car file")
+	}
+	chn := entstore.Chain{}
+	roots, err := chn.ImportCar(c.Context, c.Args().First())
+	if err != nil {
+		return err
+	}
+	if len(roots) == 0 {
+		return xerrors.Errorf("car file has no roots")
+	}
+	// Flushing writes the whole buffer, holding all imported blocks
+	if err := chn.FlushBufferedState(c.Context, roots[0]); err != nil {
+		return err
+	}
+	for _, root := range roots {
+		fmt.Printf("imported %s\n", root)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records spans for command phases.  Until setupTracing installs an
+// exporting provider it is a no-op.
+var tracer = otel.Tracer("github.com/filecoin-project/ent")
+
+// shutdownTracing flushes buffered spans, it is replaced when tracing is set up.
+var shutdownTracing = func(context.Context) error { return nil }
+
+// setupTracing exports spans to the OTLP/HTTP endpoint given by --otlp-endpoint.
+func setupTracing(c *cli.Context) error {
+	endpoint := c.String("otlp-endpoint")
+	if endpoint == "" {
+		return nil
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if c.Bool("otlp-insecure") {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(c.Context, opts...)
+	if err != nil {
+		return err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String("ent"))),
+	)
+	otel.SetTracerProvider(tp)
+	shutdownTracing = tp.Shutdown
+	return nil
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
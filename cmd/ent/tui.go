@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/filecoin-project/ent/lib"
+)
+
+// tuiRefresh is how often the dashboard is redrawn and migrations log progress
+// while it is shown.
+const tuiRefresh = time.Second
+
+// dashboard draws migration progress to a terminal, following the migration log
+// and polling cache and buffer statistics.
+type dashboard struct {
+	out      io.Writer
+	chn      *lib.Chain
+	cache    *lib.CacheStats
+	progress *migrationProgress
+	start    time.Time
+
+	drawn int // lines drawn by the previous frame
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newDashboard(out io.Writer, chn *lib.Chain, cache *lib.CacheStats, progress *migrationProgress) *dashboard {
+	return &dashboard{
+		out:      out,
+		chn:      chn,
+		cache:    cache,
+		progress: progress,
+		start:    time.Now(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// run redraws the dashboard until ctx is done or Stop is called.
+func (d *dashboard) run(ctx context.Context) {
+	defer close(d.done)
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+	for {
+		d.draw(ctx)
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			d.draw(ctx)
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop draws a final frame and stops redrawing.
+func (d *dashboard) Stop() {
+	close(d.stop)
+	<-d.done
+}
+
+func (d *dashboard) draw(ctx context.Context) {
+	p := d.progress.get()
+	workers, workersDone := p.Workers, p.WorkersDone
+	totalJobs, createdJobs, doneJobs, rate := p.TotalJobs, p.CreatedJobs, p.DoneJobs, p.Rate
+
+	jobs := fmt.Sprintf("%d/%d", doneJobs, totalJobs)
+	eta := "unknown"
+	if totalJobs == 0 {
+		jobs = fmt.Sprintf("%d/>=%d", doneJobs, createdJobs)
+	} else if doneJobs >= totalJobs {
+		eta = "done"
+	} else if rate > 0 {
+		eta = (time.Duration(totalJobs-doneJobs) * time.Second / time.Duration(rate)).String()
+	}
+	hitRate := "n/a"
+	if hits, misses := d.cache.Get(); hits+misses > 0 {
+		hitRate = fmt.Sprintf("%.1f%% (%d hits, %d misses)", 100*float64(hits)/float64(hits+misses), hits, misses)
+	}
+	queue := "n/a"
+	if buffered, flushed, err := d.chn.BufferStats(ctx); err == nil {
+		queue = fmt.Sprintf("%d blocks (%d flushed)", buffered-flushed, flushed)
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	lines := []string{
+		fmt.Sprintf("elapsed      %v", time.Since(d.start).Truncate(time.Second)),
+		fmt.Sprintf("workers busy %d/%d", workers-workersDone, workers),
+		fmt.Sprintf("actors       %s jobs, %d/s", jobs, rate),
+		fmt.Sprintf("eta          %s", eta),
+		fmt.Sprintf("cache        %s", hitRate),
+		fmt.Sprintf("flush queue  %s", queue),
+		fmt.Sprintf("memory       %d MiB heap, %d MiB sys", mem.HeapAlloc>>20, mem.Sys>>20),
+		fmt.Sprintf("last         %s", p.LastLine),
+	}
+	if d.drawn > 0 {
+		// Move back over the previous frame and clear it
+		_, _ = fmt.Fprintf(d.out, "\x1b[%dA\x1b[J", d.drawn)
+	}
+	for _, l := range lines {
+		_, _ = fmt.Fprintln(d.out, l)
+	}
+	d.drawn = len(lines)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+	entstore "github.com/filecoin-project/ent/store"
+)
+
+func validateWatchCmd() *cli.Command {
+	flags := []cli.Flag{
+		&cli.StringFlag{Name: "api", Usage: "lotus JSON-RPC API url, e.g. http://127.0.0.1:1234/rpc/v0", Required: true},
+		&cli.StringFlag{Name: "api-token", Usage: "lotus API token", EnvVars: []string{"LOTUS_API_TOKEN"}},
+		&cli.Int64Flag{Name: "every", Value: 2880, Usage: "validate the head state every this many epochs"},
+		&cli.DurationFlag{Name: "poll", Value: time.Minute, Usage: "time between chain head polls"},
+		&cli.StringFlag{Name: "baseline", Usage: "validation report of already known violations, which do not alert on the first run"},
+		&cli.BoolFlag{Name: "exit-on-alert", Usage: fmt.Sprintf("exit with code %d when new violations appear", exitValidationFailed)},
+		tolerancesFlag(),
+		checkPluginFlag(),
+	}
+	flags = append(flags, expectedBalanceFlags()...)
+	return &cli.Command{
+		Name:   "watch",
+		Usage:  "validate the state of a lotus node's chain head periodically and alert on new invariant violations",
+		Action: runValidateWatchCmd,
+		Flags:  append(flags, notifyFlags()...),
+	}
+}
+
+func runValidateWatchCmd(c *cli.Context) error {
+	every := abi.ChainEpoch(c.Int64("every"))
+	if every < 1 {
+		return xerrors.Errorf("--every must be at least 1")
+	}
+	api := lib.NewLotusAPI(c.String("api"), c.String("api-token"))
+	notifier := lib.NewNotifier(c.String("notify-url"), c.Bool("notify-slack"))
+	// The node locks its chain store and the head states on disk lag its sync, so
+	// states are read through its API, after any configured store tiers
+	entstore.AddTier(entstore.StoreTier{Name: "api", LotusAPI: c.String("api"), Token: c.String("api-token")})
+	chn := entstore.Chain{}
+	store, err := chn.LoadCborStore(c.Context)
+	if err != nil {
+		return err
+	}
+
+	// known holds the message keys of the violations of the last run, so a
+	// violation alerts when it first appears and again only after it went away
+	known := make(map[string]struct{})
+	if path := c.String("baseline"); path != "" {
+		baseline, err := readValidationReport(path)
+		if err != nil {
+			return err
+		}
+		for _, msg := range baseline.Messages {
+			if _, tolerated := baseline.Known[msg]; !tolerated {
+				known[messageKey(msg)] = struct{}{}
+			}
+		}
+	}
+
+	last := abi.ChainEpoch(-1)
+	for {
+		head, err := api.ChainHead(c.Context)
+		switch {
+		case err != nil:
+			_, _ = fmt.Fprintf(os.Stderr, "failed to get chain head: %s\n", err)
+		case last < 0 || head.Height >= last+every:
+			last = head.Height
+			violations, err := validateHead(c, store, head)
+			if err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "failed to validate state %s at %d: %s\n", head.ParentStateRoot, head.Height, err)
+				notifier.Notify("failed", err.Error(), map[string]string{"state": head.ParentStateRoot.String()})
+				break
+			}
+			current := make(map[string]struct{})
+			var added []string
+			for _, msg := range violations {
+				key := messageKey(msg)
+				current[key] = struct{}{}
+				if _, ok := known[key]; !ok {
+					added = append(added, msg)
+				}
+			}
+			known = current
+			fmt.Printf("%s epoch %d state %s: %d violations, %d new\n", time.Now().Format(time.RFC3339), head.Height, head.ParentStateRoot, len(violations), len(added))
+			if len(added) == 0 {
+				break
+			}
+			printMessages(added, false)
+			notifier.Notify("new-violations", fmt.Sprintf("%d new invariant violations at epoch %d, e.g. %s", len(added), head.Height, added[0]), map[string]string{
+				"stateRoot": head.ParentStateRoot.String(),
+				"epoch":     fmt.Sprint(head.Height),
+			})
+			if c.Bool("exit-on-alert") {
+				return validationFailed("%d new invariant violations at epoch %d", len(added), head.Height)
+			}
+		}
+		select {
+		case <-time.After(c.Duration("poll")):
+		case <-c.Context.Done():
+			return c.Context.Err()
+		}
+	}
+}
+
+// validateHead validates the parent state of the head with the checks of its
+// actors version and returns the violations that are not known epsilon findings.
+func validateHead(c *cli.Context, store cbornode.IpldStore, head *lib.ChainHead) ([]string, error) {
+	info, err := lib.InspectRoot(c.Context, store, head.ParentStateRoot)
+	if err != nil {
+		return nil, err
+	}
+	spec, ok := lookupMigration(ActorsVersion(info.ActorsVersion))
+	if !ok {
+		return nil, xerrors.Errorf("no invariant checks for actors v%d", info.ActorsVersion)
+	}
+	opts, err := loadValidateOpts(c, head.Height)
+	if err != nil {
+		return nil, err
+	}
+	var outcome validationOutcome
+	opts.Outcome, opts.Quiet = &outcome, true
+	if err := spec.Validate(c.Context, store, head.Height, head.ParentStateRoot, opts); err != nil {
+		return nil, err
+	}
+	return outcome.Violations, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// watchdog detects migrations making no progress.  When no migration job
+// completes for timeout it dumps goroutine stacks to stderr, checkpoints the
+// migration cache if it can and optionally aborts the migration, which then ends
+// with exitCheckpointed after a checkpoint and exitStalled otherwise.
+type watchdog struct {
+	timeout  time.Duration
+	progress *migrationProgress
+	// abort cancels the migration on a stall, nil to only report stalls
+	abort context.CancelFunc
+	// abandon ends the run if the aborted migration does not return within
+	// timeoutGrace
+	abandon func(error)
+
+	lk         sync.Mutex
+	checkpoint func() error
+	// stallErr is the error ending the migration once it was aborted
+	stallErr error
+
+	stop chan struct{}
+}
+
+func newWatchdog(timeout time.Duration, progress *migrationProgress) *watchdog {
+	return &watchdog{
+		timeout:  timeout,
+		progress: progress,
+		stop:     make(chan struct{}),
+	}
+}
+
+// abortWith makes the watchdog abort stalled migrations by cancelling them with
+// cancel, and end the run with abandon if they are still running timeoutGrace
+// later.
+func (w *watchdog) abortWith(cancel context.CancelFunc, abandon func(error)) {
+	w.abort, w.abandon = cancel, abandon
+}
+
+// migrationErr returns the error ending the migration which returned err, the
+// stall error if the watchdog aborted it.  w may be nil.
+func (w *watchdog) migrationErr(err error) error {
+	if err == nil || w == nil {
+		return err
+	}
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	if w.stallErr != nil {
+		return w.stallErr
+	}
+	return err
+}
+
+// setCheckpoint sets the callback persisting the in progress migration cache.
+func (w *watchdog) setCheckpoint(checkpoint func() error) {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	w.checkpoint = checkpoint
+}
+
+// run checks for stalls until Stop is called.  A stall is reported once, and
+// again only after progress resumes and stalls anew.
+func (w *watchdog) run() {
+	ticker := time.NewTicker(w.timeout / 4)
+	defer ticker.Stop()
+	var reported time.Time
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.stop:
+			return
+		}
+		p := w.progress.get()
+		if p.AllDone || time.Since(p.LastProgress) < w.timeout || p.LastProgress == reported {
+			continue
+		}
+		reported = p.LastProgress
+		w.stalled(p)
+	}
+}
+
+// Stop stops checking for stalls.
+func (w *watchdog) Stop() {
+	close(w.stop)
+}
+
+func (w *watchdog) stalled(p progressSnapshot) {
+	_, _ = fmt.Fprintf(os.Stderr, "migration stalled: no jobs done for %v, %d of %d jobs done, %d of %d workers finished\n",
+		time.Since(p.LastProgress).Truncate(time.Second), p.DoneJobs, p.CreatedJobs, p.WorkersDone, p.Workers)
+	_, _ = fmt.Fprintf(os.Stderr, "goroutine stacks:\n")
+	if err := pprof.Lookup("goroutine").WriteTo(os.Stderr, 2); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to dump goroutine stacks: %s\n", err)
+	}
+	w.lk.Lock()
+	checkpoint := w.checkpoint
+	w.lk.Unlock()
+	code := exitStalled
+	if checkpoint != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "checkpointing migration cache\n")
+		if err := checkpoint(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to checkpoint migration cache: %s\n", err)
+		} else {
+			code = exitCheckpointed
+		}
+	}
+	if w.abort == nil {
+		return
+	}
+	err := withExitCode(code, xerrors.Errorf("migration aborted after no jobs were done for %v", w.timeout))
+	w.lk.Lock()
+	w.stallErr = err
+	w.lk.Unlock()
+	_, _ = fmt.Fprintf(os.Stderr, "aborting stalled migration\n")
+	w.abort()
+	select {
+	case <-w.stop:
+	case <-time.After(timeoutGrace):
+		w.abandon(xerrors.Errorf("stalled migration still running %v after it was aborted: %w", timeoutGrace, err))
+	}
+}
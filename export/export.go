@@ -0,0 +1,123 @@
+// Package export streams rows derived from every actor of a state tree, encoded
+// as json lines, csv or length-prefixed cbor.  It is the export pipeline of the
+// ent command, importable by other tools.  Its API follows semantic versioning
+// with the ent module.
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+)
+
+// Config configures an export pipeline.
+type Config = lib.ExportConfig
+
+// Stats counts the progress of an export.
+type Stats = lib.ExportStats
+
+// ActorRows decodes the export rows of an actor, passing each to emit.
+type ActorRows = lib.ActorRows
+
+// RowEncoder encodes export rows.  Encoders may buffer until flushed.
+type RowEncoder = lib.RowEncoder
+
+// Run exports the rows of every actor of tree that rows decodes to out and counts
+// progress in stats.  Output is in a stable actor order, so an export can be
+// resumed after the last actor checkpointed.  If ctx is cancelled the output ends
+// after the last complete actor and ctx's error is returned.
+func Run(ctx context.Context, tree lib.ActorsTree, cfg Config, rows ActorRows, out io.Writer, stats *Stats) error {
+	return lib.RunExport(ctx, tree, cfg, rows, out, stats)
+}
+
+// Row is a row of an export with a json encoding and csv columns.
+type Row interface {
+	CSVRecord() []string
+}
+
+// NewEncoder returns a constructor of encoders of export rows as json lines
+// ("jsonl"), csv records without a csv header ("csv"), or length-prefixed cbor
+// ("cbor").
+func NewEncoder(format string) (func(io.Writer) RowEncoder, error) {
+	switch format {
+	case "jsonl":
+		return func(out io.Writer) RowEncoder {
+			w := bufio.NewWriter(out)
+			return &jsonlEncoder{w: w, enc: json.NewEncoder(w)}
+		}, nil
+	case "csv":
+		return func(out io.Writer) RowEncoder {
+			return &csvEncoder{w: csv.NewWriter(out)}
+		}, nil
+	case "cbor":
+		return func(out io.Writer) RowEncoder {
+			return &cborEncoder{w: bufio.NewWriter(out)}
+		}, nil
+	default:
+		return nil, xerrors.Errorf("unknown format %q, need jsonl, csv or cbor", format)
+	}
+}
+
+type jsonlEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonlEncoder) Encode(row interface{}) error { return j.enc.Encode(row) }
+func (j *jsonlEncoder) Flush() error                 { return j.w.Flush() }
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (c *csvEncoder) Encode(row interface{}) error {
+	var change []string
+	if ch, ok := row.(*lib.ChangedRow); ok {
+		change, row = []string{ch.Change}, ch.Row
+	}
+	r, ok := row.(Row)
+	if !ok {
+		return xerrors.Errorf("rows of type %T have no csv encoding", row)
+	}
+	return c.w.Write(append(change, r.CSVRecord()...))
+}
+
+func (c *csvEncoder) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// cborEncoder writes each row as its uvarint byte length followed by its cbor
+// tuple encoding, the framing of CAR file sections.
+type cborEncoder struct {
+	w   *bufio.Writer
+	buf bytes.Buffer
+}
+
+func (e *cborEncoder) Encode(row interface{}) error {
+	m, ok := row.(cbg.CBORMarshaler)
+	if !ok {
+		return xerrors.Errorf("rows of type %T have no cbor encoding", row)
+	}
+	e.buf.Reset()
+	if err := m.MarshalCBOR(&e.buf); err != nil {
+		return err
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	if _, err := e.w.Write(prefix[:binary.PutUvarint(prefix[:], uint64(e.buf.Len()))]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+func (e *cborEncoder) Flush() error { return e.w.Flush() }
@@ -11,7 +11,14 @@ func main() {
 		lib.BeaconEntry{},
 		lib.ElectionProof{},
 		lib.BlockHeader{},
+		lib.Message{},
+		lib.SignedMessage{},
+		lib.MsgMeta{},
+		lib.MessageReceipt{},
 		lib.StateRoot{},
+		lib.StateInfo0{},
+		lib.SectorRow{},
+		lib.SectorDealRow{},
 	); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// AccessStats enables counting the reads of every block through the chain store,
+// for BlockAccessReport.  It costs memory for each distinct block read.
+var AccessStats bool
+
+// Tiers of the chain store serving reads, in the order they are tried.
+const (
+	tierReadOnlyBuffer = iota
+	tierWriteBuffer
+	tierLotus
+	tierEnt
+	numTiers
+)
+
+var tierNames = [numTiers]string{"read-only buffer", "write buffer", "lotus", "ent"}
+
+// accessShards spreads block counts over locks, reads are highly concurrent.
+const accessShards = 64
+
+type accessShard struct {
+	lk     sync.Mutex
+	blocks map[cid.Cid]*BlockAccess
+}
+
+var blockAccesses [accessShards]accessShard
+
+var tierHits [numTiers]uint64
+
+// recordAccess counts a read of the block c of size bytes served by tier.
+func recordAccess(c cid.Cid, size int, tier int) {
+	atomic.AddUint64(&tierHits[tier], 1)
+	h := c.Hash()
+	shard := &blockAccesses[h[len(h)-1]%accessShards]
+	shard.lk.Lock()
+	defer shard.lk.Unlock()
+	if shard.blocks == nil {
+		shard.blocks = make(map[cid.Cid]*BlockAccess)
+	}
+	a, ok := shard.blocks[c]
+	if !ok {
+		a = &BlockAccess{Cid: c, Size: size}
+		shard.blocks[c] = a
+	}
+	a.Reads++
+}
+
+// BlockAccess counts the reads of a block.
+type BlockAccess struct {
+	Cid   cid.Cid
+	Size  int
+	Reads uint64
+}
+
+// TierHits counts the reads a tier of the chain store served.
+type TierHits struct {
+	Tier string
+	Hits uint64
+}
+
+// AccessReport summarizes the block reads counted while AccessStats is set.
+type AccessReport struct {
+	// Blocks is the number of distinct blocks read, ReadOnce those read once
+	Blocks   uint64
+	ReadOnce uint64
+	Reads    uint64
+	// Bytes is the total size of all reads
+	Bytes uint64
+	Tiers []TierHits
+	// Hottest are the most read blocks, most reads first
+	Hottest []BlockAccess
+}
+
+// BlockAccessReport returns the block reads counted so far with the top most read
+// blocks.
+func BlockAccessReport(top int) AccessReport {
+	var r AccessReport
+	// hottest is a min heap of the most read blocks seen so far
+	hottest := &accessHeap{}
+	for i := range blockAccesses {
+		shard := &blockAccesses[i]
+		shard.lk.Lock()
+		for _, a := range shard.blocks {
+			r.Blocks++
+			r.Reads += a.Reads
+			r.Bytes += a.Reads * uint64(a.Size)
+			if a.Reads == 1 {
+				r.ReadOnce++
+			}
+			if top <= 0 {
+				continue
+			}
+			if hottest.Len() < top {
+				heap.Push(hottest, *a)
+			} else if hotter(*a, (*hottest)[0]) {
+				(*hottest)[0] = *a
+				heap.Fix(hottest, 0)
+			}
+		}
+		shard.lk.Unlock()
+	}
+	r.Hottest = *hottest
+	sort.Slice(r.Hottest, func(i, j int) bool { return hotter(r.Hottest[i], r.Hottest[j]) })
+	for tier, name := range tierNames {
+		r.Tiers = append(r.Tiers, TierHits{Tier: name, Hits: atomic.LoadUint64(&tierHits[tier])})
+	}
+	return r
+}
+
+// hotter orders blocks by reads, breaking ties by CID for a stable report.
+func hotter(a, b BlockAccess) bool {
+	if a.Reads != b.Reads {
+		return a.Reads > b.Reads
+	}
+	return a.Cid.KeyString() < b.Cid.KeyString()
+}
+
+type accessHeap []BlockAccess
+
+func (h accessHeap) Len() int            { return len(h) }
+func (h accessHeap) Less(i, j int) bool  { return hotter(h[j], h[i]) }
+func (h accessHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *accessHeap) Push(x interface{}) { *h = append(*h, x.(BlockAccess)) }
+func (h *accessHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
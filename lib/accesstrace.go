@@ -0,0 +1,228 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+)
+
+// accessTraceMagic starts every access trace file.
+const accessTraceMagic = "ent-access-trace-v1\n"
+
+// AccessTrace records the block reads reaching the on disk chain stores to a
+// trace file if set, for replay with ReplayAccessTrace.
+var AccessTrace *AccessTraceWriter
+
+// AccessTraceWriter writes the CID and size of every block read, in the order
+// reads complete.  Each read is written as the uvarint length of the CID, the CID
+// bytes and the uvarint block size.  It is safe for concurrent use.
+type AccessTraceWriter struct {
+	lk    sync.Mutex
+	f     *os.File
+	w     *bufio.Writer
+	err   error
+	reads uint64
+}
+
+// CreateAccessTrace creates an access trace file at path.
+func CreateAccessTrace(path string) (*AccessTraceWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriterSize(f, 1<<20)
+	if _, err := w.WriteString(accessTraceMagic); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &AccessTraceWriter{f: f, w: w}, nil
+}
+
+// record writes a read of the block c of size bytes.  The first write error is
+// kept for Close.
+func (t *AccessTraceWriter) record(c cid.Cid, size int) {
+	var buf [2 * binary.MaxVarintLen64]byte
+	key := c.Bytes()
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if t.err != nil {
+		return
+	}
+	n := binary.PutUvarint(buf[:], uint64(len(key)))
+	if _, t.err = t.w.Write(buf[:n]); t.err != nil {
+		return
+	}
+	if _, t.err = t.w.Write(key); t.err != nil {
+		return
+	}
+	n = binary.PutUvarint(buf[:], uint64(size))
+	_, t.err = t.w.Write(buf[:n])
+	t.reads++
+}
+
+// Reads returns the number of reads recorded.
+func (t *AccessTraceWriter) Reads() uint64 {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	return t.reads
+}
+
+// Close flushes the trace and closes its file.
+func (t *AccessTraceWriter) Close() error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+	if err := t.f.Close(); t.err == nil {
+		t.err = err
+	}
+	return t.err
+}
+
+// TraceRead is a block read of an access trace.
+type TraceRead struct {
+	Cid  cid.Cid
+	Size int
+}
+
+// ReadAccessTrace reads an access trace written by AccessTraceWriter, passing each
+// read to fn in order.
+func ReadAccessTrace(r io.Reader, fn func(TraceRead) error) error {
+	br := bufio.NewReaderSize(r, 1<<20)
+	magic := make([]byte, len(accessTraceMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != accessTraceMagic {
+		return xerrors.Errorf("not an ent access trace")
+	}
+	var key []byte
+	for i := 0; ; i++ {
+		l, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return xerrors.Errorf("read %d: %w", i, err)
+		}
+		if cap(key) < int(l) {
+			key = make([]byte, l)
+		}
+		key = key[:l]
+		if _, err := io.ReadFull(br, key); err != nil {
+			return xerrors.Errorf("read %d: truncated trace: %w", i, err)
+		}
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return xerrors.Errorf("read %d: truncated trace: %w", i, err)
+		}
+		c, err := cid.Cast(key)
+		if err != nil {
+			return xerrors.Errorf("read %d: %w", i, err)
+		}
+		if err := fn(TraceRead{Cid: c, Size: int(size)}); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplayStats summarizes the replay of an access trace.
+type ReplayStats struct {
+	Reads   uint64
+	Missing uint64
+	Bytes   uint64
+	Elapsed time.Duration
+	// Latencies are the p50, p90, p99 and max read latencies
+	Latencies [4]time.Duration
+}
+
+// ReplayAccessTrace reads the blocks of the access trace r from bs in trace order
+// with workers concurrent reads, timing each read.  Blocks missing from bs are
+// counted, not failed.
+func ReplayAccessTrace(ctx context.Context, bs blockstore.Blockstore, r io.Reader, workers int) (*ReplayStats, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	var stats ReplayStats
+	reads := make(chan cid.Cid, workers*64)
+	latencies := make([][]time.Duration, workers)
+	grp, ctx := errgroup.WithContext(ctx)
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		i := i
+		grp.Go(func() error {
+			for c := range reads {
+				readStart := time.Now()
+				b, err := bs.Get(c)
+				latencies[i] = append(latencies[i], time.Since(readStart))
+				if err == blockstore.ErrNotFound {
+					atomic.AddUint64(&stats.Missing, 1)
+					continue
+				}
+				if err != nil {
+					return xerrors.Errorf("failed to read %s: %w", c, err)
+				}
+				atomic.AddUint64(&stats.Reads, 1)
+				atomic.AddUint64(&stats.Bytes, uint64(len(b.RawData())))
+			}
+			return nil
+		})
+	}
+	grp.Go(func() error {
+		defer close(reads)
+		return ReadAccessTrace(r, func(tr TraceRead) error {
+			select {
+			case reads <- tr.Cid:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	})
+	if err := grp.Wait(); err != nil {
+		return nil, err
+	}
+	stats.Elapsed = time.Since(start)
+	var all []time.Duration
+	for _, l := range latencies {
+		all = append(all, l...)
+	}
+	if len(all) > 0 {
+		sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+		for i, p := range []float64{0.5, 0.9, 0.99, 1} {
+			idx := int(p*float64(len(all))+0.5) - 1
+			if idx < 0 {
+				idx = 0
+			}
+			stats.Latencies[i] = all[idx]
+		}
+	}
+	return &stats, nil
+}
+
+// OpenDatastoreBlockstore opens the badger datastore directory at path, like a
+// lotus chain datastore, as a blockstore.
+func OpenDatastoreBlockstore(path string) (blockstore.Blockstore, func() error, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil, err
+	}
+	ds, err := chainBadgerDs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return blockstore.NewBlockstore(ds), ds.Close, nil
+}
@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"context"
+
+	address "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+)
+
+// ActorSnapshot holds the actor records of a state in memory, to count the actors
+// other states differ in without walking the state again.
+type ActorSnapshot struct {
+	// Actors is the root of the actors tree of the state
+	Actors cid.Cid
+	actors map[address.Address]Actor
+}
+
+// LoadActorSnapshot loads the actors of the state at root.
+func LoadActorSnapshot(ctx context.Context, store cbornode.IpldStore, root cid.Cid) (*ActorSnapshot, error) {
+	info, err := InspectRoot(ctx, store, root)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := LoadActorsTree(ctx, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return nil, err
+	}
+	s := &ActorSnapshot{Actors: info.Actors, actors: make(map[address.Address]Actor)}
+	err = tree.ForEach(func(addr address.Address, a *Actor) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s.actors[addr] = *a
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// CountActorDiffs returns the number of actors present in only one of the
+// snapshot and the state at root, or whose code, head, nonce or balance differ
+// between them.  States sharing an actors tree are not walked.
+func (s *ActorSnapshot) CountActorDiffs(ctx context.Context, store cbornode.IpldStore, root cid.Cid) (int, error) {
+	info, err := InspectRoot(ctx, store, root)
+	if err != nil {
+		return 0, err
+	}
+	if info.Actors.Equals(s.Actors) {
+		return 0, nil
+	}
+	tree, err := LoadActorsTree(ctx, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return 0, err
+	}
+	diffs, common := 0, 0
+	err = tree.ForEach(func(addr address.Address, a *Actor) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		prev, found := s.actors[addr]
+		if !found {
+			diffs++
+			return nil
+		}
+		common++
+		if !prev.Code.Equals(a.Code) || !prev.Head.Equals(a.Head) || prev.CallSeqNum != a.CallSeqNum || !prev.Balance.Equals(a.Balance) {
+			diffs++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// Actors of the snapshot not found in the state
+	return diffs + len(s.actors) - common, nil
+}
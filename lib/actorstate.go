@@ -0,0 +1,263 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/filecoin-project/go-state-types/cbor"
+	account0 "github.com/filecoin-project/specs-actors/actors/builtin/account"
+	cron0 "github.com/filecoin-project/specs-actors/actors/builtin/cron"
+	init0 "github.com/filecoin-project/specs-actors/actors/builtin/init"
+	market0 "github.com/filecoin-project/specs-actors/actors/builtin/market"
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	multisig0 "github.com/filecoin-project/specs-actors/actors/builtin/multisig"
+	paych0 "github.com/filecoin-project/specs-actors/actors/builtin/paych"
+	power0 "github.com/filecoin-project/specs-actors/actors/builtin/power"
+	reward0 "github.com/filecoin-project/specs-actors/actors/builtin/reward"
+	system0 "github.com/filecoin-project/specs-actors/actors/builtin/system"
+	verifreg0 "github.com/filecoin-project/specs-actors/actors/builtin/verifreg"
+	account2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/account"
+	cron2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/cron"
+	init2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/init"
+	market2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/market"
+	miner2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/miner"
+	multisig2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/multisig"
+	paych2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/paych"
+	power2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/power"
+	reward2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/reward"
+	system2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/system"
+	verifreg2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/verifreg"
+	account3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/account"
+	cron3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/cron"
+	init3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/init"
+	market3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/market"
+	miner3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/miner"
+	multisig3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/multisig"
+	paych3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/paych"
+	power3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/power"
+	reward3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/reward"
+	system3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/system"
+	verifreg3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/verifreg"
+	account4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/account"
+	cron4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/cron"
+	init4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/init"
+	market4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/market"
+	miner4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/miner"
+	multisig4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/multisig"
+	paych4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/paych"
+	power4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/power"
+	reward4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/reward"
+	system4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/system"
+	verifreg4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/verifreg"
+	account5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/account"
+	cron5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/cron"
+	init5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/init"
+	market5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/market"
+	miner5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/miner"
+	multisig5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/multisig"
+	paych5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/paych"
+	power5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/power"
+	reward5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/reward"
+	system5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/system"
+	verifreg5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/verifreg"
+	account6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/account"
+	cron6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/cron"
+	init6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/init"
+	market6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/market"
+	miner6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/miner"
+	multisig6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/multisig"
+	paych6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/paych"
+	power6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/power"
+	reward6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/reward"
+	system6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/system"
+	verifreg6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/verifreg"
+	account7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/account"
+	cron7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/cron"
+	init7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/init"
+	market7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/market"
+	miner7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/miner"
+	multisig7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/multisig"
+	paych7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/paych"
+	power7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/power"
+	reward7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/reward"
+	system7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/system"
+	verifreg7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/verifreg"
+	account8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/account"
+	cron8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/cron"
+	init8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/init"
+	market8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/market"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	multisig8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/multisig"
+	paych8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/paych"
+	power8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/power"
+	reward8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/reward"
+	system8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/system"
+	verifreg8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/verifreg"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// actorStates construct the head state type of every builtin actor by actors
+// version and actor name.  Actors v1 shares the v0 types.
+var actorStates = map[int]map[string]func() cbor.Unmarshaler{
+	0: {
+		"account":          func() cbor.Unmarshaler { return new(account0.State) },
+		"cron":             func() cbor.Unmarshaler { return new(cron0.State) },
+		"init":             func() cbor.Unmarshaler { return new(init0.State) },
+		"storagemarket":    func() cbor.Unmarshaler { return new(market0.State) },
+		"storageminer":     func() cbor.Unmarshaler { return new(miner0.State) },
+		"multisig":         func() cbor.Unmarshaler { return new(multisig0.State) },
+		"paymentchannel":   func() cbor.Unmarshaler { return new(paych0.State) },
+		"storagepower":     func() cbor.Unmarshaler { return new(power0.State) },
+		"reward":           func() cbor.Unmarshaler { return new(reward0.State) },
+		"system":           func() cbor.Unmarshaler { return new(system0.State) },
+		"verifiedregistry": func() cbor.Unmarshaler { return new(verifreg0.State) },
+	},
+	2: {
+		"account":          func() cbor.Unmarshaler { return new(account2.State) },
+		"cron":             func() cbor.Unmarshaler { return new(cron2.State) },
+		"init":             func() cbor.Unmarshaler { return new(init2.State) },
+		"storagemarket":    func() cbor.Unmarshaler { return new(market2.State) },
+		"storageminer":     func() cbor.Unmarshaler { return new(miner2.State) },
+		"multisig":         func() cbor.Unmarshaler { return new(multisig2.State) },
+		"paymentchannel":   func() cbor.Unmarshaler { return new(paych2.State) },
+		"storagepower":     func() cbor.Unmarshaler { return new(power2.State) },
+		"reward":           func() cbor.Unmarshaler { return new(reward2.State) },
+		"system":           func() cbor.Unmarshaler { return new(system2.State) },
+		"verifiedregistry": func() cbor.Unmarshaler { return new(verifreg2.State) },
+	},
+	3: {
+		"account":          func() cbor.Unmarshaler { return new(account3.State) },
+		"cron":             func() cbor.Unmarshaler { return new(cron3.State) },
+		"init":             func() cbor.Unmarshaler { return new(init3.State) },
+		"storagemarket":    func() cbor.Unmarshaler { return new(market3.State) },
+		"storageminer":     func() cbor.Unmarshaler { return new(miner3.State) },
+		"multisig":         func() cbor.Unmarshaler { return new(multisig3.State) },
+		"paymentchannel":   func() cbor.Unmarshaler { return new(paych3.State) },
+		"storagepower":     func() cbor.Unmarshaler { return new(power3.State) },
+		"reward":           func() cbor.Unmarshaler { return new(reward3.State) },
+		"system":           func() cbor.Unmarshaler { return new(system3.State) },
+		"verifiedregistry": func() cbor.Unmarshaler { return new(verifreg3.State) },
+	},
+	4: {
+		"account":          func() cbor.Unmarshaler { return new(account4.State) },
+		"cron":             func() cbor.Unmarshaler { return new(cron4.State) },
+		"init":             func() cbor.Unmarshaler { return new(init4.State) },
+		"storagemarket":    func() cbor.Unmarshaler { return new(market4.State) },
+		"storageminer":     func() cbor.Unmarshaler { return new(miner4.State) },
+		"multisig":         func() cbor.Unmarshaler { return new(multisig4.State) },
+		"paymentchannel":   func() cbor.Unmarshaler { return new(paych4.State) },
+		"storagepower":     func() cbor.Unmarshaler { return new(power4.State) },
+		"reward":           func() cbor.Unmarshaler { return new(reward4.State) },
+		"system":           func() cbor.Unmarshaler { return new(system4.State) },
+		"verifiedregistry": func() cbor.Unmarshaler { return new(verifreg4.State) },
+	},
+	5: {
+		"account":          func() cbor.Unmarshaler { return new(account5.State) },
+		"cron":             func() cbor.Unmarshaler { return new(cron5.State) },
+		"init":             func() cbor.Unmarshaler { return new(init5.State) },
+		"storagemarket":    func() cbor.Unmarshaler { return new(market5.State) },
+		"storageminer":     func() cbor.Unmarshaler { return new(miner5.State) },
+		"multisig":         func() cbor.Unmarshaler { return new(multisig5.State) },
+		"paymentchannel":   func() cbor.Unmarshaler { return new(paych5.State) },
+		"storagepower":     func() cbor.Unmarshaler { return new(power5.State) },
+		"reward":           func() cbor.Unmarshaler { return new(reward5.State) },
+		"system":           func() cbor.Unmarshaler { return new(system5.State) },
+		"verifiedregistry": func() cbor.Unmarshaler { return new(verifreg5.State) },
+	},
+	6: {
+		"account":          func() cbor.Unmarshaler { return new(account6.State) },
+		"cron":             func() cbor.Unmarshaler { return new(cron6.State) },
+		"init":             func() cbor.Unmarshaler { return new(init6.State) },
+		"storagemarket":    func() cbor.Unmarshaler { return new(market6.State) },
+		"storageminer":     func() cbor.Unmarshaler { return new(miner6.State) },
+		"multisig":         func() cbor.Unmarshaler { return new(multisig6.State) },
+		"paymentchannel":   func() cbor.Unmarshaler { return new(paych6.State) },
+		"storagepower":     func() cbor.Unmarshaler { return new(power6.State) },
+		"reward":           func() cbor.Unmarshaler { return new(reward6.State) },
+		"system":           func() cbor.Unmarshaler { return new(system6.State) },
+		"verifiedregistry": func() cbor.Unmarshaler { return new(verifreg6.State) },
+	},
+	7: {
+		"account":          func() cbor.Unmarshaler { return new(account7.State) },
+		"cron":             func() cbor.Unmarshaler { return new(cron7.State) },
+		"init":             func() cbor.Unmarshaler { return new(init7.State) },
+		"storagemarket":    func() cbor.Unmarshaler { return new(market7.State) },
+		"storageminer":     func() cbor.Unmarshaler { return new(miner7.State) },
+		"multisig":         func() cbor.Unmarshaler { return new(multisig7.State) },
+		"paymentchannel":   func() cbor.Unmarshaler { return new(paych7.State) },
+		"storagepower":     func() cbor.Unmarshaler { return new(power7.State) },
+		"reward":           func() cbor.Unmarshaler { return new(reward7.State) },
+		"system":           func() cbor.Unmarshaler { return new(system7.State) },
+		"verifiedregistry": func() cbor.Unmarshaler { return new(verifreg7.State) },
+	},
+	8: {
+		"account":          func() cbor.Unmarshaler { return new(account8.State) },
+		"cron":             func() cbor.Unmarshaler { return new(cron8.State) },
+		"init":             func() cbor.Unmarshaler { return new(init8.State) },
+		"storagemarket":    func() cbor.Unmarshaler { return new(market8.State) },
+		"storageminer":     func() cbor.Unmarshaler { return new(miner8.State) },
+		"multisig":         func() cbor.Unmarshaler { return new(multisig8.State) },
+		"paymentchannel":   func() cbor.Unmarshaler { return new(paych8.State) },
+		"storagepower":     func() cbor.Unmarshaler { return new(power8.State) },
+		"reward":           func() cbor.Unmarshaler { return new(reward8.State) },
+		"system":           func() cbor.Unmarshaler { return new(system8.State) },
+		"verifiedregistry": func() cbor.Unmarshaler { return new(verifreg8.State) },
+	},
+}
+
+// NewActorState returns a new value of the head state type of the builtin actor
+// name, like "storageminer", in an actors version.
+func NewActorState(actorsVersion int, name string) (cbor.Unmarshaler, error) {
+	if actorsVersion == 1 {
+		actorsVersion = 0
+	}
+	states, ok := actorStates[actorsVersion]
+	if !ok {
+		return nil, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+	newState, ok := states[name]
+	if !ok {
+		return nil, xerrors.Errorf("unknown actor %q in actors v%d", name, actorsVersion)
+	}
+	return newState(), nil
+}
+
+// RoundTripActorState decodes the block at head into st, encodes st again and
+// checks the encoding and its CID match the block exactly.  A mismatch is an
+// asymmetry between the decoder and encoder of the state type.
+func RoundTripActorState(ctx context.Context, store cbornode.IpldStore, head cid.Cid, st cbor.Unmarshaler) error {
+	m, ok := st.(cbor.Marshaler)
+	if !ok {
+		return xerrors.Errorf("state type %T has no cbor encoder", st)
+	}
+	var raw cbg.Deferred
+	if err := store.Get(ctx, head, &raw); err != nil {
+		return xerrors.Errorf("failed to load %s: %w", head, err)
+	}
+	if err := st.UnmarshalCBOR(bytes.NewReader(raw.Raw)); err != nil {
+		return xerrors.Errorf("failed to decode: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := m.MarshalCBOR(&buf); err != nil {
+		return xerrors.Errorf("failed to encode: %w", err)
+	}
+	encoded := buf.Bytes()
+	if !bytes.Equal(encoded, raw.Raw) {
+		at := 0
+		for at < len(encoded) && at < len(raw.Raw) && encoded[at] == raw.Raw[at] {
+			at++
+		}
+		return xerrors.Errorf("re-encoding is %d bytes, not %d, and differs from byte %d", len(encoded), len(raw.Raw), at)
+	}
+	c, err := head.Prefix().Sum(encoded)
+	if err != nil {
+		return err
+	}
+	if !c.Equals(head) {
+		return xerrors.Errorf("re-encoding has CID %s", c)
+	}
+	return nil
+}
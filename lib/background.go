@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Background runs ent opportunistically on a machine with other work: the number
+// of concurrent export workers and chain store reads follows the system load and
+// flushes pause while the machine is fully loaded.
+var Background bool
+
+const (
+	// backgroundPollPeriod is the time between load readings
+	backgroundPollPeriod = 5 * time.Second
+	// backgroundTargetLoad is the load per CPU above which concurrency drops
+	backgroundTargetLoad = 0.75
+	// backgroundPauseLoad is the load per CPU at and above which flushes pause
+	backgroundPauseLoad = 1.0
+)
+
+// LoadAverage returns the one minute system load average.
+func LoadAverage() (float64, error) {
+	raw, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, xerrors.Errorf("failed to read load average: %w", err)
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return 0, xerrors.Errorf("unexpected /proc/loadavg %q", raw)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// loadGovernor adjusts the allowed concurrency to the system load.  Concurrency
+// drops by one per reading while load is over target and rises by one while it is
+// well under, so that a burst of load elsewhere is yielded to within a minute or
+// so.
+type loadGovernor struct {
+	lk      sync.Mutex
+	cond    *sync.Cond
+	max     int
+	allowed int
+	// active counts the work units of each gate.  Gates are separate so that
+	// units of one gate may wait on another, e.g. export workers reading the
+	// chain store.
+	active [numGates]int
+	paused bool
+}
+
+// Gates of concurrent work, each allowed as many units as the load allows
+const (
+	gateExport = iota
+	gateStoreRead
+	numGates
+)
+
+var (
+	governorOnce sync.Once
+	governorVal  *loadGovernor
+)
+
+// backgroundGovernor returns the running governor, nil unless Background is set.
+func backgroundGovernor() *loadGovernor {
+	governorOnce.Do(func() {
+		if !Background {
+			return
+		}
+		g := &loadGovernor{max: runtime.NumCPU(), allowed: runtime.NumCPU()}
+		g.cond = sync.NewCond(&g.lk)
+		g.poll()
+		go func() {
+			for range time.Tick(backgroundPollPeriod) {
+				g.poll()
+			}
+		}()
+		governorVal = g
+	})
+	return governorVal
+}
+
+func (g *loadGovernor) poll() {
+	load, err := LoadAverage()
+	if err != nil {
+		// Without load readings run as if in the foreground
+		return
+	}
+	perCPU := load / float64(g.max)
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	allowed, paused := g.allowed, perCPU >= backgroundPauseLoad
+	if perCPU > backgroundTargetLoad && allowed > 1 {
+		allowed--
+	} else if perCPU < 0.8*backgroundTargetLoad && allowed < g.max {
+		allowed++
+	}
+	if allowed != g.allowed || paused != g.paused {
+		state := "running"
+		if paused {
+			state = "flushes paused"
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "background: load %.2f, %d workers, %s\n", load, allowed, state)
+	}
+	g.allowed, g.paused = allowed, paused
+	g.cond.Broadcast()
+}
+
+func (g *loadGovernor) acquire(gate int) {
+	g.lk.Lock()
+	for g.active[gate] >= g.allowed {
+		g.cond.Wait()
+	}
+	g.active[gate]++
+	g.lk.Unlock()
+}
+
+func (g *loadGovernor) release(gate int) {
+	g.lk.Lock()
+	g.active[gate]--
+	g.lk.Unlock()
+	g.cond.Broadcast()
+}
+
+func noRelease() {}
+
+// backgroundAcquire blocks until the system load allows another concurrent unit
+// of work through gate and returns a func releasing it.  Without Background it
+// returns at once.
+func backgroundAcquire(gate int) func() {
+	g := backgroundGovernor()
+	if g == nil {
+		return noRelease
+	}
+	g.acquire(gate)
+	return func() { g.release(gate) }
+}
+
+// backgroundWait blocks while flushes are paused for high system load.
+func backgroundWait(ctx context.Context) error {
+	g := backgroundGovernor()
+	if g == nil {
+		return nil
+	}
+	for {
+		g.lk.Lock()
+		paused := g.paused
+		g.lk.Unlock()
+		if !paused {
+			return nil
+		}
+		select {
+		case <-time.After(backgroundPollPeriod):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"context"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+)
+
+// BalanceChange is the change of the balance of an actor between two states.
+// Actors created or deleted between the states have a zero balance in the state
+// they are missing from.
+type BalanceChange struct {
+	Addr address.Address
+	// Code names the code of the actor in the second state, or in the first for
+	// deleted actors, like "storageminer"
+	Code   string
+	Before abi.TokenAmount
+	After  abi.TokenAmount
+	Delta  abi.TokenAmount
+}
+
+// DiffBalances returns the actors whose balance differs between the states at
+// rootA and rootB, which may be of different actors versions, in decreasing order
+// of balance change: the largest increase first and the largest decrease last.
+// The balances of rootA are held in memory while rootB is walked.
+func DiffBalances(ctx context.Context, store cbornode.IpldStore, rootA, rootB cid.Cid) ([]*BalanceChange, error) {
+	type actorBalance struct {
+		code    string
+		balance abi.TokenAmount
+	}
+	before := make(map[address.Address]actorBalance)
+	err := forEachNamedActor(ctx, store, rootA, func(addr address.Address, code string, a *Actor) error {
+		before[addr] = actorBalance{code: code, balance: a.Balance}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*BalanceChange
+	err = forEachNamedActor(ctx, store, rootB, func(addr address.Address, code string, a *Actor) error {
+		prev, found := before[addr]
+		delete(before, addr)
+		if !found {
+			prev.balance = big.Zero()
+		}
+		if delta := big.Sub(a.Balance, prev.balance); !delta.IsZero() {
+			changes = append(changes, &BalanceChange{Addr: addr, Code: code, Before: prev.balance, After: a.Balance, Delta: delta})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Actors left were deleted
+	for addr, prev := range before {
+		if !prev.balance.IsZero() {
+			changes = append(changes, &BalanceChange{Addr: addr, Code: prev.code, Before: prev.balance, After: big.Zero(), Delta: prev.balance.Neg()})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if cmp := big.Cmp(changes[i].Delta, changes[j].Delta); cmp != 0 {
+			return cmp > 0
+		}
+		return changes[i].Addr.String() < changes[j].Addr.String()
+	})
+	return changes, nil
+}
+
+// forEachNamedActor calls fn with every actor of the state at root and the name
+// of its code.
+func forEachNamedActor(ctx context.Context, store cbornode.IpldStore, root cid.Cid, fn func(addr address.Address, code string, a *Actor) error) error {
+	info, err := InspectRoot(ctx, store, root)
+	if err != nil {
+		return err
+	}
+	tree, err := LoadActorsTree(ctx, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return err
+	}
+	name, err := ActorCodeNamer(ctx, store, info)
+	if err != nil {
+		return err
+	}
+	return tree.ForEach(func(addr address.Address, a *Actor) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(addr, name(a.Code), a)
+	})
+}
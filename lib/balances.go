@@ -2,15 +2,16 @@ package lib
 
 import (
 	"context"
+	"io"
+	"sync"
 
 	address "github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
-	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
-	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
-	states0 "github.com/filecoin-project/specs-actors/actors/states"
-	"github.com/filecoin-project/specs-actors/actors/util/adt"
+	"github.com/filecoin-project/go-state-types/big"
 	cid "github.com/ipfs/go-cid"
 	cbornode "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
 )
 
 type BalanceInfo struct {
@@ -18,35 +19,98 @@ type BalanceInfo struct {
 	LockedFunds       abi.TokenAmount
 	InitialPledge     abi.TokenAmount
 	PreCommitDeposits abi.TokenAmount
+	// FeeDebt is the unpaid fee debt of miners of actors v2 and later, zero in v0
+	FeeDebt abi.TokenAmount
 }
 
-// V0TreeMinerBalancse returns a map of every miner's balance info
-// at the provided state tree.  It is used for displaying and validating miner
-// info.
-func V0TreeMinerBalances(ctx context.Context, store cbornode.IpldStore, stateRootIn cid.Cid) (map[address.Address]BalanceInfo, error) {
-	adtStore := adt.WrapStore(ctx, store)
-	actorsIn, err := states0.LoadTree(adtStore, stateRootIn)
-	if err != nil {
-		return nil, err
+// Available is the balance not locked, pledged or deposited, negative if the
+// miner cannot cover them.
+func (bi BalanceInfo) Available() abi.TokenAmount {
+	return big.Sub(bi.Balance, big.Sum(bi.LockedFunds, bi.PreCommitDeposits, bi.InitialPledge))
+}
+
+// Debt is the fee debt and the shortfall of a negative available balance.
+func (bi BalanceInfo) Debt() abi.TokenAmount {
+	debt := bi.FeeDebt
+	if available := bi.Available(); available.LessThan(big.Zero()) {
+		debt = big.Add(debt, available.Neg())
 	}
-	balances := make(map[address.Address]BalanceInfo)
+	return debt
+}
 
-	err = actorsIn.ForEach(func(addr address.Address, a *states0.Actor) error {
-		if !a.Code.Equals(builtin0.StorageMinerActorCodeID) {
+// ForEachMinerBalance calls fn with the balance info of every miner of the state
+// at root, in any actors version, as it is decoded on a worker per CPU.  Calls
+// are not concurrent but come in no particular order.  Nothing is accumulated, so
+// memory stays flat however many miners the state has.
+func ForEachMinerBalance(ctx context.Context, store cbornode.IpldStore, root cid.Cid, fn func(addr address.Address, bi BalanceInfo) error) error {
+	var lk sync.Mutex
+	return ForEachActor(ctx, store, root, DetectActorsVersion, func(v *ActorVisit) error {
+		if v.Code != "storageminer" {
 			return nil
 		}
-		var inState miner0.State
-		if err := store.Get(ctx, a.Head, &inState); err != nil {
-			return err
-		}
-		balance := BalanceInfo{
-			Balance:           a.Balance,
-			LockedFunds:       inState.LockedFunds,
-			InitialPledge:     inState.InitialPledgeRequirement,
-			PreCommitDeposits: inState.PreCommitDeposits,
+		bi, err := MinerBalanceInfo(ctx, store, v.ActorsVersion, &v.Actor)
+		if err != nil {
+			return xerrors.Errorf("failed to load balances of miner %s: %w", v.Addr, err)
 		}
-		balances[addr] = balance
-		return nil
+		lk.Lock()
+		defer lk.Unlock()
+		return fn(v.Addr, bi)
 	})
-	return balances, err
+}
+
+// MinerBalanceInfo returns the balance info of a miner actor of actorsVersion.
+// It decodes only the leading balance fields of the miner state and skips its
+// sector bitfields and the rest.
+func MinerBalanceInfo(ctx context.Context, store cbornode.IpldStore, actorsVersion int, a *Actor) (BalanceInfo, error) {
+	if actorsVersion > 8 {
+		return BalanceInfo{}, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+	funds := minerFunds{actorsVersion: actorsVersion}
+	if err := store.Get(ctx, a.Head, &funds); err != nil {
+		return BalanceInfo{}, err
+	}
+	funds.bi.Balance = a.Balance
+	return funds.bi, nil
+}
+
+// minerFunds decodes the balance fields of a miner state, the same prefix of the
+// state tuple in every actors version:
+//
+//	v0:  [Info, PreCommitDeposits, LockedFunds, VestingFunds, InitialPledgeRequirement, ...]
+//	v2+: [Info, PreCommitDeposits, LockedFunds, VestingFunds, FeeDebt, InitialPledge, ...]
+type minerFunds struct {
+	actorsVersion int
+	bi            BalanceInfo
+}
+
+func (m *minerFunds) UnmarshalCBOR(r io.Reader) error {
+	maj, extra, err := cbg.CborReadHeader(r)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray || extra < 6 {
+		return xerrors.Errorf("miner state is not a tuple of at least 6 fields")
+	}
+	if _, err := cbg.ReadCid(r); err != nil {
+		return xerrors.Errorf("failed to read Info: %w", err)
+	}
+	if err := m.bi.PreCommitDeposits.UnmarshalCBOR(r); err != nil {
+		return xerrors.Errorf("failed to read PreCommitDeposits: %w", err)
+	}
+	if err := m.bi.LockedFunds.UnmarshalCBOR(r); err != nil {
+		return xerrors.Errorf("failed to read LockedFunds: %w", err)
+	}
+	if _, err := cbg.ReadCid(r); err != nil {
+		return xerrors.Errorf("failed to read VestingFunds: %w", err)
+	}
+	m.bi.FeeDebt = big.Zero()
+	if m.actorsVersion >= 2 {
+		if err := m.bi.FeeDebt.UnmarshalCBOR(r); err != nil {
+			return xerrors.Errorf("failed to read FeeDebt: %w", err)
+		}
+	}
+	if err := m.bi.InitialPledge.UnmarshalCBOR(r); err != nil {
+		return xerrors.Errorf("failed to read InitialPledge: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+// A buffer directory holds the buffered output of a migration, written in place
+// of flushing it to ent's store, so the migration can run on one machine and be
+// flushed on another.  It holds the blocks in a badger datastore and a json
+// description of the migration.
+const (
+	bufferDirBlocks = "blocks"
+	bufferDirInfo   = "buffer.json"
+)
+
+// BufferDirInfo describes the migration whose output a buffer directory holds.
+type BufferDirInfo struct {
+	StateRootIn  cid.Cid
+	StateRootOut cid.Cid
+	// StateRootOutWrapped is the versioned state root wrapping StateRootOut when
+	// the migration ran with --wrap-output
+	StateRootOutWrapped *cid.Cid `json:",omitempty"`
+	Height              abi.ChainEpoch
+	ActorsVersion       int
+	// Blocks is the number of blocks in the directory
+	Blocks uint64
+}
+
+// WriteBufferDir writes the blocks of the buffer to the directory dir, which must
+// not exist yet, rather than flushing them to ent's store.  The description is
+// written last so an interrupted write is detected when reading dir.
+func (c *Chain) WriteBufferDir(ctx context.Context, dir string, info BufferDirInfo) error {
+	bs, err := c.loadBufferedBstore(ctx)
+	if err != nil {
+		return err
+	}
+	dir, err = homedir.Expand(dir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return xerrors.Errorf("%s already exists", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ds, err := chainBadgerDs(filepath.Join(dir, bufferDirBlocks))
+	if err != nil {
+		return xerrors.Errorf("failed to create buffer datastore: %w", err)
+	}
+	_, before := bs.Stats()
+	if err := bs.FlushBufferTo(ctx, blockstore.NewBlockstore(ds)); err != nil {
+		_ = ds.Close()
+		return err
+	}
+	if err := ds.Close(); err != nil {
+		return err
+	}
+	_, after := bs.Stats()
+	info.Blocks = after - before
+	raw, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, bufferDirInfo), raw, 0644)
+}
+
+// ReadBufferDirInfo returns the description of the buffer directory dir.
+func ReadBufferDirInfo(dir string) (*BufferDirInfo, error) {
+	dir, err := homedir.Expand(dir)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(dir, bufferDirInfo))
+	if os.IsNotExist(err) {
+		return nil, xerrors.Errorf("%s is not a complete buffer directory, its write was interrupted or it was not written by migrate --buffer-out", dir)
+	} else if err != nil {
+		return nil, err
+	}
+	var info BufferDirInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, xerrors.Errorf("failed to parse %s: %w", bufferDirInfo, err)
+	}
+	return &info, nil
+}
+
+// FlushBufferDir writes every block of the buffer directory dir to dst, or to
+// ent's store when dst is nil, and returns the number of blocks written.
+func (c *Chain) FlushBufferDir(ctx context.Context, dir string, dst blockstore.Blockstore) (uint64, error) {
+	bs, err := c.loadBufferedBstore(ctx)
+	if err != nil {
+		return 0, err
+	}
+	src, closeSrc, err := OpenDatastoreBlockstore(filepath.Join(dir, bufferDirBlocks))
+	if err != nil {
+		return 0, xerrors.Errorf("failed to open buffer datastore: %w", err)
+	}
+	defer closeSrc() // nolint:errcheck
+	if dst == nil {
+		_, before := bs.Stats()
+		err := bs.FlushFrom(ctx, src)
+		_, after := bs.Stats()
+		return after - before, err
+	}
+	var written uint64
+	err = copyAllBlocks(ctx, src, dst, &written)
+	return written, err
+}
+
+// CreateDatastoreBlockstore opens the badger datastore directory at path as a
+// blockstore, creating it if it does not exist.
+func CreateDatastoreBlockstore(path string) (blockstore.Blockstore, func() error, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, nil, err
+	}
+	ds, err := chainBadgerDs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return blockstore.NewBlockstore(ds), ds.Close, nil
+}
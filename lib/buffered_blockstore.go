@@ -2,6 +2,7 @@ package lib
 
 import (
 	"context"
+	"sync/atomic"
 
 	block "github.com/ipfs/go-block-format"
 	blocks "github.com/ipfs/go-block-format"
@@ -20,17 +21,32 @@ type BufferedBlockstore struct {
 	buffer   blockstore.Blockstore
 	read     blockstore.Blockstore
 	write    blockstore.Blockstore
+
+	// block counts for progress reporting, buffered counts repeated puts
+	buffered uint64
+	flushed  uint64
 }
 
 func NewBufferedBlockstore(readLotusPath, writeEntPath string) (*BufferedBlockstore, error) {
-	// load lotus chain datastore
-	lotusExpPath, err := homedir.Expand(lotusPath)
-	if err != nil {
-		return nil, err
-	}
-	lotusDS, err := chainBadgerDs(lotusExpPath)
-	if err != nil {
-		return nil, err
+	// load lotus chain datastore, or the configured store tiers, which retry
+	// reads tier by tier
+	var lotusBS blockstore.Blockstore
+	if Stores != nil {
+		tiered, err := NewTieredBlockstore(Stores)
+		if err != nil {
+			return nil, err
+		}
+		lotusBS = tiered
+	} else {
+		lotusExpPath, err := homedir.Expand(lotusPath)
+		if err != nil {
+			return nil, err
+		}
+		lotusDS, err := chainBadgerDs(lotusExpPath)
+		if err != nil {
+			return nil, err
+		}
+		lotusBS = NewRetryBlockstore(blockstore.NewBlockstore(lotusDS), ReadRetry)
 	}
 	entExpPath, err := homedir.Expand(entChainPath)
 	if err != nil {
@@ -41,11 +57,15 @@ func NewBufferedBlockstore(readLotusPath, writeEntPath string) (*BufferedBlockst
 		return nil, err
 	}
 
+	buffer := NewTemporarySync()
+	if BufferMaxBytes > 0 {
+		buffer = WrapIDStore(NewSpillBlockstore(BufferMaxBytes))
+	}
 	return &BufferedBlockstore{
 		roBuffer: NewTemporary(),
-		buffer:   NewTemporarySync(),
-		read:     blockstore.NewBlockstore(lotusDS),
-		write:    blockstore.NewBlockstore(entDS),
+		buffer:   buffer,
+		read:     NewPrefetchBlockstore(lotusBS, PrefetchWorkers),
+		write:    NewCompressedBlockstore(NewLimitedBlockstore(blockstore.NewBlockstore(entDS)), Compress),
 	}, nil
 }
 
@@ -74,21 +94,41 @@ func (rb *BufferedBlockstore) Has(c cid.Cid) (bool, error) {
 
 func (rb *BufferedBlockstore) Get(c cid.Cid) (blocks.Block, error) {
 	if b, err := rb.roBuffer.Get(c); err == nil {
-		return b, nil
+		return counted(b, tierReadOnlyBuffer), nil
 	} else if err != blockstore.ErrNotFound {
 		return nil, err
 	}
 	if b, err := rb.buffer.Get(c); err == nil {
-		return b, nil
+		return counted(b, tierWriteBuffer), nil
 	} else if err != blockstore.ErrNotFound {
 		return nil, err
 	}
-	if b, err := rb.read.Get(c); err == nil {
-		return b, nil
+	// Lotus store reads run as concurrently as the load allows in the background
+	release := backgroundAcquire(gateStoreRead)
+	b, err := rb.read.Get(c)
+	release()
+	if err == nil {
+		return counted(b, tierLotus), nil
 	} else if err != blockstore.ErrNotFound {
 		return nil, err
 	}
-	return rb.write.Get(c)
+	b, err = rb.write.Get(c)
+	if err != nil {
+		return nil, err
+	}
+	return counted(b, tierEnt), nil
+}
+
+// counted records the read of b from tier if AccessStats is set, and traces it
+// to AccessTrace if it reached an on disk store.
+func counted(b blocks.Block, tier int) blocks.Block {
+	if AccessStats {
+		recordAccess(b.Cid(), len(b.RawData()), tier)
+	}
+	if AccessTrace != nil && tier >= tierLotus {
+		AccessTrace.record(b.Cid(), len(b.RawData()))
+	}
+	return b
 }
 
 func (rb *BufferedBlockstore) GetSize(c cid.Cid) (int, error) {
@@ -102,7 +142,10 @@ func (rb *BufferedBlockstore) GetSize(c cid.Cid) (int, error) {
 	} else if err != blockstore.ErrNotFound {
 		return 0, err
 	}
-	if s, err := rb.read.GetSize(c); err == nil {
+	release := backgroundAcquire(gateStoreRead)
+	s, err := rb.read.GetSize(c)
+	release()
+	if err == nil {
 		return s, nil
 	} else if err != blockstore.ErrNotFound {
 		return 0, err
@@ -111,13 +154,34 @@ func (rb *BufferedBlockstore) GetSize(c cid.Cid) (int, error) {
 }
 
 func (rb *BufferedBlockstore) Put(b blocks.Block) error {
+	atomic.AddUint64(&rb.buffered, 1)
 	return rb.buffer.Put(b)
 }
 
 func (rb *BufferedBlockstore) PutMany(bs []blocks.Block) error {
+	atomic.AddUint64(&rb.buffered, uint64(len(bs)))
 	return rb.buffer.PutMany(bs)
 }
 
+// GetBuffered returns the block c if it is in the write buffer, i.e. it was
+// written by a migration or import since the store was opened.
+func (rb *BufferedBlockstore) GetBuffered(c cid.Cid) (blocks.Block, bool, error) {
+	b, err := rb.buffer.Get(c)
+	if err == blockstore.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+// Stats returns the number of blocks put into the buffer and the number of blocks
+// flushed from it so far.
+func (rb *BufferedBlockstore) Stats() (buffered, flushed uint64) {
+	return atomic.LoadUint64(&rb.buffered), atomic.LoadUint64(&rb.flushed)
+}
+
 func (rb *BufferedBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
 	// shouldn't call this
 	return nil, xerrors.Errorf("redirect block store doesn't support operation")
@@ -134,32 +198,53 @@ func (rb *BufferedBlockstore) LoadToReadOnlyBuffer(ctx context.Context, c cid.Ci
 }
 
 func (rb *BufferedBlockstore) FlushFromBuffer(ctx context.Context, c cid.Cid) error {
-	allCh, err := rb.buffer.AllKeysChan(ctx)
+	return copyAllBlocks(ctx, rb.buffer, rb.write, &rb.flushed)
+}
+
+// FlushBufferTo writes the blocks of the buffer to dst rather than ent's store.
+func (rb *BufferedBlockstore) FlushBufferTo(ctx context.Context, dst blockstore.Blockstore) error {
+	return copyAllBlocks(ctx, rb.buffer, dst, &rb.flushed)
+}
+
+// FlushFrom writes every block of src to ent's store as flushing the buffer
+// does.
+func (rb *BufferedBlockstore) FlushFrom(ctx context.Context, src blockstore.Blockstore) error {
+	return copyAllBlocks(ctx, src, rb.write, &rb.flushed)
+}
+
+// copyAllBlocks writes every block of src to dst in batches, adding the blocks
+// written to count.
+func copyAllBlocks(ctx context.Context, src, dst blockstore.Blockstore, count *uint64) error {
+	allCh, err := src.AllKeysChan(ctx)
 	if err != nil {
 		return err
 	}
-	blkCnt := 0
-	byteCnt := 0
 	var batch []block.Block
 	for c := range allCh {
-		blk, err := rb.buffer.Get(c)
+		blk, err := src.Get(c)
 		if err != nil {
-			return xerrors.Errorf("buffer get in flush", err)
+			return xerrors.Errorf("buffer get in flush: %w", err)
 		}
-		blkCnt += 1
-		byteCnt += len(blk.RawData())
 		batch = append(batch, blk)
 		if len(batch) > 100 {
-			if err := rb.write.PutMany(batch); err != nil {
+			if err := backgroundWait(ctx); err != nil {
+				return err
+			}
+			if err := dst.PutMany(batch); err != nil {
 				return xerrors.Errorf("batch put in flush: %w", err)
 			}
+			atomic.AddUint64(count, uint64(len(batch)))
 			batch = batch[:0]
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if len(batch) > 0 {
-		if err := rb.write.PutMany(batch); err != nil {
+		if err := dst.PutMany(batch); err != nil {
 			return xerrors.Errorf("batch put in flush: %w", err)
 		}
+		atomic.AddUint64(count, uint64(len(batch)))
 	}
 	return nil
 }
@@ -3,6 +3,7 @@ package lib
 import (
 	"encoding/gob"
 	"os"
+	"sync/atomic"
 
 	migration10 "github.com/filecoin-project/specs-actors/v3/actors/migration/nv10"
 	cid "github.com/ipfs/go-cid"
@@ -30,13 +31,26 @@ func PersistCache(stateRoot cid.Cid, cache *migration10.MemMigrationCache) error
 	if err != nil {
 		return err
 	}
-	cacheEnc := gob.NewEncoder(f)
+	defer f.Close() // nolint:errcheck
 	persistMap := make(map[string]cid.Cid)
 	cache.MigrationMap.Range(func(k, v interface{}) bool {
 		persistMap[k.(string)] = v.(cid.Cid)
 		return true
 	})
-	return cacheEnc.Encode(persistMap)
+	if !Compress {
+		if err := gob.NewEncoder(f).Encode(persistMap); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	zw := newCompressedWriter(f)
+	if err := gob.NewEncoder(zw).Encode(persistMap); err != nil {
+		return err
+	}
+	if err := zw.Close(&CacheCompression); err != nil {
+		return err
+	}
+	return f.Close()
 }
 
 func LoadCache(stateRoot cid.Cid) (*migration10.MemMigrationCache, error) {
@@ -48,7 +62,12 @@ func LoadCache(stateRoot cid.Cid) (*migration10.MemMigrationCache, error) {
 	if err != nil {
 		return nil, err
 	}
-	cacheDec := gob.NewDecoder(f)
+	defer f.Close() // nolint:errcheck
+	r, err := maybeDecompress(f)
+	if err != nil {
+		return nil, err
+	}
+	cacheDec := gob.NewDecoder(r)
 
 	persistMap := make(map[string]cid.Cid)
 	err = cacheDec.Decode(&persistMap)
@@ -59,3 +78,49 @@ func LoadCache(stateRoot cid.Cid) (*migration10.MemMigrationCache, error) {
 	}
 	return cache, err
 }
+
+// CacheStats counts hits and misses of a migration cache.
+type CacheStats struct {
+	hits   uint64
+	misses uint64
+}
+
+func (cs *CacheStats) count(hit bool) {
+	if hit {
+		atomic.AddUint64(&cs.hits, 1)
+	} else {
+		atomic.AddUint64(&cs.misses, 1)
+	}
+}
+
+// Get returns the number of cache hits and misses so far.
+func (cs *CacheStats) Get() (hits, misses uint64) {
+	return atomic.LoadUint64(&cs.hits), atomic.LoadUint64(&cs.misses)
+}
+
+// CountingCache is a migration cache recording its hits and misses in stats.  It
+// satisfies the MigrationCache interface of every migration since nv10.
+type CountingCache struct {
+	*migration10.MemMigrationCache
+	stats *CacheStats
+}
+
+func NewCountingCache(cache *migration10.MemMigrationCache, stats *CacheStats) *CountingCache {
+	return &CountingCache{MemMigrationCache: cache, stats: stats}
+}
+
+func (cc *CountingCache) Read(key string) (bool, cid.Cid, error) {
+	found, c, err := cc.MemMigrationCache.Read(key)
+	cc.stats.count(found)
+	return found, c, err
+}
+
+func (cc *CountingCache) Load(key string, loadFunc func() (cid.Cid, error)) (cid.Cid, error) {
+	hit := true
+	c, err := cc.MemMigrationCache.Load(key, func() (cid.Cid, error) {
+		hit = false
+		return loadFunc()
+	})
+	cc.stats.count(hit)
+	return c, err
+}
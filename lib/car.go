@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+
+	block "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	mh "github.com/multiformats/go-multihash"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// Minimal CARv1 support, enough to read actor bundles and write state snapshots
+// without pulling in go-car and its dag service dependencies.
+
+type carHeader struct {
+	Roots   []cid.Cid `refmt:"roots"`
+	Version uint64    `refmt:"version"`
+}
+
+func init() {
+	cbornode.RegisterCborType(carHeader{})
+}
+
+// ImportCar reads every block of a CARv1 stream into bs and returns the roots
+// listed in the CAR header.
+func ImportCar(r io.Reader, bs blockstore.Blockstore) ([]cid.Cid, error) {
+	br := bufio.NewReader(r)
+	hdrBytes, err := readCarSection(br)
+	if err != nil {
+		return nil, xerrors.Errorf("read car header: %w", err)
+	}
+	var hdr carHeader
+	if err := cbornode.DecodeInto(hdrBytes, &hdr); err != nil {
+		return nil, xerrors.Errorf("decode car header: %w", err)
+	}
+	if hdr.Version != 1 {
+		return nil, xerrors.Errorf("unsupported car version %d", hdr.Version)
+	}
+
+	var batch []block.Block
+	for {
+		section, err := readCarSection(br)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, xerrors.Errorf("read car section: %w", err)
+		}
+		n, c, err := cid.CidFromBytes(section)
+		if err != nil {
+			return nil, xerrors.Errorf("read car block cid: %w", err)
+		}
+		blk, err := block.NewBlockWithCid(section[n:], c)
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, blk)
+		if len(batch) > 100 {
+			if err := bs.PutMany(batch); err != nil {
+				return nil, xerrors.Errorf("batch put in car import: %w", err)
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := bs.PutMany(batch); err != nil {
+			return nil, xerrors.Errorf("batch put in car import: %w", err)
+		}
+	}
+	return hdr.Roots, nil
+}
+
+func readCarSection(br *bufio.Reader) ([]byte, error) {
+	l, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// ExportCar writes a CARv1 stream with the given roots holding every block
+// reachable from them in bs.  Identity CIDs and piece commitments are not blocks
+// and are skipped.  It returns the number of blocks and bytes written.
+func ExportCar(ctx context.Context, bs blockstore.Blockstore, roots []cid.Cid, w io.Writer) (int, int, error) {
+	bw := bufio.NewWriter(w)
+	hdr, err := cbornode.DumpObject(&carHeader{Roots: roots, Version: 1})
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := writeCarSection(bw, hdr); err != nil {
+		return 0, 0, err
+	}
+
+	blockCnt, byteCnt := 0, 0
+	seen := cid.NewSet()
+	stack := append([]cid.Cid(nil), roots...)
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return blockCnt, byteCnt, err
+		}
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		prefix := c.Prefix()
+		if prefix.MhType == mh.IDENTITY || prefix.Codec == cid.FilCommitmentSealed || prefix.Codec == cid.FilCommitmentUnsealed {
+			continue
+		}
+		if !seen.Visit(c) {
+			continue
+		}
+		blk, err := bs.Get(c)
+		if err != nil {
+			return blockCnt, byteCnt, xerrors.Errorf("get %s: %w", c, err)
+		}
+		if err := writeCarSection(bw, append(c.Bytes(), blk.RawData()...)); err != nil {
+			return blockCnt, byteCnt, err
+		}
+		blockCnt++
+		byteCnt += len(blk.RawData())
+		if prefix.Codec != cid.DagCBOR {
+			continue
+		}
+		if err := cbg.ScanForLinks(bytes.NewReader(blk.RawData()), func(link cid.Cid) {
+			stack = append(stack, link)
+		}); err != nil {
+			return blockCnt, byteCnt, xerrors.Errorf("scan links of %s: %w", c, err)
+		}
+	}
+	return blockCnt, byteCnt, bw.Flush()
+}
+
+func writeCarSection(w io.Writer, data []byte) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(len(data)))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
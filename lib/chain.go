@@ -2,6 +2,9 @@ package lib
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"os"
 
 	dgbadger "github.com/dgraph-io/badger/v2"
 	"github.com/filecoin-project/go-state-types/abi"
@@ -10,11 +13,19 @@ import (
 	badger "github.com/ipfs/go-ds-badger2"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/mitchellh/go-homedir"
 	"golang.org/x/xerrors"
 )
 
 var lotusPath = "~/.lotus/datastore/chain"
 
+// lotusMetadataPath is the lotus metadata datastore, which records the chain head
+var lotusMetadataPath = "~/.lotus/datastore/metadata"
+
+// lotusHeadKey is the key of the json list of the block CIDs of the heaviest
+// tipset in the lotus metadata datastore.
+var lotusHeadKey = datastore.NewKey("head")
+
 // persist migrated chain state
 var entChainPath = "~/.ent/datastore/chain"
 
@@ -67,6 +78,108 @@ func (c *Chain) FlushBufferedState(ctx context.Context, stateRoot cid.Cid) error
 	return bs.FlushFromBuffer(ctx, stateRoot)
 }
 
+// Blockstore returns the chain stores as a blockstore, reading through the
+// buffers into the lotus chain store or the configured tiers, then ent's store.
+func (c *Chain) Blockstore(ctx context.Context) (blockstore.Blockstore, error) {
+	bs, err := c.loadBufferedBstore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+// HasBlock reports whether the block with CID k is available from the chain stores.
+func (c *Chain) HasBlock(ctx context.Context, k cid.Cid) (bool, error) {
+	bs, err := c.loadBufferedBstore(ctx)
+	if err != nil {
+		return false, err
+	}
+	return bs.Has(k)
+}
+
+// BufferStats returns the number of blocks written to the buffer and flushed from
+// it so far.
+func (c *Chain) BufferStats(ctx context.Context) (buffered, flushed uint64, err error) {
+	bs, err := c.loadBufferedBstore(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	buffered, flushed = bs.Stats()
+	return buffered, flushed, nil
+}
+
+// ImportCar loads all blocks of the CAR file at path into the buffer, to be
+// flushed with migrated state, and returns the CAR roots.
+func (c *Chain) ImportCar(ctx context.Context, path string) ([]cid.Cid, error) {
+	bs, err := c.loadBufferedBstore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint:errcheck
+	return ImportCar(f, bs)
+}
+
+// ExportCar writes every block reachable from roots in the chain stores to w as a
+// CAR file and returns the number of blocks and bytes written.  Writes are paced
+// to IOLimit.
+func (c *Chain) ExportCar(ctx context.Context, roots []cid.Cid, w io.Writer) (int, int, error) {
+	bs, err := c.loadBufferedBstore(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ExportCar(ctx, bs, roots, LimitWriter(w))
+}
+
+// ReadChainHead returns the block CIDs of the heaviest tipset lotus recorded as its
+// chain head in its metadata datastore.  The datastore can't be read while lotus
+// runs.
+func ReadChainHead() ([]cid.Cid, error) {
+	path, err := homedir.Expand(lotusMetadataPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, xerrors.Errorf("no lotus metadata datastore: %w", err)
+	}
+	ds, err := chainBadgerDs(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open lotus metadata datastore: %w", err)
+	}
+	defer ds.Close() // nolint:errcheck
+	data, err := ds.Get(lotusHeadKey)
+	if err == datastore.ErrNotFound {
+		return nil, xerrors.Errorf("lotus metadata datastore %s has no chain head", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var head []cid.Cid
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, xerrors.Errorf("failed to parse chain head: %w", err)
+	}
+	if len(head) == 0 {
+		return nil, xerrors.Errorf("chain head is an empty tipset")
+	}
+	return head, nil
+}
+
+// BlockHeader loads the header of the block with CID blk from the chain stores.
+func (c *Chain) BlockHeader(ctx context.Context, blk cid.Cid) (*BlockHeader, error) {
+	bs, err := c.loadBufferedBstore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := bs.Get(blk)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load block header %s: %w", blk, err)
+	}
+	return DecodeBlock(raw.RawData())
+}
+
 // ChainStateIterator moves from tip to genesis emiting parent state roots of blocks
 type ChainStateIterator struct {
 	bs         blockstore.Blockstore
@@ -77,6 +190,13 @@ type ChainStateIterator struct {
 type IterVal struct {
 	Height int64
 	State  cid.Cid
+	// BaseFee is the base fee after executing the tipset at Height
+	BaseFee abi.TokenAmount
+	// BlockHeight is the height of the block holding State as its parent state
+	// root, more than Height when there were null rounds
+	BlockHeight int64
+	// TipSetKey is the block CIDs of the tipset at Height
+	TipSetKey []cid.Cid
 }
 
 func (c *Chain) NewChainStateIterator(ctx context.Context, tipCid cid.Cid) (*ChainStateIterator, error) {
@@ -113,11 +233,14 @@ func (it *ChainStateIterator) Done() bool {
 	return false
 }
 
-// Return the parent state root and parent height of the current block
+// Return the parent state root, parent height and parent base fee of the current block
 func (it *ChainStateIterator) Val() IterVal {
 	return IterVal{
-		State:  it.currBlock.ParentStateRoot,
-		Height: int64(it.currParent.Height),
+		State:       it.currBlock.ParentStateRoot,
+		Height:      int64(it.currParent.Height),
+		BaseFee:     it.currBlock.ParentBaseFee,
+		BlockHeight: int64(it.currBlock.Height),
+		TipSetKey:   it.currBlock.Parents,
 	}
 }
 
@@ -126,6 +249,9 @@ func (it *ChainStateIterator) Step(ctx context.Context) error {
 	if it.Done() { // noop
 		return nil
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	var err error
 	parent := it.currParent
 	it.currParent, err = getParent(it.currParent, it.bs)
@@ -148,3 +274,83 @@ func getParent(blk *BlockHeader, bs blockstore.Blockstore) (*BlockHeader, error)
 	}
 	return DecodeBlock(raw.RawData())
 }
+
+// rootsReadAhead is the number of epochs WalkChainRoots reads ahead of its caller
+const rootsReadAhead = 4096
+
+type walkedRoot struct {
+	val IterVal
+	err error
+}
+
+// WalkChainRoots calls fn with the parent state roots of num epochs walking back
+// from the block tip, in order, stopping early at genesis.  Headers link to their
+// parents so they are read one after the other, but a goroutine reads and decodes
+// them ahead of fn.  Once the walk reaches a block the chain index ci holds, if
+// ci is not nil, the rest of the roots come from the index instead of the chain.
+// It returns the number of roots fn was called with.
+func (c *Chain) WalkChainRoots(ctx context.Context, ci *ChainIndex, tip cid.Cid, num int, fn func(IterVal) error) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	vals := make(chan walkedRoot, rootsReadAhead)
+	go func() {
+		defer close(vals)
+		send := func(r walkedRoot) bool {
+			select {
+			case vals <- r:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		var iter *ChainStateIterator
+		blk := tip
+		for read := 0; read < num; read++ {
+			if ci != nil {
+				indexed, ok, err := ci.Roots(blk, num-read)
+				if err != nil {
+					send(walkedRoot{err: err})
+					return
+				}
+				if ok {
+					for _, val := range indexed {
+						if !send(walkedRoot{val: val}) {
+							return
+						}
+					}
+					return
+				}
+			}
+			var err error
+			if iter == nil {
+				iter, err = c.NewChainStateIterator(ctx, blk)
+			} else {
+				err = iter.Step(ctx)
+			}
+			if err != nil {
+				send(walkedRoot{err: err})
+				return
+			}
+			if iter.Done() {
+				return
+			}
+			val := iter.Val()
+			if !send(walkedRoot{val: val}) {
+				return
+			}
+			// The next value is that of the parent block the iterator steps to
+			blk = val.TipSetKey[0]
+		}
+	}()
+	n := 0
+	for r := range vals {
+		if r.err != nil {
+			return n, r.err
+		}
+		if err := fn(r.val); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, ctx.Err()
+}
@@ -0,0 +1,220 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// ChainwatchBlock is a block header row of a lotus chainwatch Postgres database.
+type ChainwatchBlock struct {
+	Cid             cid.Cid
+	Height          int64
+	ParentStateRoot cid.Cid
+	// ParentHeight is the height of the block's parent tipset, -1 if the parents
+	// are not in the database
+	ParentHeight int64
+}
+
+// chainwatchBlocksQuery lists blocks with the height of their parents from the
+// chainwatch blocks and block_parents tables, oldest first.
+const chainwatchBlocksQuery = `SELECT b.cid, b.height, b.parentstateroot, coalesce(max(p.height), -1)
+FROM blocks b
+LEFT JOIN block_parents bp ON bp.block = b.cid
+LEFT JOIN blocks p ON p.cid = bp.parent
+WHERE b.height >= %d
+GROUP BY b.cid, b.height, b.parentstateroot
+ORDER BY b.height, b.cid`
+
+// ReadChainwatchBlocks streams the block rows at and above minHeight of the
+// chainwatch database at dsn, oldest first.  Queries run through the psql client
+// so ent needs no Postgres driver.
+func ReadChainwatchBlocks(ctx context.Context, psql, dsn string, minHeight int64, fn func(*ChainwatchBlock) error) error {
+	query := fmt.Sprintf(chainwatchBlocksQuery, minHeight)
+	cmd := exec.CommandContext(ctx, psql, "--no-psqlrc", "--tuples-only", "--no-align", "--field-separator=\t", "--set=ON_ERROR_STOP=1", "--command="+query, dsn)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return xerrors.Errorf("failed to run %s: %w", psql, err)
+	}
+	scanner := bufio.NewScanner(out)
+	var scanErr error
+	for scanner.Scan() {
+		blk, err := parseChainwatchRow(scanner.Text())
+		if err == nil {
+			err = fn(blk)
+		}
+		if err != nil {
+			scanErr = err
+			break
+		}
+	}
+	if scanErr == nil {
+		scanErr = scanner.Err()
+	}
+	if scanErr != nil {
+		// Stop psql rather than wait for the rest of its output
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return scanErr
+	}
+	if err := cmd.Wait(); err != nil {
+		return xerrors.Errorf("chainwatch query failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func parseChainwatchRow(row string) (*ChainwatchBlock, error) {
+	fields := strings.Split(row, "\t")
+	if len(fields) != 4 {
+		return nil, xerrors.Errorf("unexpected chainwatch row %q", row)
+	}
+	var blk ChainwatchBlock
+	var err error
+	if blk.Cid, err = cid.Decode(fields[0]); err != nil {
+		return nil, xerrors.Errorf("chainwatch block cid %q: %w", fields[0], err)
+	}
+	if blk.Height, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return nil, xerrors.Errorf("chainwatch block %s height: %w", blk.Cid, err)
+	}
+	if blk.ParentStateRoot, err = cid.Decode(fields[2]); err != nil {
+		return nil, xerrors.Errorf("chainwatch block %s parent state root: %w", blk.Cid, err)
+	}
+	if blk.ParentHeight, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+		return nil, xerrors.Errorf("chainwatch block %s parent height: %w", blk.Cid, err)
+	}
+	return &blk, nil
+}
+
+// chainwatchForkWindow is how far below the current height tipsets are kept to
+// detect blocks of other forks.  Tipsets no block built on within the window are
+// dropped.
+const chainwatchForkWindow = 900
+
+// ImportChainwatch indexes the chain recorded in the chainwatch database at dsn
+// from minHeight, for chains whose headers are not in the chain store.  The state
+// root of an epoch is the parent state root of the first block building on its
+// tipset, and the tipset is the blocks of the epoch on that state.  Blocks of
+// other forks are skipped.  It returns the number of entries written and of
+// blocks skipped.
+func (c *Chain) ImportChainwatch(ctx context.Context, ci *ChainIndex, psql, dsn string, minHeight int64, progress func(*IndexEntry)) (int, int, error) {
+	store, err := c.LoadCborStore(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := ci.ds.Batch()
+	if err != nil {
+		return 0, 0, err
+	}
+	written, batched, skipped := 0, 0, 0
+
+	// pending entries have their tipset but wait for a child block to give their
+	// state root.  Their tipsets are the blocks on the state of the first block of
+	// the epoch.
+	pending := make(map[int64]*IndexEntry)
+	tipsetState := make(map[int64]cid.Cid)
+	done := make(map[int64]cid.Cid)
+	height := int64(-1)
+	err = ReadChainwatchBlocks(ctx, psql, dsn, minHeight, func(blk *ChainwatchBlock) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if blk.Height != height {
+			height = blk.Height
+			for epoch := range pending {
+				if epoch < height-chainwatchForkWindow {
+					delete(pending, epoch)
+					delete(tipsetState, epoch)
+				}
+			}
+			for epoch := range done {
+				if epoch < height-chainwatchForkWindow {
+					delete(done, epoch)
+				}
+			}
+		}
+		e, ok := pending[blk.Height]
+		if !ok {
+			e = &IndexEntry{Epoch: blk.Height, Parent: blk.ParentHeight}
+			pending[blk.Height] = e
+			tipsetState[blk.Height] = blk.ParentStateRoot
+		}
+		if blk.ParentStateRoot != tipsetState[blk.Height] {
+			skipped++
+			return nil
+		}
+		e.TipSetKey = append(e.TipSetKey, blk.Cid)
+
+		if blk.ParentHeight < 0 {
+			return nil
+		}
+		if root, ok := done[blk.ParentHeight]; ok {
+			if root != blk.ParentStateRoot {
+				skipped++
+			}
+			return nil
+		}
+		parent, ok := pending[blk.ParentHeight]
+		if !ok {
+			// The parent tipset is below minHeight
+			return nil
+		}
+		parent.StateRoot = blk.ParentStateRoot
+		parent.BlockHeight = blk.Height
+		if info, err := InspectRoot(ctx, store, parent.StateRoot); err == nil {
+			parent.ActorsVersion = info.ActorsVersion
+		} else {
+			parent.ActorsVersion = ExpectedActorsVersion(abi.ChainEpoch(parent.BlockHeight))
+			parent.VersionExpected = true
+		}
+		if progress != nil {
+			progress(parent)
+		}
+		if err := ci.put(b, parent); err != nil {
+			return err
+		}
+		delete(pending, parent.Epoch)
+		delete(tipsetState, parent.Epoch)
+		done[parent.Epoch] = parent.StateRoot
+		written++
+		batched++
+		if batched < indexBatchSize {
+			return nil
+		}
+		if err := b.Commit(); err != nil {
+			return err
+		}
+		b, err = ci.ds.Batch()
+		batched = 0
+		return err
+	})
+	if err != nil {
+		return written, skipped, err
+	}
+	// Tipsets at the head have no state root yet but their blocks still lead to
+	// their parents, like the head block of a build
+	for _, e := range pending {
+		if e.Parent < 0 {
+			continue
+		}
+		if _, ok := done[e.Parent]; !ok {
+			continue
+		}
+		if err := ci.putBlocks(b, e.TipSetKey, e.Parent); err != nil {
+			return written, skipped, err
+		}
+	}
+	return written, skipped, b.Commit()
+}
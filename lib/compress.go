@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync/atomic"
+
+	"github.com/DataDog/zstd"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// Compress enables zstd compression of blocks and migration caches written to
+// the stores ent owns: the ~/.ent chain store, migration caches and buffer spill
+// stores.  Compressed data is recognized on read whether or not it is set.
+var Compress bool
+
+// zstdMagic starts every zstd frame.  No dag-cbor block starts with it, the
+// first byte would be a complete negative integer item.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// CompressionStats counts bytes before and after compression.
+type CompressionStats struct {
+	raw    uint64
+	stored uint64
+}
+
+// BlockCompression and CacheCompression count compression of blocks and of
+// migration caches.
+var BlockCompression, CacheCompression CompressionStats
+
+func (cs *CompressionStats) add(raw, stored int) {
+	atomic.AddUint64(&cs.raw, uint64(raw))
+	atomic.AddUint64(&cs.stored, uint64(stored))
+}
+
+// Get returns the number of bytes compressed and the number of bytes they were
+// compressed to.
+func (cs *CompressionStats) Get() (raw, stored uint64) {
+	return atomic.LoadUint64(&cs.raw), atomic.LoadUint64(&cs.stored)
+}
+
+// CompressedBlockstore zstd compresses the data of dag-cbor blocks put into the
+// wrapped blockstore when compress is set, and decompresses compressed blocks on
+// read.  Blocks of other codecs, like bundle wasm code, are stored as is.
+type CompressedBlockstore struct {
+	blockstore.Blockstore
+	compress bool
+}
+
+func NewCompressedBlockstore(bs blockstore.Blockstore, compress bool) *CompressedBlockstore {
+	return &CompressedBlockstore{Blockstore: bs, compress: compress}
+}
+
+func (cb *CompressedBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	b, err := cb.Blockstore.Get(c)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decompressBlock(c, b.RawData())
+	if err != nil {
+		return nil, err
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
+
+func (cb *CompressedBlockstore) GetSize(c cid.Cid) (int, error) {
+	b, err := cb.Get(c)
+	if err != nil {
+		return -1, err
+	}
+	return len(b.RawData()), nil
+}
+
+func (cb *CompressedBlockstore) Put(b blocks.Block) error {
+	cmp, err := cb.compressBlock(b)
+	if err != nil {
+		return err
+	}
+	return cb.Blockstore.Put(cmp)
+}
+
+func (cb *CompressedBlockstore) PutMany(bs []blocks.Block) error {
+	cmps := make([]blocks.Block, len(bs))
+	for i, b := range bs {
+		var err error
+		if cmps[i], err = cb.compressBlock(b); err != nil {
+			return err
+		}
+	}
+	return cb.Blockstore.PutMany(cmps)
+}
+
+func (cb *CompressedBlockstore) compressBlock(b blocks.Block) (blocks.Block, error) {
+	if !cb.compress || b.Cid().Prefix().Codec != cid.DagCBOR {
+		return b, nil
+	}
+	data, err := zstd.Compress(nil, b.RawData())
+	if err != nil {
+		return nil, err
+	}
+	BlockCompression.add(len(b.RawData()), len(data))
+	// Blocks are stored by multihash so the cid no longer verifying the data is fine
+	return blocks.NewBlockWithCid(data, b.Cid())
+}
+
+func decompressBlock(c cid.Cid, data []byte) ([]byte, error) {
+	if c.Prefix().Codec != cid.DagCBOR || !bytes.HasPrefix(data, zstdMagic) {
+		return data, nil
+	}
+	return zstd.Decompress(nil, data)
+}
+
+// compressedWriter compresses everything written to it into w.
+type compressedWriter struct {
+	zw *zstd.Writer
+	cw *countingWriter
+	n  int
+}
+
+func newCompressedWriter(w io.Writer) *compressedWriter {
+	cw := &countingWriter{w: w}
+	return &compressedWriter{zw: zstd.NewWriter(cw), cw: cw}
+}
+
+func (w *compressedWriter) Write(p []byte) (int, error) {
+	n, err := w.zw.Write(p)
+	w.n += n
+	return n, err
+}
+
+// Close flushes the last zstd frame and counts the compression in stats.
+func (w *compressedWriter) Close(stats *CompressionStats) error {
+	if err := w.zw.Close(); err != nil {
+		return err
+	}
+	stats.add(w.n, w.cw.n)
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += n
+	return n, err
+}
+
+// maybeDecompress returns a reader of the decompressed data of r if it holds a
+// zstd frame, or of r as is otherwise.
+func maybeDecompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.Equal(magic, zstdMagic) {
+		return zstd.NewReader(br), nil
+	}
+	return br, nil
+}
@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"context"
+	"io"
+
+	builtin8 "github.com/filecoin-project/specs-actors/v8/actors/builtin"
+	paych8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/paych"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// Field indexes of collections in actor states, unchanged in every actors version
+// they appear in.
+const (
+	multisigPendingTxnsField = 6
+	paychLaneStatesField     = 5
+)
+
+// EmptyActorState reports whether the state at head of an actor with the named
+// code holds nothing but its configuration: an account, a multisig without
+// pending transactions, a payment channel without lanes or a miner without
+// sectors.  Actors of other codes are never empty.
+func EmptyActorState(ctx context.Context, store cbornode.IpldStore, actorsVersion int, code string, head cid.Cid) (bool, error) {
+	switch code {
+	case "account":
+		// The state is the key address
+		return true, nil
+	case "multisig":
+		txns := stateField{index: multisigPendingTxnsField}
+		if err := store.Get(ctx, head, &txns); err != nil {
+			return false, err
+		}
+		m, err := loadMap(ctx, store, actorsVersion, txns.c, builtin8.DefaultHamtBitwidth)
+		if err != nil {
+			return false, err
+		}
+		var val cbg.Deferred
+		return emptyCollection(m.ForEach(&val, func(string) error { return errNotEmpty }))
+	case "paymentchannel":
+		lanes := stateField{index: paychLaneStatesField}
+		if err := store.Get(ctx, head, &lanes); err != nil {
+			return false, err
+		}
+		arr, err := loadArray(ctx, store, actorsVersion, lanes.c, paych8.LaneStatesAmtBitwidth)
+		if err != nil {
+			return false, err
+		}
+		var val cbg.Deferred
+		return emptyCollection(arr.ForEach(&val, func(int64) error { return errNotEmpty }))
+	case "storageminer":
+		sectors, err := loadMinerSectors(ctx, store, actorsVersion, head)
+		if err != nil {
+			return false, err
+		}
+		var val cbg.Deferred
+		return emptyCollection(sectors.ForEach(&val, func(int64) error { return errNotEmpty }))
+	default:
+		return false, nil
+	}
+}
+
+// errNotEmpty stops the walk of a collection at its first entry.
+var errNotEmpty = xerrors.New("not empty")
+
+// emptyCollection returns whether the walk of a collection that stops at its
+// first entry with errNotEmpty found none.
+func emptyCollection(err error) (bool, error) {
+	if xerrors.Is(err, errNotEmpty) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// stateField decodes the cid at field index of a state tuple without decoding
+// the rest.
+type stateField struct {
+	index int
+	c     cid.Cid
+}
+
+func (f *stateField) UnmarshalCBOR(r io.Reader) error {
+	maj, extra, err := cbg.CborReadHeader(r)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray || int(extra) <= f.index {
+		return xerrors.Errorf("state is not a tuple of more than %d fields", f.index)
+	}
+	for i := 0; i < f.index; i++ {
+		var skip cbg.Deferred
+		if err := skip.UnmarshalCBOR(r); err != nil {
+			return err
+		}
+	}
+	if f.c, err = cbg.ReadCid(r); err != nil {
+		return xerrors.Errorf("failed to read field %d: %w", f.index, err)
+	}
+	return nil
+}
@@ -1,113 +1,517 @@
 package lib
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
 	"fmt"
-	"os"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	address "github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
-	"github.com/filecoin-project/specs-actors/v2/actors/builtin"
-	"github.com/filecoin-project/specs-actors/v2/actors/builtin/miner"
-	"github.com/filecoin-project/specs-actors/v2/actors/states"
-	"github.com/filecoin-project/specs-actors/v2/actors/util/adt"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
 )
 
-type SectorInfo struct {
-	Sector *miner.SectorOnChainInfo
-	Status string
+// Exports run as a pipeline of stages connected by bounded queues: a single tree
+// walk feeds actors to workers which decode each actor into rows and encode the
+// rows into chunks of output, and a single writer writes the chunks out in tree
+// walk order.  Memory is bounded by the queue sizes and the output of the actors
+// in flight rather than the state size.
+//
+// Cancelling the context winds the pipeline down rather than aborting it: the walk
+// stops, actors already being encoded are finished, queued actors are skipped and
+// the output ends after the last complete actor.
+
+// ExportConfig configures an export pipeline.
+type ExportConfig struct {
+	// Workers decode and encode actors in parallel, default the number of CPUs
+	Workers int
+	// QueueSize is the capacity of the queues between stages, default 64
+	QueueSize int
+	// NewEncoder returns an encoder of rows to w for each worker
+	NewEncoder func(w io.Writer) RowEncoder
+	// Sorted walks actors in actor ID order rather than tree order, at the cost
+	// of a lookup per actor
+	Sorted bool
+	// ResumeAfter, if set, skips the actors walked up to and including it
+	ResumeAfter address.Address
+	// Checkpoint, if set, is called periodically and at the end of the export
+	// with the last actor whose output has all been written
+	Checkpoint func(last address.Address) error
+	// ActorWritten, if set, is called after the output of each actor is written
+	ActorWritten func(addr address.Address) error
+}
+
+// RowEncoder encodes export rows.  Encoders may buffer until flushed.
+type RowEncoder interface {
+	Encode(row interface{}) error
+	Flush() error
 }
 
-const channelBufferSize = 100
+// ActorRows decodes the export rows of the actor at addr, passing each to emit.
+type ActorRows func(addr address.Address, a *Actor, emit func(row interface{}) error) error
+
+const (
+	defaultExportQueueSize = 64
+	// exportChunkSize is the encoded output size at which workers pass a chunk
+	// on to the writer
+	exportChunkSize = 256 << 10
+	// exportCheckpointPeriod is the time between checkpoints
+	exportCheckpointPeriod = 10 * time.Second
+)
+
+// ExportStats counts the progress of an export.
+type ExportStats struct {
+	start   time.Time
+	actors  uint64
+	rows    uint64
+	written uint64
+}
 
-// ExportSectors returns a channel iterating over all sector infos in miner actor state
-func ExportSectors(ctx context.Context, store adt.Store, actorsIn *states.Tree) (chan *SectorInfo, error) {
-	out := make(chan *SectorInfo, channelBufferSize)
+// Get returns the number of actors decoded, rows encoded and bytes written.
+func (s *ExportStats) Get() (actors, rows, written uint64) {
+	return atomic.LoadUint64(&s.actors), atomic.LoadUint64(&s.rows), atomic.LoadUint64(&s.written)
+}
 
-	go func() {
-		defer close(out)
+func (s *ExportStats) String() string {
+	actors, rows, written := s.Get()
+	elapsed := time.Since(s.start)
+	return fmt.Sprintf("%d actors, %d rows, %d bytes after %v (%.0f rows/s)", actors, rows, written, elapsed.Truncate(time.Second), float64(rows)/elapsed.Seconds())
+}
+
+// exportChunk is output of the actor walked seq'th.  The last chunk of an actor
+// has last set.  A skipped actor, queued when the export was cancelled, has a
+// single chunk with skipped set.
+type exportChunk struct {
+	seq     uint64
+	data    []byte
+	last    bool
+	skipped bool
+}
+
+// chunkWriter collects encoded output of one actor at a time and passes it to the
+// writer stage in chunks of about exportChunkSize.
+type chunkWriter struct {
+	ctx context.Context
+	seq uint64
+	buf bytes.Buffer
+	out chan<- exportChunk
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	n, _ := cw.buf.Write(p)
+	if cw.buf.Len() >= exportChunkSize {
+		return n, cw.send(false)
+	}
+	return n, nil
+}
 
-		err := actorsIn.ForEach(func(addr address.Address, a *states.Actor) error {
-			if !a.Code.Equals(builtin.StorageMinerActorCodeID) {
+// skip passes on that the current actor was skipped.
+func (cw *chunkWriter) skip() error {
+	select {
+	case cw.out <- exportChunk{seq: cw.seq, last: true, skipped: true}:
+		return nil
+	case <-cw.ctx.Done():
+		return cw.ctx.Err()
+	}
+}
+
+func (cw *chunkWriter) send(last bool) error {
+	if cw.buf.Len() == 0 && !last {
+		return nil
+	}
+	chunk := exportChunk{seq: cw.seq, data: make([]byte, cw.buf.Len()), last: last}
+	copy(chunk.data, cw.buf.Bytes())
+	cw.buf.Reset()
+	select {
+	case cw.out <- chunk:
+		return nil
+	case <-cw.ctx.Done():
+		return cw.ctx.Err()
+	}
+}
+
+// RunExport exports the rows of every actor of tree that rows decodes to out and
+// counts progress in stats.  Output is in walk order, tree order or actor ID order
+// if sorted, which is the same for every export of a state, so an export can be
+// resumed after the last actor checkpointed.  Output is paced to IOLimit.  If ctx
+// is cancelled the output ends after the last complete actor and ctx's error is
+// returned.
+func RunExport(ctx context.Context, tree ActorsTree, cfg ExportConfig, rows ActorRows, out io.Writer, stats *ExportStats) error {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultExportQueueSize
+	}
+	stats.start = time.Now()
+	out = LimitWriter(out)
+
+	type actorJob struct {
+		seq   uint64
+		addr  address.Address
+		actor Actor
+	}
+	jobs := make(chan actorJob, queueSize)
+	chunks := make(chan exportChunk, queueSize)
+	// window bounds the actors walked but not yet written so that output waiting
+	// to be written in order stays bounded
+	window := make(chan struct{}, queueSize+workers)
+	// addrs are the actors in the window by seq, read by the writer to checkpoint
+	var addrs sync.Map
+	// stop is closed by cancelling the caller's context, while ctx is cancelled
+	// only by a failing stage
+	stop := ctx.Done()
+	interrupted := ctx.Err
+	grp, ctx := errgroup.WithContext(context.Background())
+
+	// Tree walk
+	grp.Go(func() error {
+		defer close(jobs)
+		skipping := cfg.ResumeAfter != address.Undef
+		walk := tree.ForEach
+		if cfg.Sorted {
+			walk = func(fn func(address.Address, *Actor) error) error {
+				return forEachActorByID(tree, fn)
+			}
+		}
+		var seq uint64
+		err := walk(func(addr address.Address, a *Actor) error {
+			if skipping {
+				skipping = addr != cfg.ResumeAfter
 				return nil
 			}
-			_, _ = fmt.Fprintf(os.Stderr, "Miner %v\n", addr)
-			var st miner.State
-			if err := store.Get(ctx, a.Head, &st); err != nil {
-				return err
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-stop:
+				return errExportStopped
+			}
+			addrs.Store(seq, addr)
+			select {
+			case jobs <- actorJob{seq: seq, addr: addr, actor: *a}: // ForEach reuses its actor pointer
+				seq++
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-stop:
+				<-window
+				return errExportStopped
 			}
+		})
+		if err == errExportStopped {
+			return nil
+		}
+		if err == nil && skipping {
+			return xerrors.Errorf("resume actor %s is not in the state", cfg.ResumeAfter)
+		}
+		return err
+	})
 
-			sectors, err := miner.LoadSectors(store, st.Sectors)
-			if err != nil {
-				return err
+	// Decode and encode
+	var encoders errgroup.Group
+	for i := 0; i < workers; i++ {
+		encoders.Go(func() error {
+			cw := &chunkWriter{ctx: ctx, out: chunks}
+			enc := cfg.NewEncoder(cw)
+			for job := range jobs {
+				cw.seq = job.seq
+				if interrupted() != nil {
+					if err := cw.skip(); err != nil {
+						return err
+					}
+					continue
+				}
+				release := backgroundAcquire(gateExport)
+				err := rows(job.addr, &job.actor, func(row interface{}) error {
+					atomic.AddUint64(&stats.rows, 1)
+					return enc.Encode(row)
+				})
+				release()
+				if err != nil {
+					return xerrors.Errorf("failed to export actor %s: %w", job.addr, err)
+				}
+				if err := enc.Flush(); err != nil {
+					return err
+				}
+				if err := cw.send(true); err != nil {
+					return err
+				}
+				atomic.AddUint64(&stats.actors, 1)
 			}
+			return nil
+		})
+	}
+	grp.Go(func() error {
+		defer close(chunks)
+		return encoders.Wait()
+	})
 
-			deadlines, err := st.LoadDeadlines(store)
-			if err != nil {
+	// Write
+	grp.Go(func() error {
+		var next uint64
+		var last address.Address
+		pending := make(map[uint64][]exportChunk)
+		lastCheckpoint := time.Now()
+		// skipped is set from the first skipped actor on, whose output and that of
+		// the actors after it is dropped
+		skipped := false
+		write := func(chunk exportChunk) error {
+			if skipped = skipped || chunk.skipped; skipped {
+				return nil
+			}
+			if _, err := out.Write(chunk.data); err != nil {
 				return err
 			}
-			if err = deadlines.ForEach(store, func(dlIdx uint64, dl *miner.Deadline) error {
-				partitions, err := dl.PartitionsArray(store)
-				if err != nil {
+			atomic.AddUint64(&stats.written, uint64(len(chunk.data)))
+			if !chunk.last {
+				return nil
+			}
+			a, _ := addrs.Load(next)
+			addrs.Delete(next)
+			last = a.(address.Address)
+			next++
+			<-window
+			if cfg.ActorWritten != nil {
+				if err := cfg.ActorWritten(last); err != nil {
 					return err
 				}
-				var partition miner.Partition
-				if err = partitions.ForEach(&partition, func(i int64) error {
-					unproven, err := partition.Unproven.AllMap(1 << 20)
-					if err != nil {
-						return err
-					}
-					faults, err := partition.Faults.AllMap(1 << 20)
-					if err != nil {
-						return err
-					}
-					recovering, err := partition.Recoveries.AllMap(1 << 20)
-					if err != nil {
-						return err
-					}
-					terminated, err := partition.Terminated.AllMap(1 << 20)
-					if err != nil {
-						return err
-					}
-
-					if err = partition.Sectors.ForEach(func(sno uint64) error {
-						status := "active"
-						if unproven[sno] {
-							status = "unproven"
-						} else if faults[sno] {
-							status = "faulty"
-						} else if recovering[sno] {
-							status = "recovering"
-						} else if terminated[sno] {
-							status = "terminated"
-						}
-						sector, err := sectors.MustGet(abi.SectorNumber(sno))
-						if err != nil {
-							return nil
-						}
-
-						out <- &SectorInfo{
-							Sector: sector,
-							Status: status,
-						}
-						return nil
-					}); err != nil {
+			}
+			if cfg.Checkpoint != nil && time.Since(lastCheckpoint) >= exportCheckpointPeriod {
+				lastCheckpoint = time.Now()
+				return cfg.Checkpoint(last)
+			}
+			return nil
+		}
+		for chunk := range chunks {
+			if chunk.seq != next {
+				pending[chunk.seq] = append(pending[chunk.seq], chunk)
+				continue
+			}
+			if err := write(chunk); err != nil {
+				return err
+			}
+			// Completing an actor may release output of the following actors
+			for chunk.last {
+				waiting := pending[next]
+				if len(waiting) == 0 {
+					break
+				}
+				delete(pending, next)
+				for _, chunk = range waiting {
+					if err := write(chunk); err != nil {
 						return err
 					}
-					return nil
-				}); err != nil {
-					return err
 				}
-				return nil
-			}); err != nil {
-				return err
+				if !chunk.last {
+					break
+				}
 			}
+		}
+		// Output up to last is complete even if another stage failed
+		if cfg.Checkpoint != nil && last != address.Undef {
+			return cfg.Checkpoint(last)
+		}
+		return nil
+	})
+	if err := grp.Wait(); err != nil {
+		return err
+	}
+	return interrupted()
+}
+
+// errExportStopped stops the tree walk of a cancelled export.
+var errExportStopped = xerrors.New("export stopped")
+
+// forEachActorByID calls fn with the actors of tree in actor ID order.  The tree
+// only holds ID addresses.
+func forEachActorByID(tree ActorsTree, fn func(addr address.Address, a *Actor) error) error {
+	var ids []uint64
+	err := tree.ForEach(func(addr address.Address, _ *Actor) error {
+		id, err := address.IDFromAddress(addr)
+		if err != nil {
+			return xerrors.Errorf("unexpected actor address %s: %w", addr, err)
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		addr, err := address.NewIDAddress(id)
+		if err != nil {
+			return err
+		}
+		a, found, err := tree.GetActor(addr)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return xerrors.Errorf("actor %s walked but not found", addr)
+		}
+		if err := fn(addr, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SectorPlacement is the deadline and partition a sector is assigned to, and its
+// status in the partition.
+type SectorPlacement struct {
+	Deadline  uint64
+	Partition int64
+	Status    string
+}
+
+// MinerSectorPlacements returns the placement of every sector in the partitions
+// of the miner with head head.
+func MinerSectorPlacements(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid) (map[uint64]SectorPlacement, error) {
+	placements := make(map[uint64]SectorPlacement)
+	err := ForEachMinerPartition(ctx, store, actorsVersion, head, func(dlIdx uint64, partIdx int64, p *miner8.Partition) error {
+		unproven, err := p.Unproven.AllMap(1 << 20)
+		if err != nil {
+			return err
+		}
+		faults, err := p.Faults.AllMap(1 << 20)
+		if err != nil {
+			return err
+		}
+		recovering, err := p.Recoveries.AllMap(1 << 20)
+		if err != nil {
+			return err
+		}
+		terminated, err := p.Terminated.AllMap(1 << 20)
+		if err != nil {
+			return err
+		}
+		return p.Sectors.ForEach(func(sno uint64) error {
+			status := "active"
+			if unproven[sno] {
+				status = "unproven"
+			} else if faults[sno] {
+				status = "faulty"
+			} else if recovering[sno] {
+				status = "recovering"
+			} else if terminated[sno] {
+				status = "terminated"
+			}
+			placements[sno] = SectorPlacement{Deadline: dlIdx, Partition: partIdx, Status: status}
 			return nil
 		})
+	})
+	return placements, err
+}
+
+// SectorRows returns the ActorRows of a sector export: a SectorRow for every
+// sector assigned to a partition of every miner, in sector number order.  name
+// names actor codes as returned by ActorCodeNamer.
+func SectorRows(ctx context.Context, store cbornode.IpldStore, actorsVersion int, name func(cid.Cid) string) ActorRows {
+	return func(addr address.Address, a *Actor, emit func(row interface{}) error) error {
+		if name(a.Code) != "storageminer" {
+			return nil
+		}
+		placements, err := MinerSectorPlacements(ctx, store, actorsVersion, a.Head)
+		if err != nil {
+			return err
+		}
+		return ForEachMinerSector(ctx, store, actorsVersion, a.Head, func(s *MinerSector) error {
+			placement, ok := placements[uint64(s.SectorNumber)]
+			if !ok {
+				return nil
+			}
+			return emit(NewSectorRow(addr, s, placement.Status))
+		})
+	}
+}
+
+// SectorDealRow is a row of a sector deals export: a deal stored in a sector.
+// Deal fields are empty when the deal is no longer in the market, i.e. it expired
+// or was terminated.
+type SectorDealRow struct {
+	Miner            address.Address     `json:"miner"`
+	Sector           abi.SectorNumber    `json:"sector"`
+	SectorActivation abi.ChainEpoch      `json:"sectorActivation"`
+	SectorExpiration abi.ChainEpoch      `json:"sectorExpiration"`
+	DealID           abi.DealID          `json:"dealId"`
+	Found            bool                `json:"found"`
+	PieceCID         *cid.Cid            `json:"pieceCid,omitempty"`
+	PieceSize        abi.PaddedPieceSize `json:"pieceSize,omitempty"`
+	Verified         bool                `json:"verified"`
+	Client           *address.Address    `json:"client,omitempty"`
+	StartEpoch       abi.ChainEpoch      `json:"startEpoch,omitempty"`
+	EndEpoch         abi.ChainEpoch      `json:"endEpoch,omitempty"`
+}
+
+// SectorDealHeader is the csv header of SectorDealRow records.
+var SectorDealHeader = []string{"miner", "sector", "sector_activation", "sector_expiration", "deal_id", "found", "piece_cid", "piece_size", "verified", "client", "start_epoch", "end_epoch"}
+
+// CSVRecord returns the csv record of the row.
+func (sd *SectorDealRow) CSVRecord() []string {
+	rec := []string{
+		sd.Miner.String(),
+		strconv.FormatUint(uint64(sd.Sector), 10),
+		strconv.FormatInt(int64(sd.SectorActivation), 10),
+		strconv.FormatInt(int64(sd.SectorExpiration), 10),
+		strconv.FormatUint(uint64(sd.DealID), 10),
+		strconv.FormatBool(sd.Found),
+		"", "", "", "", "", "",
+	}
+	if sd.Found {
+		rec[6] = sd.PieceCID.String()
+		rec[7] = strconv.FormatUint(uint64(sd.PieceSize), 10)
+		rec[8] = strconv.FormatBool(sd.Verified)
+		rec[9] = sd.Client.String()
+		rec[10] = strconv.FormatInt(int64(sd.StartEpoch), 10)
+		rec[11] = strconv.FormatInt(int64(sd.EndEpoch), 10)
+	}
+	return rec
+}
+
+// PeerRow is a row of a miner peers export: the libp2p peer a miner advertises.
+// Multiaddrs ent can't decode are exported as 0x-prefixed hex.
+type PeerRow struct {
+	Miner      address.Address `json:"miner"`
+	PeerID     string          `json:"peerId"`
+	Multiaddrs []string        `json:"multiaddrs"`
+}
+
+// PeerHeader is the csv header of PeerRow records.
+var PeerHeader = []string{"miner", "peer_id", "multiaddrs"}
+
+// NewPeerRow returns the row of the peer a miner advertises.
+func NewPeerRow(miner address.Address, peer *MinerPeerInfo) *PeerRow {
+	row := &PeerRow{Miner: miner, Multiaddrs: []string{}}
+	if len(peer.PeerID) > 0 {
+		row.PeerID = PeerIDString(peer.PeerID)
+	}
+	for _, b := range peer.Multiaddrs {
+		ma, err := MultiaddrString(b)
 		if err != nil {
-			panic(err)
+			ma = "0x" + hex.EncodeToString(b)
 		}
-	}()
+		row.Multiaddrs = append(row.Multiaddrs, ma)
+	}
+	return row
+}
 
-	return out, nil
+// CSVRecord returns the csv record of the row, multiaddrs separated by spaces.
+func (p *PeerRow) CSVRecord() []string {
+	return []string{p.Miner.String(), p.PeerID, strings.Join(p.Multiaddrs, " ")}
 }
@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/cbor"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+)
+
+// DetectActorsVersion makes ForEachActor detect the actors version of the state.
+const DetectActorsVersion = -1
+
+// ActorVisit is an actor of a state passed to ForEachActor callbacks.
+type ActorVisit struct {
+	Addr  address.Address
+	Actor Actor
+	// Code is the name of the actor's code, like "storageminer", or "" for
+	// unknown code
+	Code string
+	// ActorsVersion is the actors version of the state
+	ActorsVersion int
+
+	ctx   context.Context
+	store cbornode.IpldStore
+	once  sync.Once
+	state cbor.Unmarshaler
+	err   error
+}
+
+// State decodes the actor's head with the state type of its code, once.  Visits
+// that do not need the state do not pay for decoding it.
+func (v *ActorVisit) State() (cbor.Unmarshaler, error) {
+	v.once.Do(func() {
+		st, err := NewActorState(v.ActorsVersion, v.Code)
+		if err != nil {
+			v.err = err
+			return
+		}
+		if err := v.store.Get(v.ctx, v.Actor.Head, st); err != nil {
+			v.err = xerrors.Errorf("failed to load %s state of %s: %w", v.Code, v.Addr, err)
+			return
+		}
+		v.state = st
+	})
+	return v.state, v.err
+}
+
+// ForEachActor calls fn for every actor of the state at root, a wrapped state root
+// or a bare actors tree, in actors version version or DetectActorsVersion.  Calls
+// run in parallel on a worker per CPU in no particular order, so fn must be safe
+// for concurrent use.  The walk stops at the first error fn returns.
+func ForEachActor(ctx context.Context, store cbornode.IpldStore, root cid.Cid, version int, fn func(v *ActorVisit) error) error {
+	var info *RootInfo
+	if version == DetectActorsVersion {
+		var err error
+		if info, err = InspectRoot(ctx, store, root); err != nil {
+			return err
+		}
+	} else {
+		actors, _, err := UnwrapStateRoot(ctx, store, root)
+		if err != nil {
+			return err
+		}
+		info = &RootInfo{Actors: actors, ActorsVersion: version}
+	}
+	codeName, err := ActorCodeNamer(ctx, store, info)
+	if err != nil {
+		return err
+	}
+	tree, err := LoadActorsTree(ctx, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return err
+	}
+
+	grp, ctx := errgroup.WithContext(ctx)
+	visits := make(chan *ActorVisit, 2*runtime.NumCPU())
+	grp.Go(func() error {
+		defer close(visits)
+		return tree.ForEach(func(addr address.Address, a *Actor) error {
+			// ForEach reuses its actor pointer
+			v := &ActorVisit{Addr: addr, Actor: *a, Code: codeName(a.Code), ActorsVersion: info.ActorsVersion, ctx: ctx, store: store}
+			select {
+			case visits <- v:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	})
+	for i := 0; i < runtime.NumCPU(); i++ {
+		grp.Go(func() error {
+			for v := range visits {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := fn(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return grp.Wait()
+}
@@ -0,0 +1,275 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+// persist the epoch index of walked chains
+var entIndexPath = "~/.ent/datastore/index"
+
+// IndexEntry is the index record of the state of one epoch.
+type IndexEntry struct {
+	Epoch int64
+	// TipSetKey is the block CIDs of the tipset at Epoch
+	TipSetKey []cid.Cid
+	// StateRoot is the state after executing the tipset at Epoch
+	StateRoot cid.Cid
+	// BlockHeight is the height of the first block holding StateRoot as its parent
+	// state root, more than Epoch after null rounds
+	BlockHeight   int64
+	ActorsVersion int
+	// VersionExpected is set when the state was not in the store and
+	// ActorsVersion is that of the mainnet upgrade schedule
+	VersionExpected bool
+	// Parent is the epoch of the entry of the parent tipset, -1 at genesis
+	Parent int64
+}
+
+// ChainIndex maps epochs of walked chains to their tipsets and state roots.
+// Entries link to the entry of their parent tipset so reading a chain back is a
+// key lookup per epoch.
+type ChainIndex struct {
+	ds datastore.Batching
+}
+
+var (
+	// /epoch/<epoch> holds the IndexEntry of an epoch, zero padded to sort by epoch
+	indexEpochPrefix = "/epoch/"
+	// /block/<cid> holds the epoch of the entry of the parent tipset of a block
+	indexBlockPrefix = "/block/"
+	// indexBuildingKey is set while a build is in progress.  Entries written by an
+	// interrupted build may link to missing parents.
+	indexBuildingKey = datastore.NewKey("/meta/building")
+)
+
+func indexEpochKey(epoch int64) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("%s%020d", indexEpochPrefix, epoch))
+}
+
+func indexBlockKey(c cid.Cid) datastore.Key {
+	return datastore.NewKey(indexBlockPrefix + c.String())
+}
+
+// OpenChainIndex opens the ~/.ent chain index, creating it if needed.
+func OpenChainIndex() (*ChainIndex, error) {
+	path, err := homedir.Expand(entIndexPath)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := chainBadgerDs(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open chain index: %w", err)
+	}
+	return &ChainIndex{ds: ds}, nil
+}
+
+func (ci *ChainIndex) Close() error {
+	return ci.ds.Close()
+}
+
+// Entry returns the entry of epoch.
+func (ci *ChainIndex) Entry(epoch int64) (*IndexEntry, bool, error) {
+	raw, err := ci.ds.Get(indexEpochKey(epoch))
+	if err == datastore.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var e IndexEntry
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return nil, false, xerrors.Errorf("corrupt index entry for epoch %d: %w", epoch, err)
+	}
+	// Older builds recorded expected pre-v2 versions as v0 and present ones as v1
+	if e.ActorsVersion < GenesisActorsVersion {
+		e.ActorsVersion = GenesisActorsVersion
+	}
+	return &e, true, nil
+}
+
+// maxNullRounds bounds the epochs EntryAtOrBefore looks back over
+const maxNullRounds = 1000
+
+// EntryAtOrBefore returns the entry of the latest epoch at or before epoch, the
+// tipset before a run of null rounds if epoch is one of them.
+func (ci *ChainIndex) EntryAtOrBefore(epoch int64) (*IndexEntry, bool, error) {
+	for e := epoch; e >= 0 && e > epoch-maxNullRounds; e-- {
+		entry, found, err := ci.Entry(e)
+		if err != nil || found {
+			return entry, found, err
+		}
+	}
+	return nil, false, nil
+}
+
+// Roots returns the state roots walking back from the block tip as the
+// ChainStateIterator does, up to num of them.  It returns false if the index does
+// not hold the chain of tip down to num roots or genesis.
+func (ci *ChainIndex) Roots(tip cid.Cid, num int) ([]IterVal, bool, error) {
+	raw, err := ci.ds.Get(indexBlockKey(tip))
+	if err == datastore.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var epoch int64
+	if err := json.Unmarshal(raw, &epoch); err != nil {
+		return nil, false, err
+	}
+	var vals []IterVal
+	for epoch >= 0 && len(vals) < num {
+		e, found, err := ci.Entry(epoch)
+		if err != nil || !found {
+			return nil, false, err
+		}
+		vals = append(vals, IterVal{Height: e.Epoch, State: e.StateRoot, BlockHeight: e.BlockHeight, TipSetKey: e.TipSetKey})
+		epoch = e.Parent
+	}
+	return vals, true, nil
+}
+
+func (ci *ChainIndex) put(b datastore.Batch, e *IndexEntry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(indexEpochKey(e.Epoch), raw); err != nil {
+		return err
+	}
+	// Blocks of the first tipset have no parent entry to point to
+	if e.Parent < 0 {
+		return nil
+	}
+	return ci.putBlocks(b, e.TipSetKey, e.Parent)
+}
+
+func (ci *ChainIndex) putBlocks(b datastore.Batch, blks []cid.Cid, parentEpoch int64) error {
+	raw, err := json.Marshal(parentEpoch)
+	if err != nil {
+		return err
+	}
+	for _, blk := range blks {
+		if err := b.Put(indexBlockKey(blk), raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexBatchSize is the number of entries written per index batch
+const indexBatchSize = 1000
+
+// BuildIndex indexes the chain walking back from the block head until genesis or
+// an epoch already indexed with the same state, and returns the number of
+// entries written.  Actors versions are read from the states where available.
+// progress, if not nil, is called with every entry before it is written.
+func (c *Chain) BuildIndex(ctx context.Context, ci *ChainIndex, head cid.Cid, progress func(*IndexEntry)) (int, error) {
+	store, err := c.LoadCborStore(ctx)
+	if err != nil {
+		return 0, err
+	}
+	iter, err := c.NewChainStateIterator(ctx, head)
+	if err != nil {
+		return 0, err
+	}
+	// After an interrupted build existing entries may not link down to genesis
+	resume, err := ci.ds.Has(indexBuildingKey)
+	if err != nil {
+		return 0, err
+	}
+	if err := ci.ds.Put(indexBuildingKey, head.Bytes()); err != nil {
+		return 0, err
+	}
+	b, err := ci.ds.Batch()
+	if err != nil {
+		return 0, err
+	}
+	written, batched := 0, 0
+	flush := func() error {
+		if err := b.Commit(); err != nil {
+			return err
+		}
+		b, err = ci.ds.Batch()
+		batched = 0
+		return err
+	}
+
+	// An entry is written once the epoch of its parent entry is known
+	var prev *IndexEntry
+	writePrev := func(parent int64) error {
+		if prev == nil {
+			return nil
+		}
+		prev.Parent = parent
+		if progress != nil {
+			progress(prev)
+		}
+		if err := ci.put(b, prev); err != nil {
+			return err
+		}
+		written++
+		batched++
+		if batched >= indexBatchSize {
+			return flush()
+		}
+		return nil
+	}
+	for !iter.Done() {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		val := iter.Val()
+		if prev == nil {
+			if err := ci.putBlocks(b, []cid.Cid{head}, val.Height); err != nil {
+				return written, err
+			}
+		}
+		if !resume {
+			existing, found, err := ci.Entry(val.Height)
+			if err != nil {
+				return written, err
+			}
+			if found && existing.StateRoot == val.State {
+				if err := writePrev(val.Height); err != nil {
+					return written, err
+				}
+				prev = nil
+				break
+			}
+		}
+		if err := writePrev(val.Height); err != nil {
+			return written, err
+		}
+		prev = &IndexEntry{
+			Epoch:       val.Height,
+			TipSetKey:   val.TipSetKey,
+			StateRoot:   val.State,
+			BlockHeight: val.BlockHeight,
+		}
+		if info, err := InspectRoot(ctx, store, val.State); err == nil {
+			prev.ActorsVersion = info.ActorsVersion
+		} else {
+			prev.ActorsVersion = ExpectedActorsVersion(abi.ChainEpoch(val.BlockHeight))
+			prev.VersionExpected = true
+		}
+		if err := iter.Step(ctx); err != nil {
+			return written, err
+		}
+	}
+	if err := writePrev(-1); err != nil {
+		return written, err
+	}
+	if err := flush(); err != nil {
+		return written, err
+	}
+	return written, ci.ds.Delete(indexBuildingKey)
+}
@@ -0,0 +1,117 @@
+package lib
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// IOLimit caps the rate in bytes per second of writes to the ~/.ent chain store
+// and of export output, 0 for no limit.  All limited writes share the one rate so
+// that ent leaves disk bandwidth to a co-located lotus node.
+var IOLimit int64
+
+// IOLimitBurst is the time worth of writes at IOLimit that may go out at once
+const IOLimitBurst = 100 * time.Millisecond
+
+// rateLimiter is a token bucket filled at rate bytes per second.
+type rateLimiter struct {
+	lk     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+var (
+	ioLimiterOnce sync.Once
+	ioLimiterVal  *rateLimiter
+)
+
+// ioLimiter returns the limiter of IOLimit, nil if there is no limit.
+func ioLimiter() *rateLimiter {
+	ioLimiterOnce.Do(func() {
+		if IOLimit <= 0 {
+			return
+		}
+		rate := float64(IOLimit)
+		ioLimiterVal = &rateLimiter{
+			rate:  rate,
+			burst: rate * IOLimitBurst.Seconds(),
+			last:  time.Now(),
+		}
+	})
+	return ioLimiterVal
+}
+
+// wait blocks until n bytes may be written.  Writes larger than the burst take
+// the bucket into debt so that following writes wait them out.
+func (rl *rateLimiter) wait(n int) {
+	rl.lk.Lock()
+	now := time.Now()
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > rl.burst {
+		rl.tokens = rl.burst
+	}
+	rl.last = now
+	rl.tokens -= float64(n)
+	var delay time.Duration
+	if rl.tokens < 0 {
+		delay = time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+	}
+	rl.lk.Unlock()
+	time.Sleep(delay)
+}
+
+// LimitedBlockstore paces puts to an underlying blockstore to IOLimit.
+type LimitedBlockstore struct {
+	blockstore.Blockstore
+	limiter *rateLimiter
+}
+
+// NewLimitedBlockstore wraps bs in a LimitedBlockstore, or returns it as is if
+// there is no IOLimit.
+func NewLimitedBlockstore(bs blockstore.Blockstore) blockstore.Blockstore {
+	limiter := ioLimiter()
+	if limiter == nil {
+		return bs
+	}
+	return &LimitedBlockstore{Blockstore: bs, limiter: limiter}
+}
+
+func (lb *LimitedBlockstore) Put(b blocks.Block) error {
+	lb.limiter.wait(len(b.RawData()))
+	return lb.Blockstore.Put(b)
+}
+
+func (lb *LimitedBlockstore) PutMany(bs []blocks.Block) error {
+	n := 0
+	for _, b := range bs {
+		n += len(b.RawData())
+	}
+	lb.limiter.wait(n)
+	return lb.Blockstore.PutMany(bs)
+}
+
+type limitedWriter struct {
+	w       io.Writer
+	limiter *rateLimiter
+}
+
+// LimitWriter paces writes to w to IOLimit, or returns w as is if there is no
+// IOLimit.
+func LimitWriter(w io.Writer) io.Writer {
+	limiter := ioLimiter()
+	if limiter == nil {
+		return w
+	}
+	return &limitedWriter{w: w, limiter: limiter}
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	lw.limiter.wait(len(p))
+	return lw.w.Write(p)
+}
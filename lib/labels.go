@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	address "github.com/filecoin-project/go-address"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+// EntLabelsPath is the address labels file read by LoadAddressLabels in addition
+// to the built-in labels, if it exists.
+var EntLabelsPath = "~/.ent/labels"
+
+// AddressLabels names well known actors, so reports can show "f099 (burnt
+// funds)" rather than a bare ID.
+type AddressLabels map[address.Address]string
+
+// BuiltinAddressLabels returns the labels of the singleton actors of every
+// network.
+func BuiltinAddressLabels() AddressLabels {
+	return AddressLabels{
+		builtin0.SystemActorAddr:           "system",
+		builtin0.InitActorAddr:             "init",
+		builtin0.RewardActorAddr:           "reward",
+		builtin0.CronActorAddr:             "cron",
+		builtin0.StoragePowerActorAddr:     "storage power",
+		builtin0.StorageMarketActorAddr:    "storage market",
+		builtin0.VerifiedRegistryActorAddr: "verified registry",
+		ReserveAddr:                        "mining reserve",
+		builtin0.BurntFundsActorAddr:       "burnt funds",
+	}
+}
+
+// LoadAddressLabels returns the built-in labels overridden by those of
+// EntLabelsPath, if it exists, and then by those of the files at paths, which
+// must exist.  Labels files list an address and its label per line, in the form
+// ReadAddressesFile reads.
+func LoadAddressLabels(paths ...string) (AddressLabels, error) {
+	labels := BuiltinAddressLabels()
+	defaultPath, err := homedir.Expand(EntLabelsPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(defaultPath); err == nil {
+		paths = append([]string{defaultPath}, paths...)
+	}
+	for _, path := range paths {
+		_, fileLabels, err := ReadAddressesFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for addr, label := range fileLabels {
+			labels[addr] = label
+		}
+	}
+	return labels, nil
+}
+
+// ForState returns the labels with those of robust addresses also keyed by the
+// ID address of their actor in the state at root, since reports of a state list
+// actors by ID.  The state is only read if there are robust addresses.
+func (l AddressLabels) ForState(ctx context.Context, store cbornode.IpldStore, root cid.Cid) (AddressLabels, error) {
+	resolved := make(AddressLabels, len(l))
+	var resolver *AddressResolver
+	for addr, label := range l {
+		resolved[addr] = label
+		if addr.Protocol() == address.ID {
+			continue
+		}
+		if resolver == nil {
+			var err error
+			if resolver, err = NewAddressResolver(ctx, store, root); err != nil {
+				return nil, xerrors.Errorf("failed to resolve labelled addresses: %w", err)
+			}
+		}
+		id, found, err := resolver.Resolve(addr)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to resolve labelled address %s: %w", addr, err)
+		}
+		// Explicit labels of ID addresses win
+		if _, ok := l[id]; found && !ok {
+			resolved[id] = label
+		}
+	}
+	return resolved, nil
+}
+
+// Format returns addr followed by its label in parentheses, if it has one.
+func (l AddressLabels) Format(addr address.Address) string {
+	if label, ok := l[addr]; ok {
+		return addr.String() + " (" + label + ")"
+	}
+	return addr.String()
+}
+
+// ReadAddressesFile reads addresses, one per line optionally followed by a label.
+// Blank lines and lines starting with # are skipped.
+func ReadAddressesFile(path string) ([]address.Address, map[address.Address]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var addrs []address.Address
+	labels := make(map[address.Address]string)
+	for i, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		addr, err := address.NewFromString(fields[0])
+		if err != nil {
+			return nil, nil, xerrors.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		addrs = append(addrs, addr)
+		if len(fields) == 2 {
+			labels[addr] = strings.TrimSpace(fields[1])
+		}
+	}
+	return addrs, labels, nil
+}
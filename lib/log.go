@@ -10,6 +10,8 @@ import (
 
 type MigrationLogger struct {
 	l *log.Logger
+	// hooks receive every formatted log message
+	hooks []func(rt.LogLevel, string)
 }
 
 func NewMigrationLogger(out io.Writer) *MigrationLogger {
@@ -18,6 +20,20 @@ func NewMigrationLogger(out io.Writer) *MigrationLogger {
 	}
 }
 
+// OnLog registers fn to be called with every log message after formatting.
+func (m *MigrationLogger) OnLog(fn func(level rt.LogLevel, msg string)) {
+	m.hooks = append(m.hooks, fn)
+}
+
+// NotifyProgress forwards info and higher level migration log messages to n.
+func (m *MigrationLogger) NotifyProgress(n *Notifier) {
+	m.OnLog(func(level rt.LogLevel, msg string) {
+		if level != rt.DEBUG {
+			n.Notify("progress", msg, nil)
+		}
+	})
+}
+
 func (m *MigrationLogger) Log(level rt.LogLevel, msg string, args ...interface{}) {
 	var prefix string
 	if level == rt.DEBUG {
@@ -31,4 +47,10 @@ func (m *MigrationLogger) Log(level rt.LogLevel, msg string, args ...interface{}
 	}
 	outStr := fmt.Sprintf("%s %s", prefix, msg)
 	m.l.Printf(outStr, args...)
+	if len(m.hooks) > 0 {
+		formatted := fmt.Sprintf(outStr, args...)
+		for _, hook := range m.hooks {
+			hook(level, formatted)
+		}
+	}
 }
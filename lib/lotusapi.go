@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// LotusAPI calls the JSON-RPC API of a lotus node over http.  Only the few
+// methods ent needs are implemented, so lotus is not a dependency.
+type LotusAPI struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewLotusAPI returns a client of the lotus API at url, e.g.
+// http://127.0.0.1:1234/rpc/v0, authorized with token if set.
+func NewLotusAPI(url, token string) *LotusAPI {
+	return &LotusAPI{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (api *LotusAPI) call(ctx context.Context, method string, out interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, api.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if api.token != "" {
+		req.Header.Set("Authorization", "Bearer "+api.token)
+	}
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return xerrors.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("%s: lotus API returned %s", method, resp.Status)
+	}
+	var rpcResp rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return xerrors.Errorf("%s: failed to decode response: %w", method, err)
+	}
+	if rpcResp.Error != nil {
+		return xerrors.Errorf("%s: %s (code %d)", method, rpcResp.Error.Message, rpcResp.Error.Code)
+	}
+	return json.Unmarshal(rpcResp.Result, out)
+}
+
+// ChainHead is the head tipset as far as ent needs it.
+type ChainHead struct {
+	Height abi.ChainEpoch
+	// ParentStateRoot is the state the head tipset was executed on
+	ParentStateRoot cid.Cid
+}
+
+// ChainHead returns the node's current head.
+func (api *LotusAPI) ChainHead(ctx context.Context) (*ChainHead, error) {
+	var ts struct {
+		Height abi.ChainEpoch
+		Blocks []struct {
+			ParentStateRoot cid.Cid
+		}
+	}
+	if err := api.call(ctx, "Filecoin.ChainHead", &ts); err != nil {
+		return nil, err
+	}
+	if len(ts.Blocks) == 0 {
+		return nil, xerrors.Errorf("head tipset at %d has no blocks", ts.Height)
+	}
+	return &ChainHead{Height: ts.Height, ParentStateRoot: ts.Blocks[0].ParentStateRoot}, nil
+}
+
+// ChainReadObj returns the raw data of the block c from the node's blockstore.
+func (api *LotusAPI) ChainReadObj(ctx context.Context, c cid.Cid) ([]byte, error) {
+	var data []byte
+	if err := api.call(ctx, "Filecoin.ChainReadObj", &data, c); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ChainHasObj returns whether the node's blockstore has the block c.
+func (api *LotusAPI) ChainHasObj(ctx context.Context, c cid.Cid) (bool, error) {
+	var has bool
+	if err := api.call(ctx, "Filecoin.ChainHasObj", &has, c); err != nil {
+		return false, err
+	}
+	return has, nil
+}
@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"context"
+	"strings"
+
+	address "github.com/filecoin-project/go-address"
+	builtin8 "github.com/filecoin-project/specs-actors/v8/actors/builtin"
+	manifest8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/manifest"
+	system8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/system"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// ActorsManifest maps builtin actor names to the code CIDs of an actors bundle.
+// Starting with nv16 actor code is installed from a bundle and the system actor
+// state points at the manifest data.
+type ActorsManifest struct {
+	// Data is the CID of the manifest entries, as stored in the system actor
+	Data    cid.Cid
+	Entries []manifest8.ManifestEntry
+}
+
+// LoadManifest loads the bundle manifest with CID manifestCid.
+func LoadManifest(ctx context.Context, store cbornode.IpldStore, manifestCid cid.Cid) (*ActorsManifest, error) {
+	var m manifest8.Manifest
+	if err := store.Get(ctx, manifestCid, &m); err != nil {
+		return nil, xerrors.Errorf("failed to read actors manifest: %w", err)
+	}
+	if m.Version != 1 {
+		return nil, xerrors.Errorf("unknown manifest version %d", m.Version)
+	}
+	return LoadManifestData(ctx, store, m.Data)
+}
+
+// LoadManifestData loads manifest entries directly from the manifest data CID.
+func LoadManifestData(ctx context.Context, store cbornode.IpldStore, data cid.Cid) (*ActorsManifest, error) {
+	var md manifest8.ManifestData
+	if err := store.Get(ctx, data, &md); err != nil {
+		return nil, xerrors.Errorf("failed to read actors manifest data: %w", err)
+	}
+	return &ActorsManifest{
+		Data:    data,
+		Entries: md.Entries,
+	}, nil
+}
+
+// ManifestFromState loads the manifest referenced by the system actor of the
+// v8+ actors tree at actorsRoot.  It returns nil when the system actor predates
+// bundles and has no manifest.
+func ManifestFromState(ctx context.Context, store cbornode.IpldStore, actorsVersion int, actorsRoot cid.Cid) (*ActorsManifest, error) {
+	if actorsVersion < 8 {
+		return nil, nil
+	}
+	tree, err := LoadActorsTree(ctx, store, actorsVersion, actorsRoot)
+	if err != nil {
+		return nil, err
+	}
+	system, found, err := tree.GetActor(builtin8.SystemActorAddr)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, xerrors.Errorf("no system actor in state %s", actorsRoot)
+	}
+	return ManifestFromSystemActor(ctx, store, system)
+}
+
+// ManifestFromSystemActor loads the manifest referenced by a v8+ system actor.
+func ManifestFromSystemActor(ctx context.Context, store cbornode.IpldStore, system *Actor) (*ActorsManifest, error) {
+	var st system8.State
+	if err := store.Get(ctx, system.Head, &st); err != nil {
+		return nil, xerrors.Errorf("failed to read system actor state: %w", err)
+	}
+	return LoadManifestData(ctx, store, st.BuiltinActors)
+}
+
+// Code returns the code CID of the named actor.
+func (m *ActorsManifest) Code(name string) (cid.Cid, bool) {
+	for _, e := range m.Entries {
+		if e.Name == name {
+			return e.Code, true
+		}
+	}
+	return cid.Undef, false
+}
+
+// CanonicalCodes maps the bundle code CIDs of the manifest to the placeholder
+// code CIDs specs-actors v8 uses internally, so specs-actors invariant checks can
+// run over bundle state.
+func (m *ActorsManifest) CanonicalCodes() map[cid.Cid]cid.Cid {
+	byName := make(map[string]cid.Cid)
+	for _, c := range []cid.Cid{
+		builtin8.SystemActorCodeID,
+		builtin8.InitActorCodeID,
+		builtin8.CronActorCodeID,
+		builtin8.AccountActorCodeID,
+		builtin8.StoragePowerActorCodeID,
+		builtin8.StorageMinerActorCodeID,
+		builtin8.StorageMarketActorCodeID,
+		builtin8.PaymentChannelActorCodeID,
+		builtin8.MultisigActorCodeID,
+		builtin8.RewardActorCodeID,
+		builtin8.VerifiedRegistryActorCodeID,
+	} {
+		byName[strings.TrimPrefix(builtin8.ActorNameByCode(c), "fil/8/")] = c
+	}
+	remap := make(map[cid.Cid]cid.Cid)
+	for _, e := range m.Entries {
+		if c, ok := byName[e.Name]; ok {
+			remap[e.Code] = c
+		}
+	}
+	return remap
+}
+
+// VerifyStateManifest checks that the system actor of the v8+ actors tree at
+// actorsRoot references the manifest m and that every actor runs code from m.
+func VerifyStateManifest(ctx context.Context, store cbornode.IpldStore, actorsVersion int, actorsRoot cid.Cid, m *ActorsManifest) error {
+	stateManifest, err := ManifestFromState(ctx, store, actorsVersion, actorsRoot)
+	if err != nil {
+		return err
+	}
+	if stateManifest == nil || !stateManifest.Data.Equals(m.Data) {
+		return xerrors.Errorf("system actor does not reference bundle manifest data %s", m.Data)
+	}
+	codes := make(map[cid.Cid]struct{})
+	for _, e := range m.Entries {
+		codes[e.Code] = struct{}{}
+	}
+	tree, err := LoadActorsTree(ctx, store, actorsVersion, actorsRoot)
+	if err != nil {
+		return err
+	}
+	var unknown []address.Address
+	if err := tree.ForEach(func(addr address.Address, a *Actor) error {
+		if _, ok := codes[a.Code]; !ok {
+			unknown = append(unknown, addr)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return xerrors.Errorf("%d actors have code CIDs missing from the bundle manifest, first %s", len(unknown), unknown[0])
+	}
+	return nil
+}
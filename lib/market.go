@@ -0,0 +1,200 @@
+package lib
+
+import (
+	"context"
+	"sync"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/cbor"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	adt0 "github.com/filecoin-project/specs-actors/actors/util/adt"
+	adt2 "github.com/filecoin-project/specs-actors/v2/actors/util/adt"
+	market8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/market"
+	adt8 "github.com/filecoin-project/specs-actors/v8/actors/util/adt"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// LoadMarketState loads the storage market actor state of the state tree at root.
+// The state layout is the same in all actors versions so it is returned as v8
+// state.
+func LoadMarketState(ctx context.Context, store cbornode.IpldStore, root cid.Cid) (*market8.State, *RootInfo, error) {
+	a, info, err := LoadStateActor(ctx, store, root, builtin0.StorageMarketActorAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	var st market8.State
+	if err := store.Get(ctx, a.Head, &st); err != nil {
+		return nil, nil, err
+	}
+	return &st, info, nil
+}
+
+// DealProposals looks up deal proposals of a market state by deal id.  Lookups
+// are safe for concurrent use.
+type DealProposals struct {
+	// lk guards arr, which caches the nodes it loads
+	lk  sync.Mutex
+	arr interface {
+		Get(k uint64, out cbor.Unmarshaler) (bool, error)
+	}
+}
+
+// LoadDealProposals loads the deal proposals AMT of a market state.  The AMT
+// bitwidth changed in actors v3.  Proposals are returned as v8 proposals, whose
+// label decodes the string labels of earlier versions.
+func LoadDealProposals(ctx context.Context, store cbornode.IpldStore, actorsVersion int, st *market8.State) (*DealProposals, error) {
+	var dp DealProposals
+	var err error
+	switch {
+	case actorsVersion <= 1:
+		dp.arr, err = adt0.AsArray(adt0.WrapStore(ctx, store), st.Proposals)
+	case actorsVersion == 2:
+		dp.arr, err = adt2.AsArray(adt2.WrapStore(ctx, store), st.Proposals)
+	case actorsVersion <= 8:
+		dp.arr, err = adt8.AsArray(adt8.WrapStore(ctx, store), st.Proposals, market8.ProposalsAmtBitwidth)
+	default:
+		return nil, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load deal proposals: %w", err)
+	}
+	return &dp, nil
+}
+
+// Get returns the proposal of deal id, or false if there is no such deal.  Deals
+// are removed from the market once they expire or are terminated.
+func (dp *DealProposals) Get(id abi.DealID) (*market8.DealProposal, bool, error) {
+	var p market8.DealProposal
+	dp.lk.Lock()
+	found, err := dp.arr.Get(uint64(id), &p)
+	dp.lk.Unlock()
+	if err != nil || !found {
+		return nil, found, err
+	}
+	return &p, true, nil
+}
+
+// CountActiveDeals returns the number of deals with a deal state, i.e. deals which
+// were activated in a sector and are not yet removed from the market.
+func CountActiveDeals(ctx context.Context, store cbornode.IpldStore, actorsVersion int, st *market8.State) (uint64, error) {
+	switch {
+	case actorsVersion <= 1:
+		states, err := adt0.AsArray(adt0.WrapStore(ctx, store), st.States)
+		if err != nil {
+			return 0, err
+		}
+		return states.Length(), nil
+	case actorsVersion == 2:
+		states, err := adt2.AsArray(adt2.WrapStore(ctx, store), st.States)
+		if err != nil {
+			return 0, err
+		}
+		return states.Length(), nil
+	case actorsVersion <= 8:
+		states, err := adt8.AsArray(adt8.WrapStore(ctx, store), st.States, market8.StatesAmtBitwidth)
+		if err != nil {
+			return 0, err
+		}
+		return states.Length(), nil
+	default:
+		return 0, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+}
+
+// ForEachDeal calls fn with every deal proposal of a market state and its deal
+// state, nil for deals not yet activated in a sector.
+func ForEachDeal(ctx context.Context, store cbornode.IpldStore, actorsVersion int, st *market8.State, fn func(id abi.DealID, p *market8.DealProposal, s *market8.DealState) error) error {
+	proposals, err := loadArray(ctx, store, actorsVersion, st.Proposals, market8.ProposalsAmtBitwidth)
+	if err != nil {
+		return xerrors.Errorf("failed to load deal proposals: %w", err)
+	}
+	states, err := loadArray(ctx, store, actorsVersion, st.States, market8.StatesAmtBitwidth)
+	if err != nil {
+		return xerrors.Errorf("failed to load deal states: %w", err)
+	}
+	var p market8.DealProposal
+	return proposals.ForEach(&p, func(i int64) error {
+		var s market8.DealState
+		found, err := states.Get(uint64(i), &s)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fn(abi.DealID(i), &p, nil)
+		}
+		return fn(abi.DealID(i), &p, &s)
+	})
+}
+
+// ForEachBalance calls fn with every address and amount of a market balance
+// table, the escrow or locked table.
+func ForEachBalance(ctx context.Context, store cbornode.IpldStore, actorsVersion int, root cid.Cid, fn func(addr address.Address, amount abi.TokenAmount) error) error {
+	m, err := loadMap(ctx, store, actorsVersion, root, adt8.BalanceTableBitwidth)
+	if err != nil {
+		return err
+	}
+	var amount abi.TokenAmount
+	return m.ForEach(&amount, func(k string) error {
+		addr, err := address.NewFromBytes([]byte(k))
+		if err != nil {
+			return err
+		}
+		return fn(addr, amount)
+	})
+}
+
+// DealLocks are the funds the deals of a market state lock.
+type DealLocks struct {
+	// ByAddress is the funds locked for each client and provider
+	ByAddress          map[address.Address]abi.TokenAmount
+	ClientCollateral   abi.TokenAmount
+	ProviderCollateral abi.TokenAmount
+	ClientStorageFee   abi.TokenAmount
+	Deals              int
+}
+
+// LoadDealLocks sums the funds the deals of a market state lock.  Every deal
+// still in the market locks its client and provider collateral, and the storage
+// fee not yet paid to the provider from the client.  The fee is paid up to the
+// last update of an active deal, and slashed or expired deals lock their funds
+// until cron removes them.
+func LoadDealLocks(ctx context.Context, store cbornode.IpldStore, actorsVersion int, st *market8.State) (*DealLocks, error) {
+	locks := &DealLocks{
+		ByAddress:          make(map[address.Address]abi.TokenAmount),
+		ClientCollateral:   big.Zero(),
+		ProviderCollateral: big.Zero(),
+		ClientStorageFee:   big.Zero(),
+	}
+	lock := func(addr address.Address, amount abi.TokenAmount) {
+		prev, ok := locks.ByAddress[addr]
+		if !ok {
+			prev = big.Zero()
+		}
+		locks.ByAddress[addr] = big.Add(prev, amount)
+	}
+	err := ForEachDeal(ctx, store, actorsVersion, st, func(id abi.DealID, p *market8.DealProposal, s *market8.DealState) error {
+		locks.Deals++
+		paidTo := p.StartEpoch
+		if s != nil && s.LastUpdatedEpoch > paidTo {
+			paidTo = s.LastUpdatedEpoch
+		}
+		fee := big.Zero()
+		if paidTo < p.EndEpoch {
+			fee = big.Mul(p.StoragePricePerEpoch, big.NewInt(int64(p.EndEpoch-paidTo)))
+		}
+		lock(p.Client, big.Add(p.ClientCollateral, fee))
+		lock(p.Provider, p.ProviderCollateral)
+		locks.ClientCollateral = big.Add(locks.ClientCollateral, p.ClientCollateral)
+		locks.ProviderCollateral = big.Add(locks.ProviderCollateral, p.ProviderCollateral)
+		locks.ClientStorageFee = big.Add(locks.ClientStorageFee, fee)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
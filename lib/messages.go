@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"context"
+
+	adt0 "github.com/filecoin-project/specs-actors/actors/util/adt"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// Lotus stores the message and receipt AMTs of blocks in the actors v0 AMT format
+// whatever the network version.
+
+// ForEachReceipt calls fn with every receipt in the message receipts AMT at root,
+// indexed by the execution order of the messages they belong to.
+func ForEachReceipt(ctx context.Context, store cbornode.IpldStore, root cid.Cid, fn func(i int64, r *MessageReceipt) error) error {
+	receipts, err := adt0.AsArray(adt0.WrapStore(ctx, store), root)
+	if err != nil {
+		return xerrors.Errorf("failed to load receipts %s: %w", root, err)
+	}
+	var r MessageReceipt
+	return receipts.ForEach(&r, func(i int64) error {
+		return fn(i, &r)
+	})
+}
+
+// BlockMessage is a message included in a block.
+type BlockMessage struct {
+	Cid cid.Cid
+	// Secp is set for secp256k1 signed messages, BLS messages are unsigned in
+	// blocks as their signatures are aggregated
+	Secp    bool
+	Message *Message
+}
+
+// ForEachBlockMessage calls fn with the BLS and then the secp messages of the
+// block blk, in the order the block lists them.
+func ForEachBlockMessage(ctx context.Context, store cbornode.IpldStore, blk *BlockHeader, fn func(m *BlockMessage) error) error {
+	var meta MsgMeta
+	if err := store.Get(ctx, blk.Messages, &meta); err != nil {
+		return xerrors.Errorf("failed to load message meta %s: %w", blk.Messages, err)
+	}
+	each := func(root cid.Cid, secp bool) error {
+		cids, err := adt0.AsArray(adt0.WrapStore(ctx, store), root)
+		if err != nil {
+			return xerrors.Errorf("failed to load messages %s: %w", root, err)
+		}
+		var c cbg.CborCid
+		return cids.ForEach(&c, func(int64) error {
+			m := BlockMessage{Cid: cid.Cid(c), Secp: secp}
+			if secp {
+				var sm SignedMessage
+				if err := store.Get(ctx, m.Cid, &sm); err != nil {
+					return xerrors.Errorf("failed to load message %s: %w", m.Cid, err)
+				}
+				m.Message = &sm.Message
+			} else {
+				m.Message = new(Message)
+				if err := store.Get(ctx, m.Cid, m.Message); err != nil {
+					return xerrors.Errorf("failed to load message %s: %w", m.Cid, err)
+				}
+			}
+			return fn(&m)
+		})
+	}
+	if err := each(meta.BlsMessages, false); err != nil {
+		return err
+	}
+	return each(meta.SecpkMessages, true)
+}
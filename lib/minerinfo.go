@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"context"
+	"io"
+
+	address "github.com/filecoin-project/go-address"
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// MinerAddresses are the addresses of other actors a miner's info references.
+type MinerAddresses struct {
+	Owner            address.Address
+	Worker           address.Address
+	ControlAddresses []address.Address
+	// PendingWorker is the new worker of a worker key change in progress,
+	// undefined if there is none
+	PendingWorker address.Address
+	// PendingOwner is the proposed new owner, undefined if there is none or in
+	// actors v0
+	PendingOwner address.Address
+}
+
+// LoadMinerAddresses loads the addresses referenced by the info of the miner
+// actor state at head.  The miner info layout of actors v2 decodes as v8 info.
+func LoadMinerAddresses(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid) (*MinerAddresses, error) {
+	var infoCid minerInfoCid
+	if err := store.Get(ctx, head, &infoCid); err != nil {
+		return nil, err
+	}
+	switch {
+	case actorsVersion <= 1:
+		var info miner0.MinerInfo
+		if err := store.Get(ctx, cid.Cid(infoCid), &info); err != nil {
+			return nil, xerrors.Errorf("failed to load miner info: %w", err)
+		}
+		addrs := &MinerAddresses{Owner: info.Owner, Worker: info.Worker, ControlAddresses: info.ControlAddresses}
+		if info.PendingWorkerKey != nil {
+			addrs.PendingWorker = info.PendingWorkerKey.NewWorker
+		}
+		return addrs, nil
+	case actorsVersion <= 8:
+		var info miner8.MinerInfo
+		if err := store.Get(ctx, cid.Cid(infoCid), &info); err != nil {
+			return nil, xerrors.Errorf("failed to load miner info: %w", err)
+		}
+		addrs := &MinerAddresses{Owner: info.Owner, Worker: info.Worker, ControlAddresses: info.ControlAddresses}
+		if info.PendingWorkerKey != nil {
+			addrs.PendingWorker = info.PendingWorkerKey.NewWorker
+		}
+		if info.PendingOwnerAddress != nil {
+			addrs.PendingOwner = *info.PendingOwnerAddress
+		}
+		return addrs, nil
+	default:
+		return nil, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+}
+
+// minerInfoCid decodes the info cid of a miner state, its first field in every
+// actors version, without decoding the rest.
+type minerInfoCid cid.Cid
+
+func (m *minerInfoCid) UnmarshalCBOR(r io.Reader) error {
+	maj, extra, err := cbg.CborReadHeader(r)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray || extra == 0 {
+		return xerrors.Errorf("miner state is not a tuple")
+	}
+	c, err := cbg.ReadCid(r)
+	if err != nil {
+		return xerrors.Errorf("failed to read Info: %w", err)
+	}
+	*m = minerInfoCid(c)
+	return nil
+}
+
+// MinerPeerInfo is the libp2p peer a miner advertises in its info.
+type MinerPeerInfo struct {
+	// PeerID is the binary peer ID, empty if the miner set none
+	PeerID     []byte
+	Multiaddrs [][]byte
+}
+
+// LoadMinerPeerInfo loads the peer ID and multiaddrs of the info of the miner
+// actor state at head.
+func LoadMinerPeerInfo(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid) (*MinerPeerInfo, error) {
+	var infoCid minerInfoCid
+	if err := store.Get(ctx, head, &infoCid); err != nil {
+		return nil, err
+	}
+	var peer MinerPeerInfo
+	switch {
+	case actorsVersion <= 1:
+		var info miner0.MinerInfo
+		if err := store.Get(ctx, cid.Cid(infoCid), &info); err != nil {
+			return nil, xerrors.Errorf("failed to load miner info: %w", err)
+		}
+		peer.PeerID = info.PeerId
+		for _, ma := range info.Multiaddrs {
+			peer.Multiaddrs = append(peer.Multiaddrs, ma)
+		}
+	case actorsVersion <= 8:
+		var info miner8.MinerInfo
+		if err := store.Get(ctx, cid.Cid(infoCid), &info); err != nil {
+			return nil, xerrors.Errorf("failed to load miner info: %w", err)
+		}
+		peer.PeerID = info.PeerId
+		for _, ma := range info.Multiaddrs {
+			peer.Multiaddrs = append(peer.Multiaddrs, ma)
+		}
+	default:
+		return nil, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+	return &peer, nil
+}
@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mr-tron/base58"
+	"golang.org/x/xerrors"
+)
+
+// multiaddrProtocol is a multiaddr protocol with the bit size of its value, -1 for
+// a length-prefixed value.
+type multiaddrProtocol struct {
+	name string
+	size int
+}
+
+// multiaddrProtocols are the protocols miners advertise, by multicodec code.
+// Only the few protocols ent needs are decoded, so go-multiaddr is not a
+// dependency.
+var multiaddrProtocols = map[uint64]multiaddrProtocol{
+	4:   {"ip4", 32},
+	6:   {"tcp", 16},
+	33:  {"dccp", 16},
+	41:  {"ip6", 128},
+	42:  {"ip6zone", -1},
+	53:  {"dns", -1},
+	54:  {"dns4", -1},
+	55:  {"dns6", -1},
+	56:  {"dnsaddr", -1},
+	132: {"sctp", 16},
+	273: {"udp", 16},
+	290: {"p2p-circuit", 0},
+	301: {"udt", 0},
+	302: {"utp", 0},
+	421: {"p2p", -1},
+	443: {"https", 0},
+	448: {"tls", 0},
+	460: {"quic", 0},
+	461: {"quic-v1", 0},
+	465: {"webtransport", 0},
+	477: {"ws", 0},
+	478: {"wss", 0},
+	480: {"http", 0},
+}
+
+// PeerIDString encodes a binary libp2p peer ID in base58, its usual text form.
+func PeerIDString(id []byte) string {
+	return base58.Encode(id)
+}
+
+// MultiaddrString decodes a binary multiaddr into its text form, e.g.
+// /ip4/1.2.3.4/tcp/24001.  It fails on protocols it doesn't know.
+func MultiaddrString(b []byte) (string, error) {
+	var s strings.Builder
+	for len(b) > 0 {
+		code, n := binary.Uvarint(b)
+		if n <= 0 {
+			return "", xerrors.Errorf("bad multiaddr protocol code")
+		}
+		b = b[n:]
+		p, ok := multiaddrProtocols[code]
+		if !ok {
+			return "", xerrors.Errorf("unknown multiaddr protocol %d", code)
+		}
+		s.WriteString("/" + p.name)
+		size := p.size / 8
+		if p.size < 0 {
+			l, n := binary.Uvarint(b)
+			if n <= 0 {
+				return "", xerrors.Errorf("bad multiaddr %s value length", p.name)
+			}
+			b, size = b[n:], int(l)
+		}
+		if size == 0 {
+			continue
+		}
+		if len(b) < size {
+			return "", xerrors.Errorf("truncated multiaddr %s value", p.name)
+		}
+		value := b[:size]
+		b = b[size:]
+		switch p.name {
+		case "ip4", "ip6":
+			s.WriteString("/" + net.IP(value).String())
+		case "tcp", "udp", "dccp", "sctp":
+			s.WriteString("/" + strconv.Itoa(int(binary.BigEndian.Uint16(value))))
+		case "p2p":
+			s.WriteString("/" + PeerIDString(value))
+		default:
+			s.WriteString("/" + string(value))
+		}
+	}
+	return s.String(), nil
+}
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Notifier posts progress milestones of long running commands to a webhook.  A
+// nil Notifier sends nothing.  Delivery failures are reported on stderr and never
+// fail the command.
+type Notifier struct {
+	url    string
+	slack  bool
+	client *http.Client
+}
+
+// NewNotifier returns a notifier posting json events to url, or Slack compatible
+// {"text": ...} messages if slack is set.  It returns nil when url is empty.
+func NewNotifier(url string, slack bool) *Notifier {
+	if url == "" {
+		return nil
+	}
+	return &Notifier{
+		url:    url,
+		slack:  slack,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notification is the json payload of a notification.
+type Notification struct {
+	Event  string            `json:"event"`
+	Text   string            `json:"text"`
+	Fields map[string]string `json:"fields,omitempty"`
+	Time   time.Time         `json:"time"`
+}
+
+// Notify posts an event with a human readable text and optional fields.
+func (n *Notifier) Notify(event, text string, fields map[string]string) {
+	if n == nil {
+		return
+	}
+	var payload interface{} = Notification{
+		Event:  event,
+		Text:   text,
+		Fields: fields,
+		Time:   time.Now(),
+	}
+	if n.slack {
+		payload = map[string]string{"text": slackText(event, text, fields)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to encode notification: %s\n", err)
+		return
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to send notification: %s\n", err)
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		_, _ = fmt.Fprintf(os.Stderr, "notification rejected: %s\n", resp.Status)
+	}
+}
+
+func slackText(event, text string, fields map[string]string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*ent %s*: %s", event, text)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "\n%s: `%s`", k, fields[k])
+	}
+	return sb.String()
+}
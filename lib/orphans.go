@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"context"
+	"sort"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+)
+
+// ActorChanges are actors a migration is documented to delete or create.
+type ActorChanges struct {
+	Deleted []address.Address
+	Created []address.Address
+}
+
+// DocumentedActorChanges are the actors the migration to each actors version
+// deletes or creates.  The mainnet migrations to actors v2 through v8 keep the
+// same set of actors.
+var DocumentedActorChanges = map[int]ActorChanges{
+	2: {}, 3: {}, 4: {}, 5: {}, 6: {}, 7: {}, 8: {},
+}
+
+// PresentActor is an actor present in only one of two states.
+type PresentActor struct {
+	Addr address.Address
+	// Code names the code of the actor, like "storageminer"
+	Code    string
+	Balance abi.TokenAmount
+}
+
+// DiffActorSets returns the actors of the state at rootA missing from the state at
+// rootB and those of rootB missing from rootA, in actor ID order.  The states may
+// be of different actors versions.  The actor IDs of rootA are held in memory
+// while rootB is walked.
+func DiffActorSets(ctx context.Context, store cbornode.IpldStore, rootA, rootB cid.Cid) (removed, created []*PresentActor, err error) {
+	onlyA := make(map[address.Address]*PresentActor)
+	err = forEachNamedActor(ctx, store, rootA, func(addr address.Address, code string, a *Actor) error {
+		onlyA[addr] = &PresentActor{Addr: addr, Code: code, Balance: a.Balance}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = forEachNamedActor(ctx, store, rootB, func(addr address.Address, code string, a *Actor) error {
+		if _, ok := onlyA[addr]; ok {
+			delete(onlyA, addr)
+			return nil
+		}
+		created = append(created, &PresentActor{Addr: addr, Code: code, Balance: a.Balance})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, a := range onlyA {
+		removed = append(removed, a)
+	}
+	sortActorsByID(removed)
+	sortActorsByID(created)
+	return removed, created, nil
+}
+
+// sortActorsByID sorts actors with ID addresses by ID.
+func sortActorsByID(actors []*PresentActor) {
+	id := func(a *PresentActor) uint64 {
+		n, _ := address.IDFromAddress(a.Addr)
+		return n
+	}
+	sort.Slice(actors, func(i, j int) bool { return id(actors[i]) < id(actors[j]) })
+}
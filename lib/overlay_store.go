@@ -0,0 +1,41 @@
+package lib
+
+import (
+	"context"
+
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+)
+
+// OverlayStore reads from a base store and writes to a scratch store in memory,
+// so structures derived from a state, like trees rewritten for checking, never
+// reach the base store or the migration buffer behind it.
+type OverlayStore struct {
+	base         cbornode.IpldStore
+	scratchBlock blockstore.Blockstore
+	scratch      cbornode.IpldStore
+}
+
+// NewOverlayStore returns an overlay of base with an empty scratch store.
+func NewOverlayStore(base cbornode.IpldStore) *OverlayStore {
+	bs := NewTemporarySync()
+	return &OverlayStore{base: base, scratchBlock: bs, scratch: cbornode.NewCborStore(bs)}
+}
+
+// Get reads c from the scratch store if it was written there, else from base.
+func (s *OverlayStore) Get(ctx context.Context, c cid.Cid, out interface{}) error {
+	has, err := s.scratchBlock.Has(c)
+	if err != nil {
+		return err
+	}
+	if has {
+		return s.scratch.Get(ctx, c, out)
+	}
+	return s.base.Get(ctx, c, out)
+}
+
+// Put writes v to the scratch store.
+func (s *OverlayStore) Put(ctx context.Context, v interface{}) (cid.Cid, error) {
+	return s.scratch.Put(ctx, v)
+}
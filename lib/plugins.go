@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"context"
+	"plugin"
+	"sync"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// ActorCheck is a custom check of the actors of a state, registered by a check
+// plugin.
+type ActorCheck struct {
+	Name string
+	// Codes limits the check to actors with these code names, like
+	// "storageminer".  The check runs on every actor if empty.
+	Codes []string
+	// Check returns a message for every failure of the actor.  Checks run in
+	// parallel so must be safe for concurrent use.
+	Check func(ctx context.Context, env *CheckEnv, v *ActorVisit) ([]string, error)
+}
+
+// CheckEnv is the state custom checks run on.
+type CheckEnv struct {
+	Store cbornode.IpldStore
+	Root  cid.Cid
+	Info  *RootInfo
+	// Height is the epoch of the state
+	Height abi.ChainEpoch
+	// CodeName names actor code CIDs, like "storageminer"
+	CodeName func(cid.Cid) string
+}
+
+// LoadCheckPlugin opens a Go plugin of custom checks, which exports them as
+//
+//	var Checks []*lib.ActorCheck
+//
+// Plugins must be built with -buildmode=plugin against the same ent source as the
+// ent binary loading them.
+func LoadCheckPlugin(path string) ([]*ActorCheck, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open check plugin %s: %w", path, err)
+	}
+	sym, err := p.Lookup("Checks")
+	if err != nil {
+		return nil, xerrors.Errorf("check plugin %s: %w", path, err)
+	}
+	checks, ok := sym.(*[]*ActorCheck)
+	if !ok {
+		return nil, xerrors.Errorf("check plugin %s exports Checks as %T, not []*lib.ActorCheck", path, sym)
+	}
+	for _, check := range *checks {
+		if check.Name == "" || check.Check == nil {
+			return nil, xerrors.Errorf("check plugin %s has a check without a name or func", path)
+		}
+	}
+	return *checks, nil
+}
+
+// NewCheckEnv loads the environment of custom checks of the state at root.
+func NewCheckEnv(ctx context.Context, store cbornode.IpldStore, root cid.Cid, height abi.ChainEpoch) (*CheckEnv, error) {
+	info, err := InspectRoot(ctx, store, root)
+	if err != nil {
+		return nil, err
+	}
+	name, err := ActorCodeNamer(ctx, store, info)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckEnv{Store: store, Root: root, Info: info, Height: height, CodeName: name}, nil
+}
+
+// RunActorChecks runs checks on every actor of the state of env and passes their
+// failures to fail as "<addr> <code>: <check>: <message>", the form of per actor
+// invariant messages.  fail is not called concurrently.
+func RunActorChecks(ctx context.Context, env *CheckEnv, checks []*ActorCheck, fail func(msg string)) error {
+	if len(checks) == 0 {
+		return nil
+	}
+	byCode := make(map[string][]*ActorCheck)
+	var all []*ActorCheck
+	for _, check := range checks {
+		if len(check.Codes) == 0 {
+			all = append(all, check)
+		}
+		for _, code := range check.Codes {
+			byCode[code] = append(byCode[code], check)
+		}
+	}
+	var lk sync.Mutex
+	return ForEachActor(ctx, env.Store, env.Info.Actors, env.Info.ActorsVersion, func(v *ActorVisit) error {
+		for _, checks := range [][]*ActorCheck{byCode[v.Code], all} {
+			for _, check := range checks {
+				msgs, err := check.Check(ctx, env, v)
+				if err != nil {
+					return xerrors.Errorf("check %s of %s: %w", check.Name, v.Addr, err)
+				}
+				lk.Lock()
+				for _, msg := range msgs {
+					fail(v.Addr.String() + " " + v.Code + ": " + check.Name + ": " + msg)
+				}
+				lk.Unlock()
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"context"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	power0 "github.com/filecoin-project/specs-actors/actors/builtin/power"
+	adt0 "github.com/filecoin-project/specs-actors/actors/util/adt"
+	power2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/power"
+	adt2 "github.com/filecoin-project/specs-actors/v2/actors/util/adt"
+	builtin8 "github.com/filecoin-project/specs-actors/v8/actors/builtin"
+	power8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/power"
+	adt8 "github.com/filecoin-project/specs-actors/v8/actors/util/adt"
+	smoothing8 "github.com/filecoin-project/specs-actors/v8/actors/util/smoothing"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+)
+
+// LoadPowerState loads the power actor state of the state tree at root.  The state
+// layout is unchanged from actors v2 through v8 so it is returned as v8 state.
+// Actors v0 state is converted, dropping LastProcessedCronEpoch.  The claims HAMT
+// layout still differs between versions, read it with ForEachPowerClaim.
+func LoadPowerState(ctx context.Context, store cbornode.IpldStore, root cid.Cid) (*power8.State, *RootInfo, error) {
+	a, info, err := LoadStateActor(ctx, store, root, builtin0.StoragePowerActorAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	st, err := loadPowerState(ctx, store, info.ActorsVersion, a.Head)
+	if err != nil {
+		return nil, nil, err
+	}
+	return st, info, nil
+}
+
+// loadPowerState loads the power actor state at head as v8 state.
+func loadPowerState(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid) (*power8.State, error) {
+	if actorsVersion >= 2 {
+		var st power8.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return nil, err
+		}
+		return &st, nil
+	}
+	var st0 power0.State
+	if err := store.Get(ctx, head, &st0); err != nil {
+		return nil, err
+	}
+	st := power8.State{
+		TotalRawBytePower:         st0.TotalRawBytePower,
+		TotalBytesCommitted:       st0.TotalBytesCommitted,
+		TotalQualityAdjPower:      st0.TotalQualityAdjPower,
+		TotalQABytesCommitted:     st0.TotalQABytesCommitted,
+		TotalPledgeCollateral:     st0.TotalPledgeCollateral,
+		ThisEpochRawBytePower:     st0.ThisEpochRawBytePower,
+		ThisEpochQualityAdjPower:  st0.ThisEpochQualityAdjPower,
+		ThisEpochPledgeCollateral: st0.ThisEpochPledgeCollateral,
+		MinerCount:                st0.MinerCount,
+		MinerAboveMinPowerCount:   st0.MinerAboveMinPowerCount,
+		CronEventQueue:            st0.CronEventQueue,
+		FirstCronEpoch:            st0.FirstCronEpoch,
+		Claims:                    st0.Claims,
+		ProofValidationBatch:      st0.ProofValidationBatch,
+	}
+	if st0.ThisEpochQAPowerSmoothed != nil {
+		st.ThisEpochQAPowerSmoothed = smoothing8.FilterEstimate{
+			PositionEstimate: st0.ThisEpochQAPowerSmoothed.PositionEstimate,
+			VelocityEstimate: st0.ThisEpochQAPowerSmoothed.VelocityEstimate,
+		}
+	}
+	return &st, nil
+}
+
+// ForEachPowerClaim calls fn with the raw byte and quality adjusted power of every
+// miner claim in the power actor claims HAMT at claimsRoot.
+func ForEachPowerClaim(ctx context.Context, store cbornode.IpldStore, actorsVersion int, claimsRoot cid.Cid, fn func(addr address.Address, raw, qa abi.StoragePower) error) error {
+	switch {
+	case actorsVersion <= 1:
+		claims, err := adt0.AsMap(adt0.WrapStore(ctx, store), claimsRoot)
+		if err != nil {
+			return err
+		}
+		var claim power0.Claim
+		return claims.ForEach(&claim, func(k string) error {
+			addr, err := address.NewFromBytes([]byte(k))
+			if err != nil {
+				return err
+			}
+			return fn(addr, claim.RawBytePower, claim.QualityAdjPower)
+		})
+	case actorsVersion == 2:
+		claims, err := adt2.AsMap(adt2.WrapStore(ctx, store), claimsRoot)
+		if err != nil {
+			return err
+		}
+		var claim power2.Claim
+		return claims.ForEach(&claim, func(k string) error {
+			addr, err := address.NewFromBytes([]byte(k))
+			if err != nil {
+				return err
+			}
+			return fn(addr, claim.RawBytePower, claim.QualityAdjPower)
+		})
+	default:
+		claims, err := adt8.AsMap(adt8.WrapStore(ctx, store), claimsRoot, builtin8.DefaultHamtBitwidth)
+		if err != nil {
+			return err
+		}
+		var claim power8.Claim
+		return claims.ForEach(&claim, func(k string) error {
+			addr, err := address.NewFromBytes([]byte(k))
+			if err != nil {
+				return err
+			}
+			return fn(addr, claim.RawBytePower, claim.QualityAdjPower)
+		})
+	}
+}
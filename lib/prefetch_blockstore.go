@@ -0,0 +1,163 @@
+package lib
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	mh "github.com/multiformats/go-multihash"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// PrefetchWorkers is the number of concurrent reads of the lotus chain store
+// fetching the blocks linked from each block read ahead of the reader, 0 disables
+// prefetching.  Tree walks otherwise read one block at a time, which leaves a cold
+// disk cache on spinning disks mostly idle.
+var PrefetchWorkers int
+
+// PrefetchMaxBlocks caps the prefetched blocks held until they are read.  Past the
+// cap the oldest are dropped.
+const PrefetchMaxBlocks = 1 << 16
+
+// PrefetchStats counts prefetched blocks over the life of the process.
+type PrefetchStats struct {
+	// Fetched counts blocks read ahead, Used those of them read afterwards
+	Fetched uint64
+	Used    uint64
+}
+
+var prefetchStats PrefetchStats
+
+// ReadPrefetchStats returns the counts of all prefetching blockstores.
+func ReadPrefetchStats() PrefetchStats {
+	return PrefetchStats{
+		Fetched: atomic.LoadUint64(&prefetchStats.Fetched),
+		Used:    atomic.LoadUint64(&prefetchStats.Used),
+	}
+}
+
+// PrefetchBlockstore reads the blocks linked from every dag-cbor block read from
+// an underlying blockstore ahead of the reader, so the children of HAMT and AMT
+// nodes are fetched concurrently while a walk visits them one at a time.  Blocks
+// prefetched are kept until read once.
+type PrefetchBlockstore struct {
+	blockstore.Blockstore
+	queue chan cid.Cid
+
+	lk sync.Mutex
+	// fetched holds prefetched blocks not yet read, order the CIDs of fetched
+	// as a ring from oldest at next
+	fetched map[cid.Cid]blocks.Block
+	order   []cid.Cid
+	next    int
+	// pending holds CIDs queued or being fetched
+	pending map[cid.Cid]struct{}
+}
+
+// NewPrefetchBlockstore wraps bs in a PrefetchBlockstore with workers concurrent
+// reads, or returns it as is if workers is 0.
+func NewPrefetchBlockstore(bs blockstore.Blockstore, workers int) blockstore.Blockstore {
+	if workers <= 0 {
+		return bs
+	}
+	pb := &PrefetchBlockstore{
+		Blockstore: bs,
+		queue:      make(chan cid.Cid, workers*64),
+		fetched:    make(map[cid.Cid]blocks.Block),
+		order:      make([]cid.Cid, PrefetchMaxBlocks),
+		pending:    make(map[cid.Cid]struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go pb.work()
+	}
+	return pb
+}
+
+func (pb *PrefetchBlockstore) work() {
+	for c := range pb.queue {
+		release := backgroundAcquire(gateStoreRead)
+		b, err := pb.Blockstore.Get(c)
+		release()
+		pb.lk.Lock()
+		delete(pb.pending, c)
+		if _, ok := pb.fetched[c]; err == nil && !ok {
+			pb.keep(b)
+		}
+		pb.lk.Unlock()
+	}
+}
+
+// keep adds b to the fetched blocks, dropping the oldest past the cap.  The lock
+// must be held.
+func (pb *PrefetchBlockstore) keep(b blocks.Block) {
+	if old := pb.order[pb.next]; old.Defined() {
+		delete(pb.fetched, old)
+	}
+	pb.order[pb.next] = b.Cid()
+	pb.next = (pb.next + 1) % len(pb.order)
+	pb.fetched[b.Cid()] = b
+	atomic.AddUint64(&prefetchStats.Fetched, 1)
+}
+
+// prefetch queues the blocks linked from b which are neither fetched nor pending.
+// Links are dropped while the queue is full.
+func (pb *PrefetchBlockstore) prefetch(b blocks.Block) {
+	if b.Cid().Prefix().Codec != cid.DagCBOR {
+		return
+	}
+	var links []cid.Cid
+	// Inline CIDs like actor codes are not stored
+	_ = cbg.ScanForLinks(bytes.NewReader(b.RawData()), func(c cid.Cid) {
+		if c.Prefix().MhType != mh.IDENTITY {
+			links = append(links, c)
+		}
+	})
+	pb.lk.Lock()
+	defer pb.lk.Unlock()
+	for _, c := range links {
+		if _, ok := pb.fetched[c]; ok {
+			continue
+		}
+		if _, ok := pb.pending[c]; ok {
+			continue
+		}
+		select {
+		case pb.queue <- c:
+			pb.pending[c] = struct{}{}
+		default:
+			return
+		}
+	}
+}
+
+func (pb *PrefetchBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	pb.lk.Lock()
+	b, ok := pb.fetched[c]
+	// The ring slot of a taken block is freed when it comes round, at worst
+	// dropping a later prefetch of the same block early
+	delete(pb.fetched, c)
+	pb.lk.Unlock()
+	if ok {
+		atomic.AddUint64(&prefetchStats.Used, 1)
+	} else {
+		var err error
+		if b, err = pb.Blockstore.Get(c); err != nil {
+			return nil, err
+		}
+	}
+	pb.prefetch(b)
+	return b, nil
+}
+
+func (pb *PrefetchBlockstore) Has(c cid.Cid) (bool, error) {
+	pb.lk.Lock()
+	_, ok := pb.fetched[c]
+	pb.lk.Unlock()
+	if ok {
+		return true, nil
+	}
+	return pb.Blockstore.Has(c)
+}
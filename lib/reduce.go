@@ -0,0 +1,233 @@
+package lib
+
+import (
+	"context"
+	"reflect"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/cbor"
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	adt0 "github.com/filecoin-project/specs-actors/actors/util/adt"
+	miner2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/miner"
+	adt2 "github.com/filecoin-project/specs-actors/v2/actors/util/adt"
+	miner3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/miner"
+	adt3 "github.com/filecoin-project/specs-actors/v3/actors/util/adt"
+	miner4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/miner"
+	adt4 "github.com/filecoin-project/specs-actors/v4/actors/util/adt"
+	miner5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/miner"
+	adt5 "github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	miner6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/miner"
+	adt6 "github.com/filecoin-project/specs-actors/v6/actors/util/adt"
+	miner7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/miner"
+	adt7 "github.com/filecoin-project/specs-actors/v7/actors/util/adt"
+	market8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/market"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	adt8 "github.com/filecoin-project/specs-actors/v8/actors/util/adt"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// Helpers removing parts of actor state, for shrinking failing migration inputs.
+
+// array is the AMT method set, including lookup and deletion, shared by the adt
+// packages of every actors version.
+type array interface {
+	cborArray
+	Get(i uint64, out cbor.Unmarshaler) (bool, error)
+	Delete(i uint64) error
+	Root() (cid.Cid, error)
+}
+
+// loadArray loads an AMT of an actors version, bitwidth applies from actors v3.
+func loadArray(ctx context.Context, store cbornode.IpldStore, actorsVersion int, root cid.Cid, bitwidth int) (array, error) {
+	switch {
+	case actorsVersion <= 1:
+		return adt0.AsArray(adt0.WrapStore(ctx, store), root)
+	case actorsVersion == 2:
+		return adt2.AsArray(adt2.WrapStore(ctx, store), root)
+	case actorsVersion <= 8:
+		return adt8.AsArray(adt8.WrapStore(ctx, store), root, bitwidth)
+	default:
+		return nil, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+}
+
+// arrayIndexes returns the indexes set in an AMT.
+func arrayIndexes(arr cborArray) ([]uint64, error) {
+	var idxs []uint64
+	var val cbg.Deferred
+	err := arr.ForEach(&val, func(i int64) error {
+		idxs = append(idxs, uint64(i))
+		return nil
+	})
+	return idxs, err
+}
+
+// filterArray writes a copy of the AMT at root holding only the entries keep
+// returns true for.
+func filterArray(ctx context.Context, store cbornode.IpldStore, actorsVersion int, root cid.Cid, bitwidth int, keep func(i uint64) bool) (cid.Cid, error) {
+	arr, err := loadArray(ctx, store, actorsVersion, root, bitwidth)
+	if err != nil {
+		return cid.Undef, err
+	}
+	idxs, err := arrayIndexes(arr)
+	if err != nil {
+		return cid.Undef, err
+	}
+	for _, i := range idxs {
+		if keep(i) {
+			continue
+		}
+		if err := arr.Delete(i); err != nil {
+			return cid.Undef, err
+		}
+	}
+	return arr.Root()
+}
+
+// setStateField stores a copy of the state st with its CID field name set to c.
+func setStateField(ctx context.Context, store cbornode.IpldStore, st interface{}, name string, c cid.Cid) (cid.Cid, error) {
+	f := reflect.ValueOf(st).Elem().FieldByName(name)
+	if !f.IsValid() {
+		return cid.Undef, xerrors.Errorf("state %T has no field %s", st, name)
+	}
+	f.Set(reflect.ValueOf(c))
+	return store.Put(ctx, st)
+}
+
+// MinerSectorNumbers returns the numbers of all sectors of the miner with head
+// head.
+func MinerSectorNumbers(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid) ([]uint64, error) {
+	sectors, err := loadMinerSectors(ctx, store, actorsVersion, head)
+	if err != nil {
+		return nil, err
+	}
+	return arrayIndexes(sectors)
+}
+
+// FilterMinerSectors writes a copy of the miner state at head holding only the
+// sectors keep returns true for and returns its head.  Deadlines and partitions
+// still reference removed sectors.
+func FilterMinerSectors(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid, keep func(sectorNo uint64) bool) (cid.Cid, error) {
+	st, err := LoadMinerState(ctx, store, actorsVersion, head)
+	if err != nil {
+		return cid.Undef, err
+	}
+	root := reflect.ValueOf(st).Elem().FieldByName("Sectors").Interface().(cid.Cid)
+	newRoot, err := filterArray(ctx, store, actorsVersion, root, miner8.SectorsAmtBitwidth, keep)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return setStateField(ctx, store, st, "Sectors", newRoot)
+}
+
+// ClearMinerDeadlines writes a copy of the miner state at head with the deadlines
+// clear returns true for replaced by empty deadlines and returns its head.
+func ClearMinerDeadlines(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid, clear func(dlIdx uint64) bool) (cid.Cid, error) {
+	st, err := LoadMinerState(ctx, store, actorsVersion, head)
+	if err != nil {
+		return cid.Undef, err
+	}
+	empty, err := emptyDeadline(ctx, store, actorsVersion)
+	if err != nil {
+		return cid.Undef, err
+	}
+	// The deadlines list is encoded the same way in every actors version
+	dlsCid := reflect.ValueOf(st).Elem().FieldByName("Deadlines").Interface().(cid.Cid)
+	var dls miner8.Deadlines
+	if err := store.Get(ctx, dlsCid, &dls); err != nil {
+		return cid.Undef, err
+	}
+	for i := range dls.Due {
+		if clear(uint64(i)) {
+			dls.Due[i] = empty
+		}
+	}
+	newDlsCid, err := store.Put(ctx, &dls)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return setStateField(ctx, store, st, "Deadlines", newDlsCid)
+}
+
+func emptyDeadline(ctx context.Context, store cbornode.IpldStore, actorsVersion int) (cid.Cid, error) {
+	var dl interface{}
+	var err error
+	switch actorsVersion {
+	case 0, 1:
+		emptyArray, err := adt0.MakeEmptyArray(adt0.WrapStore(ctx, store)).Root()
+		if err != nil {
+			return cid.Undef, err
+		}
+		dl = miner0.ConstructDeadline(emptyArray)
+	case 2:
+		emptyArray, err := adt2.MakeEmptyArray(adt2.WrapStore(ctx, store)).Root()
+		if err != nil {
+			return cid.Undef, err
+		}
+		dl = miner2.ConstructDeadline(emptyArray)
+	case 3:
+		dl, err = miner3.ConstructDeadline(adt3.WrapStore(ctx, store))
+	case 4:
+		dl, err = miner4.ConstructDeadline(adt4.WrapStore(ctx, store))
+	case 5:
+		dl, err = miner5.ConstructDeadline(adt5.WrapStore(ctx, store))
+	case 6:
+		dl, err = miner6.ConstructDeadline(adt6.WrapStore(ctx, store))
+	case 7:
+		dl, err = miner7.ConstructDeadline(adt7.WrapStore(ctx, store))
+	case 8:
+		dl, err = miner8.ConstructDeadline(adt8.WrapStore(ctx, store))
+	default:
+		return cid.Undef, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+	if err != nil {
+		return cid.Undef, err
+	}
+	return store.Put(ctx, dl)
+}
+
+// MarketDealIDs returns the ids of all deal proposals of the market state at head.
+func MarketDealIDs(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid) ([]uint64, error) {
+	var st market8.State
+	if err := store.Get(ctx, head, &st); err != nil {
+		return nil, err
+	}
+	proposals, err := loadArray(ctx, store, actorsVersion, st.Proposals, market8.ProposalsAmtBitwidth)
+	if err != nil {
+		return nil, err
+	}
+	return arrayIndexes(proposals)
+}
+
+// FilterMarketDeals writes a copy of the market state at head holding only the
+// deal proposals and states keep returns true for and returns its head.  Other
+// deal indexes still reference removed deals.
+func FilterMarketDeals(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid, keep func(id uint64) bool) (cid.Cid, error) {
+	var st market8.State
+	if err := store.Get(ctx, head, &st); err != nil {
+		return cid.Undef, err
+	}
+	var err error
+	if st.Proposals, err = filterArray(ctx, store, actorsVersion, st.Proposals, market8.ProposalsAmtBitwidth, keep); err != nil {
+		return cid.Undef, err
+	}
+	if st.States, err = filterArray(ctx, store, actorsVersion, st.States, market8.StatesAmtBitwidth, keep); err != nil {
+		return cid.Undef, err
+	}
+	return store.Put(ctx, &st)
+}
+
+// ReplaceActorHead writes a copy of the actors tree at root with the head of the
+// actor at addr replaced and returns its root.
+func ReplaceActorHead(ctx context.Context, store cbornode.IpldStore, actorsVersion int, root cid.Cid, addr address.Address, head cid.Cid) (cid.Cid, error) {
+	newRoot, _, err := RewriteActorsTree(ctx, store, actorsVersion, root, func(a address.Address, actor *Actor) bool {
+		if a == addr {
+			actor.Head = head
+		}
+		return true
+	})
+	return newRoot, err
+}
@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"context"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	multisig8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/multisig"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// ReserveActor is the balance and, for multisigs, vesting status of a reserve
+// or foundation actor.
+type ReserveActor struct {
+	Addr address.Address
+	// ID is the ID address of Addr, undefined if it has no actor
+	ID      address.Address
+	Code    string
+	Balance abi.TokenAmount
+	// Vesting is set for multisigs with a vesting schedule
+	Vesting *MultisigVesting
+}
+
+// MultisigVesting is the vesting status of a multisig at an epoch.
+type MultisigVesting struct {
+	InitialBalance abi.TokenAmount
+	StartEpoch     abi.ChainEpoch
+	UnlockDuration abi.ChainEpoch
+	// Locked is the part of InitialBalance still locked, Vested the rest
+	Locked abi.TokenAmount
+	Vested abi.TokenAmount
+}
+
+// LoadReserveActors returns the reserve actors at addrs in the state at root, and
+// every other multisig with a vesting schedule if allVesting is set, with vesting
+// status at height.
+func LoadReserveActors(ctx context.Context, store cbornode.IpldStore, root cid.Cid, height abi.ChainEpoch, addrs []address.Address, allVesting bool) ([]*ReserveActor, error) {
+	info, err := InspectRoot(ctx, store, root)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := LoadActorsTree(ctx, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return nil, err
+	}
+	name, err := ActorCodeNamer(ctx, store, info)
+	if err != nil {
+		return nil, err
+	}
+	resolver, err := NewAddressResolver(ctx, store, root)
+	if err != nil {
+		return nil, err
+	}
+
+	load := func(r *ReserveActor, a *Actor) error {
+		r.Code, r.Balance = name(a.Code), a.Balance
+		if r.Code != "multisig" {
+			return nil
+		}
+		// Multisig state layout is the same in all actors versions
+		var st multisig8.State
+		if err := store.Get(ctx, a.Head, &st); err != nil {
+			return xerrors.Errorf("failed to load multisig %s state: %w", r.Addr, err)
+		}
+		if st.UnlockDuration == 0 {
+			return nil
+		}
+		locked := st.AmountLocked(height - st.StartEpoch)
+		r.Vesting = &MultisigVesting{
+			InitialBalance: st.InitialBalance,
+			StartEpoch:     st.StartEpoch,
+			UnlockDuration: st.UnlockDuration,
+			Locked:         locked,
+			Vested:         big.Sub(st.InitialBalance, locked),
+		}
+		return nil
+	}
+
+	var reserves []*ReserveActor
+	listed := make(map[address.Address]struct{})
+	for _, addr := range addrs {
+		r := &ReserveActor{Addr: addr, Balance: big.Zero()}
+		reserves = append(reserves, r)
+		id, found, err := resolver.Resolve(addr)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to resolve %s: %w", addr, err)
+		}
+		if !found {
+			continue
+		}
+		a, found, err := tree.GetActor(id)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		r.ID = id
+		listed[id] = struct{}{}
+		if err := load(r, a); err != nil {
+			return nil, err
+		}
+	}
+	if !allVesting {
+		return reserves, nil
+	}
+	err = tree.ForEach(func(addr address.Address, a *Actor) error {
+		if _, ok := listed[addr]; ok || name(a.Code) != "multisig" {
+			return nil
+		}
+		r := &ReserveActor{Addr: addr, ID: addr}
+		if err := load(r, a); err != nil {
+			return err
+		}
+		if r.Vesting != nil {
+			reserves = append(reserves, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reserves, nil
+}
@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"context"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	builtin8 "github.com/filecoin-project/specs-actors/v8/actors/builtin"
+	init8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/init"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// AddressResolver resolves robust addresses to ID addresses with the init actor
+// address map of a state.
+type AddressResolver struct {
+	addrs hamtMap
+}
+
+// NewAddressResolver loads the init actor address map of the state at root.
+func NewAddressResolver(ctx context.Context, store cbornode.IpldStore, root cid.Cid) (*AddressResolver, error) {
+	a, info, err := LoadStateActor(ctx, store, root, builtin0.InitActorAddr)
+	if err != nil {
+		return nil, err
+	}
+	// Init state layout is the same in all actors versions
+	var st init8.State
+	if err := store.Get(ctx, a.Head, &st); err != nil {
+		return nil, xerrors.Errorf("failed to load init state: %w", err)
+	}
+	addrs, err := loadMap(ctx, store, info.ActorsVersion, st.AddressMap, builtin8.DefaultHamtBitwidth)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load init address map: %w", err)
+	}
+	return &AddressResolver{addrs: addrs}, nil
+}
+
+// Resolve returns the ID address of addr, which is returned as is if it is an ID
+// address already.  It returns false if addr has no actor.
+func (r *AddressResolver) Resolve(addr address.Address) (address.Address, bool, error) {
+	if addr.Protocol() == address.ID {
+		return addr, true, nil
+	}
+	var id cbg.CborInt
+	found, err := r.addrs.Get(abi.AddrKey(addr), &id)
+	if err != nil || !found {
+		return address.Undef, false, err
+	}
+	idAddr, err := address.NewIDAddress(uint64(id))
+	return idAddr, err == nil, err
+}
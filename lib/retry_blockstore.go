@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"golang.org/x/xerrors"
+)
+
+// RetryConfig controls retrying failed reads of the lotus chain store, or of each
+// configured store tier.
+type RetryConfig struct {
+	// Attempts is the total number of attempts per read, 1 disables retries
+	Attempts int
+	// Backoff is the delay before the first retry, doubling for each further retry
+	Backoff time.Duration
+	// Context stops retries, including backoff waits, when it is cancelled, nil
+	// for never
+	Context context.Context
+}
+
+// ReadRetry is the retry configuration for reads of the lotus chain store and of
+// each store tier, local or lotus API.  Only errors other than not found are
+// retried.
+var ReadRetry = RetryConfig{
+	Attempts: 1,
+	Backoff:  100 * time.Millisecond,
+}
+
+// RetryStats summarizes retried reads over the life of the process.
+type RetryStats struct {
+	// Retried counts reads which failed at least once
+	Retried uint64
+	// Recovered counts retried reads which eventually succeeded
+	Recovered uint64
+	// Failed counts reads which failed on every attempt
+	Failed uint64
+}
+
+var readRetryStats RetryStats
+
+// ReadRetryStats returns the retry counts of all retrying blockstores.
+func ReadRetryStats() RetryStats {
+	return RetryStats{
+		Retried:   atomic.LoadUint64(&readRetryStats.Retried),
+		Recovered: atomic.LoadUint64(&readRetryStats.Recovered),
+		Failed:    atomic.LoadUint64(&readRetryStats.Failed),
+	}
+}
+
+// RetryBlockstore retries reads of an underlying blockstore which fail with
+// transient errors, backing off exponentially between attempts.
+type RetryBlockstore struct {
+	blockstore.Blockstore
+	cfg RetryConfig
+}
+
+func NewRetryBlockstore(bs blockstore.Blockstore, cfg RetryConfig) *RetryBlockstore {
+	return &RetryBlockstore{
+		Blockstore: bs,
+		cfg:        cfg,
+	}
+}
+
+func (rb *RetryBlockstore) retry(op func() error) error {
+	err := op()
+	if err == nil || err == blockstore.ErrNotFound || rb.cfg.Attempts <= 1 {
+		return err
+	}
+	atomic.AddUint64(&readRetryStats.Retried, 1)
+	backoff := rb.cfg.Backoff
+	var done <-chan struct{}
+	if rb.cfg.Context != nil {
+		done = rb.cfg.Context.Done()
+	}
+	for attempt := 1; attempt < rb.cfg.Attempts; attempt++ {
+		select {
+		case <-time.After(backoff):
+		case <-done:
+			atomic.AddUint64(&readRetryStats.Failed, 1)
+			return xerrors.Errorf("read retries stopped: %w", rb.cfg.Context.Err())
+		}
+		backoff *= 2
+		if err = op(); err == nil || err == blockstore.ErrNotFound {
+			atomic.AddUint64(&readRetryStats.Recovered, 1)
+			return err
+		}
+	}
+	atomic.AddUint64(&readRetryStats.Failed, 1)
+	return err
+}
+
+func (rb *RetryBlockstore) Has(c cid.Cid) (bool, error) {
+	var has bool
+	err := rb.retry(func() error {
+		var err error
+		has, err = rb.Blockstore.Has(c)
+		return err
+	})
+	return has, err
+}
+
+func (rb *RetryBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	var b blocks.Block
+	err := rb.retry(func() error {
+		var err error
+		b, err = rb.Blockstore.Get(c)
+		return err
+	})
+	return b, err
+}
+
+func (rb *RetryBlockstore) GetSize(c cid.Cid) (int, error) {
+	var size int
+	err := rb.retry(func() error {
+		var err error
+		size, err = rb.Blockstore.GetSize(c)
+		return err
+	})
+	return size, err
+}
+
+func (rb *RetryBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	return rb.Blockstore.AllKeysChan(ctx)
+}
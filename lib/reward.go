@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-state-types/big"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	reward0 "github.com/filecoin-project/specs-actors/actors/builtin/reward"
+	reward8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/reward"
+	smoothing8 "github.com/filecoin-project/specs-actors/v8/actors/util/smoothing"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+)
+
+// LoadRewardState loads the reward actor state of the state tree at root.  The
+// state layout is unchanged from actors v2 through v8 so it is returned as v8
+// state.  Actors v0 state is converted: TotalMined becomes TotalStoragePowerReward
+// and SimpleTotal and BaselineTotal, which v0 lacks, are zero.
+func LoadRewardState(ctx context.Context, store cbornode.IpldStore, root cid.Cid) (*reward8.State, *RootInfo, error) {
+	a, info, err := LoadStateActor(ctx, store, root, builtin0.RewardActorAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	st, err := loadRewardState(ctx, store, info.ActorsVersion, a.Head)
+	if err != nil {
+		return nil, nil, err
+	}
+	return st, info, nil
+}
+
+// loadRewardState loads the reward actor state at head as v8 state.
+func loadRewardState(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid) (*reward8.State, error) {
+	if actorsVersion >= 2 {
+		var st reward8.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return nil, err
+		}
+		return &st, nil
+	}
+	var st0 reward0.State
+	if err := store.Get(ctx, head, &st0); err != nil {
+		return nil, err
+	}
+	st := reward8.State{
+		CumsumBaseline:          st0.CumsumBaseline,
+		CumsumRealized:          st0.CumsumRealized,
+		EffectiveNetworkTime:    st0.EffectiveNetworkTime,
+		EffectiveBaselinePower:  st0.EffectiveBaselinePower,
+		ThisEpochReward:         st0.ThisEpochReward,
+		ThisEpochBaselinePower:  st0.ThisEpochBaselinePower,
+		Epoch:                   st0.Epoch,
+		TotalStoragePowerReward: st0.TotalMined,
+		SimpleTotal:             big.Zero(),
+		BaselineTotal:           big.Zero(),
+	}
+	if st0.ThisEpochRewardSmoothed != nil {
+		st.ThisEpochRewardSmoothed = smoothing8.FilterEstimate{
+			PositionEstimate: st0.ThisEpochRewardSmoothed.PositionEstimate,
+			VelocityEstimate: st0.ThisEpochRewardSmoothed.VelocityEstimate,
+		}
+	}
+	return &st, nil
+}
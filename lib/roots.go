@@ -0,0 +1,242 @@
+package lib
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	address "github.com/filecoin-project/go-address"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	mh "github.com/multiformats/go-multihash"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// RootInfo describes what a CID handed to ent as a state root points at.
+type RootInfo struct {
+	// Wrapped is true if the CID is a StateRoot wrapper rather than a bare actors HAMT
+	Wrapped bool
+	// Version is the StateRoot version field, only meaningful for wrapped roots
+	Version StateTreeVersion
+	// Actors is the actors HAMT root
+	Actors cid.Cid
+	// ActorsVersion is the actors version of the system actor code in the tree
+	ActorsVersion int
+}
+
+// UnwrapStateRoot returns the actors tree root of c.  If c is a StateRoot wrapper
+// it is unwrapped and the wrapper is returned too.  If c is already a bare actors
+// HAMT it is returned unchanged with a nil wrapper, so callers never double unwrap.
+func UnwrapStateRoot(ctx context.Context, store cbornode.IpldStore, c cid.Cid) (cid.Cid, *StateRoot, error) {
+	var root StateRoot
+	err := store.Get(ctx, c, &root)
+	if err == nil {
+		return root.Actors, &root, nil
+	}
+	// A HAMT node is a two element array, a StateRoot a three element array
+	var raw cbg.Deferred
+	if rawErr := store.Get(ctx, c, &raw); rawErr != nil {
+		return cid.Undef, nil, err
+	}
+	if len(raw.Raw) == 0 || raw.Raw[0] != 0x82 {
+		return cid.Undef, nil, xerrors.Errorf("%s is neither a state root nor an actors tree: %w", c, err)
+	}
+	return c, nil, nil
+}
+
+// WrapStateRoot writes a StateRoot wrapper, as lotus expects it, around the actors
+// tree at actorsRoot holding actors of the given version.  Trees of actors v0/v1
+// predate wrappers and are returned unchanged.
+func WrapStateRoot(ctx context.Context, store cbornode.IpldStore, actorsVersion int, actorsRoot cid.Cid) (cid.Cid, error) {
+	version := ExpectedStateTreeVersion(actorsVersion)
+	if version == StateTreeVersion0 {
+		return actorsRoot, nil
+	}
+	info, err := store.Put(ctx, new(StateInfo0))
+	if err != nil {
+		return cid.Undef, err
+	}
+	return store.Put(ctx, &StateRoot{
+		Version: version,
+		Actors:  actorsRoot,
+		Info:    info,
+	})
+}
+
+// treeLayouts are actors versions with distinct actors HAMT encodings, newest
+// first.  Loading with each in turn finds the layout of an unknown tree.
+var treeLayouts = []int{8, 2, 0}
+
+// InspectRoot determines whether c is a wrapped state root or a bare actors HAMT
+// and which actors version the tree holds.
+func InspectRoot(ctx context.Context, store cbornode.IpldStore, c cid.Cid) (*RootInfo, error) {
+	actors, root, err := UnwrapStateRoot(ctx, store, c)
+	if err != nil {
+		return nil, err
+	}
+	info := RootInfo{Actors: actors}
+	if root != nil {
+		info.Wrapped = true
+		info.Version = root.Version
+	}
+
+	var lastErr error
+	for _, layout := range treeLayouts {
+		tree, err := LoadActorsTree(ctx, store, layout, info.Actors)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		system, found, err := tree.GetActor(builtin0.SystemActorAddr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !found {
+			return nil, xerrors.Errorf("actors tree %s has no system actor", info.Actors)
+		}
+		info.ActorsVersion, err = actorsVersionOfSystem(ctx, store, system)
+		if err != nil {
+			return nil, err
+		}
+		return &info, nil
+	}
+	return nil, xerrors.Errorf("%s is neither a state root nor an actors tree: %w", c, lastErr)
+}
+
+// LoadStateActor looks up the actor at addr in the state tree at root, which may be
+// a wrapped state root or a bare actors tree of any actors version.
+func LoadStateActor(ctx context.Context, store cbornode.IpldStore, root cid.Cid, addr address.Address) (*Actor, *RootInfo, error) {
+	info, err := InspectRoot(ctx, store, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := LoadActorsTree(ctx, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, found, err := tree.GetActor(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, xerrors.Errorf("actor %s not found in state %s", addr, root)
+	}
+	return a, info, nil
+}
+
+// ActorsVersionOfCode returns the actors version of a builtin actor code CID from
+// before actor bundles.  Those CIDs inline names like "fil/3/storageminer".
+func ActorsVersionOfCode(code cid.Cid) (int, bool) {
+	parts, ok := builtinCodeParts(code)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// ActorNameOfCode returns the builtin actor name, like "storageminer", of a code
+// CID from before actor bundles.
+func ActorNameOfCode(code cid.Cid) (string, bool) {
+	parts, ok := builtinCodeParts(code)
+	if !ok {
+		return "", false
+	}
+	return parts[2], true
+}
+
+func builtinCodeParts(code cid.Cid) ([]string, bool) {
+	if code.Prefix().MhType != mh.IDENTITY {
+		return nil, false
+	}
+	dmh, err := mh.Decode(code.Hash())
+	if err != nil {
+		return nil, false
+	}
+	parts := strings.Split(string(dmh.Digest), "/")
+	if len(parts) != 3 || parts[0] != "fil" {
+		return nil, false
+	}
+	return parts, true
+}
+
+// ActorCodeNamer returns a function naming the builtin actor code CIDs of the tree
+// described by info.  Bundle code CIDs are named from the manifest of the state.
+// Unknown codes are named "".
+func ActorCodeNamer(ctx context.Context, store cbornode.IpldStore, info *RootInfo) (func(cid.Cid) string, error) {
+	m, err := ManifestFromState(ctx, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[cid.Cid]string)
+	if m != nil {
+		for _, e := range m.Entries {
+			names[e.Code] = e.Name
+		}
+	}
+	return func(code cid.Cid) string {
+		if name, ok := names[code]; ok {
+			return name
+		}
+		name, _ := ActorNameOfCode(code)
+		return name
+	}, nil
+}
+
+// ActorCodeVersioner returns a function giving the actors version of the code CIDs
+// of the tree described by info.  Inline code CIDs name their version, and the
+// bundle code CIDs of the manifest of the state are of its actors version.  Other
+// codes are unknown and reported as not ok.
+func ActorCodeVersioner(ctx context.Context, store cbornode.IpldStore, info *RootInfo) (func(cid.Cid) (int, bool), error) {
+	m, err := ManifestFromState(ctx, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return nil, err
+	}
+	bundled := make(map[cid.Cid]bool)
+	if m != nil {
+		for _, e := range m.Entries {
+			bundled[e.Code] = true
+		}
+	}
+	return func(code cid.Cid) (int, bool) {
+		if bundled[code] {
+			return info.ActorsVersion, true
+		}
+		return ActorsVersionOfCode(code)
+	}, nil
+}
+
+func actorsVersionOfSystem(ctx context.Context, store cbornode.IpldStore, system *Actor) (int, error) {
+	if v, ok := ActorsVersionOfCode(system.Code); ok {
+		return v, nil
+	}
+	// Bundle code CIDs are content hashes, the system actor state holds the manifest
+	if _, err := ManifestFromSystemActor(ctx, store, system); err != nil {
+		return 0, xerrors.Errorf("unrecognized system actor code %s: %w", system.Code, err)
+	}
+	return 8, nil
+}
+
+// ExpectedStateTreeVersion returns the StateRoot version used with an actors version.
+func ExpectedStateTreeVersion(actorsVersion int) StateTreeVersion {
+	switch {
+	case actorsVersion <= 1:
+		return StateTreeVersion0
+	case actorsVersion == 2:
+		return StateTreeVersion1
+	case actorsVersion == 3:
+		return StateTreeVersion2
+	case actorsVersion == 4:
+		return StateTreeVersion3
+	case actorsVersion <= 9:
+		return StateTreeVersion4
+	default:
+		return StateTreeVersion5
+	}
+}
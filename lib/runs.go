@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	init0 "github.com/filecoin-project/specs-actors/actors/builtin/init"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+// EntRunsPath is the json lines log of completed runs of large operations, which
+// estimates of later runs scale from.
+var EntRunsPath = "~/.ent/runs.jsonl"
+
+// RunRecord records a completed migration or export.
+type RunRecord struct {
+	// Command names the operation, like "migrate v8" or "export sector-deals"
+	Command   string    `json:"command"`
+	StateRoot cid.Cid   `json:"stateRoot"`
+	Time      time.Time `json:"time"`
+	// Actors is the EstimateActors estimate of the state
+	Actors  uint64  `json:"actors"`
+	Seconds float64 `json:"seconds"`
+	// Blocks written by a migration, Bytes written by an export
+	Blocks uint64 `json:"blocks,omitempty"`
+	Bytes  uint64 `json:"bytes,omitempty"`
+}
+
+// EstimateActors estimates the number of actors of the state at root without
+// walking its actors tree, by the next actor ID of the init actor.  Deleted actors
+// are counted too.  The init actor state layout is the same in every actors
+// version.
+func EstimateActors(ctx context.Context, store cbornode.IpldStore, root cid.Cid) (uint64, error) {
+	a, _, err := LoadStateActor(ctx, store, root, builtin0.InitActorAddr)
+	if err != nil {
+		return 0, err
+	}
+	var st init0.State
+	if err := store.Get(ctx, a.Head, &st); err != nil {
+		return 0, xerrors.Errorf("failed to load init actor state: %w", err)
+	}
+	return uint64(st.NextID), nil
+}
+
+// RecordRun appends r to the runs log at EntRunsPath.
+func RecordRun(r RunRecord) error {
+	path, err := homedir.Expand(EntRunsPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(&r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LastRun returns the latest record of command in the runs log, if any.
+func LastRun(command string) (*RunRecord, bool, error) {
+	path, err := homedir.Expand(EntRunsPath)
+	if err != nil {
+		return nil, false, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close() // nolint:errcheck
+	var last *RunRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r RunRecord
+		// Skip lines torn by a crash mid write
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil || r.Command != command {
+			continue
+		}
+		last = &r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, err
+	}
+	return last, last != nil, nil
+}
+
+// RunEstimate estimates the cost of running a command over a state.
+type RunEstimate struct {
+	Actors uint64
+	// Previous is the run the duration and size are scaled from, nil if the
+	// command never completed before
+	Previous *RunRecord
+	Duration time.Duration
+	Blocks   uint64
+	Bytes    uint64
+}
+
+// EstimateRun estimates running command over the state at root from the actors
+// of the state, scaling the last recorded run of command by the ratio of actors.
+func EstimateRun(ctx context.Context, store cbornode.IpldStore, command string, root cid.Cid) (*RunEstimate, error) {
+	actors, err := EstimateActors(ctx, store, root)
+	if err != nil {
+		return nil, err
+	}
+	est := &RunEstimate{Actors: actors}
+	prev, found, err := LastRun(command)
+	if err != nil || !found || prev.Actors == 0 {
+		return est, err
+	}
+	scale := float64(actors) / float64(prev.Actors)
+	est.Previous = prev
+	est.Duration = time.Duration(prev.Seconds * scale * float64(time.Second))
+	est.Blocks = uint64(float64(prev.Blocks) * scale)
+	est.Bytes = uint64(float64(prev.Bytes) * scale)
+	return est, nil
+}
@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// SampleRow is a row of a sample export: the shape of an actor and its state,
+// with its address optionally redacted.
+type SampleRow struct {
+	// Actor is the actor's ID address, or its redacted form
+	Actor   string          `json:"actor"`
+	Code    string          `json:"code"`
+	Nonce   uint64          `json:"nonce"`
+	Balance abi.TokenAmount `json:"balance"`
+	// StateBlocks and StateBytes count the distinct blocks of the actor's state
+	StateBlocks int `json:"stateBlocks"`
+	StateBytes  int `json:"stateBytes"`
+}
+
+// SampleHeader is the csv header of SampleRow records.
+var SampleHeader = []string{"actor", "code", "nonce", "balance", "state_blocks", "state_bytes"}
+
+// CSVRecord returns the csv record of the row.
+func (s *SampleRow) CSVRecord() []string {
+	return []string{
+		s.Actor,
+		s.Code,
+		strconv.FormatUint(s.Nonce, 10),
+		s.Balance.String(),
+		strconv.Itoa(s.StateBlocks),
+		strconv.Itoa(s.StateBytes),
+	}
+}
+
+// Coarsen rounds the nonce and balance of the row down to a power of ten, for
+// rows with redacted addresses.  Exact values are distinctive enough to find the
+// actor by in public chain state, undoing the redaction of its address.
+func (s *SampleRow) Coarsen() {
+	s.Nonce = floorPow10(s.Nonce)
+	if s.Balance.Sign() > 0 {
+		digits := len(s.Balance.String())
+		s.Balance = big.Exp(big.NewInt(10), big.NewInt(int64(digits-1)))
+	}
+}
+
+// floorPow10 returns the largest power of ten not above n, or 0 for 0.
+func floorPow10(n uint64) uint64 {
+	if n == 0 {
+		return 0
+	}
+	p := uint64(1)
+	for n/p >= 10 {
+		p *= 10
+	}
+	return p
+}
+
+// AddressRedactor replaces addresses by a keyed hash, so rows of the same actor
+// can be joined without revealing it.  Actor IDs are few enough to enumerate, so
+// the key must stay secret for the hash to hide them.
+type AddressRedactor struct {
+	key []byte
+}
+
+// NewAddressRedactor returns a redactor hashing with key, or with a random key if
+// key is empty.
+func NewAddressRedactor(key string) (*AddressRedactor, error) {
+	if key != "" {
+		return &AddressRedactor{key: []byte(key)}, nil
+	}
+	r := &AddressRedactor{key: make([]byte, 32)}
+	if _, err := rand.Read(r.key); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Redact returns the redacted form of addr, "x" followed by 20 hex digits.
+func (r *AddressRedactor) Redact(addr address.Address) string {
+	mac := hmac.New(sha256.New, r.key)
+	_, _ = mac.Write(addr.Bytes())
+	return "x" + hex.EncodeToString(mac.Sum(nil)[:10])
+}
+
+// CountStateBlocks returns the number and total size of the distinct blocks
+// reachable from root.  Links to anything but dag-cbor blocks, such as sector
+// commitments, are not followed.
+func CountStateBlocks(ctx context.Context, store cbornode.IpldStore, root cid.Cid) (blocks, size int, err error) {
+	seen := cid.NewSet()
+	stack := []cid.Cid{root}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if c.Prefix().Codec != cid.DagCBOR || c.Prefix().MhType == 0 || !seen.Visit(c) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+		var raw cbg.Deferred
+		if err := store.Get(ctx, c, &raw); err != nil {
+			return 0, 0, xerrors.Errorf("failed to load %s: %w", c, err)
+		}
+		blocks++
+		size += len(raw.Raw)
+		if err := cbg.ScanForLinks(bytes.NewReader(raw.Raw), func(l cid.Cid) {
+			stack = append(stack, l)
+		}); err != nil {
+			return 0, 0, xerrors.Errorf("failed to scan %s for links: %w", c, err)
+		}
+	}
+	return blocks, size, nil
+}
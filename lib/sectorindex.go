@@ -0,0 +1,197 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+// EntSectorIndexPath is the default directory of the sector index built by
+// BuildSectorIndex.
+var EntSectorIndexPath = "~/.ent/datastore/sectors"
+
+// SectorLocation is the sector index record of a sector: where it is in its
+// miner's deadlines and its key fields.
+type SectorLocation struct {
+	Miner        address.Address
+	SectorNumber abi.SectorNumber
+	Deadline     uint64
+	Partition    int64
+	Status       string
+	SealProof    abi.RegisteredSealProof
+	SealedCID    cid.Cid
+	DealIDs      []abi.DealID
+	Activation   abi.ChainEpoch
+	Expiration   abi.ChainEpoch
+}
+
+// SectorIndex maps the (miner, sector number) pairs of a state to the location of
+// the sector, for lookups without walking the miner's state.
+type SectorIndex struct {
+	ds datastore.Batching
+}
+
+var (
+	// /sector/<miner>/<sector> holds the SectorLocation of a sector, the sector
+	// number zero padded to sort in order
+	sectorIndexPrefix = "/sector/"
+	// sectorIndexRootKey holds the state root indexed, set once the build completes
+	sectorIndexRootKey = datastore.NewKey("/meta/root")
+)
+
+func sectorIndexKey(miner address.Address, sector abi.SectorNumber) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("%s%s/%020d", sectorIndexPrefix, miner, sector))
+}
+
+// CreateSectorIndex creates a sector index at the directory path, which must not
+// exist yet.
+func CreateSectorIndex(path string) (*SectorIndex, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, xerrors.Errorf("%s already exists", path)
+	}
+	ds, err := chainBadgerDs(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create sector index: %w", err)
+	}
+	return &SectorIndex{ds: ds}, nil
+}
+
+// OpenSectorIndex opens the sector index at the directory path and returns the
+// state root it indexes.
+func OpenSectorIndex(path string) (*SectorIndex, cid.Cid, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, cid.Undef, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, cid.Undef, err
+	}
+	ds, err := chainBadgerDs(path)
+	if err != nil {
+		return nil, cid.Undef, xerrors.Errorf("failed to open sector index: %w", err)
+	}
+	raw, err := ds.Get(sectorIndexRootKey)
+	if err == datastore.ErrNotFound {
+		_ = ds.Close()
+		return nil, cid.Undef, xerrors.Errorf("sector index %s is incomplete, its build was interrupted", path)
+	}
+	if err != nil {
+		_ = ds.Close()
+		return nil, cid.Undef, err
+	}
+	root, err := cid.Cast(raw)
+	if err != nil {
+		_ = ds.Close()
+		return nil, cid.Undef, err
+	}
+	return &SectorIndex{ds: ds}, root, nil
+}
+
+func (si *SectorIndex) Close() error {
+	return si.ds.Close()
+}
+
+// Sector returns the location of sector of miner, an ID address.
+func (si *SectorIndex) Sector(miner address.Address, sector abi.SectorNumber) (*SectorLocation, bool, error) {
+	raw, err := si.ds.Get(sectorIndexKey(miner, sector))
+	if err == datastore.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var loc SectorLocation
+	if err := json.Unmarshal(raw, &loc); err != nil {
+		return nil, false, xerrors.Errorf("corrupt sector index entry for %s sector %d: %w", miner, sector, err)
+	}
+	return &loc, true, nil
+}
+
+// sectorIndexBatchSize is the number of sectors written per index batch
+const sectorIndexBatchSize = 10000
+
+// BuildSectorIndex indexes every sector assigned to a partition of every miner of
+// the state at root and returns the number of miners and sectors indexed.
+// progress, if not nil, is called after each miner is indexed.
+func BuildSectorIndex(ctx context.Context, store cbornode.IpldStore, si *SectorIndex, root cid.Cid, progress func(miners, sectors int)) (int, int, error) {
+	r, err := NewStateReader(ctx, store, root)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := si.ds.Batch()
+	if err != nil {
+		return 0, 0, err
+	}
+	miners, sectors, batched := 0, 0, 0
+	err = r.ForEachMiner(func(addr address.Address, a *Actor) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		placements, err := r.MinerSectorPlacements(a)
+		if err != nil {
+			return xerrors.Errorf("failed to load partitions of %s: %w", addr, err)
+		}
+		err = r.ForEachMinerSector(a, func(s *MinerSector) error {
+			placement, ok := placements[uint64(s.SectorNumber)]
+			if !ok {
+				return nil
+			}
+			raw, err := json.Marshal(&SectorLocation{
+				Miner:        addr,
+				SectorNumber: s.SectorNumber,
+				Deadline:     placement.Deadline,
+				Partition:    placement.Partition,
+				Status:       placement.Status,
+				SealProof:    s.SealProof,
+				SealedCID:    s.SealedCID,
+				DealIDs:      s.DealIDs,
+				Activation:   s.Activation,
+				Expiration:   s.Expiration,
+			})
+			if err != nil {
+				return err
+			}
+			if err := b.Put(sectorIndexKey(addr, s.SectorNumber), raw); err != nil {
+				return err
+			}
+			sectors++
+			if batched++; batched >= sectorIndexBatchSize {
+				if err := b.Commit(); err != nil {
+					return err
+				}
+				batched = 0
+				b, err = si.ds.Batch()
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return xerrors.Errorf("failed to index sectors of %s: %w", addr, err)
+		}
+		miners++
+		if progress != nil {
+			progress(miners, sectors)
+		}
+		return nil
+	})
+	if err != nil {
+		return miners, sectors, err
+	}
+	if err := b.Put(sectorIndexRootKey, root.Bytes()); err != nil {
+		return miners, sectors, err
+	}
+	return miners, sectors, b.Commit()
+}
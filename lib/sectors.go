@@ -0,0 +1,370 @@
+package lib
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/cbor"
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	adt0 "github.com/filecoin-project/specs-actors/actors/util/adt"
+	miner2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/miner"
+	adt2 "github.com/filecoin-project/specs-actors/v2/actors/util/adt"
+	miner3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/miner"
+	adt3 "github.com/filecoin-project/specs-actors/v3/actors/util/adt"
+	miner4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/miner"
+	adt4 "github.com/filecoin-project/specs-actors/v4/actors/util/adt"
+	miner5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/miner"
+	adt5 "github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	miner6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/miner"
+	adt6 "github.com/filecoin-project/specs-actors/v6/actors/util/adt"
+	miner7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/miner"
+	adt7 "github.com/filecoin-project/specs-actors/v7/actors/util/adt"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	adt8 "github.com/filecoin-project/specs-actors/v8/actors/util/adt"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// MinerSector is the sector on chain info fields shared by all actors versions.
+type MinerSector struct {
+	SectorNumber          abi.SectorNumber
+	SealProof             abi.RegisteredSealProof
+	SealedCID             cid.Cid
+	DealIDs               []abi.DealID
+	Activation            abi.ChainEpoch
+	Expiration            abi.ChainEpoch
+	DealWeight            abi.DealWeight
+	VerifiedDealWeight    abi.DealWeight
+	InitialPledge         abi.TokenAmount
+	ExpectedDayReward     abi.TokenAmount
+	ExpectedStoragePledge abi.TokenAmount
+}
+
+// LoadMinerState decodes the miner actor state at head into the state type of the
+// given actors version, for display.
+func LoadMinerState(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid) (interface{}, error) {
+	var st interface{}
+	switch actorsVersion {
+	case 0, 1:
+		st = new(miner0.State)
+	case 2:
+		st = new(miner2.State)
+	case 3:
+		st = new(miner3.State)
+	case 4:
+		st = new(miner4.State)
+	case 5:
+		st = new(miner5.State)
+	case 6:
+		st = new(miner6.State)
+	case 7:
+		st = new(miner7.State)
+	case 8:
+		st = new(miner8.State)
+	default:
+		return nil, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+	if err := store.Get(ctx, head, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// cborArray is the AMT wrapper method set shared by the adt packages of every
+// actors version.
+type cborArray interface {
+	ForEach(out cbor.Unmarshaler, fn func(i int64) error) error
+}
+
+// loadMinerSectors loads the sectors AMT of the miner actor state at head.
+func loadMinerSectors(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid) (cborArray, error) {
+	switch actorsVersion {
+	case 0, 1:
+		var st miner0.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return nil, err
+		}
+		return miner0.LoadSectors(adt0.WrapStore(ctx, store), st.Sectors)
+	case 2:
+		var st miner2.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return nil, err
+		}
+		return miner2.LoadSectors(adt2.WrapStore(ctx, store), st.Sectors)
+	case 3:
+		var st miner3.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return nil, err
+		}
+		return miner3.LoadSectors(adt3.WrapStore(ctx, store), st.Sectors)
+	case 4:
+		var st miner4.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return nil, err
+		}
+		return miner4.LoadSectors(adt4.WrapStore(ctx, store), st.Sectors)
+	case 5:
+		var st miner5.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return nil, err
+		}
+		return miner5.LoadSectors(adt5.WrapStore(ctx, store), st.Sectors)
+	case 6:
+		var st miner6.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return nil, err
+		}
+		return miner6.LoadSectors(adt6.WrapStore(ctx, store), st.Sectors)
+	case 7:
+		var st miner7.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return nil, err
+		}
+		return miner7.LoadSectors(adt7.WrapStore(ctx, store), st.Sectors)
+	case 8:
+		var st miner8.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return nil, err
+		}
+		return miner8.LoadSectors(adt8.WrapStore(ctx, store), st.Sectors)
+	default:
+		return nil, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+}
+
+// ForEachMinerSector calls fn with every sector in the state of the miner actor
+// with head head.  Sector infos are encoded the same way in actors v2 through v6
+// and again in v7 and v8 so only three decodings are needed.
+func ForEachMinerSector(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid, fn func(*MinerSector) error) error {
+	sectors, err := loadMinerSectors(ctx, store, actorsVersion, head)
+	if err != nil {
+		return err
+	}
+	switch {
+	case actorsVersion <= 1:
+		var info miner0.SectorOnChainInfo
+		return sectors.ForEach(&info, func(int64) error {
+			return fn(&MinerSector{
+				SectorNumber:          info.SectorNumber,
+				SealProof:             info.SealProof,
+				SealedCID:             info.SealedCID,
+				DealIDs:               info.DealIDs,
+				Activation:            info.Activation,
+				Expiration:            info.Expiration,
+				DealWeight:            info.DealWeight,
+				VerifiedDealWeight:    info.VerifiedDealWeight,
+				InitialPledge:         info.InitialPledge,
+				ExpectedDayReward:     info.ExpectedDayReward,
+				ExpectedStoragePledge: info.ExpectedStoragePledge,
+			})
+		})
+	case actorsVersion <= 6:
+		var info miner2.SectorOnChainInfo
+		return sectors.ForEach(&info, func(int64) error {
+			return fn(&MinerSector{
+				SectorNumber:          info.SectorNumber,
+				SealProof:             info.SealProof,
+				SealedCID:             info.SealedCID,
+				DealIDs:               info.DealIDs,
+				Activation:            info.Activation,
+				Expiration:            info.Expiration,
+				DealWeight:            info.DealWeight,
+				VerifiedDealWeight:    info.VerifiedDealWeight,
+				InitialPledge:         info.InitialPledge,
+				ExpectedDayReward:     info.ExpectedDayReward,
+				ExpectedStoragePledge: info.ExpectedStoragePledge,
+			})
+		})
+	default:
+		var info miner8.SectorOnChainInfo
+		return sectors.ForEach(&info, func(int64) error {
+			return fn(&MinerSector{
+				SectorNumber:          info.SectorNumber,
+				SealProof:             info.SealProof,
+				SealedCID:             info.SealedCID,
+				DealIDs:               info.DealIDs,
+				Activation:            info.Activation,
+				Expiration:            info.Expiration,
+				DealWeight:            info.DealWeight,
+				VerifiedDealWeight:    info.VerifiedDealWeight,
+				InitialPledge:         info.InitialPledge,
+				ExpectedDayReward:     info.ExpectedDayReward,
+				ExpectedStoragePledge: info.ExpectedStoragePledge,
+			})
+		})
+	}
+}
+
+// ForEachMinerPartition calls fn with every partition of every deadline in the
+// state of the miner actor with head head.  Partitions are encoded the same way
+// from actors v2 on so they are returned as v8 partitions.  Actors v0 partitions
+// are converted with empty Unproven sectors and power.
+func ForEachMinerPartition(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid, fn func(dlIdx uint64, partIdx int64, p *miner8.Partition) error) error {
+	each := func(dlIdx uint64, partitions cborArray) error {
+		if actorsVersion <= 1 {
+			var p0 miner0.Partition
+			return partitions.ForEach(&p0, func(partIdx int64) error {
+				return fn(dlIdx, partIdx, &miner8.Partition{
+					Sectors:           p0.Sectors,
+					Unproven:          bitfield.New(),
+					Faults:            p0.Faults,
+					Recoveries:        p0.Recoveries,
+					Terminated:        p0.Terminated,
+					ExpirationsEpochs: p0.ExpirationsEpochs,
+					EarlyTerminated:   p0.EarlyTerminated,
+					LivePower:         miner8.PowerPair(p0.LivePower),
+					UnprovenPower:     miner8.NewPowerPairZero(),
+					FaultyPower:       miner8.PowerPair(p0.FaultyPower),
+					RecoveringPower:   miner8.PowerPair(p0.RecoveringPower),
+				})
+			})
+		}
+		var p miner8.Partition
+		return partitions.ForEach(&p, func(partIdx int64) error {
+			return fn(dlIdx, partIdx, &p)
+		})
+	}
+
+	switch actorsVersion {
+	case 0, 1:
+		var st miner0.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return err
+		}
+		adtStore := adt0.WrapStore(ctx, store)
+		deadlines, err := st.LoadDeadlines(adtStore)
+		if err != nil {
+			return err
+		}
+		return deadlines.ForEach(adtStore, func(dlIdx uint64, dl *miner0.Deadline) error {
+			partitions, err := dl.PartitionsArray(adtStore)
+			if err != nil {
+				return err
+			}
+			return each(dlIdx, partitions)
+		})
+	case 2:
+		var st miner2.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return err
+		}
+		adtStore := adt2.WrapStore(ctx, store)
+		deadlines, err := st.LoadDeadlines(adtStore)
+		if err != nil {
+			return err
+		}
+		return deadlines.ForEach(adtStore, func(dlIdx uint64, dl *miner2.Deadline) error {
+			partitions, err := dl.PartitionsArray(adtStore)
+			if err != nil {
+				return err
+			}
+			return each(dlIdx, partitions)
+		})
+	case 3:
+		var st miner3.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return err
+		}
+		adtStore := adt3.WrapStore(ctx, store)
+		deadlines, err := st.LoadDeadlines(adtStore)
+		if err != nil {
+			return err
+		}
+		return deadlines.ForEach(adtStore, func(dlIdx uint64, dl *miner3.Deadline) error {
+			partitions, err := dl.PartitionsArray(adtStore)
+			if err != nil {
+				return err
+			}
+			return each(dlIdx, partitions)
+		})
+	case 4:
+		var st miner4.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return err
+		}
+		adtStore := adt4.WrapStore(ctx, store)
+		deadlines, err := st.LoadDeadlines(adtStore)
+		if err != nil {
+			return err
+		}
+		return deadlines.ForEach(adtStore, func(dlIdx uint64, dl *miner4.Deadline) error {
+			partitions, err := dl.PartitionsArray(adtStore)
+			if err != nil {
+				return err
+			}
+			return each(dlIdx, partitions)
+		})
+	case 5:
+		var st miner5.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return err
+		}
+		adtStore := adt5.WrapStore(ctx, store)
+		deadlines, err := st.LoadDeadlines(adtStore)
+		if err != nil {
+			return err
+		}
+		return deadlines.ForEach(adtStore, func(dlIdx uint64, dl *miner5.Deadline) error {
+			partitions, err := dl.PartitionsArray(adtStore)
+			if err != nil {
+				return err
+			}
+			return each(dlIdx, partitions)
+		})
+	case 6:
+		var st miner6.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return err
+		}
+		adtStore := adt6.WrapStore(ctx, store)
+		deadlines, err := st.LoadDeadlines(adtStore)
+		if err != nil {
+			return err
+		}
+		return deadlines.ForEach(adtStore, func(dlIdx uint64, dl *miner6.Deadline) error {
+			partitions, err := dl.PartitionsArray(adtStore)
+			if err != nil {
+				return err
+			}
+			return each(dlIdx, partitions)
+		})
+	case 7:
+		var st miner7.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return err
+		}
+		adtStore := adt7.WrapStore(ctx, store)
+		deadlines, err := st.LoadDeadlines(adtStore)
+		if err != nil {
+			return err
+		}
+		return deadlines.ForEach(adtStore, func(dlIdx uint64, dl *miner7.Deadline) error {
+			partitions, err := dl.PartitionsArray(adtStore)
+			if err != nil {
+				return err
+			}
+			return each(dlIdx, partitions)
+		})
+	case 8:
+		var st miner8.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return err
+		}
+		adtStore := adt8.WrapStore(ctx, store)
+		deadlines, err := st.LoadDeadlines(adtStore)
+		if err != nil {
+			return err
+		}
+		return deadlines.ForEach(adtStore, func(dlIdx uint64, dl *miner8.Deadline) error {
+			partitions, err := dl.PartitionsArray(adtStore)
+			if err != nil {
+				return err
+			}
+			return each(dlIdx, partitions)
+		})
+	default:
+		return xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+}
@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+
+	address "github.com/filecoin-project/go-address"
+	"golang.org/x/xerrors"
+)
+
+// SectorSchemaVersion is the version of the SectorRow schema.  Fields may be added
+// within a version; renaming, retyping or removing a field, or making it nullable,
+// needs a new version.
+const SectorSchemaVersion = 1
+
+// SectorRow is a row of a sector export: a sector assigned to a partition of a
+// miner.  Its json encoding is the export schema, so fields hold plain json types
+// and no field is ever null: token amounts and weights are decimal strings and a
+// sector without deals has an empty dealIds array.
+type SectorRow struct {
+	SchemaVersion         int64    `json:"schemaVersion" doc:"version of this schema"`
+	Miner                 string   `json:"miner" doc:"ID address of the miner, e.g. f01234"`
+	SectorNumber          uint64   `json:"sectorNumber"`
+	Status                string   `json:"status" doc:"status of the sector in its partition" enum:"active,faulty,recovering,terminated,unproven"`
+	SealProof             int64    `json:"sealProof" doc:"registered seal proof type"`
+	SealedCID             string   `json:"sealedCid" doc:"CommR of the sector"`
+	DealIDs               []uint64 `json:"dealIds" doc:"IDs of the deals in the sector, empty if none"`
+	Activation            int64    `json:"activation" doc:"epoch the sector was activated"`
+	Expiration            int64    `json:"expiration" doc:"epoch the sector expires"`
+	DealWeight            string   `json:"dealWeight" doc:"deal space-time in byte-epochs"`
+	VerifiedDealWeight    string   `json:"verifiedDealWeight" doc:"verified deal space-time in byte-epochs"`
+	InitialPledge         string   `json:"initialPledge" doc:"initial pledge in attoFIL"`
+	ExpectedDayReward     string   `json:"expectedDayReward" doc:"expected reward per day at activation in attoFIL"`
+	ExpectedStoragePledge string   `json:"expectedStoragePledge" doc:"expected storage pledge at activation in attoFIL"`
+}
+
+// NewSectorRow returns the export row of sector s of miner with status.
+func NewSectorRow(miner address.Address, s *MinerSector, status string) *SectorRow {
+	dealIDs := make([]uint64, len(s.DealIDs))
+	for i, id := range s.DealIDs {
+		dealIDs[i] = uint64(id)
+	}
+	return &SectorRow{
+		SchemaVersion:         SectorSchemaVersion,
+		Miner:                 miner.String(),
+		SectorNumber:          uint64(s.SectorNumber),
+		Status:                status,
+		SealProof:             int64(s.SealProof),
+		SealedCID:             s.SealedCID.String(),
+		DealIDs:               dealIDs,
+		Activation:            int64(s.Activation),
+		Expiration:            int64(s.Expiration),
+		DealWeight:            s.DealWeight.String(),
+		VerifiedDealWeight:    s.VerifiedDealWeight.String(),
+		InitialPledge:         s.InitialPledge.String(),
+		ExpectedDayReward:     s.ExpectedDayReward.String(),
+		ExpectedStoragePledge: s.ExpectedStoragePledge.String(),
+	}
+}
+
+// SectorSchema returns the JSON Schema of SectorRow.
+func SectorSchema() (map[string]interface{}, error) {
+	schema, err := jsonSchemaOf(reflect.TypeOf(SectorRow{}))
+	if err != nil {
+		return nil, err
+	}
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "ent sector export row"
+	schema["description"] = "A sector assigned to a partition of a miner. No field is null."
+	schema["properties"].(map[string]interface{})["schemaVersion"].(map[string]interface{})["const"] = SectorSchemaVersion
+	return schema, nil
+}
+
+// jsonSchemaOf returns the JSON Schema of values of t, described by doc and enum
+// struct tags.  Struct fields are all required and not nullable; objects may gain
+// fields so others are allowed.
+func jsonSchemaOf(t reflect.Type) (map[string]interface{}, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Slice:
+		items, err := jsonSchemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Struct:
+		props := make(map[string]interface{})
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			prop, err := jsonSchemaOf(f.Type)
+			if err != nil {
+				return nil, xerrors.Errorf("field %s: %w", f.Name, err)
+			}
+			if doc := f.Tag.Get("doc"); doc != "" {
+				prop["description"] = doc
+			}
+			if enum := f.Tag.Get("enum"); enum != "" {
+				prop["enum"] = strings.Split(enum, ",")
+			}
+			props[name] = prop
+			required = append(required, name)
+		}
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": props,
+			"required":   required,
+		}, nil
+	default:
+		return nil, xerrors.Errorf("no json schema for %s", t)
+	}
+}
@@ -0,0 +1,200 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+
+	address "github.com/filecoin-project/go-address"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// KeyedRow is an export row with a key identifying it among the rows of its actor,
+// so rows of two states can be matched.
+type KeyedRow interface {
+	RowKey() string
+}
+
+// RowKey is the sector number.
+func (r *SectorRow) RowKey() string {
+	return strconv.FormatUint(r.SectorNumber, 10)
+}
+
+// RowKey is the sector number and deal ID.
+func (sd *SectorDealRow) RowKey() string {
+	return strconv.FormatUint(uint64(sd.Sector), 10) + "/" + strconv.FormatUint(uint64(sd.DealID), 10)
+}
+
+// RowKey is empty, a miner has a single peer row.
+func (p *PeerRow) RowKey() string {
+	return ""
+}
+
+// RowKey is empty, an actor has a single sample row.
+func (s *SampleRow) RowKey() string {
+	return ""
+}
+
+// Changes of rows of an incremental export.
+const (
+	RowAdded   = "add"
+	RowUpdated = "update"
+	RowDeleted = "delete"
+)
+
+// ChangedRow is a row of an incremental export with how it changed since the
+// previous state.  Deleted rows hold the row of the previous state.
+type ChangedRow struct {
+	Change string      `json:"change"`
+	Row    interface{} `json:"row"`
+}
+
+// MarshalCBOR encodes the row as [change, row].
+func (r *ChangedRow) MarshalCBOR(w io.Writer) error {
+	m, ok := r.Row.(cbg.CBORMarshaler)
+	if !ok {
+		return xerrors.Errorf("rows of type %T have no cbor encoding", r.Row)
+	}
+	if err := cbg.WriteMajorTypeHeader(w, cbg.MajArray, 2); err != nil {
+		return err
+	}
+	if err := cbg.WriteMajorTypeHeader(w, cbg.MajTextString, uint64(len(r.Change))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, r.Change); err != nil {
+		return err
+	}
+	return m.MarshalCBOR(w)
+}
+
+// sinceActor is the previous record of an actor walked by a sinceTree.
+type sinceActor struct {
+	prev    *Actor
+	deleted bool
+}
+
+// sinceTree walks the actors of tree whose head differs from their head in prev,
+// then the actors of prev deleted from tree.  The previous records of the actors
+// walked are kept in walked for their rows.
+type sinceTree struct {
+	ActorsTree
+	prev   ActorsTree
+	walked *sync.Map
+}
+
+func (t *sinceTree) ForEach(fn func(addr address.Address, a *Actor) error) error {
+	err := t.ActorsTree.ForEach(func(addr address.Address, a *Actor) error {
+		prev, found, err := t.prev.GetActor(addr)
+		if err != nil {
+			return err
+		}
+		if !found {
+			prev = nil
+		} else if prev.Head == a.Head {
+			return nil
+		}
+		t.walked.Store(addr, &sinceActor{prev: prev})
+		return fn(addr, a)
+	})
+	if err != nil {
+		return err
+	}
+	return t.prev.ForEach(func(addr address.Address, a *Actor) error {
+		_, found, err := t.ActorsTree.GetActor(addr)
+		if err != nil || found {
+			return err
+		}
+		prev := *a // ForEach reuses its actor pointer
+		t.walked.Store(addr, &sinceActor{prev: &prev, deleted: true})
+		return fn(addr, &prev)
+	})
+}
+
+// GetActor falls back to prev for deleted actors, for sorted walks.
+func (t *sinceTree) GetActor(addr address.Address) (*Actor, bool, error) {
+	a, found, err := t.ActorsTree.GetActor(addr)
+	if err != nil || found {
+		return a, found, err
+	}
+	return t.prev.GetActor(addr)
+}
+
+// ExportSince restricts an export of tree with rows to the rows that changed since
+// the state prev, whose rows prevRows decodes.  Only actors whose head changed are
+// decoded, and their rows are matched by RowKey and emitted as ChangedRows.  Rows
+// of an actor are emitted in the order rows emits them, followed by its deleted
+// rows.
+func ExportSince(tree, prev ActorsTree, rows, prevRows ActorRows) (ActorsTree, ActorRows) {
+	walked := new(sync.Map)
+	since := &sinceTree{ActorsTree: tree, prev: prev, walked: walked}
+	return since, func(addr address.Address, a *Actor, emit func(row interface{}) error) error {
+		v, ok := walked.Load(addr)
+		if !ok {
+			return xerrors.Errorf("actor %s was not walked", addr)
+		}
+		walked.Delete(addr)
+		sa := v.(*sinceActor)
+
+		type prevRow struct {
+			row     interface{}
+			encoded []byte
+		}
+		var order []string
+		before := make(map[string]*prevRow)
+		if sa.prev != nil {
+			err := prevRows(addr, sa.prev, func(row interface{}) error {
+				key, encoded, err := rowKey(row)
+				if err != nil {
+					return err
+				}
+				order = append(order, key)
+				before[key] = &prevRow{row: row, encoded: encoded}
+				return nil
+			})
+			if err != nil {
+				return xerrors.Errorf("failed to load previous rows: %w", err)
+			}
+		}
+		if !sa.deleted {
+			err := rows(addr, a, func(row interface{}) error {
+				key, encoded, err := rowKey(row)
+				if err != nil {
+					return err
+				}
+				p, found := before[key]
+				delete(before, key)
+				switch {
+				case !found:
+					return emit(&ChangedRow{Change: RowAdded, Row: row})
+				case !bytes.Equal(p.encoded, encoded):
+					return emit(&ChangedRow{Change: RowUpdated, Row: row})
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for _, key := range order {
+			if p, ok := before[key]; ok {
+				if err := emit(&ChangedRow{Change: RowDeleted, Row: p.row}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// rowKey returns the key and json encoding of an export row.
+func rowKey(row interface{}) (string, []byte, error) {
+	kr, ok := row.(KeyedRow)
+	if !ok {
+		return "", nil, xerrors.Errorf("rows of type %T have no key for incremental exports", row)
+	}
+	encoded, err := json.Marshal(row)
+	return kr.RowKey(), encoded, err
+}
@@ -0,0 +1,221 @@
+package lib
+
+import (
+	"container/list"
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"golang.org/x/xerrors"
+)
+
+// BufferMaxBytes caps the memory held by the migration write buffer, zero means
+// no cap.  Beyond the cap the least recently used blocks spill to a temporary on
+// disk store.
+var BufferMaxBytes int64
+
+// spill statistics of all spill stores of the process
+var spilledBlocks, spilledBytes uint64
+
+// SpillStats returns the number of blocks and bytes spilled to disk by buffers
+// over their memory cap.
+func SpillStats() (blocks, bytes uint64) {
+	return atomic.LoadUint64(&spilledBlocks), atomic.LoadUint64(&spilledBytes)
+}
+
+// spillStores are open spill stores, removed by RemoveSpillStores
+var (
+	spillStoresLk sync.Mutex
+	spillStores   []*SpillBlockstore
+)
+
+// RemoveSpillStores closes and deletes the temporary stores of all spill stores.
+func RemoveSpillStores() error {
+	spillStoresLk.Lock()
+	defer spillStoresLk.Unlock()
+	for _, s := range spillStores {
+		if err := s.close(); err != nil {
+			return err
+		}
+	}
+	spillStores = nil
+	return nil
+}
+
+// SpillBlockstore is a thread-safe in memory blockstore holding at most max
+// bytes of block data in memory.  Least recently used blocks beyond the cap move
+// to a badger store in a temporary directory, created on first spill.
+type SpillBlockstore struct {
+	lk      sync.Mutex
+	max     int64
+	size    int64
+	mem     map[cid.Cid]*list.Element
+	lru     *list.List // of blocks.Block, most recently used first
+	dir     string
+	ds      datastore.Batching
+	disk    blockstore.Blockstore
+	spilled map[cid.Cid]struct{}
+}
+
+func NewSpillBlockstore(max int64) *SpillBlockstore {
+	s := &SpillBlockstore{
+		max:     max,
+		mem:     make(map[cid.Cid]*list.Element),
+		lru:     list.New(),
+		spilled: make(map[cid.Cid]struct{}),
+	}
+	spillStoresLk.Lock()
+	spillStores = append(spillStores, s)
+	spillStoresLk.Unlock()
+	return s
+}
+
+func (s *SpillBlockstore) DeleteBlock(c cid.Cid) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if e, ok := s.mem[c]; ok {
+		s.size -= int64(len(e.Value.(blocks.Block).RawData()))
+		s.lru.Remove(e)
+		delete(s.mem, c)
+		return nil
+	}
+	if _, ok := s.spilled[c]; ok {
+		delete(s.spilled, c)
+		return s.disk.DeleteBlock(c)
+	}
+	return nil
+}
+
+func (s *SpillBlockstore) Has(c cid.Cid) (bool, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if _, ok := s.mem[c]; ok {
+		return true, nil
+	}
+	_, ok := s.spilled[c]
+	return ok, nil
+}
+
+func (s *SpillBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if e, ok := s.mem[c]; ok {
+		s.lru.MoveToFront(e)
+		return e.Value.(blocks.Block), nil
+	}
+	if _, ok := s.spilled[c]; ok {
+		return s.disk.Get(c)
+	}
+	return nil, blockstore.ErrNotFound
+}
+
+func (s *SpillBlockstore) GetSize(c cid.Cid) (int, error) {
+	b, err := s.Get(c)
+	if err != nil {
+		return -1, err
+	}
+	return len(b.RawData()), nil
+}
+
+func (s *SpillBlockstore) Put(b blocks.Block) error {
+	return s.PutMany([]blocks.Block{b})
+}
+
+func (s *SpillBlockstore) PutMany(bs []blocks.Block) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for _, b := range bs {
+		if _, ok := s.mem[b.Cid()]; ok {
+			continue
+		}
+		if _, ok := s.spilled[b.Cid()]; ok {
+			continue
+		}
+		s.mem[b.Cid()] = s.lru.PushFront(b)
+		s.size += int64(len(b.RawData()))
+	}
+	return s.spill()
+}
+
+// spill moves least recently used blocks to disk until the memory held is under
+// the cap.
+func (s *SpillBlockstore) spill() error {
+	if s.size <= s.max {
+		return nil
+	}
+	if s.disk == nil {
+		dir, err := ioutil.TempDir("", "ent-buffer-spill")
+		if err != nil {
+			return xerrors.Errorf("failed to create buffer spill dir: %w", err)
+		}
+		ds, err := chainBadgerDs(dir)
+		if err != nil {
+			return xerrors.Errorf("failed to open buffer spill store: %w", err)
+		}
+		s.dir, s.ds, s.disk = dir, ds, NewCompressedBlockstore(blockstore.NewBlockstore(ds), Compress)
+	}
+	var batch []blocks.Block
+	var batchBytes int
+	for s.size > s.max {
+		e := s.lru.Back()
+		b := e.Value.(blocks.Block)
+		s.lru.Remove(e)
+		delete(s.mem, b.Cid())
+		s.spilled[b.Cid()] = struct{}{}
+		s.size -= int64(len(b.RawData()))
+		batch = append(batch, b)
+		batchBytes += len(b.RawData())
+	}
+	if err := s.disk.PutMany(batch); err != nil {
+		return xerrors.Errorf("failed to spill buffered blocks: %w", err)
+	}
+	atomic.AddUint64(&spilledBlocks, uint64(len(batch)))
+	atomic.AddUint64(&spilledBytes, uint64(batchBytes))
+	return nil
+}
+
+func (s *SpillBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	s.lk.Lock()
+	keys := make([]cid.Cid, 0, len(s.mem)+len(s.spilled))
+	for c := range s.mem {
+		keys = append(keys, c)
+	}
+	for c := range s.spilled {
+		keys = append(keys, c)
+	}
+	s.lk.Unlock()
+
+	ch := make(chan cid.Cid)
+	go func() {
+		defer close(ch)
+		for _, c := range keys {
+			select {
+			case ch <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (s *SpillBlockstore) HashOnRead(enabled bool) {}
+
+func (s *SpillBlockstore) close() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.ds == nil {
+		return nil
+	}
+	if err := s.ds.Close(); err != nil {
+		return err
+	}
+	s.ds, s.disk = nil, nil
+	return os.RemoveAll(s.dir)
+}
@@ -0,0 +1,174 @@
+package lib
+
+import (
+	"context"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/cbor"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	market8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/market"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	power8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/power"
+	reward8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/reward"
+	verifreg8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/verifreg"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// StateReader reads a state of any actors version.  It inspects the state once
+// and passes its actors version to the version dispatching readers of this
+// package, which return the v8 types the state's own types convert to.
+type StateReader struct {
+	Root cid.Cid
+	Info *RootInfo
+	// Tree is the actors tree of the state
+	Tree ActorsTree
+
+	ctx   context.Context
+	store cbornode.IpldStore
+	name  func(cid.Cid) string
+}
+
+// NewStateReader returns a reader of the state at root.
+func NewStateReader(ctx context.Context, store cbornode.IpldStore, root cid.Cid) (*StateReader, error) {
+	info, err := InspectRoot(ctx, store, root)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := LoadActorsTree(ctx, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return nil, err
+	}
+	name, err := ActorCodeNamer(ctx, store, info)
+	if err != nil {
+		return nil, err
+	}
+	return &StateReader{Root: root, Info: info, Tree: tree, ctx: ctx, store: store, name: name}, nil
+}
+
+// ActorsVersion returns the actors version of the state.
+func (r *StateReader) ActorsVersion() int {
+	return r.Info.ActorsVersion
+}
+
+// CodeName returns the name of a builtin actor code of the state, like
+// "storageminer", or "" for other codes.
+func (r *StateReader) CodeName(code cid.Cid) string {
+	return r.name(code)
+}
+
+// Actor returns the actor at the ID address addr.
+func (r *StateReader) Actor(addr address.Address) (*Actor, error) {
+	a, found, err := r.Tree.GetActor(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, xerrors.Errorf("actor %s not found in state %s", addr, r.Root)
+	}
+	return a, nil
+}
+
+// ForEachMiner calls fn with every miner actor of the state.
+func (r *StateReader) ForEachMiner(fn func(addr address.Address, a *Actor) error) error {
+	return r.Tree.ForEach(func(addr address.Address, a *Actor) error {
+		if r.name(a.Code) != "storageminer" {
+			return nil
+		}
+		return fn(addr, a)
+	})
+}
+
+// NewActorState returns a new value of the head state type of the actor code in
+// the state's actors version.
+func (r *StateReader) NewActorState(code cid.Cid) (cbor.Unmarshaler, error) {
+	return NewActorState(r.Info.ActorsVersion, r.name(code))
+}
+
+// MinerBalance returns the balance info of the miner actor a.
+func (r *StateReader) MinerBalance(a *Actor) (BalanceInfo, error) {
+	return MinerBalanceInfo(r.ctx, r.store, r.Info.ActorsVersion, a)
+}
+
+// ForEachMinerSector calls fn with every sector of the miner actor a.
+func (r *StateReader) ForEachMinerSector(a *Actor, fn func(*MinerSector) error) error {
+	return ForEachMinerSector(r.ctx, r.store, r.Info.ActorsVersion, a.Head, fn)
+}
+
+// ForEachMinerPartition calls fn with every partition of the miner actor a.
+func (r *StateReader) ForEachMinerPartition(a *Actor, fn func(dlIdx uint64, partIdx int64, p *miner8.Partition) error) error {
+	return ForEachMinerPartition(r.ctx, r.store, r.Info.ActorsVersion, a.Head, fn)
+}
+
+// MinerSectorPlacements returns the placement of every sector in the partitions
+// of the miner actor a.
+func (r *StateReader) MinerSectorPlacements(a *Actor) (map[uint64]SectorPlacement, error) {
+	return MinerSectorPlacements(r.ctx, r.store, r.Info.ActorsVersion, a.Head)
+}
+
+// MinerAddresses returns the owner, worker and control addresses of the miner
+// actor a.
+func (r *StateReader) MinerAddresses(a *Actor) (*MinerAddresses, error) {
+	return LoadMinerAddresses(r.ctx, r.store, r.Info.ActorsVersion, a.Head)
+}
+
+// MinerPeerInfo returns the peer the miner actor a advertises.
+func (r *StateReader) MinerPeerInfo(a *Actor) (*MinerPeerInfo, error) {
+	return LoadMinerPeerInfo(r.ctx, r.store, r.Info.ActorsVersion, a.Head)
+}
+
+// singleton returns the head of the singleton actor at addr.
+func (r *StateReader) singleton(addr address.Address) (cid.Cid, error) {
+	a, err := r.Actor(addr)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return a.Head, nil
+}
+
+// PowerState returns the power actor state as v8 state, see LoadPowerState.
+func (r *StateReader) PowerState() (*power8.State, error) {
+	head, err := r.singleton(builtin0.StoragePowerActorAddr)
+	if err != nil {
+		return nil, err
+	}
+	return loadPowerState(r.ctx, r.store, r.Info.ActorsVersion, head)
+}
+
+// RewardState returns the reward actor state as v8 state, see LoadRewardState.
+func (r *StateReader) RewardState() (*reward8.State, error) {
+	head, err := r.singleton(builtin0.RewardActorAddr)
+	if err != nil {
+		return nil, err
+	}
+	return loadRewardState(r.ctx, r.store, r.Info.ActorsVersion, head)
+}
+
+// VerifregState returns the verified registry actor state as v8 state, see
+// LoadVerifregState.
+func (r *StateReader) VerifregState() (*verifreg8.State, error) {
+	head, err := r.singleton(builtin0.VerifiedRegistryActorAddr)
+	if err != nil {
+		return nil, err
+	}
+	return loadVerifregState(r.ctx, r.store, r.Info.ActorsVersion, head)
+}
+
+// MarketState returns the storage market actor state as v8 state.
+func (r *StateReader) MarketState() (*market8.State, error) {
+	head, err := r.singleton(builtin0.StorageMarketActorAddr)
+	if err != nil {
+		return nil, err
+	}
+	var st market8.State
+	if err := r.store.Get(r.ctx, head, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// DealProposals returns the deal proposals of the market state st.
+func (r *StateReader) DealProposals(st *market8.State) (*DealProposals, error) {
+	return LoadDealProposals(r.ctx, r.store, r.Info.ActorsVersion, st)
+}
@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"context"
+	"sync"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	market8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/market"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// Reports ComputeStateReports computes.
+const (
+	ReportBalances = "balances"
+	ReportDebts    = "debts"
+	ReportPower    = "power"
+	ReportDeals    = "deals"
+)
+
+// AllStateReports are the names of every report of ComputeStateReports.
+var AllStateReports = []string{ReportBalances, ReportDebts, ReportPower, ReportDeals}
+
+// StateReports are reports of a state computed in a single walk of its actors.
+// Reports not asked for are left nil.
+type StateReports struct {
+	// Balances of every miner, computed for the balances and debts reports
+	Balances map[address.Address]BalanceInfo
+	// BurntFunds is the balance of the burnt funds actor, for the debts report
+	BurntFunds *abi.TokenAmount
+	Power      *PowerReport
+	Deals      *DealsReport
+}
+
+// PowerReport sums the power claims of miners.
+type PowerReport struct {
+	Claims int
+	// RawBytePower and QualityAdjPower sum the claims, which also count miners
+	// below the consensus minimum
+	RawBytePower    abi.StoragePower
+	QualityAdjPower abi.StoragePower
+	// TotalRawBytePower and TotalQualityAdjPower are the totals of the power actor
+	TotalRawBytePower       abi.StoragePower
+	TotalQualityAdjPower    abi.StoragePower
+	MinerAboveMinPowerCount int64
+}
+
+// DealsReport counts the deals of the market.
+type DealsReport struct {
+	Proposals uint64
+	// Active deals have a deal state, the rest are not yet activated in a sector
+	Active                        uint64
+	TotalClientLockedCollateral   abi.TokenAmount
+	TotalProviderLockedCollateral abi.TokenAmount
+	TotalClientStorageFee         abi.TokenAmount
+}
+
+// ComputeStateReports computes the reports named by include, some of
+// AllStateReports, of the state at root in one parallel walk of its actors.  If
+// ctx is cancelled it returns the reports computed so far with the error.
+func ComputeStateReports(ctx context.Context, store cbornode.IpldStore, root cid.Cid, include []string) (*StateReports, error) {
+	want := make(map[string]bool)
+	for _, name := range include {
+		found := false
+		for _, r := range AllStateReports {
+			found = found || r == name
+		}
+		if !found {
+			return nil, xerrors.Errorf("unknown report %q, want some of %v", name, AllStateReports)
+		}
+		want[name] = true
+	}
+
+	var reports StateReports
+	if want[ReportBalances] || want[ReportDebts] {
+		reports.Balances = make(map[address.Address]BalanceInfo)
+	}
+	var lk sync.Mutex
+	err := ForEachActor(ctx, store, root, DetectActorsVersion, func(v *ActorVisit) error {
+		switch {
+		case v.Code == "storageminer" && reports.Balances != nil:
+			bi, err := MinerBalanceInfo(ctx, store, v.ActorsVersion, &v.Actor)
+			if err != nil {
+				return xerrors.Errorf("failed to load balances of miner %s: %w", v.Addr, err)
+			}
+			lk.Lock()
+			reports.Balances[v.Addr] = bi
+			lk.Unlock()
+		case v.Addr == builtin0.BurntFundsActorAddr && want[ReportDebts]:
+			bf := v.Actor.Balance
+			lk.Lock()
+			reports.BurntFunds = &bf
+			lk.Unlock()
+		case v.Code == "storagepower" && want[ReportPower]:
+			power, err := powerReport(ctx, store, v)
+			if err != nil {
+				return xerrors.Errorf("failed to load power report: %w", err)
+			}
+			lk.Lock()
+			reports.Power = power
+			lk.Unlock()
+		case v.Code == "storagemarket" && want[ReportDeals]:
+			deals, err := dealsReport(ctx, store, v)
+			if err != nil {
+				return xerrors.Errorf("failed to load deals report: %w", err)
+			}
+			lk.Lock()
+			reports.Deals = deals
+			lk.Unlock()
+		}
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+	return &reports, err
+}
+
+func powerReport(ctx context.Context, store cbornode.IpldStore, v *ActorVisit) (*PowerReport, error) {
+	st, err := loadPowerState(ctx, store, v.ActorsVersion, v.Actor.Head)
+	if err != nil {
+		return nil, err
+	}
+	r := &PowerReport{
+		RawBytePower:            big.Zero(),
+		QualityAdjPower:         big.Zero(),
+		TotalRawBytePower:       st.TotalRawBytePower,
+		TotalQualityAdjPower:    st.TotalQualityAdjPower,
+		MinerAboveMinPowerCount: st.MinerAboveMinPowerCount,
+	}
+	err = ForEachPowerClaim(ctx, store, v.ActorsVersion, st.Claims, func(_ address.Address, raw, qa abi.StoragePower) error {
+		r.Claims++
+		r.RawBytePower = big.Add(r.RawBytePower, raw)
+		r.QualityAdjPower = big.Add(r.QualityAdjPower, qa)
+		return nil
+	})
+	return r, err
+}
+
+func dealsReport(ctx context.Context, store cbornode.IpldStore, v *ActorVisit) (*DealsReport, error) {
+	var st market8.State
+	if err := store.Get(ctx, v.Actor.Head, &st); err != nil {
+		return nil, err
+	}
+	proposals, err := loadArray(ctx, store, v.ActorsVersion, st.Proposals, market8.ProposalsAmtBitwidth)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load deal proposals: %w", err)
+	}
+	// every adt array version has Length, which array does not declare
+	n := proposals.(interface{ Length() uint64 }).Length()
+	active, err := CountActiveDeals(ctx, store, v.ActorsVersion, &st)
+	if err != nil {
+		return nil, err
+	}
+	return &DealsReport{
+		Proposals:                     n,
+		Active:                        active,
+		TotalClientLockedCollateral:   st.TotalClientLockedCollateral,
+		TotalProviderLockedCollateral: st.TotalProviderLockedCollateral,
+		TotalClientStorageFee:         st.TotalClientStorageFee,
+	}, nil
+}
@@ -0,0 +1,242 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// JSON-RPC error codes of StateServer responses.  Failed calls use code 1 as
+// lotus does.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcCallError      = 1
+)
+
+// StateServer answers a few lotus JSON-RPC state methods from an ent store, so
+// lotus client tooling can inspect any state in it, including migration outputs
+// never executed on chain.  The tipset key argument of every method selects the
+// state: a state root is used as is, a block header CID stands for its parent
+// state root as lotus does, and an empty key selects the default state.
+type StateServer struct {
+	store cbornode.IpldStore
+	// root is the default state, cid.Undef for none
+	root    cid.Cid
+	methods map[string]stateMethod
+}
+
+// stateMethod handles the params of a call of a StateServer method.
+type stateMethod func(ctx context.Context, params []json.RawMessage) (interface{}, error)
+
+// NewStateServer returns a server of the states of store with the default state
+// root, which may be cid.Undef.
+func NewStateServer(store cbornode.IpldStore, root cid.Cid) *StateServer {
+	s := &StateServer{store: store, root: root}
+	s.methods = map[string]stateMethod{
+		"Filecoin.StateGetActor":     s.stateGetActor,
+		"Filecoin.StateReadState":    s.stateReadState,
+		"Filecoin.StateMinerSectors": s.stateMinerSectors,
+	}
+	return s
+}
+
+type rpcServerRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcServerResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// ServeHTTP answers a JSON-RPC 2.0 request posted as the request body.
+func (s *StateServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSON-RPC requests must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req rpcServerRequest
+	resp := rpcServerResponse{JSONRPC: "2.0"}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		resp.Error = &rpcError{Code: rpcParseError, Message: err.Error()}
+	} else if method, ok := s.methods[req.Method]; !ok {
+		resp.ID = req.ID
+		resp.Error = &rpcError{Code: rpcMethodNotFound, Message: "method '" + req.Method + "' not found"}
+	} else {
+		resp.ID = req.ID
+		result, err := method(r.Context(), req.Params)
+		var paramsErr invalidParamsError
+		if xerrors.As(err, &paramsErr) {
+			resp.Error = &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		} else if err != nil {
+			resp.Error = &rpcError{Code: rpcCallError, Message: err.Error()}
+		} else {
+			resp.Result = result
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&resp)
+}
+
+// invalidParamsError is the error of params which do not decode.
+type invalidParamsError struct{ msg string }
+
+func (e invalidParamsError) Error() string { return e.msg }
+
+// decodeParams decodes params into out, in order.  Params missing at the end are
+// left zero, as lotus clients omit trailing null params.
+func decodeParams(params []json.RawMessage, out ...interface{}) error {
+	if len(params) > len(out) {
+		return invalidParamsError{fmt.Sprintf("expected %d params, got %d", len(out), len(params))}
+	}
+	for i, p := range params {
+		if err := json.Unmarshal(p, out[i]); err != nil {
+			return invalidParamsError{fmt.Sprintf("param %d: %s", i, err)}
+		}
+	}
+	return nil
+}
+
+// state returns the state root the tipset key tsk selects.
+func (s *StateServer) state(ctx context.Context, tsk []cid.Cid) (cid.Cid, error) {
+	if len(tsk) == 0 {
+		if s.root == cid.Undef {
+			return cid.Undef, xerrors.Errorf("no default state, pass a state root or block CID as the tipset key")
+		}
+		return s.root, nil
+	}
+	if _, err := InspectRoot(ctx, s.store, tsk[0]); err == nil {
+		return tsk[0], nil
+	}
+	var blk BlockHeader
+	if err := s.store.Get(ctx, tsk[0], &blk); err != nil {
+		return cid.Undef, xerrors.Errorf("%s is neither a state root nor a block header: %w", tsk[0], err)
+	}
+	return blk.ParentStateRoot, nil
+}
+
+// actor returns the actor at addr, which may be a robust address, and a reader
+// of the state tsk selects.
+func (s *StateServer) actor(ctx context.Context, addr address.Address, tsk []cid.Cid) (*Actor, *StateReader, error) {
+	root, err := s.state(ctx, tsk)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolver, err := NewAddressResolver(ctx, s.store, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, found, err := resolver.Resolve(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, xerrors.Errorf("actor not found: %s", addr)
+	}
+	r, err := NewStateReader(ctx, s.store, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := r.Actor(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, r, nil
+}
+
+// rpcActor is the lotus JSON encoding of an actor.
+type rpcActor struct {
+	Code    cid.Cid
+	Head    cid.Cid
+	Nonce   uint64
+	Balance abi.TokenAmount
+}
+
+func (s *StateServer) stateGetActor(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var addr address.Address
+	var tsk []cid.Cid
+	if err := decodeParams(params, &addr, &tsk); err != nil {
+		return nil, err
+	}
+	a, _, err := s.actor(ctx, addr, tsk)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcActor{Code: a.Code, Head: a.Head, Nonce: a.CallSeqNum, Balance: a.Balance}, nil
+}
+
+// rpcActorState is the lotus JSON encoding of an actor's decoded state.
+type rpcActorState struct {
+	Balance abi.TokenAmount
+	Code    cid.Cid
+	State   interface{}
+}
+
+func (s *StateServer) stateReadState(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var addr address.Address
+	var tsk []cid.Cid
+	if err := decodeParams(params, &addr, &tsk); err != nil {
+		return nil, err
+	}
+	a, r, err := s.actor(ctx, addr, tsk)
+	if err != nil {
+		return nil, err
+	}
+	st, err := r.NewActorState(a.Code)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Get(ctx, a.Head, st); err != nil {
+		return nil, xerrors.Errorf("failed to load state of %s: %w", addr, err)
+	}
+	return &rpcActorState{Balance: a.Balance, Code: a.Code, State: st}, nil
+}
+
+func (s *StateServer) stateMinerSectors(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var addr address.Address
+	var sectorNos *bitfield.BitField
+	var tsk []cid.Cid
+	if err := decodeParams(params, &addr, &sectorNos, &tsk); err != nil {
+		return nil, err
+	}
+	a, r, err := s.actor(ctx, addr, tsk)
+	if err != nil {
+		return nil, err
+	}
+	if r.CodeName(a.Code) != "storageminer" {
+		return nil, xerrors.Errorf("%s is not a miner actor", addr)
+	}
+	sectors := []*MinerSector{}
+	err = r.ForEachMinerSector(a, func(sector *MinerSector) error {
+		if sectorNos != nil {
+			if set, err := sectorNos.IsSet(uint64(sector.SectorNumber)); err != nil || !set {
+				return err
+			}
+		}
+		sectors = append(sectors, sector)
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load sectors of %s: %w", addr, err)
+	}
+	return sectors, nil
+}
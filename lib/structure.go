@@ -0,0 +1,346 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/cbor"
+	market0 "github.com/filecoin-project/specs-actors/actors/builtin/market"
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	power0 "github.com/filecoin-project/specs-actors/actors/builtin/power"
+	adt0 "github.com/filecoin-project/specs-actors/actors/util/adt"
+	market2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/market"
+	miner2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/miner"
+	power2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/power"
+	adt2 "github.com/filecoin-project/specs-actors/v2/actors/util/adt"
+	market3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/market"
+	miner3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/miner"
+	power3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/power"
+	market4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/market"
+	miner4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/miner"
+	power4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/power"
+	market5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/market"
+	miner5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/miner"
+	power5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/power"
+	market6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/market"
+	miner6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/miner"
+	power6 "github.com/filecoin-project/specs-actors/v6/actors/builtin/power"
+	market7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/market"
+	miner7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/miner"
+	power7 "github.com/filecoin-project/specs-actors/v7/actors/builtin/power"
+	builtin8 "github.com/filecoin-project/specs-actors/v8/actors/builtin"
+	market8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/market"
+	miner8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/miner"
+	power8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/power"
+	adt8 "github.com/filecoin-project/specs-actors/v8/actors/util/adt"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// StructureType is a kind of HAMT or AMT found in state, with the encoding
+// parameters and value type it has in each actors version.
+type StructureType struct {
+	Name        string
+	Description string
+	// AMT is set for AMTs, HAMTs otherwise
+	AMT bool
+	// bitwidth is the bitwidth from actors v3.  Earlier HAMTs have bitwidth 5 and
+	// AMTs bitwidth 3.
+	bitwidth int
+	// key decodes a HAMT key to print
+	key func(k string) (string, error)
+	// values construct the value type by actors version.  Actors v1 shares the
+	// v0 types.
+	values map[int]func() cbor.Unmarshaler
+}
+
+// Bitwidth returns the bitwidth of the structure in actorsVersion.
+func (t *StructureType) Bitwidth(actorsVersion int) int {
+	switch {
+	case actorsVersion >= 3:
+		return t.bitwidth
+	case t.AMT:
+		return amtV0Bitwidth
+	default:
+		return hamtV0Bitwidth
+	}
+}
+
+// hamtV0Bitwidth is the fixed bitwidth of v0 and v2 HAMTs
+const hamtV0Bitwidth = 5
+
+func addressKey(k string) (string, error) {
+	addr, err := address.NewFromBytes([]byte(k))
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+func uintKey(k string) (string, error) {
+	n, err := abi.ParseUIntKey(k)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(n, 10), nil
+}
+
+// allVersions constructs the same value type in every actors version.
+func allVersions(f func() cbor.Unmarshaler) map[int]func() cbor.Unmarshaler {
+	return map[int]func() cbor.Unmarshaler{0: f, 2: f, 3: f, 4: f, 5: f, 6: f, 7: f, 8: f}
+}
+
+// StructureTypes are the structures check structure knows.
+var StructureTypes = []*StructureType{
+	{
+		Name:        "actors-hamt",
+		Description: "state tree actors by ID address",
+		bitwidth:    builtin8.DefaultHamtBitwidth,
+		key:         addressKey,
+		values:      allVersions(func() cbor.Unmarshaler { return new(Actor) }),
+	},
+	{
+		Name:        "init-addresses-hamt",
+		Description: "init actor ID addresses by robust address",
+		bitwidth:    builtin8.DefaultHamtBitwidth,
+		key:         addressKey,
+		values:      allVersions(func() cbor.Unmarshaler { return new(cbg.CborInt) }),
+	},
+	{
+		Name:        "miner-sectors-amt",
+		Description: "miner sector infos by sector number",
+		AMT:         true,
+		bitwidth:    miner8.SectorsAmtBitwidth,
+		values: map[int]func() cbor.Unmarshaler{
+			0: func() cbor.Unmarshaler { return new(miner0.SectorOnChainInfo) },
+			2: func() cbor.Unmarshaler { return new(miner2.SectorOnChainInfo) },
+			3: func() cbor.Unmarshaler { return new(miner3.SectorOnChainInfo) },
+			4: func() cbor.Unmarshaler { return new(miner4.SectorOnChainInfo) },
+			5: func() cbor.Unmarshaler { return new(miner5.SectorOnChainInfo) },
+			6: func() cbor.Unmarshaler { return new(miner6.SectorOnChainInfo) },
+			7: func() cbor.Unmarshaler { return new(miner7.SectorOnChainInfo) },
+			8: func() cbor.Unmarshaler { return new(miner8.SectorOnChainInfo) },
+		},
+	},
+	{
+		Name:        "miner-precommits-hamt",
+		Description: "miner precommitted sectors by sector number",
+		bitwidth:    builtin8.DefaultHamtBitwidth,
+		key:         uintKey,
+		values: map[int]func() cbor.Unmarshaler{
+			0: func() cbor.Unmarshaler { return new(miner0.SectorPreCommitOnChainInfo) },
+			2: func() cbor.Unmarshaler { return new(miner2.SectorPreCommitOnChainInfo) },
+			3: func() cbor.Unmarshaler { return new(miner3.SectorPreCommitOnChainInfo) },
+			4: func() cbor.Unmarshaler { return new(miner4.SectorPreCommitOnChainInfo) },
+			5: func() cbor.Unmarshaler { return new(miner5.SectorPreCommitOnChainInfo) },
+			6: func() cbor.Unmarshaler { return new(miner6.SectorPreCommitOnChainInfo) },
+			7: func() cbor.Unmarshaler { return new(miner7.SectorPreCommitOnChainInfo) },
+			8: func() cbor.Unmarshaler { return new(miner8.SectorPreCommitOnChainInfo) },
+		},
+	},
+	{
+		Name:        "miner-partitions-amt",
+		Description: "partitions of a miner deadline by partition index",
+		AMT:         true,
+		bitwidth:    miner8.DeadlinePartitionsAmtBitwidth,
+		values: map[int]func() cbor.Unmarshaler{
+			0: func() cbor.Unmarshaler { return new(miner0.Partition) },
+			2: func() cbor.Unmarshaler { return new(miner2.Partition) },
+			3: func() cbor.Unmarshaler { return new(miner3.Partition) },
+			4: func() cbor.Unmarshaler { return new(miner4.Partition) },
+			5: func() cbor.Unmarshaler { return new(miner5.Partition) },
+			6: func() cbor.Unmarshaler { return new(miner6.Partition) },
+			7: func() cbor.Unmarshaler { return new(miner7.Partition) },
+			8: func() cbor.Unmarshaler { return new(miner8.Partition) },
+		},
+	},
+	{
+		Name:        "miner-expirations-amt",
+		Description: "partition expiration queue sets by quantized epoch",
+		AMT:         true,
+		bitwidth:    miner8.PartitionExpirationAmtBitwidth,
+		values: map[int]func() cbor.Unmarshaler{
+			0: func() cbor.Unmarshaler { return new(miner0.ExpirationSet) },
+			2: func() cbor.Unmarshaler { return new(miner2.ExpirationSet) },
+			3: func() cbor.Unmarshaler { return new(miner3.ExpirationSet) },
+			4: func() cbor.Unmarshaler { return new(miner4.ExpirationSet) },
+			5: func() cbor.Unmarshaler { return new(miner5.ExpirationSet) },
+			6: func() cbor.Unmarshaler { return new(miner6.ExpirationSet) },
+			7: func() cbor.Unmarshaler { return new(miner7.ExpirationSet) },
+			8: func() cbor.Unmarshaler { return new(miner8.ExpirationSet) },
+		},
+	},
+	{
+		Name:        "market-proposals-amt",
+		Description: "market deal proposals by deal ID",
+		AMT:         true,
+		bitwidth:    market8.ProposalsAmtBitwidth,
+		values: map[int]func() cbor.Unmarshaler{
+			0: func() cbor.Unmarshaler { return new(market0.DealProposal) },
+			2: func() cbor.Unmarshaler { return new(market2.DealProposal) },
+			3: func() cbor.Unmarshaler { return new(market3.DealProposal) },
+			4: func() cbor.Unmarshaler { return new(market4.DealProposal) },
+			5: func() cbor.Unmarshaler { return new(market5.DealProposal) },
+			6: func() cbor.Unmarshaler { return new(market6.DealProposal) },
+			7: func() cbor.Unmarshaler { return new(market7.DealProposal) },
+			8: func() cbor.Unmarshaler { return new(market8.DealProposal) },
+		},
+	},
+	{
+		Name:        "market-states-amt",
+		Description: "market deal states by deal ID",
+		AMT:         true,
+		bitwidth:    market8.StatesAmtBitwidth,
+		values: map[int]func() cbor.Unmarshaler{
+			0: func() cbor.Unmarshaler { return new(market0.DealState) },
+			2: func() cbor.Unmarshaler { return new(market2.DealState) },
+			3: func() cbor.Unmarshaler { return new(market3.DealState) },
+			4: func() cbor.Unmarshaler { return new(market4.DealState) },
+			5: func() cbor.Unmarshaler { return new(market5.DealState) },
+			6: func() cbor.Unmarshaler { return new(market6.DealState) },
+			7: func() cbor.Unmarshaler { return new(market7.DealState) },
+			8: func() cbor.Unmarshaler { return new(market8.DealState) },
+		},
+	},
+	{
+		Name:        "market-balances-hamt",
+		Description: "market escrow or locked balance table by address",
+		bitwidth:    adt8.BalanceTableBitwidth,
+		key:         addressKey,
+		values:      allVersions(func() cbor.Unmarshaler { return new(big.Int) }),
+	},
+	{
+		Name:        "power-claims-hamt",
+		Description: "power claims by miner address",
+		bitwidth:    builtin8.DefaultHamtBitwidth,
+		key:         addressKey,
+		values: map[int]func() cbor.Unmarshaler{
+			0: func() cbor.Unmarshaler { return new(power0.Claim) },
+			2: func() cbor.Unmarshaler { return new(power2.Claim) },
+			3: func() cbor.Unmarshaler { return new(power3.Claim) },
+			4: func() cbor.Unmarshaler { return new(power4.Claim) },
+			5: func() cbor.Unmarshaler { return new(power5.Claim) },
+			6: func() cbor.Unmarshaler { return new(power6.Claim) },
+			7: func() cbor.Unmarshaler { return new(power7.Claim) },
+			8: func() cbor.Unmarshaler { return new(power8.Claim) },
+		},
+	},
+	{
+		Name:        "verifreg-datacap-hamt",
+		Description: "verifier or client DataCap by address",
+		bitwidth:    builtin8.DefaultHamtBitwidth,
+		key:         addressKey,
+		values:      allVersions(func() cbor.Unmarshaler { return new(big.Int) }),
+	},
+}
+
+// LookupStructureType returns the structure type called name.
+func LookupStructureType(name string) (*StructureType, bool) {
+	for _, t := range StructureTypes {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+type structureKey string
+
+func (k structureKey) Key() string { return string(k) }
+
+// hamtMap is the HAMT interface shared by all adt versions.
+type hamtMap interface {
+	ForEach(out cbor.Unmarshaler, fn func(key string) error) error
+	Get(k abi.Keyer, out cbor.Unmarshaler) (bool, error)
+}
+
+func loadMap(ctx context.Context, store cbornode.IpldStore, actorsVersion int, root cid.Cid, bitwidth int) (hamtMap, error) {
+	switch {
+	case actorsVersion <= 1:
+		return adt0.AsMap(adt0.WrapStore(ctx, store), root)
+	case actorsVersion == 2:
+		return adt2.AsMap(adt2.WrapStore(ctx, store), root)
+	case actorsVersion <= 8:
+		return adt8.AsMap(adt8.WrapStore(ctx, store), root, bitwidth)
+	default:
+		return nil, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+}
+
+// CheckStructure checks the HAMT or AMT at root is a well formed structure of
+// type t in actorsVersion without loading any state around it: it loads with the
+// bitwidth of the version, every key and value decodes, and every HAMT key is
+// found again by lookup, which fails for keys placed with another bitwidth.
+// Entry failures are passed to fail with the printable key of the entry and
+// checking continues, structural failures are returned.  It returns the number of entries checked.
+func CheckStructure(ctx context.Context, store cbornode.IpldStore, actorsVersion int, root cid.Cid, t *StructureType, fail func(key string, err error)) (int, error) {
+	v := actorsVersion
+	if v == 1 {
+		v = 0
+	}
+	newValue, ok := t.values[v]
+	if !ok {
+		return 0, xerrors.Errorf("no %s in actors v%d", t.Name, actorsVersion)
+	}
+	decode := func(raw []byte) error {
+		return newValue().UnmarshalCBOR(bytes.NewReader(raw))
+	}
+	bitwidth := t.Bitwidth(actorsVersion)
+	entries := 0
+	var raw cbg.Deferred
+	if t.AMT {
+		arr, err := loadArray(ctx, store, actorsVersion, root, bitwidth)
+		if err != nil {
+			return 0, xerrors.Errorf("failed to load AMT with bitwidth %d: %w", bitwidth, err)
+		}
+		err = arr.ForEach(&raw, func(i int64) error {
+			entries++
+			if err := decode(raw.Raw); err != nil {
+				fail(strconv.FormatInt(i, 10), xerrors.Errorf("value does not decode: %w", err))
+			}
+			return ctx.Err()
+		})
+		return entries, err
+	}
+
+	m, err := loadMap(ctx, store, actorsVersion, root, bitwidth)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to load HAMT with bitwidth %d: %w", bitwidth, err)
+	}
+	var keys []string
+	printable := make(map[string]string)
+	err = m.ForEach(&raw, func(k string) error {
+		entries++
+		keys = append(keys, k)
+		pk, err := t.key(k)
+		if err != nil {
+			pk = fmt.Sprintf("%x", k)
+			fail(pk, xerrors.Errorf("key does not decode: %w", err))
+		}
+		printable[k] = pk
+		if err := decode(raw.Raw); err != nil {
+			fail(pk, xerrors.Errorf("value does not decode: %w", err))
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return entries, err
+	}
+	for _, k := range keys {
+		found, err := m.Get(structureKey(k), &raw)
+		if err != nil {
+			return entries, err
+		}
+		if !found {
+			fail(printable[k], xerrors.Errorf("key not found by lookup, placed with another bitwidth or hash"))
+		}
+	}
+	return entries, nil
+}
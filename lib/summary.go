@@ -0,0 +1,281 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	address "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// ActorTypeChanges counts the changes a migration made to the actors of one type.
+type ActorTypeChanges struct {
+	// Actors is the number of actors of the type after the migration
+	Actors int
+	// Rewritten actors have a new state head
+	Rewritten int
+	// CodeOnly actors kept their state head under new code
+	CodeOnly int
+	// Unchanged actors kept both code and state head
+	Unchanged int
+	// Created actors were not in the input state, Removed actors are not in the
+	// output state
+	Created int
+	Removed int
+	// Blocks and Bytes are the new blocks first reached from the actors' heads
+	Blocks int
+	Bytes  int
+}
+
+// MigrationSummary categorizes the changes of a migration by actor type, from the
+// blocks the migration wrote to the buffer.
+type MigrationSummary struct {
+	FromVersion int
+	ToVersion   int
+	// Types are the changes by actor code name, of the input code for removed
+	// actors and of the output code otherwise
+	Types map[string]*ActorTypeChanges
+	// TreeBlocks and TreeBytes are the new blocks of the state tree itself: the
+	// actors HAMT and state root
+	TreeBlocks int
+	TreeBytes  int
+	// AMTRoots counts new AMT roots by bitwidth.  v0 and v2 AMTs record no
+	// bitwidth and count as 3.
+	AMTRoots map[int]int
+	// EmptyHAMTs and EmptyAMTs count references to empty structures from new
+	// blocks, repeated references to the same empty structure included
+	EmptyHAMTs int
+	EmptyAMTs  int
+}
+
+func (s *MigrationSummary) changes(name string) *ActorTypeChanges {
+	tc, ok := s.Types[name]
+	if !ok {
+		tc = new(ActorTypeChanges)
+		s.Types[name] = tc
+	}
+	return tc
+}
+
+// blockShape is what a block looks like from its encoding.  Shapes are guessed
+// from the cbor layout alone, so a struct laid out like an AMT root counts as one.
+type blockShape int
+
+const (
+	shapeOther blockShape = iota
+	shapeHAMTNode
+	shapeEmptyHAMT
+	shapeAMTRoot
+	shapeEmptyAMT
+)
+
+// amtV0Bitwidth is the fixed bitwidth of v0 and v2 AMTs
+const amtV0Bitwidth = 3
+
+// classifyBlock guesses the shape of a dag-cbor block.  HAMT nodes are
+// [bitfield, pointers], AMT roots [bitwidth, height, count, node] or, before
+// actors v3, [height, count, node].
+func classifyBlock(raw []byte) (blockShape, int) {
+	r := bytes.NewReader(raw)
+	maj, n, err := cbg.CborReadHeader(r)
+	if err != nil || maj != cbg.MajArray {
+		return shapeOther, 0
+	}
+	switch n {
+	case 2:
+		maj, bfLen, err := cbg.CborReadHeader(r)
+		if err != nil || maj != cbg.MajByteString {
+			return shapeOther, 0
+		}
+		if _, err := r.Seek(int64(bfLen), io.SeekCurrent); err != nil {
+			return shapeOther, 0
+		}
+		maj, ptrs, err := cbg.CborReadHeader(r)
+		if err != nil || maj != cbg.MajArray {
+			return shapeOther, 0
+		}
+		if ptrs == 0 {
+			return shapeEmptyHAMT, 0
+		}
+		return shapeHAMTNode, 0
+	case 3, 4:
+		var fields [3]uint64
+		bitwidth := uint64(amtV0Bitwidth)
+		for i := uint64(0); i < n-1; i++ {
+			maj, v, err := cbg.CborReadHeader(r)
+			if err != nil || maj != cbg.MajUnsignedInt {
+				return shapeOther, 0
+			}
+			fields[i] = v
+		}
+		if n == 4 {
+			bitwidth = fields[0]
+		}
+		count := fields[n-2]
+		maj, _, err := cbg.CborReadHeader(r)
+		if err != nil || maj != cbg.MajArray {
+			return shapeOther, 0
+		}
+		if count == 0 {
+			return shapeEmptyAMT, int(bitwidth)
+		}
+		return shapeAMTRoot, int(bitwidth)
+	}
+	return shapeOther, 0
+}
+
+// summaryWalk walks new blocks, those in the buffer, once each.
+type summaryWalk struct {
+	bs     *BufferedBlockstore
+	s      *MigrationSummary
+	shapes map[cid.Cid]blockShape
+}
+
+// walk visits the new blocks reachable from c through new blocks and returns the
+// number of blocks and bytes first visited.
+func (w *summaryWalk) walk(c cid.Cid) (blocks, size int, err error) {
+	if c.Prefix().MhType == 0 {
+		// identity cid, no block
+		return 0, 0, nil
+	}
+	if shape, seen := w.shapes[c]; seen {
+		w.countEmpty(shape)
+		return 0, 0, nil
+	}
+	blk, found, err := w.bs.GetBuffered(c)
+	if err != nil || !found {
+		// Blocks not in the buffer are unchanged from the input state
+		return 0, 0, err
+	}
+	shape := shapeOther
+	if c.Prefix().Codec == cid.DagCBOR {
+		var bitwidth int
+		shape, bitwidth = classifyBlock(blk.RawData())
+		if shape == shapeAMTRoot || shape == shapeEmptyAMT {
+			w.s.AMTRoots[bitwidth]++
+		}
+	}
+	w.shapes[c] = shape
+	w.countEmpty(shape)
+	blocks, size = 1, len(blk.RawData())
+	var links []cid.Cid
+	if err := linksForObj(blk, func(l cid.Cid) { links = append(links, l) }); err != nil {
+		return 0, 0, err
+	}
+	for _, l := range links {
+		b, n, err := w.walk(l)
+		if err != nil {
+			return 0, 0, err
+		}
+		blocks += b
+		size += n
+	}
+	return blocks, size, nil
+}
+
+func (w *summaryWalk) countEmpty(shape blockShape) {
+	switch shape {
+	case shapeEmptyHAMT:
+		w.s.EmptyHAMTs++
+	case shapeEmptyAMT:
+		w.s.EmptyAMTs++
+	}
+}
+
+// SummarizeMigration compares the actors of the migration input and output
+// states, which may be wrapped or bare, and attributes the new blocks the
+// migration wrote to the buffer to the actor types first reaching them.  It must
+// run before the buffer is discarded, but may run while it is flushed.
+func (c *Chain) SummarizeMigration(ctx context.Context, in, out cid.Cid) (*MigrationSummary, error) {
+	bs, err := c.loadBufferedBstore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store, err := c.LoadCborStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inInfo, err := InspectRoot(ctx, store, in)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load input state: %w", err)
+	}
+	outInfo, err := InspectRoot(ctx, store, out)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load output state: %w", err)
+	}
+	inTree, err := LoadActorsTree(ctx, store, inInfo.ActorsVersion, inInfo.Actors)
+	if err != nil {
+		return nil, err
+	}
+	outTree, err := LoadActorsTree(ctx, store, outInfo.ActorsVersion, outInfo.Actors)
+	if err != nil {
+		return nil, err
+	}
+	inName, err := ActorCodeNamer(ctx, store, inInfo)
+	if err != nil {
+		return nil, err
+	}
+	outName, err := ActorCodeNamer(ctx, store, outInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &MigrationSummary{
+		FromVersion: inInfo.ActorsVersion,
+		ToVersion:   outInfo.ActorsVersion,
+		Types:       make(map[string]*ActorTypeChanges),
+		AMTRoots:    make(map[int]int),
+	}
+	w := &summaryWalk{bs: bs, s: s, shapes: make(map[cid.Cid]blockShape)}
+	err = outTree.ForEach(func(addr address.Address, a *Actor) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tc := s.changes(outName(a.Code))
+		tc.Actors++
+		old, found, err := inTree.GetActor(addr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !found:
+			tc.Created++
+		case old.Head != a.Head:
+			tc.Rewritten++
+		case old.Code != a.Code:
+			tc.CodeOnly++
+		default:
+			tc.Unchanged++
+		}
+		blocks, size, err := w.walk(a.Head)
+		if err != nil {
+			return xerrors.Errorf("failed to walk state of actor %s: %w", addr, err)
+		}
+		tc.Blocks += blocks
+		tc.Bytes += size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = inTree.ForEach(func(addr address.Address, a *Actor) error {
+		_, found, err := outTree.GetActor(addr)
+		if err != nil || found {
+			return err
+		}
+		s.changes(inName(a.Code)).Removed++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Actor states are all visited so what remains is the tree itself
+	s.TreeBlocks, s.TreeBytes, err = w.walk(out)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to walk state tree: %w", err)
+	}
+	return s, nil
+}
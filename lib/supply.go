@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"context"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	market8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/market"
+	multisig8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/multisig"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// ReserveAddr is the address of the mining reserve multisig, f090.
+var ReserveAddr = func() address.Address {
+	a, err := address.NewIDAddress(90)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}()
+
+// InitialFilReserved is the balance the mining reserve started with.
+var InitialFilReserved = big.Mul(big.NewInt(300_000_000), big.NewInt(1e18))
+
+// SupplyEpoch is the total of actor balances, all FIL in existence, from Epoch on.
+type SupplyEpoch struct {
+	Epoch abi.ChainEpoch
+	Total abi.TokenAmount
+	Note  string
+}
+
+// SupplySchedules are the total supply of each network, oldest first.  Burnt
+// funds are held by the burnt funds actor and the undisbursed mining reserve by
+// f090, so neither changes the total; only FIL minted or destroyed outside of
+// actor balances does.
+var SupplySchedules = map[string][]SupplyEpoch{
+	"mainnet": {
+		{Epoch: 0, Total: builtin0.TotalFilecoin, Note: "genesis allocation of 2B FIL, 300M FIL of it held by the mining reserve"},
+	},
+}
+
+// ExpectedTotalSupply returns the total of actor balances expected in the state of
+// network at epoch.
+func ExpectedTotalSupply(network string, epoch abi.ChainEpoch) (SupplyEpoch, error) {
+	schedule, ok := SupplySchedules[network]
+	if !ok {
+		return SupplyEpoch{}, xerrors.Errorf("no supply schedule for network %s, pass the expected balance", network)
+	}
+	var expected SupplyEpoch
+	found := false
+	for _, se := range schedule {
+		if se.Epoch <= epoch {
+			expected, found = se, true
+		}
+	}
+	if !found {
+		return SupplyEpoch{}, xerrors.Errorf("%s supply schedule starts after epoch %d", network, epoch)
+	}
+	return expected, nil
+}
+
+// SupplyBreakdown holds the terms of the circulating supply calculation.
+type SupplyBreakdown struct {
+	// Vested is unlocked funds of vesting multisigs
+	Vested abi.TokenAmount
+	// Mined is the storage power reward paid out so far
+	Mined abi.TokenAmount
+	// ReserveDisbursed is funds paid out of the mining reserve
+	ReserveDisbursed abi.TokenAmount
+	// Burnt is the balance of the burnt funds actor
+	Burnt abi.TokenAmount
+	// Locked is market deal collateral and fees plus power pledge collateral
+	Locked abi.TokenAmount
+}
+
+// Circulating returns vested + mined + reserve disbursed - burnt - locked.
+func (s *SupplyBreakdown) Circulating() abi.TokenAmount {
+	cs := big.Sum(s.Vested, s.Mined, s.ReserveDisbursed)
+	cs = big.Sub(cs, s.Burnt)
+	cs = big.Sub(cs, s.Locked)
+	return big.Max(cs, big.Zero())
+}
+
+// EstimateCirculatingSupply follows the lotus circulating supply calculation over
+// the state at root at epoch height.  Lotus takes vesting from a table of genesis
+// multisig schedules, here every multisig with a vesting schedule counts, so the
+// result is an estimate close to but not exactly the value the VM sees.
+func EstimateCirculatingSupply(ctx context.Context, store cbornode.IpldStore, root cid.Cid, height abi.ChainEpoch) (*SupplyBreakdown, error) {
+	info, err := InspectRoot(ctx, store, root)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := LoadActorsTree(ctx, store, info.ActorsVersion, info.Actors)
+	if err != nil {
+		return nil, err
+	}
+	name, err := ActorCodeNamer(ctx, store, info)
+	if err != nil {
+		return nil, err
+	}
+	reward, _, err := LoadRewardState(ctx, store, root)
+	if err != nil {
+		return nil, err
+	}
+	power, _, err := LoadPowerState(ctx, store, root)
+	if err != nil {
+		return nil, err
+	}
+
+	supply := SupplyBreakdown{
+		Vested:           big.Zero(),
+		Mined:            reward.TotalStoragePowerReward,
+		ReserveDisbursed: big.Zero(),
+		Burnt:            big.Zero(),
+		Locked:           power.TotalPledgeCollateral,
+	}
+	err = tree.ForEach(func(addr address.Address, a *Actor) error {
+		switch {
+		case addr == ReserveAddr:
+			supply.ReserveDisbursed = big.Sub(InitialFilReserved, a.Balance)
+		case addr == builtin0.BurntFundsActorAddr:
+			supply.Burnt = a.Balance
+		case addr == builtin0.StorageMarketActorAddr:
+			// Market state layout is the same in all actors versions
+			var st market8.State
+			if err := store.Get(ctx, a.Head, &st); err != nil {
+				return xerrors.Errorf("failed to load market state: %w", err)
+			}
+			supply.Locked = big.Sum(supply.Locked, st.TotalClientLockedCollateral, st.TotalProviderLockedCollateral, st.TotalClientStorageFee)
+		case name(a.Code) == "multisig":
+			// Multisig state layout is the same in all actors versions
+			var st multisig8.State
+			if err := store.Get(ctx, a.Head, &st); err != nil {
+				return xerrors.Errorf("failed to load multisig %s state: %w", addr, err)
+			}
+			if st.UnlockDuration == 0 {
+				return nil
+			}
+			supply.Vested = big.Add(supply.Vested, big.Sub(st.InitialBalance, st.AmountLocked(height-st.StartEpoch)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &supply, nil
+}
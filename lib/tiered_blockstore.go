@@ -0,0 +1,234 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+// EntStoresPath is the store tiers config read by LoadStoresConfig if it exists.
+var EntStoresPath = "~/.ent/stores.json"
+
+// Stores configures the sources of chain blocks read in place of the lotus chain
+// store at ~/.lotus/datastore/chain, nil for that store alone.
+var Stores *StoresConfig
+
+// StoresConfig lists sources of chain blocks in the order they are read, e.g. an
+// NVMe copy of recent states, then an archive on slow disks, then a lotus node.
+type StoresConfig struct {
+	Tiers []StoreTier `json:"tiers"`
+}
+
+// StoreTier is a source of chain blocks, either a badger chain datastore
+// directory or a lotus node API.
+type StoreTier struct {
+	Name string `json:"name"`
+	// Path is a lotus badger chain datastore directory, like ~/.lotus/datastore/chain
+	Path string `json:"path,omitempty"`
+	// LotusAPI is the url of a lotus JSON-RPC API, like http://127.0.0.1:1234/rpc/v0,
+	// authorized with Token if set
+	LotusAPI string `json:"lotusApi,omitempty"`
+	Token    string `json:"token,omitempty"`
+	// Fill writes blocks read from later tiers to this one, so repeated runs read
+	// them from here.  Only datastore tiers can be filled.
+	Fill bool `json:"fill,omitempty"`
+}
+
+// LoadStoresConfig reads a json store tiers config of the form
+// {"tiers": [{"name": "nvme", "path": ..., "fill": true}, {"name": "node", "lotusApi": ...}]}
+// from path, or from EntStoresPath if path is "".  It returns nil if path is ""
+// and there is no file at EntStoresPath.
+func LoadStoresConfig(path string) (*StoresConfig, error) {
+	if path == "" {
+		defaultPath, err := homedir.Expand(EntStoresPath)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(defaultPath); os.IsNotExist(err) {
+			return nil, nil
+		}
+		path = defaultPath
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint:errcheck
+	var cfg StoresConfig
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, xerrors.Errorf("failed to parse stores config %s: %w", path, err)
+	}
+	if len(cfg.Tiers) == 0 {
+		return nil, xerrors.Errorf("stores config %s has no tiers", path)
+	}
+	for i, t := range cfg.Tiers {
+		if (t.Path == "") == (t.LotusAPI == "") {
+			return nil, xerrors.Errorf("store tier %d %q must have one of path and lotusApi", i, t.Name)
+		}
+		if t.Fill && t.Path == "" {
+			return nil, xerrors.Errorf("store tier %d %q: only datastore tiers can be filled", i, t.Name)
+		}
+		if t.Name == "" {
+			cfg.Tiers[i].Name = t.Path + t.LotusAPI
+		}
+	}
+	return &cfg, nil
+}
+
+// storeTierHits counts the reads each configured tier served, in tier order.
+var storeTierHits []uint64
+
+// StoreTierHits returns the number of reads each tier of Stores served.
+func StoreTierHits() []TierHits {
+	if Stores == nil {
+		return nil
+	}
+	hits := make([]TierHits, len(Stores.Tiers))
+	for i, t := range Stores.Tiers {
+		hits[i] = TierHits{Tier: t.Name, Hits: atomic.LoadUint64(&storeTierHits[i])}
+	}
+	return hits
+}
+
+// TieredBlockstore reads blocks from the first of its tiers holding them.  It is
+// read only, apart from filling tiers with blocks read from later ones.
+type TieredBlockstore struct {
+	blockstore.Blockstore
+	tiers []blockstore.Blockstore
+	fill  []bool
+}
+
+// NewTieredBlockstore opens the tiers of cfg.  Failed reads of each tier are
+// retried as configured by ReadRetry before moving on.
+func NewTieredBlockstore(cfg *StoresConfig) (*TieredBlockstore, error) {
+	tb := &TieredBlockstore{}
+	for _, t := range cfg.Tiers {
+		if t.LotusAPI != "" {
+			api := &lotusAPIBlockstore{api: NewLotusAPI(t.LotusAPI, t.Token)}
+			tb.tiers = append(tb.tiers, NewRetryBlockstore(api, ReadRetry))
+			tb.fill = append(tb.fill, false)
+			continue
+		}
+		path, err := homedir.Expand(t.Path)
+		if err != nil {
+			return nil, err
+		}
+		ds, err := chainBadgerDs(path)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to open store tier %q: %w", t.Name, err)
+		}
+		tb.tiers = append(tb.tiers, NewRetryBlockstore(blockstore.NewBlockstore(ds), ReadRetry))
+		tb.fill = append(tb.fill, t.Fill)
+	}
+	// Writes go to the first tier, though nothing but fills should write
+	tb.Blockstore = tb.tiers[0]
+	storeTierHits = make([]uint64, len(tb.tiers))
+	return tb, nil
+}
+
+func (tb *TieredBlockstore) Has(c cid.Cid) (bool, error) {
+	for _, t := range tb.tiers {
+		if has, err := t.Has(c); err != nil || has {
+			return has, err
+		}
+	}
+	return false, nil
+}
+
+func (tb *TieredBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	for i, t := range tb.tiers {
+		b, err := t.Get(c)
+		if err == blockstore.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddUint64(&storeTierHits[i], 1)
+		for j := 0; j < i; j++ {
+			if tb.fill[j] {
+				if err := tb.tiers[j].Put(b); err != nil {
+					return nil, xerrors.Errorf("failed to fill store tier %d: %w", j, err)
+				}
+			}
+		}
+		return b, nil
+	}
+	return nil, blockstore.ErrNotFound
+}
+
+func (tb *TieredBlockstore) GetSize(c cid.Cid) (int, error) {
+	for _, t := range tb.tiers {
+		s, err := t.GetSize(c)
+		if err == blockstore.ErrNotFound {
+			continue
+		}
+		return s, err
+	}
+	return 0, blockstore.ErrNotFound
+}
+
+func (tb *TieredBlockstore) HashOnRead(enabled bool) {
+	for _, t := range tb.tiers {
+		t.HashOnRead(enabled)
+	}
+}
+
+// lotusAPIBlockstore reads blocks from a lotus node through its API.
+type lotusAPIBlockstore struct {
+	api *LotusAPI
+}
+
+// notFound maps the lotus API error of a missing block to ErrNotFound.
+func notFound(err error) error {
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		return blockstore.ErrNotFound
+	}
+	return err
+}
+
+func (lb *lotusAPIBlockstore) Has(c cid.Cid) (bool, error) {
+	return lb.api.ChainHasObj(context.TODO(), c)
+}
+
+func (lb *lotusAPIBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	data, err := lb.api.ChainReadObj(context.TODO(), c)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
+
+func (lb *lotusAPIBlockstore) GetSize(c cid.Cid) (int, error) {
+	b, err := lb.Get(c)
+	if err != nil {
+		return 0, err
+	}
+	return len(b.RawData()), nil
+}
+
+func (lb *lotusAPIBlockstore) DeleteBlock(c cid.Cid) error {
+	return xerrors.Errorf("lotus API store can't delete blocks")
+}
+
+func (lb *lotusAPIBlockstore) Put(b blocks.Block) error {
+	return xerrors.Errorf("lotus API store can't put blocks")
+}
+
+func (lb *lotusAPIBlockstore) PutMany(bs []blocks.Block) error {
+	return xerrors.Errorf("lotus API store can't put blocks")
+}
+
+func (lb *lotusAPIBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	return nil, xerrors.Errorf("lotus API store can't list blocks")
+}
+
+func (lb *lotusAPIBlockstore) HashOnRead(enabled bool) {}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+
+	"github.com/filecoin-project/go-state-types/big"
+	"golang.org/x/xerrors"
+)
+
+// ToleranceRule accepts invariant check messages which are known and tolerated,
+// typically attoFIL rounding differences.
+type ToleranceRule struct {
+	// Name describes the known finding in reports
+	Name string `json:"name"`
+	// Pattern is a regular expression matched against accumulator messages.  If it
+	// has two or more capture groups the first two are the compared values.
+	Pattern string `json:"pattern"`
+	// Epsilon is the largest tolerated absolute difference of the compared values.
+	// Matching messages are always tolerated when the pattern captures no values.
+	Epsilon string `json:"epsilon"`
+
+	re      *regexp.Regexp
+	epsilon big.Int
+}
+
+// ToleranceConfig is the set of rules read from a tolerance config file.
+type ToleranceConfig struct {
+	Rules []*ToleranceRule `json:"rules"`
+}
+
+// LoadToleranceConfig reads a json tolerance config file of the form
+// {"rules": [{"name": ..., "pattern": ..., "epsilon": ...}]}.
+func LoadToleranceConfig(path string) (*ToleranceConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint:errcheck
+	var cfg ToleranceConfig
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, xerrors.Errorf("failed to parse tolerance config %s: %w", path, err)
+	}
+	for _, r := range cfg.Rules {
+		if r.re, err = regexp.Compile(r.Pattern); err != nil {
+			return nil, xerrors.Errorf("tolerance rule %q: %w", r.Name, err)
+		}
+		r.epsilon = big.Zero()
+		if r.Epsilon != "" {
+			if r.epsilon, err = big.FromString(r.Epsilon); err != nil {
+				return nil, xerrors.Errorf("tolerance rule %q epsilon: %w", r.Name, err)
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+// Match returns the first rule tolerating msg, or nil if msg is a new violation.
+// A nil config tolerates nothing.
+func (cfg *ToleranceConfig) Match(msg string) *ToleranceRule {
+	if cfg == nil {
+		return nil
+	}
+	for _, r := range cfg.Rules {
+		if r.tolerates(msg) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (r *ToleranceRule) tolerates(msg string) bool {
+	groups := r.re.FindStringSubmatch(msg)
+	if groups == nil {
+		return false
+	}
+	if len(groups) < 3 {
+		return true
+	}
+	a, err := big.FromString(groups[1])
+	if err != nil {
+		return false
+	}
+	b, err := big.FromString(groups[2])
+	if err != nil {
+		return false
+	}
+	return big.Sub(a, b).Abs().LessThanEqual(r.epsilon)
+}
@@ -0,0 +1,271 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"math/bits"
+
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	init8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/init"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// StructureParams is the layout of one HAMT or AMT of a state.
+type StructureParams struct {
+	// Name says where in the state the structure is
+	Name string
+	Type *StructureType
+	Root cid.Cid
+	// Bitwidth is recorded in AMT roots from actors v3 and follows from the
+	// bitmap length of earlier AMTs.  HAMTs record none so it is inferred from the
+	// highest bitfield bit set, a lower bound that small HAMTs may fall short of.
+	Bitwidth         int
+	BitwidthInferred bool
+	// Expected is the bitwidth of Type in the state's actors version
+	Expected int
+	Nodes    int
+	// Depth is the number of levels of nodes, 1 for a lone root node
+	Depth   int
+	Entries int
+}
+
+// Matches reports whether the bitwidth is as expected.  An inferred bitwidth
+// below the expected one matches while the HAMT is too small to tell: keys hash
+// uniformly, so with 8 entries per root slot every slot is taken but with
+// probability e^-8.
+func (p *StructureParams) Matches() bool {
+	if p.BitwidthInferred && p.Bitwidth < p.Expected {
+		return p.Entries < 8<<uint(p.Expected)
+	}
+	return p.Bitwidth == p.Expected
+}
+
+// bitwidthOf returns the smallest bitwidth whose bitfields hold bit index maxBit.
+func bitwidthOf(maxBit int) int {
+	if maxBit < 0 {
+		return 0
+	}
+	return bits.Len(uint(maxBit))
+}
+
+// inspectHAMT walks the nodes of the HAMT at root.  Nodes are read raw so any
+// HAMT format works: [bitfield, pointers] with pointers encoded as {"0": link} or
+// {"1": bucket} before actors v3 and as a bare link or bucket after.
+func inspectHAMT(ctx context.Context, store cbornode.IpldStore, root cid.Cid, p *StructureParams) error {
+	maxBit := -1
+	var walk func(c cid.Cid, depth int) error
+	walk = func(c cid.Cid, depth int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var node cbg.Deferred
+		if err := store.Get(ctx, c, &node); err != nil {
+			return err
+		}
+		p.Nodes++
+		if depth > p.Depth {
+			p.Depth = depth
+		}
+		r := bytes.NewReader(node.Raw)
+		if maj, n, err := cbg.CborReadHeader(r); err != nil || maj != cbg.MajArray || n != 2 {
+			return xerrors.Errorf("HAMT node %s is not a [bitfield, pointers] array", c)
+		}
+		bitfield, err := cbg.ReadByteArray(r, 1<<8)
+		if err != nil {
+			return xerrors.Errorf("HAMT node %s bitfield: %w", c, err)
+		}
+		// Bitfields are big endian big.Int bytes without leading zero bytes
+		if len(bitfield) > 0 && bitfield[0] != 0 {
+			if b := (len(bitfield)-1)*8 + bits.Len8(bitfield[0]) - 1; b > maxBit {
+				maxBit = b
+			}
+		}
+		maj, n, err := cbg.CborReadHeader(r)
+		if err != nil || maj != cbg.MajArray {
+			return xerrors.Errorf("HAMT node %s has no pointers array", c)
+		}
+		for i := uint64(0); i < n; i++ {
+			var ptr cbg.Deferred
+			if err := ptr.UnmarshalCBOR(r); err != nil {
+				return xerrors.Errorf("HAMT node %s pointer %d: %w", c, i, err)
+			}
+			raw := ptr.Raw
+			if len(raw) > 0 && raw[0]>>5 == cbg.MajMap {
+				// Unwrap the link or bucket of {"0": link} or {"1": bucket}
+				pr := bytes.NewReader(raw)
+				if _, _, err := cbg.CborReadHeader(pr); err != nil {
+					return err
+				}
+				if _, err := cbg.ReadString(pr); err != nil {
+					return err
+				}
+				raw = raw[len(raw)-pr.Len():]
+			}
+			maj, size, err := cbg.CborReadHeader(bytes.NewReader(raw))
+			if err != nil {
+				return err
+			}
+			switch maj {
+			case cbg.MajTag:
+				child, err := cbg.ReadCid(bytes.NewReader(raw))
+				if err != nil {
+					return xerrors.Errorf("HAMT node %s pointer %d link: %w", c, i, err)
+				}
+				if err := walk(child, depth+1); err != nil {
+					return err
+				}
+			case cbg.MajArray:
+				p.Entries += int(size)
+			default:
+				return xerrors.Errorf("HAMT node %s pointer %d is neither a link nor a bucket", c, i)
+			}
+		}
+		return nil
+	}
+	if err := walk(root, 1); err != nil {
+		return err
+	}
+	p.Bitwidth, p.BitwidthInferred = bitwidthOf(maxBit), true
+	return nil
+}
+
+// inspectAMT walks the nodes of the AMT at root, [bitwidth, height, count, node]
+// from actors v3 and [height, count, node] before.  Nodes are [bitmap, links,
+// values].
+func inspectAMT(ctx context.Context, store cbornode.IpldStore, root cid.Cid, p *StructureParams) error {
+	var raw cbg.Deferred
+	if err := store.Get(ctx, root, &raw); err != nil {
+		return err
+	}
+	r := bytes.NewReader(raw.Raw)
+	maj, n, err := cbg.CborReadHeader(r)
+	if err != nil || maj != cbg.MajArray || (n != 3 && n != 4) {
+		return xerrors.Errorf("AMT root %s is not an AMT root array", root)
+	}
+	var fields [3]uint64
+	for i := uint64(0); i < n-1; i++ {
+		maj, v, err := cbg.CborReadHeader(r)
+		if err != nil || maj != cbg.MajUnsignedInt {
+			return xerrors.Errorf("AMT root %s field %d is not an unsigned int", root, i)
+		}
+		fields[i] = v
+	}
+	if n == 4 {
+		p.Bitwidth = int(fields[0])
+	}
+	p.Depth = int(fields[n-3]) + 1
+	p.Entries = int(fields[n-2])
+
+	var walk func(r *bytes.Reader) error
+	walk = func(r *bytes.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p.Nodes++
+		if maj, n, err := cbg.CborReadHeader(r); err != nil || maj != cbg.MajArray || n != 3 {
+			return xerrors.Errorf("AMT node of %s is not a [bitmap, links, values] array", root)
+		}
+		bitmap, err := cbg.ReadByteArray(r, 1<<8)
+		if err != nil {
+			return err
+		}
+		if n == 3 && p.Nodes == 1 {
+			// Bitmaps have a bit per slot, 2^bitwidth
+			p.Bitwidth = bitwidthOf(len(bitmap)*8 - 1)
+		}
+		maj, links, err := cbg.CborReadHeader(r)
+		if err != nil || maj != cbg.MajArray {
+			return xerrors.Errorf("AMT node of %s has no links array", root)
+		}
+		for i := uint64(0); i < links; i++ {
+			child, err := cbg.ReadCid(r)
+			if err != nil {
+				return err
+			}
+			var node cbg.Deferred
+			if err := store.Get(ctx, child, &node); err != nil {
+				return err
+			}
+			if err := walk(bytes.NewReader(node.Raw)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(r)
+}
+
+// InspectStructure returns the layout of the HAMT or AMT of type t at root.
+func InspectStructure(ctx context.Context, store cbornode.IpldStore, actorsVersion int, name string, t *StructureType, root cid.Cid) (*StructureParams, error) {
+	p := &StructureParams{Name: name, Type: t, Root: root, Expected: t.Bitwidth(actorsVersion)}
+	inspect := inspectHAMT
+	if t.AMT {
+		inspect = inspectAMT
+	}
+	if err := inspect(ctx, store, root, p); err != nil {
+		return nil, xerrors.Errorf("failed to inspect %s %s: %w", name, root, err)
+	}
+	return p, nil
+}
+
+// TreeParams returns the layout of the actors HAMT of the state at root and of the
+// major structures of the singleton actors.
+func TreeParams(ctx context.Context, store cbornode.IpldStore, root cid.Cid) ([]*StructureParams, *RootInfo, error) {
+	info, err := InspectRoot(ctx, store, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	initActor, _, err := LoadStateActor(ctx, store, root, builtin0.InitActorAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Init state layout is the same in all actors versions
+	var initSt init8.State
+	if err := store.Get(ctx, initActor.Head, &initSt); err != nil {
+		return nil, nil, xerrors.Errorf("failed to load init state: %w", err)
+	}
+	power, _, err := LoadPowerState(ctx, store, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	market, _, err := LoadMarketState(ctx, store, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	verifreg, _, err := LoadVerifregState(ctx, store, root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	structures := []struct {
+		name string
+		typ  string
+		root cid.Cid
+	}{
+		{"actors", "actors-hamt", info.Actors},
+		{"init address map", "init-addresses-hamt", initSt.AddressMap},
+		{"power claims", "power-claims-hamt", power.Claims},
+		{"market proposals", "market-proposals-amt", market.Proposals},
+		{"market states", "market-states-amt", market.States},
+		{"market escrow table", "market-balances-hamt", market.EscrowTable},
+		{"market locked table", "market-balances-hamt", market.LockedTable},
+		{"verifreg verifiers", "verifreg-datacap-hamt", verifreg.Verifiers},
+		{"verifreg verified clients", "verifreg-datacap-hamt", verifreg.VerifiedClients},
+	}
+	var params []*StructureParams
+	for _, s := range structures {
+		t, ok := LookupStructureType(s.typ)
+		if !ok {
+			return nil, nil, xerrors.Errorf("unknown structure type %s", s.typ)
+		}
+		p, err := InspectStructure(ctx, store, info.ActorsVersion, s.name, t, s.root)
+		if err != nil {
+			return nil, nil, err
+		}
+		params = append(params, p)
+	}
+	return params, info, nil
+}
@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"context"
+	"hash/fnv"
+
+	address "github.com/filecoin-project/go-address"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	states0 "github.com/filecoin-project/specs-actors/actors/states"
+	adt0 "github.com/filecoin-project/specs-actors/actors/util/adt"
+	states2 "github.com/filecoin-project/specs-actors/v2/actors/states"
+	adt2 "github.com/filecoin-project/specs-actors/v2/actors/util/adt"
+	states3 "github.com/filecoin-project/specs-actors/v3/actors/states"
+	adt3 "github.com/filecoin-project/specs-actors/v3/actors/util/adt"
+	states4 "github.com/filecoin-project/specs-actors/v4/actors/states"
+	adt4 "github.com/filecoin-project/specs-actors/v4/actors/util/adt"
+	states5 "github.com/filecoin-project/specs-actors/v5/actors/states"
+	adt5 "github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	states6 "github.com/filecoin-project/specs-actors/v6/actors/states"
+	adt6 "github.com/filecoin-project/specs-actors/v6/actors/util/adt"
+	states7 "github.com/filecoin-project/specs-actors/v7/actors/states"
+	adt7 "github.com/filecoin-project/specs-actors/v7/actors/util/adt"
+	states8 "github.com/filecoin-project/specs-actors/v8/actors/states"
+	adt8 "github.com/filecoin-project/specs-actors/v8/actors/util/adt"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// Actor is the actor record of the state tree.  All specs-actors versions use the
+// v0 record so trees can be handled uniformly.
+type Actor = states0.Actor
+
+// ActorsTree is the method set shared by the state tree types of every specs-actors
+// version.
+type ActorsTree interface {
+	GetActor(addr address.Address) (*Actor, bool, error)
+	SetActor(addr address.Address, actor *Actor) error
+	ForEach(fn func(addr address.Address, actor *Actor) error) error
+	Flush() (cid.Cid, error)
+}
+
+// SingletonActorAddrs are the addresses of the builtin singleton actors.  Migrations
+// of other actors may read these so they are kept in any partial tree.
+var SingletonActorAddrs = []address.Address{
+	builtin0.SystemActorAddr,
+	builtin0.InitActorAddr,
+	builtin0.RewardActorAddr,
+	builtin0.CronActorAddr,
+	builtin0.StoragePowerActorAddr,
+	builtin0.StorageMarketActorAddr,
+	builtin0.VerifiedRegistryActorAddr,
+	builtin0.BurntFundsActorAddr,
+}
+
+// LoadActorsTree loads the (unwrapped) actors HAMT at root using the tree layout of
+// the given specs-actors version.
+func LoadActorsTree(ctx context.Context, store cbornode.IpldStore, actorsVersion int, root cid.Cid) (ActorsTree, error) {
+	switch actorsVersion {
+	case 0, 1:
+		return states0.LoadTree(adt0.WrapStore(ctx, store), root)
+	case 2:
+		return states2.LoadTree(adt2.WrapStore(ctx, store), root)
+	case 3:
+		return states3.LoadTree(adt3.WrapStore(ctx, store), root)
+	case 4:
+		return states4.LoadTree(adt4.WrapStore(ctx, store), root)
+	case 5:
+		return states5.LoadTree(adt5.WrapStore(ctx, store), root)
+	case 6:
+		return states6.LoadTree(adt6.WrapStore(ctx, store), root)
+	case 7:
+		return states7.LoadTree(adt7.WrapStore(ctx, store), root)
+	case 8:
+		return states8.LoadTree(adt8.WrapStore(ctx, store), root)
+	default:
+		return nil, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+}
+
+// NewActorsTree creates an empty actors tree using the layout of the given
+// specs-actors version.
+func NewActorsTree(ctx context.Context, store cbornode.IpldStore, actorsVersion int) (ActorsTree, error) {
+	switch actorsVersion {
+	case 0, 1:
+		return states0.NewTree(adt0.WrapStore(ctx, store))
+	case 2:
+		return states2.NewTree(adt2.WrapStore(ctx, store))
+	case 3:
+		return states3.NewTree(adt3.WrapStore(ctx, store))
+	case 4:
+		return states4.NewTree(adt4.WrapStore(ctx, store))
+	case 5:
+		return states5.NewTree(adt5.WrapStore(ctx, store))
+	case 6:
+		return states6.NewTree(adt6.WrapStore(ctx, store))
+	case 7:
+		return states7.NewTree(adt7.WrapStore(ctx, store))
+	case 8:
+		return states8.NewTree(adt8.WrapStore(ctx, store))
+	default:
+		return nil, xerrors.Errorf("unsupported actors version %d", actorsVersion)
+	}
+}
+
+// SubsetActorsTree writes a new actors tree holding only the actors of the tree at
+// root for which keep returns true.  Actor heads are shared with the input tree so
+// this is cheap even for large miners.  It returns the root of the new tree and the
+// number of actors kept.
+func SubsetActorsTree(ctx context.Context, store cbornode.IpldStore, actorsVersion int, root cid.Cid, keep func(addr address.Address, a *Actor) bool) (cid.Cid, int, error) {
+	return RewriteActorsTree(ctx, store, actorsVersion, root, keep)
+}
+
+// RewriteActorsTree writes a new actors tree from the tree at root passing a copy
+// of every actor record to fn.  The record, including any changes fn makes to it,
+// is written to the new tree if fn returns true.
+func RewriteActorsTree(ctx context.Context, store cbornode.IpldStore, actorsVersion int, root cid.Cid, fn func(addr address.Address, a *Actor) bool) (cid.Cid, int, error) {
+	in, err := LoadActorsTree(ctx, store, actorsVersion, root)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	out, err := NewActorsTree(ctx, store, actorsVersion)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	kept := 0
+	err = in.ForEach(func(addr address.Address, a *Actor) error {
+		actor := *a // ForEach reuses its actor pointer
+		if !fn(addr, &actor) {
+			return nil
+		}
+		kept++
+		return out.SetActor(addr, &actor)
+	})
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	newRoot, err := out.Flush()
+	return newRoot, kept, err
+}
+
+// InSample deterministically decides whether addr belongs to a sample covering
+// roughly fraction of all addresses.  The same address is always in or out of a
+// sample of a given size so sampled runs are comparable across builds.
+func InSample(addr address.Address, fraction float64) bool {
+	h := fnv.New64a()
+	_, _ = h.Write(addr.Bytes())
+	return float64(h.Sum64()%1000000) < fraction*1000000
+}
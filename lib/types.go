@@ -9,6 +9,7 @@ import (
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/go-state-types/exitcode"
 	proof2 "github.com/filecoin-project/specs-actors/v2/actors/runtime/proof"
 	cid "github.com/ipfs/go-cid"
 )
@@ -76,6 +77,45 @@ func DecodeBlock(b []byte) (*BlockHeader, error) {
 	return &blk, nil
 }
 
+// From lotus/chain/types/message.go, signedmessage.go and blockmsg.go
+
+type Message struct {
+	Version uint64
+
+	To   address.Address
+	From address.Address
+
+	Nonce uint64
+
+	Value abi.TokenAmount
+
+	GasLimit   int64
+	GasFeeCap  abi.TokenAmount
+	GasPremium abi.TokenAmount
+
+	Method abi.MethodNum
+	Params []byte
+}
+
+type SignedMessage struct {
+	Message   Message
+	Signature crypto.Signature
+}
+
+// MsgMeta is the root of the message AMTs of a block
+type MsgMeta struct {
+	BlsMessages   cid.Cid
+	SecpkMessages cid.Cid
+}
+
+// From lotus/chain/types/message_receipt.go
+
+type MessageReceipt struct {
+	ExitCode exitcode.ExitCode
+	Return   []byte
+	GasUsed  int64
+}
+
 // From lotus/chain/types/state.go
 
 // StateTreeVersion is the version of the state tree itself, independent of the
@@ -85,8 +125,17 @@ type StateTreeVersion uint64
 const (
 	// StateTreeVersion0 corresponds to actors < v2.
 	StateTreeVersion0 StateTreeVersion = iota
-	// StateTreeVersion1 corresponds to actors >= v2.
+	// StateTreeVersion1 corresponds to actors v2.
 	StateTreeVersion1
+	// StateTreeVersion2 corresponds to actors v3.
+	StateTreeVersion2
+	// StateTreeVersion3 corresponds to actors v4.
+	StateTreeVersion3
+	// StateTreeVersion4 corresponds to actors v5 through v9, including v8, the
+	// first bundle installed actors.
+	StateTreeVersion4
+	// StateTreeVersion5 corresponds to actors v10 and later.
+	StateTreeVersion5
 )
 
 type StateRoot struct {
@@ -97,3 +146,6 @@ type StateRoot struct {
 	// Info. The structure depends on the state root version.
 	Info cid.Cid
 }
+
+// TODO: version this.
+type StateInfo0 struct{}
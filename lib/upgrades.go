@@ -0,0 +1,84 @@
+package lib
+
+import "github.com/filecoin-project/go-state-types/abi"
+
+// Upgrade is a mainnet network upgrade.
+type Upgrade struct {
+	Name           string
+	Height         abi.ChainEpoch
+	NetworkVersion int
+	// ActorsVersion is the actors version in effect after the upgrade
+	ActorsVersion int
+}
+
+// GenesisActorsVersion is the actors version of mainnet before actors v2.  Those
+// actors carry fil/1/ code CIDs, so InspectRoot reports their states as v1.
+const GenesisActorsVersion = 1
+
+// MainnetNetworkUpgrades are the mainnet network upgrades, oldest first.  Refuel,
+// Liftoff and Claus ran at heights of their own without a new network version.
+var MainnetNetworkUpgrades = []Upgrade{
+	{Name: "Breeze", Height: 41280, NetworkVersion: 1, ActorsVersion: GenesisActorsVersion},
+	{Name: "Smoke", Height: 51000, NetworkVersion: 2, ActorsVersion: GenesisActorsVersion},
+	{Name: "Ignition", Height: 94000, NetworkVersion: 3, ActorsVersion: GenesisActorsVersion},
+	{Name: "Refuel", Height: 130800, NetworkVersion: 3, ActorsVersion: GenesisActorsVersion},
+	{Name: "ActorsV2", Height: 138720, NetworkVersion: 4, ActorsVersion: 2},
+	{Name: "Tape", Height: 140760, NetworkVersion: 5, ActorsVersion: 2},
+	{Name: "Liftoff", Height: 148888, NetworkVersion: 5, ActorsVersion: 2},
+	{Name: "Kumquat", Height: 170000, NetworkVersion: 6, ActorsVersion: 2},
+	{Name: "Calico", Height: 265200, NetworkVersion: 7, ActorsVersion: 2},
+	{Name: "Persian", Height: 272400, NetworkVersion: 8, ActorsVersion: 2},
+	{Name: "Orange", Height: 336458, NetworkVersion: 9, ActorsVersion: 2},
+	{Name: "Claus", Height: 343200, NetworkVersion: 9, ActorsVersion: 2},
+	{Name: "Trust", Height: 550321, NetworkVersion: 10, ActorsVersion: 3},
+	{Name: "Norwegian", Height: 665280, NetworkVersion: 11, ActorsVersion: 3},
+	{Name: "Turbo", Height: 712320, NetworkVersion: 12, ActorsVersion: 4},
+	{Name: "Hyperdrive", Height: 892800, NetworkVersion: 13, ActorsVersion: 5},
+	{Name: "Chocolate", Height: 1231620, NetworkVersion: 14, ActorsVersion: 6},
+	{Name: "OhSnap", Height: 1594680, NetworkVersion: 15, ActorsVersion: 7},
+	{Name: "Skyr", Height: 1960320, NetworkVersion: 16, ActorsVersion: 8},
+}
+
+// MainnetUpgrades are the mainnet upgrades installing new actors, oldest first.
+var MainnetUpgrades = actorsUpgrades(MainnetNetworkUpgrades)
+
+// actorsUpgrades returns the upgrades of upgrades changing the actors version.
+func actorsUpgrades(upgrades []Upgrade) []Upgrade {
+	var out []Upgrade
+	v := GenesisActorsVersion
+	for _, u := range upgrades {
+		if u.ActorsVersion != v {
+			out = append(out, u)
+			v = u.ActorsVersion
+		}
+	}
+	return out
+}
+
+// ExpectedActorsVersion returns the actors version of the parent state root of a
+// mainnet block at height.  Upgrades run while computing the state for the first
+// block after the upgrade height, so a block's parent state includes every
+// upgrade before its own height.
+func ExpectedActorsVersion(height abi.ChainEpoch) int {
+	v := GenesisActorsVersion
+	for _, u := range MainnetUpgrades {
+		if u.Height < height {
+			v = u.ActorsVersion
+		}
+	}
+	return v
+}
+
+// MainnetUpgradesBetween returns the mainnet upgrades run while computing the
+// state at epoch to from the state at epoch from, those at heights from up to but
+// excluding to.  Upgrades run before the messages of the first tipset above their
+// height, on the state of its parent tipset.
+func MainnetUpgradesBetween(from, to abi.ChainEpoch) []Upgrade {
+	var out []Upgrade
+	for _, u := range MainnetNetworkUpgrades {
+		if u.Height >= from && u.Height < to {
+			out = append(out, u)
+		}
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"context"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	verifreg0 "github.com/filecoin-project/specs-actors/actors/builtin/verifreg"
+	adt0 "github.com/filecoin-project/specs-actors/actors/util/adt"
+	adt2 "github.com/filecoin-project/specs-actors/v2/actors/util/adt"
+	builtin8 "github.com/filecoin-project/specs-actors/v8/actors/builtin"
+	verifreg8 "github.com/filecoin-project/specs-actors/v8/actors/builtin/verifreg"
+	adt8 "github.com/filecoin-project/specs-actors/v8/actors/util/adt"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+)
+
+// LoadVerifregState loads the verified registry actor state of the state tree at
+// root as v8 state.  Before actors v7 the state has no RemoveDataCapProposalIDs,
+// it is left undefined.  The HAMT layouts differ between versions, read the
+// DataCap tables with ForEachDataCap.
+func LoadVerifregState(ctx context.Context, store cbornode.IpldStore, root cid.Cid) (*verifreg8.State, *RootInfo, error) {
+	a, info, err := LoadStateActor(ctx, store, root, builtin0.VerifiedRegistryActorAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	st, err := loadVerifregState(ctx, store, info.ActorsVersion, a.Head)
+	if err != nil {
+		return nil, nil, err
+	}
+	return st, info, nil
+}
+
+// loadVerifregState loads the verified registry actor state at head as v8 state.
+func loadVerifregState(ctx context.Context, store cbornode.IpldStore, actorsVersion int, head cid.Cid) (*verifreg8.State, error) {
+	if actorsVersion >= 7 {
+		var st verifreg8.State
+		if err := store.Get(ctx, head, &st); err != nil {
+			return nil, err
+		}
+		return &st, nil
+	}
+	var st0 verifreg0.State
+	if err := store.Get(ctx, head, &st0); err != nil {
+		return nil, err
+	}
+	return &verifreg8.State{
+		RootKey:         st0.RootKey,
+		Verifiers:       st0.Verifiers,
+		VerifiedClients: st0.VerifiedClients,
+	}, nil
+}
+
+// ForEachDataCap calls fn with every entry of a verified registry DataCap HAMT,
+// the Verifiers or the VerifiedClients of the state.
+func ForEachDataCap(ctx context.Context, store cbornode.IpldStore, actorsVersion int, root cid.Cid, fn func(addr address.Address, dcap abi.StoragePower) error) error {
+	var dcap abi.StoragePower
+	each := func(k string) error {
+		addr, err := address.NewFromBytes([]byte(k))
+		if err != nil {
+			return err
+		}
+		return fn(addr, dcap)
+	}
+	switch {
+	case actorsVersion <= 1:
+		m, err := adt0.AsMap(adt0.WrapStore(ctx, store), root)
+		if err != nil {
+			return err
+		}
+		return m.ForEach(&dcap, each)
+	case actorsVersion == 2:
+		m, err := adt2.AsMap(adt2.WrapStore(ctx, store), root)
+		if err != nil {
+			return err
+		}
+		return m.ForEach(&dcap, each)
+	default:
+		m, err := adt8.AsMap(adt8.WrapStore(ctx, store), root, builtin8.DefaultHamtBitwidth)
+		if err != nil {
+			return err
+		}
+		return m.ForEach(&dcap, each)
+	}
+}
@@ -0,0 +1,220 @@
+// Package migrate runs filecoin state tree migrations, with the migration caches
+// ent persists between runs.  It is the migration orchestration of the ent
+// command, importable by tools which would otherwise shell out to it.  Its API
+// follows semantic versioning with the ent module.  The lib types in its
+// signatures, lib.MigrationLogger, lib.CacheStats and lib.CountingCache, are part
+// of that API and change only with a major version too.
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	migration7 "github.com/filecoin-project/specs-actors/v2/actors/migration/nv7"
+	migration10 "github.com/filecoin-project/specs-actors/v3/actors/migration/nv10"
+	migration12 "github.com/filecoin-project/specs-actors/v4/actors/migration/nv12"
+	migration13 "github.com/filecoin-project/specs-actors/v5/actors/migration/nv13"
+	migration14 "github.com/filecoin-project/specs-actors/v6/actors/migration/nv14"
+	migration15 "github.com/filecoin-project/specs-actors/v7/actors/migration/nv15"
+	migration16 "github.com/filecoin-project/specs-actors/v8/actors/migration/nv16"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+
+	"github.com/filecoin-project/ent/lib"
+)
+
+// ActorsVersion is a specs-actors major version.
+type ActorsVersion int
+
+const (
+	V2 ActorsVersion = iota + 2
+	V3
+	V4
+	V5
+	V6
+	V7
+	V8
+)
+
+// Options carries per run inputs that only some migrations use.
+type Options struct {
+	// ReadCache is the input state root of a persisted migration cache to start from
+	ReadCache string
+	// Manifest is the CID of the actors bundle manifest to install
+	Manifest cid.Cid
+	// ProgressLogPeriod is how often migrations log job progress
+	ProgressLogPeriod time.Duration
+	// CacheStats counts migration cache hits and misses, if set
+	CacheStats *lib.CacheStats
+	// OnCheckpoint is given a callback persisting the migration cache while the
+	// migration runs, if set
+	OnCheckpoint func(checkpoint func() error)
+}
+
+// DefaultProgressLogPeriod is how often migrations log job progress by default.
+const DefaultProgressLogPeriod = 5 * time.Minute
+
+// Func migrates the state tree at stateRootIn, the actors tree of the state at
+// height, and returns the migrated actors tree, the time the migration took and a
+// callback persisting the migration cache to lib.EntCachePath.  The callback is
+// returned on failure too, to checkpoint the progress made.
+type Func func(ctx context.Context, stateRootIn cid.Cid, opts Options, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error)
+
+// Spec describes a supported migration into actors version To.
+type Spec struct {
+	To             ActorsVersion
+	NetworkVersion int
+	Migrate        Func
+	// Cached is true when the migration supports reading and writing migration caches
+	Cached bool
+	// Bundle is true when the migration installs actor code from a builtin-actors
+	// bundle, whose manifest must be set in Options
+	Bundle bool
+}
+
+// Registry lists supported migrations, newest first.
+var Registry = []Spec{
+	{To: V8, NetworkVersion: 16, Migrate: migrateV7ToV8, Cached: true, Bundle: true},
+	{To: V7, NetworkVersion: 15, Migrate: migrateV6ToV7, Cached: true},
+	{To: V6, NetworkVersion: 14, Migrate: migrateV5ToV6, Cached: true},
+	{To: V5, NetworkVersion: 13, Migrate: migrateV4ToV5, Cached: true},
+	{To: V4, NetworkVersion: 12, Migrate: migrateV3ToV4, Cached: true},
+	{To: V3, NetworkVersion: 10, Migrate: migrateV2ToV3, Cached: true},
+	{To: V2, NetworkVersion: 4, Migrate: migrateV1ToV2},
+}
+
+// Latest is the newest actors version ent can migrate to.
+var Latest = Registry[0].To
+
+// Lookup returns the migration into actors version v.
+func Lookup(v ActorsVersion) (Spec, bool) {
+	for _, spec := range Registry {
+		if spec.To == v {
+			return spec, true
+		}
+	}
+	return Spec{}, false
+}
+
+/*
+	Versioned migration functions
+*/
+
+func migrateV1ToV2(ctx context.Context, stateRootIn cid.Cid, opts Options, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
+	start := time.Now()
+	stateRootOut, err := migration7.MigrateStateTree(ctx, store, stateRootIn, height, migration7.DefaultConfig())
+	duration := time.Since(start)
+	cacheWriteCallback := func() error { return nil }
+	return stateRootOut, duration, cacheWriteCallback, err
+}
+
+func migrateV2ToV3(ctx context.Context, stateRootIn cid.Cid, opts Options, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
+	cfg := migration10.Config{
+		MaxWorkers:        8,
+		JobQueueSize:      1000,
+		ResultQueueSize:   100,
+		ProgressLogPeriod: opts.ProgressLogPeriod,
+	}
+	return WithCache(stateRootIn, opts, func(cache *lib.CountingCache) (cid.Cid, error) {
+		return migration10.MigrateStateTree(ctx, store, stateRootIn, height, cfg, log, cache)
+	})
+}
+
+func migrateV3ToV4(ctx context.Context, stateRootIn cid.Cid, opts Options, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
+	cfg := migration12.Config{
+		MaxWorkers:        8,
+		JobQueueSize:      1000,
+		ResultQueueSize:   100,
+		ProgressLogPeriod: opts.ProgressLogPeriod,
+	}
+	return WithCache(stateRootIn, opts, func(cache *lib.CountingCache) (cid.Cid, error) {
+		return migration12.MigrateStateTree(ctx, store, stateRootIn, height, cfg, log, cache)
+	})
+}
+
+func migrateV4ToV5(ctx context.Context, stateRootIn cid.Cid, opts Options, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
+	cfg := migration13.Config{
+		MaxWorkers:        8,
+		JobQueueSize:      1000,
+		ResultQueueSize:   100,
+		ProgressLogPeriod: opts.ProgressLogPeriod,
+	}
+	return WithCache(stateRootIn, opts, func(cache *lib.CountingCache) (cid.Cid, error) {
+		return migration13.MigrateStateTree(ctx, store, stateRootIn, height, cfg, log, cache)
+	})
+}
+
+func migrateV5ToV6(ctx context.Context, stateRootIn cid.Cid, opts Options, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
+	cfg := migration14.Config{
+		MaxWorkers:        8,
+		JobQueueSize:      1000,
+		ResultQueueSize:   100,
+		ProgressLogPeriod: opts.ProgressLogPeriod,
+	}
+	return WithCache(stateRootIn, opts, func(cache *lib.CountingCache) (cid.Cid, error) {
+		return migration14.MigrateStateTree(ctx, store, stateRootIn, height, cfg, log, cache)
+	})
+}
+
+func migrateV6ToV7(ctx context.Context, stateRootIn cid.Cid, opts Options, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
+	cfg := migration15.Config{
+		MaxWorkers:        8,
+		JobQueueSize:      1000,
+		ResultQueueSize:   100,
+		ProgressLogPeriod: opts.ProgressLogPeriod,
+	}
+	return WithCache(stateRootIn, opts, func(cache *lib.CountingCache) (cid.Cid, error) {
+		return migration15.MigrateStateTree(ctx, store, stateRootIn, height, cfg, log, cache)
+	})
+}
+
+func migrateV7ToV8(ctx context.Context, stateRootIn cid.Cid, opts Options, store cbornode.IpldStore, height abi.ChainEpoch, log *lib.MigrationLogger) (cid.Cid, time.Duration, func() error, error) {
+	cfg := migration16.Config{
+		MaxWorkers:        8,
+		JobQueueSize:      1000,
+		ResultQueueSize:   100,
+		ProgressLogPeriod: opts.ProgressLogPeriod,
+	}
+	return WithCache(stateRootIn, opts, func(cache *lib.CountingCache) (cid.Cid, error) {
+		return migration16.MigrateStateTree(ctx, store, opts.Manifest, stateRootIn, height, cfg, log, cache)
+	})
+}
+
+// WithCache runs a migration with a migration cache, optionally read from disk,
+// and returns a callback persisting the cache after the migration, or after the
+// migration fails to checkpoint its progress.  The cache type is shared by all
+// migrations since nv10.
+func WithCache(stateRootIn cid.Cid, opts Options, migrate func(*lib.CountingCache) (cid.Cid, error)) (cid.Cid, time.Duration, func() error, error) {
+	cacheRootStr := opts.ReadCache
+	cache := migration10.NewMemMigrationCache()
+	if cacheRootStr != "" {
+		cacheStateRoot, err := cid.Decode(cacheRootStr)
+		if err != nil {
+			return cid.Undef, time.Duration(0), nil, err
+		}
+		cache, err = lib.LoadCache(cacheStateRoot)
+		if err != nil {
+			return cid.Undef, time.Duration(0), nil, err
+		}
+	}
+
+	cacheWriteCallback := func() error {
+		return lib.PersistCache(stateRootIn, cache)
+	}
+	if opts.OnCheckpoint != nil {
+		opts.OnCheckpoint(cacheWriteCallback)
+	}
+	stats := opts.CacheStats
+	if stats == nil {
+		stats = &lib.CacheStats{}
+	}
+	start := time.Now()
+	stateRootOut, err := migrate(lib.NewCountingCache(cache, stats))
+	if err != nil {
+		// The callback still persists the partial cache as a checkpoint
+		return cid.Undef, time.Duration(0), cacheWriteCallback, err
+	}
+	duration := time.Since(start)
+	return stateRootOut, duration, cacheWriteCallback, nil
+}
@@ -0,0 +1,108 @@
+// Package store opens the chain blockstores ent works on: states are read from
+// the lotus chain store at ~/.lotus/datastore/chain, or configured store tiers,
+// and migrated states are buffered in memory and flushed to ~/.ent.  Its API
+// follows semantic versioning with the ent module.
+package store
+
+import (
+	"context"
+
+	cbornode "github.com/ipfs/go-ipld-cbor"
+
+	"github.com/filecoin-project/ent/lib"
+)
+
+// Chain is the buffered chain blockstore.  Blocks written to it stay in memory
+// until flushed with FlushBufferedState.
+type Chain = lib.Chain
+
+// RetryConfig controls retrying failed reads of the lotus chain store.
+type RetryConfig = lib.RetryConfig
+
+// StoresConfig lists sources of chain blocks in the order they are read.
+type StoresConfig = lib.StoresConfig
+
+// StoreTier is a source of chain blocks.
+type StoreTier = lib.StoreTier
+
+// RetryStats counts retried reads.
+type RetryStats = lib.RetryStats
+
+// TierHits is the number of reads a store tier served.
+type TierHits = lib.TierHits
+
+// DefaultRetryBackoff is the delay before the first retry of a failed read
+// unless Options set another.
+var DefaultRetryBackoff = lib.ReadRetry.Backoff
+
+// Options configures the chain stores.  The zero value reads the lotus chain
+// store without retries, buffers writes in memory without a cap and writes
+// uncompressed blocks at full speed.
+type Options struct {
+	Retry RetryConfig
+	// BufferMaxBytes caps the in memory write buffer, spilling to disk past it
+	BufferMaxBytes int64
+	// Compress zstd compresses blocks written to ~/.ent
+	Compress bool
+	// IOLimit caps writes to ~/.ent in bytes per second
+	IOLimit int64
+	// Background slows writes to ~/.ent down while the machine is busy
+	Background bool
+	// PrefetchWorkers read blocks linked from each block read ahead of tree walks
+	PrefetchWorkers int
+	// Stores replaces the lotus chain store with these tiers if set
+	Stores *StoresConfig
+}
+
+// LoadStoresConfig reads a json store tiers config from path, or from
+// ~/.ent/stores.json if path is "", returning nil if that does not exist.
+func LoadStoresConfig(path string) (*StoresConfig, error) {
+	return lib.LoadStoresConfig(path)
+}
+
+// Configure applies opts to the chain stores of the process.  Chains opened
+// afterwards, by Open or as zero Chain values, use them.
+func Configure(opts Options) {
+	if opts.Retry.Attempts == 0 {
+		opts.Retry = RetryConfig{Attempts: 1, Backoff: DefaultRetryBackoff, Context: opts.Retry.Context}
+	}
+	lib.ReadRetry = opts.Retry
+	lib.BufferMaxBytes = opts.BufferMaxBytes
+	lib.Compress = opts.Compress
+	lib.IOLimit = opts.IOLimit
+	lib.Background = opts.Background
+	lib.PrefetchWorkers = opts.PrefetchWorkers
+	lib.Stores = opts.Stores
+}
+
+// AddTier adds t as the last of the configured store tiers.  Without tiers
+// configured t becomes the only source of chain blocks in place of the lotus
+// chain store.
+func AddTier(t StoreTier) {
+	if lib.Stores == nil {
+		lib.Stores = &StoresConfig{}
+	}
+	lib.Stores.Tiers = append(lib.Stores.Tiers, t)
+}
+
+// ReadRetryStats returns the counts of retried reads so far.
+func ReadRetryStats() RetryStats {
+	return lib.ReadRetryStats()
+}
+
+// StoreTierHits returns the number of reads each configured tier served.
+func StoreTierHits() []TierHits {
+	return lib.StoreTierHits()
+}
+
+// Open configures the chain stores with opts and returns the chain with a cbor
+// store over it.  Options apply to the whole process, so open the chain once.
+func Open(ctx context.Context, opts Options) (*Chain, cbornode.IpldStore, error) {
+	Configure(opts)
+	chn := &Chain{}
+	store, err := chn.LoadCborStore(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chn, store, nil
+}
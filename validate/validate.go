@@ -0,0 +1,150 @@
+// Package validate checks the invariants specs-actors defines for a state tree of
+// each actors version ent can migrate to.  Its API follows semantic versioning
+// with the ent module.
+package validate
+
+import (
+	"context"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	adt0 "github.com/filecoin-project/specs-actors/actors/util/adt"
+	states2 "github.com/filecoin-project/specs-actors/v2/actors/states"
+	states3 "github.com/filecoin-project/specs-actors/v3/actors/states"
+	adt3 "github.com/filecoin-project/specs-actors/v3/actors/util/adt"
+	states4 "github.com/filecoin-project/specs-actors/v4/actors/states"
+	adt4 "github.com/filecoin-project/specs-actors/v4/actors/util/adt"
+	states5 "github.com/filecoin-project/specs-actors/v5/actors/states"
+	adt5 "github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	states6 "github.com/filecoin-project/specs-actors/v6/actors/states"
+	adt6 "github.com/filecoin-project/specs-actors/v6/actors/util/adt"
+	states7 "github.com/filecoin-project/specs-actors/v7/actors/states"
+	adt7 "github.com/filecoin-project/specs-actors/v7/actors/util/adt"
+	states8 "github.com/filecoin-project/specs-actors/v8/actors/states"
+	adt8 "github.com/filecoin-project/specs-actors/v8/actors/util/adt"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/ent/lib"
+)
+
+// MessageAccumulator is the method set shared by the invariant check accumulators
+// of every specs-actors version.
+type MessageAccumulator interface {
+	IsEmpty() bool
+	Messages() []string
+}
+
+// Func checks the invariants of the actors tree at actorsRoot, a bare tree rather
+// than a wrapped state root, holding expectedBalance in total at priorEpoch.
+type Func func(ctx context.Context, store cbornode.IpldStore, actorsRoot cid.Cid, expectedBalance abi.TokenAmount, priorEpoch abi.ChainEpoch) (MessageAccumulator, error)
+
+// Registry holds the invariant checks of each actors version.
+var Registry = map[int]Func{
+	8: validateV8,
+	7: validateV7,
+	6: validateV6,
+	5: validateV5,
+	4: validateV4,
+	3: validateV3,
+	2: validateV2,
+}
+
+// CheckInvariants checks the invariants of the state at stateRoot, which may be a
+// wrapped state root or a bare actors tree of actors version actorsVersion, and
+// returns the messages of violations.
+func CheckInvariants(ctx context.Context, store cbornode.IpldStore, actorsVersion int, stateRoot cid.Cid, expectedBalance abi.TokenAmount, priorEpoch abi.ChainEpoch) ([]string, error) {
+	check, ok := Registry[actorsVersion]
+	if !ok {
+		return nil, xerrors.Errorf("no invariant checks of actors version %d", actorsVersion)
+	}
+	actorsRoot, _, err := lib.UnwrapStateRoot(ctx, store, stateRoot)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unwrap state root: %w", err)
+	}
+	acc, err := check(ctx, store, actorsRoot, expectedBalance, priorEpoch)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to check state invariants %w", err)
+	}
+	return acc.Messages(), nil
+}
+
+/*
+	Versioned validation functions
+*/
+
+// validateV8 checks bundle state by mapping the bundle's code CIDs, read from the
+// manifest the system actor references, to the code CIDs specs-actors checks against.
+// The remapped tree is written to an overlay, as store may be the write buffer of
+// a migration being flushed concurrently.
+func validateV8(ctx context.Context, store cbornode.IpldStore, actorsRoot cid.Cid, expectedBalance abi.TokenAmount, priorEpoch abi.ChainEpoch) (MessageAccumulator, error) {
+	manifest, err := lib.ManifestFromState(ctx, store, 8, actorsRoot)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load manifest: %w", err)
+	}
+	remap := manifest.CanonicalCodes()
+	overlay := lib.NewOverlayStore(store)
+	canonicalRoot, _, err := lib.RewriteActorsTree(ctx, overlay, 8, actorsRoot, func(_ address.Address, a *lib.Actor) bool {
+		if code, ok := remap[a.Code]; ok {
+			a.Code = code
+		}
+		return true
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to map bundle code CIDs: %w", err)
+	}
+	tree, err := states8.LoadTree(adt8.WrapStore(ctx, overlay), canonicalRoot)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load tree: %w", err)
+	}
+	return states8.CheckStateInvariants(tree, expectedBalance, priorEpoch)
+}
+
+func validateV7(ctx context.Context, store cbornode.IpldStore, actorsRoot cid.Cid, expectedBalance abi.TokenAmount, priorEpoch abi.ChainEpoch) (MessageAccumulator, error) {
+	tree, err := states7.LoadTree(adt7.WrapStore(ctx, store), actorsRoot)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load tree: %w", err)
+	}
+	return states7.CheckStateInvariants(tree, expectedBalance, priorEpoch)
+}
+
+func validateV6(ctx context.Context, store cbornode.IpldStore, actorsRoot cid.Cid, expectedBalance abi.TokenAmount, priorEpoch abi.ChainEpoch) (MessageAccumulator, error) {
+	tree, err := states6.LoadTree(adt6.WrapStore(ctx, store), actorsRoot)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load tree: %w", err)
+	}
+	return states6.CheckStateInvariants(tree, expectedBalance, priorEpoch)
+}
+
+func validateV5(ctx context.Context, store cbornode.IpldStore, actorsRoot cid.Cid, expectedBalance abi.TokenAmount, priorEpoch abi.ChainEpoch) (MessageAccumulator, error) {
+	tree, err := states5.LoadTree(adt5.WrapStore(ctx, store), actorsRoot)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load tree: %w", err)
+	}
+	return states5.CheckStateInvariants(tree, expectedBalance, priorEpoch)
+}
+
+func validateV4(ctx context.Context, store cbornode.IpldStore, actorsRoot cid.Cid, expectedBalance abi.TokenAmount, priorEpoch abi.ChainEpoch) (MessageAccumulator, error) {
+	tree, err := states4.LoadTree(adt4.WrapStore(ctx, store), actorsRoot)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load tree: %w", err)
+	}
+	return states4.CheckStateInvariants(tree, expectedBalance, priorEpoch)
+}
+
+func validateV3(ctx context.Context, store cbornode.IpldStore, actorsRoot cid.Cid, expectedBalance abi.TokenAmount, priorEpoch abi.ChainEpoch) (MessageAccumulator, error) {
+	tree, err := states3.LoadTree(adt3.WrapStore(ctx, store), actorsRoot)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load tree: %w", err)
+	}
+	return states3.CheckStateInvariants(tree, expectedBalance, priorEpoch)
+}
+
+func validateV2(ctx context.Context, store cbornode.IpldStore, actorsRoot cid.Cid, expectedBalance abi.TokenAmount, priorEpoch abi.ChainEpoch) (MessageAccumulator, error) {
+	tree, err := states2.LoadTree(adt0.WrapStore(ctx, store), actorsRoot)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load tree: %w", err)
+	}
+	return states2.CheckStateInvariants(tree, expectedBalance, priorEpoch)
+}